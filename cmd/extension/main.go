@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"io"
 	"os"
 	"os/signal"
 	"syscall"
@@ -12,6 +14,9 @@ import (
 )
 
 func main() {
+	local := flag.Bool("local", false, "run outside Lambda, shipping log lines read from stdin or LAMBDAWATCH_LOCAL_INPUT")
+	flag.Parse()
+
 	logger.Init()
 
 	// Load configuration
@@ -19,11 +24,7 @@ func main() {
 	if err != nil {
 		logger.Fatalf("Failed to load config: %v", err)
 	}
-
-	// Validate required config
-	if cfg.LokiEndpoint == "" {
-		logger.Fatal("LOKI_URL environment variable is required")
-	}
+	cfg.Local = cfg.Local || *local
 
 	// Setup context with signal handling
 	ctx, cancel := context.WithCancel(context.Background())
@@ -40,7 +41,26 @@ func main() {
 
 	// Create and run the extension
 	mgr := extension.NewManager(cfg)
+	if cfg.Local {
+		if err := mgr.RunLocal(ctx, openLocalInput(cfg.LocalInput)); err != nil {
+			logger.Fatalf("Local mode error: %v", err)
+		}
+		return
+	}
 	if err := mgr.Run(ctx); err != nil {
 		logger.Fatalf("Extension error: %v", err)
 	}
 }
+
+// openLocalInput opens the file or named pipe local mode reads from,
+// defaulting to stdin
+func openLocalInput(path string) io.Reader {
+	if path == "" {
+		return os.Stdin
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		logger.Fatalf("Failed to open local input: %v", err)
+	}
+	return f
+}
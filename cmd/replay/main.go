@@ -0,0 +1,196 @@
+// Command replay pushes batches the extension could not deliver to Loki:
+// files spooled under LOKI_SPOOL_DIR and objects dead-lettered to S3 by
+// LOKI_DEAD_LETTER_BUCKET. Loki is configured by the same environment
+// variables as the extension (LOKI_URL, credentials, LOKI_TENANT_ID, ...)
+// and pushed with the same client.
+//
+//	replay [-rewrite-older-than 168h] [-region eu-west-1] SOURCE...
+//
+// SOURCE is a spool file, a directory of them, or s3://bucket/prefix.
+// Batches are replayed oldest first; one that fails is reported and the
+// rest are still attempted. The exit status is 1 if any batch failed.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+	"github.com/mumzworld-tech/lambdawatch/internal/deadletter"
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+)
+
+// batchExt names the files the spool and the dead-letter writer create
+const batchExt = ".json.gz"
+
+func main() {
+	rewriteOlderThan := flag.Duration("rewrite-older-than", 0, "restamp entries older than this with the replay time, so Loki's reject_old_samples_max_age does not refuse them (0 = keep timestamps)")
+	region := flag.String("region", os.Getenv("AWS_REGION"), "region of the dead-letter bucket")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] SOURCE...\n\nSOURCE is a spool file, a directory of them, or s3://bucket/prefix.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	logger.Init()
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.LokiEndpoint == "" && !cfg.DryRun {
+		logger.Fatalf("LOKI_URL is not set")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	r := &replayer{
+		client:           loki.NewClient(cfg),
+		region:           *region,
+		rewriteOlderThan: *rewriteOlderThan,
+	}
+	for _, source := range flag.Args() {
+		if err := r.replaySource(ctx, source); err != nil {
+			logger.Errorf("%s: %v", source, err)
+			r.failed++
+		}
+	}
+
+	logger.Infof("Replayed %d batches (%d entries, %d restamped); %d failed", r.replayed, r.entries, r.restamped, r.failed)
+	if r.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// replayer pushes batches and counts the outcomes
+type replayer struct {
+	client           *loki.Client
+	region           string
+	rewriteOlderThan time.Duration
+
+	replayed, failed, entries, restamped int
+}
+
+// replaySource replays every batch in source, returning an error only if
+// the batches could not be listed
+func (r *replayer) replaySource(ctx context.Context, source string) error {
+	if location, ok := strings.CutPrefix(source, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(location, "/")
+		return r.replayS3(ctx, bucket, prefix)
+	}
+
+	paths, err := batchFiles(source)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		req, err := readFile(path)
+		if err != nil {
+			logger.Errorf("%s: %v", path, err)
+			r.failed++
+			continue
+		}
+		r.push(ctx, path, req)
+	}
+	return nil
+}
+
+func (r *replayer) replayS3(ctx context.Context, bucket, prefix string) error {
+	if r.region == "" {
+		return fmt.Errorf("the bucket's region is unknown; set -region or AWS_REGION")
+	}
+	reader := deadletter.NewS3Reader(bucket, r.region)
+	keys, err := reader.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		req, err := reader.Read(ctx, key)
+		if err != nil {
+			logger.Errorf("%v", err)
+			r.failed++
+			continue
+		}
+		r.push(ctx, "s3://"+bucket+"/"+key, req)
+	}
+	return nil
+}
+
+// push sends one batch, restamping old entries first if asked to
+func (r *replayer) push(ctx context.Context, name string, req *loki.PushRequest) {
+	if r.rewriteOlderThan > 0 {
+		now := time.Now()
+		r.restamped += rewriteTimestamps(req, now.Add(-r.rewriteOlderThan), now)
+	}
+	if err := r.client.Push(ctx, req); err != nil {
+		logger.Errorf("%s: %v", name, err)
+		r.failed++
+		return
+	}
+	n := entryCount(req)
+	logger.Infof("Replayed %s (%d entries)", name, n)
+	r.replayed++
+	r.entries += n
+}
+
+// batchFiles returns path if it is a file, or the batch files in it, oldest
+// first, if it is a directory
+func batchFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), batchExt) {
+			paths = append(paths, filepath.Join(path, e.Name()))
+		}
+	}
+	// Names start with the write time, so they sort by it
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func readFile(path string) (*loki.PushRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return deadletter.ReadBatch(f)
+}
+
+func entryCount(req *loki.PushRequest) int {
+	n := 0
+	for _, s := range req.Streams {
+		n += len(s.Values)
+	}
+	return n
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+)
+
+// originalTimestampKey is the structured metadata holding the timestamp a
+// restamped entry was logged at
+const originalTimestampKey = "original_timestamp"
+
+// rewriteTimestamps gives every entry of req logged before cutoff a
+// timestamp of now, plus one nanosecond per restamped entry so they keep
+// their order, and records the original time in structured metadata. It
+// returns the number of entries restamped.
+func rewriteTimestamps(req *loki.PushRequest, cutoff, now time.Time) int {
+	restamped := 0
+	for i := range req.Streams {
+		stream := &req.Streams[i]
+		for j, value := range stream.Values {
+			ts, err := strconv.ParseInt(value[0], 10, 64)
+			if err != nil || ts >= cutoff.UnixNano() {
+				continue
+			}
+
+			if stream.Metadata == nil {
+				stream.Metadata = make([]map[string]string, len(stream.Values))
+			}
+			md := make(map[string]string, len(stream.Metadata[j])+1)
+			for k, v := range stream.Metadata[j] {
+				md[k] = v
+			}
+			md[originalTimestampKey] = time.Unix(0, ts).UTC().Format(time.RFC3339Nano)
+			stream.Metadata[j] = md
+
+			value[0] = strconv.FormatInt(now.UnixNano()+int64(restamped), 10)
+			restamped++
+		}
+	}
+	return restamped
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+)
+
+func TestRewriteTimestamps(t *testing.T) {
+	now := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	old := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := now.Add(-time.Hour)
+
+	req := loki.NewPushRequest(map[string]string{"source": "lambda"}, [][]string{
+		{itoa(old.UnixNano()), "first"},
+		{itoa(old.UnixNano() + 1), "second"},
+		{itoa(recent.UnixNano()), "recent"},
+	})
+	if n := rewriteTimestamps(req, now.Add(-7*24*time.Hour), now); n != 2 {
+		t.Fatalf("restamped %d entries, want 2", n)
+	}
+
+	s := req.Streams[0]
+	if s.Values[0][0] != itoa(now.UnixNano()) || s.Values[1][0] != itoa(now.UnixNano()+1) {
+		t.Errorf("restamped timestamps = %s, %s; want now and now+1ns", s.Values[0][0], s.Values[1][0])
+	}
+	if s.Values[2][0] != itoa(recent.UnixNano()) {
+		t.Errorf("recent entry restamped to %s", s.Values[2][0])
+	}
+	if got := s.Metadata[0][originalTimestampKey]; got != "2026-01-01T00:00:00Z" {
+		t.Errorf("original_timestamp = %q", got)
+	}
+	if len(s.Metadata[2]) != 0 {
+		t.Errorf("recent entry metadata = %v, want none", s.Metadata[2])
+	}
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
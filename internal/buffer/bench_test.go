@@ -0,0 +1,100 @@
+package buffer
+
+import (
+	"strings"
+	"testing"
+)
+
+// benchEntry is a typical JSON function log line
+var benchEntry = LogEntry{
+	Timestamp: 1700000000000,
+	Message:   `{"level":"info","message":"order processed","order_id":"ord-12345","duration_ms":42}`,
+	Type:      "function",
+	RequestID: "8f5c0a2e-1b7d-4c3e-9a6f-2d8e4b1c7a90",
+}
+
+func BenchmarkBuffer_Add(b *testing.B) {
+	buf := New(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Add(benchEntry)
+	}
+}
+
+func BenchmarkBuffer_AddBatch(b *testing.B) {
+	buf := New(10000)
+	batch := make([]LogEntry, 100)
+	for i := range batch {
+		batch[i] = benchEntry
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.AddBatch(batch)
+	}
+}
+
+func BenchmarkBuffer_Flush(b *testing.B) {
+	buf := New(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 100; j++ {
+			buf.Add(benchEntry)
+		}
+		buf.Flush(100)
+	}
+}
+
+func BenchmarkBuffer_FlushBySize(b *testing.B) {
+	buf := New(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 100; j++ {
+			buf.Add(benchEntry)
+		}
+		for buf.Len() > 0 {
+			buf.FlushBySize(100, 8*1024)
+		}
+	}
+}
+
+func BenchmarkLogEntry_Size(b *testing.B) {
+	entry := benchEntry
+	entry.Message = strings.Repeat(`{"html":"<b>&</b>"} `, 50)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = entry.Size()
+	}
+}
+
+// Allocation budgets for the hot path: entries are copied into the ring,
+// so adding must not allocate, and a flush allocates only its result
+func TestBuffer_AllocBudget(t *testing.T) {
+	buf := New(1000)
+	if allocs := testing.AllocsPerRun(100, func() { buf.Add(benchEntry) }); allocs > 0 {
+		t.Errorf("Add allocs = %v, want 0", allocs)
+	}
+
+	// Two byte-limited batches of 50 entries each
+	buf = New(1000)
+	limit := 50 * benchEntry.Size()
+	if allocs := testing.AllocsPerRun(100, func() {
+		for i := 0; i < 100; i++ {
+			buf.Add(benchEntry)
+		}
+		for buf.Len() > 0 {
+			buf.FlushBySize(100, limit)
+		}
+	}); allocs > 2 {
+		t.Errorf("FlushBySize allocs = %v, want <= 2 (one per batch)", allocs)
+	}
+
+	entry := benchEntry
+	if allocs := testing.AllocsPerRun(100, func() { _ = entry.Size() }); allocs > 0 {
+		t.Errorf("Size allocs = %v, want 0", allocs)
+	}
+}
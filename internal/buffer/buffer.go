@@ -2,42 +2,281 @@ package buffer
 
 import (
 	"sync"
+	"time"
 )
 
+// OverflowPolicy decides what happens when an entry is added to a full buffer
+type OverflowPolicy string
+
+const (
+	// DropOldest evicts the oldest entry to make room (default)
+	DropOldest OverflowPolicy = "drop-oldest"
+	// DropNewest discards the incoming entry
+	DropNewest OverflowPolicy = "drop-newest"
+	// BlockWithTimeout makes AddBatch wait for a flush to free space, then
+	// discards the incoming entry if the timeout expires first
+	BlockWithTimeout OverflowPolicy = "block-with-timeout"
+)
+
+// ParseOverflowPolicy returns the policy named by s, or DropOldest if unknown
+func ParseOverflowPolicy(s string) OverflowPolicy {
+	switch p := OverflowPolicy(s); p {
+	case DropNewest, BlockWithTimeout:
+		return p
+	default:
+		return DropOldest
+	}
+}
+
 // LogEntry represents a single log entry
 type LogEntry struct {
 	Timestamp int64
 	Message   string
 	Type      string
 	RequestID string // AWS Lambda request ID for grouping
+	Priority  Priority
+	Internal  bool // Written by the extension's own logger, stamped at write time
+
+	// Attributes describe the entry without being part of its line, such as
+	// its level or trace ID (see the Attr constants). Pipeline stages set
+	// them and sinks decide how to ship them; Loki gets them as structured
+	// metadata. Set them with SetAttribute, which never modifies a map
+	// another copy of the entry may share.
+	Attributes map[string]string
+
+	// Chunk places the entry within a line split for exceeding
+	// MAX_LINE_SIZE; zero for lines that were not split
+	Chunk Chunk
+
+	// StreamLabels are extra Loki labels for this entry. Entries with the
+	// same extra labels are shipped together in their own stream.
+	StreamLabels map[string]string
+
+	// enqueued is when the entry first entered a buffer (UnixMilli); kept
+	// if the entry is added again so its age is not reset
+	enqueued int64
+
+	// attempts counts the pushes of the entry that failed, each ending in Nack
+	attempts int
+
+	// retried is set on entries Nack or Release hands back, so they are
+	// known to have been leased before
+	retried bool
+}
+
+// Well-known attribute keys
+const (
+	AttrLevel     = "level"      // lowercase log level of a function log line
+	AttrTraceID   = "trace_id"   // X-Ray or W3C trace ID for log/trace correlation
+	AttrSpanID    = "span_id"    // span a function log line was written in, with its trace_id
+	AttrColdStart = "cold_start" // "true" for entries of the sandbox's first invocation
+	AttrOutcome   = "outcome"    // runtimeDone status of an invocation that did not succeed
+)
+
+// Retried reports whether the entry was handed back by Nack or Release, so
+// it was already taken for an earlier push
+func (e *LogEntry) Retried() bool {
+	return e.retried
+}
+
+// Attribute returns the attribute stored under key, or ""
+func (e *LogEntry) Attribute(key string) string {
+	return e.Attributes[key]
 }
 
-// Size returns the approximate byte size of the entry
+// SetAttribute stores value under key, or removes key if value is empty.
+// The entry gets a new map, so copies of the entry are not affected.
+func (e *LogEntry) SetAttribute(key, value string) {
+	if e.Attributes[key] == value {
+		return
+	}
+	attrs := make(map[string]string, len(e.Attributes)+1)
+	for k, v := range e.Attributes {
+		attrs[k] = v
+	}
+	if value == "" {
+		delete(attrs, key)
+	} else {
+		attrs[key] = value
+	}
+	if len(attrs) == 0 {
+		attrs = nil
+	}
+	e.Attributes = attrs
+}
+
+// Chunk identifies one piece of a split line, so a consumer can rejoin the
+// pieces by ID in Index order
+type Chunk struct {
+	ID    string // shared by every chunk of the line
+	Index int    // 1-based position within the line
+	Total int    // number of chunks the line was split into
+}
+
+// Priority ranks entries when the buffer has to choose what to ship first
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh            // errors, faults — shipped first under pressure
+)
+
+// pressureRatio is the fill level at which Flush and FlushBySize start
+// preferring high-priority entries
+const pressureRatio = 0.9
+
+// Bytes an entry adds to a Loki push body beyond its escaped strings
+const (
+	valueOverhead     = 27 // ["<19-digit ns timestamp>","<line>"], with separator
+	requestIDOverhead = 20 // \"request_id\":\"<id>\", injected into a JSON line
+	metadataOverhead  = 3  // ,{…} around the structured metadata
+	pairOverhead      = 6  // "<name>":"<value>", one structured metadata pair
+	chunkOverhead     = 48 // "chunk_id":"…","chunk_index":"…","chunk_total":"…", structured metadata
+	labelOverhead     = 6  // "<name>":"<value>", in its own stream's labels
+)
+
+// Size returns the entry's size once serialized into a Loki push body: the
+// JSON-escaped line, the nanosecond timestamp string and tuple punctuation,
+// the injected request ID, structured metadata and any extra stream labels.
+// The stream envelope shared by a batch is not included.
 func (e *LogEntry) Size() int {
-	return len(e.Message) + len(e.Type) + len(e.RequestID) + 8 // 8 bytes for timestamp
+	size := valueOverhead + jsonLen(e.Message)
+	if e.RequestID != "" {
+		size += requestIDOverhead + jsonLen(e.RequestID)
+	}
+	metadata := 0
+	for k, v := range e.Attributes {
+		metadata += pairOverhead + jsonLen(k) + jsonLen(v)
+	}
+	if e.Chunk.Total > 0 {
+		metadata += chunkOverhead + jsonLen(e.Chunk.ID) + digits(e.Chunk.Index) + digits(e.Chunk.Total)
+	}
+	if metadata > 0 {
+		size += metadataOverhead + metadata - 1 // the last pair has no separator
+	}
+	for k, v := range e.StreamLabels {
+		size += labelOverhead + jsonLen(k) + jsonLen(v)
+	}
+	return size
+}
+
+// jsonLen returns the length of s as a JSON string body, escaped the way
+// encoding/json escapes it (including HTML-sensitive characters)
+func jsonLen(s string) int {
+	n := len(s)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\' || c == '\n' || c == '\r' || c == '\t':
+			n++
+		case c < 0x20 || c == '<' || c == '>' || c == '&':
+			n += 5
+		case c == 0xe2 && i+2 < len(s) && s[i+1] == 0x80 && (s[i+2] == 0xa8 || s[i+2] == 0xa9):
+			n += 3 // U+2028/U+2029 become \u2028/\u2029
+		}
+	}
+	return n
 }
 
-// Buffer is a thread-safe bounded buffer for log entries
+// digits returns the length of n's decimal form, for n >= 0
+func digits(n int) int {
+	d := 1
+	for n >= 10 {
+		n /= 10
+		d++
+	}
+	return d
+}
+
+// Buffer is a thread-safe bounded buffer for log entries.
+// Entries are stored in a fixed-size ring so the backing array is allocated
+// once and reused; adding and flushing only move the head index and count.
 type Buffer struct {
 	mu       sync.Mutex
-	entries  []LogEntry
+	entries  []LogEntry // ring storage, len == maxSize
+	head     int        // index of the oldest entry
+	count    int        // number of entries currently stored
 	maxSize  int
+	maxBytes int // cap on byteSize (0 = entry count only)
 	byteSize int // Current total byte size
 	ready    chan struct{}
 	closed   bool
+
+	// Overflow handling
+	policy       OverflowPolicy
+	blockTimeout time.Duration
+	dropped      uint64        // entries discarded due to overflow
+	spaceFreed   chan struct{} // closed and replaced whenever entries are removed
+	waiters      int           // AddBatch calls blocked on spaceFreed
+
+	// Entries taken by Take and not yet settled. Their bytes still count
+	// against maxBytes, so Nack has room to hand them back.
+	leased        int
+	leasedBytes   int
+	maxAttempts   int    // Nacks after which an entry is discarded (0 = no limit)
+	undeliverable uint64 // entries discarded after maxAttempts
+
+	// Age-based expiry
+	maxAge  time.Duration // 0 keeps entries until flushed or overflowed
+	expired uint64        // entries discarded for exceeding maxAge
+	now     func() time.Time
 }
 
-// New creates a new buffer with the specified max size
+// New creates a new buffer with the specified max size that drops the
+// oldest entry on overflow
 func New(maxSize int) *Buffer {
+	return NewWithPolicy(maxSize, DropOldest, 0)
+}
+
+// NewWithPolicy creates a new buffer with the given overflow policy.
+// blockTimeout is only used by BlockWithTimeout.
+func NewWithPolicy(maxSize int, policy OverflowPolicy, blockTimeout time.Duration) *Buffer {
+	if maxSize < 1 {
+		maxSize = 1
+	}
 	return &Buffer{
-		entries: make([]LogEntry, 0, maxSize),
-		maxSize: maxSize,
-		ready:   make(chan struct{}, 1),
+		entries:      make([]LogEntry, maxSize),
+		maxSize:      maxSize,
+		ready:        make(chan struct{}, 1),
+		policy:       policy,
+		blockTimeout: blockTimeout,
+		spaceFreed:   make(chan struct{}),
+		now:          time.Now,
 	}
 }
 
+// SetMaxAge makes the buffer discard entries that have waited longer than
+// maxAge, so when Loki stays unreachable stale entries are expired before
+// newer ones are lost to overflow. Zero disables expiry.
+func (b *Buffer) SetMaxAge(maxAge time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.maxAge = maxAge
+}
+
+// SetMaxBytes caps the total size of buffered entries, so a buffer of
+// large lines is bounded by memory and not only by entry count. A full
+// buffer is then handled by the overflow policy as for the count limit. A
+// single entry larger than the cap is still accepted into an empty buffer.
+// Zero disables the cap.
+func (b *Buffer) SetMaxBytes(maxBytes int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.maxBytes = maxBytes
+}
+
+// SetMaxAttempts makes Nack discard entries whose push has failed
+// maxAttempts times, so a batch that can never be delivered is not retried
+// forever. Zero disables the limit.
+func (b *Buffer) SetMaxAttempts(maxAttempts int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.maxAttempts = maxAttempts
+}
+
 // Add adds a log entry to the buffer
-// Returns true if the buffer is at capacity
+// Returns true if the buffer is at capacity.
+// Add never blocks: under BlockWithTimeout a full buffer drops the new entry,
+// since the extension's own logger calls Add from the flush path.
 func (b *Buffer) Add(entry LogEntry) bool {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -46,15 +285,13 @@ func (b *Buffer) Add(entry LogEntry) bool {
 		return false
 	}
 
-	// If at capacity, drop oldest entry
-	if len(b.entries) >= b.maxSize {
-		b.byteSize -= b.entries[0].Size()
-		b.entries = b.entries[1:]
+	b.expire()
+	if b.policy != DropOldest && b.full(entry.Size()) {
+		b.dropped++
+		return true
 	}
-
-	b.entries = append(b.entries, entry)
-	b.byteSize += entry.Size()
-	return len(b.entries) >= b.maxSize
+	b.push(entry)
+	return b.atCapacity()
 }
 
 // AddBatch adds multiple log entries to the buffer
@@ -66,13 +303,13 @@ func (b *Buffer) AddBatch(entries []LogEntry) {
 		return
 	}
 
+	b.expire()
 	for _, entry := range entries {
-		if len(b.entries) >= b.maxSize {
-			b.byteSize -= b.entries[0].Size()
-			b.entries = b.entries[1:]
+		if b.full(entry.Size()) && !b.makeRoom(entry.Size()) {
+			b.dropped++
+			continue
 		}
-		b.entries = append(b.entries, entry)
-		b.byteSize += entry.Size()
+		b.push(entry)
 	}
 
 	// Signal that batch is ready
@@ -82,65 +319,381 @@ func (b *Buffer) AddBatch(entries []LogEntry) {
 	}
 }
 
-// Flush returns and clears up to batchSize entries from the buffer
-func (b *Buffer) Flush(batchSize int) []LogEntry {
+// makeRoom applies the overflow policy to a full buffer and reports whether
+// an incoming entry of size bytes can now be stored. Caller must hold the
+// lock; it is released while blocking.
+func (b *Buffer) makeRoom(size int) bool {
+	switch b.policy {
+	case DropNewest:
+		return false
+	case BlockWithTimeout:
+		timer := time.NewTimer(b.blockTimeout)
+		defer timer.Stop()
+		for b.full(size) && !b.closed {
+			freed := b.spaceFreed
+			b.waiters++
+			b.mu.Unlock()
+			select {
+			case <-freed:
+				b.mu.Lock()
+				b.waiters--
+			case <-timer.C:
+				b.mu.Lock()
+				b.waiters--
+				return false
+			}
+		}
+		return !b.closed
+	default:
+		// DropOldest: push evicts from the head
+		return true
+	}
+}
+
+// full reports whether storing an entry of size bytes would exceed the
+// entry count or byte cap, counting leased bytes against the cap. Caller
+// must hold the lock.
+func (b *Buffer) full(size int) bool {
+	if b.count >= b.maxSize {
+		return true
+	}
+	return b.maxBytes > 0 && b.count > 0 && b.byteSize+b.leasedBytes+size > b.maxBytes
+}
+
+// atCapacity reports whether either limit has been reached. Caller must
+// hold the lock.
+func (b *Buffer) atCapacity() bool {
+	return b.count >= b.maxSize || (b.maxBytes > 0 && b.byteSize >= b.maxBytes)
+}
+
+// Update applies fn to every buffered entry, keeping the byte size in step
+// with any change fn makes. It lets metadata learned after entries were
+// buffered, such as an invocation's outcome, reach entries not yet flushed.
+func (b *Buffer) Update(fn func(*LogEntry)) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	for i := 0; i < b.count; i++ {
+		e := b.at(i)
+		before := e.Size()
+		fn(e)
+		b.byteSize += e.Size() - before
+	}
+}
 
-	if len(b.entries) == 0 {
-		return nil
+// push appends an entry at the tail, dropping the oldest until it fits.
+// Caller must hold the lock.
+func (b *Buffer) push(entry LogEntry) {
+	size := entry.Size()
+	for b.full(size) {
+		b.popFront(1)
+		b.dropped++
+	}
+	if entry.enqueued == 0 {
+		entry.enqueued = b.now().UnixMilli()
 	}
+	b.entries[(b.head+b.count)%b.maxSize] = entry
+	b.count++
+	b.byteSize += size
+}
 
-	count := batchSize
-	if count > len(b.entries) {
-		count = len(b.entries)
+// expire discards entries older than maxAge from the front of the buffer.
+// Entries are kept in arrival order, so the expired ones are all at the
+// front. Caller must hold the lock.
+func (b *Buffer) expire() {
+	if b.maxAge <= 0 || b.count == 0 {
+		return
+	}
+	cutoff := b.now().Add(-b.maxAge).UnixMilli()
+	n := 0
+	for n < b.count && b.at(n).enqueued < cutoff {
+		n++
+	}
+	if n > 0 {
+		b.popFront(n)
+		b.expired += uint64(n)
 	}
+}
 
-	batch := make([]LogEntry, count)
-	copy(batch, b.entries[:count])
+// at returns the i-th oldest entry. Caller must hold the lock.
+func (b *Buffer) at(i int) *LogEntry {
+	return &b.entries[(b.head+i)%b.maxSize]
+}
 
-	// Update byte size
-	for i := 0; i < count; i++ {
-		b.byteSize -= b.entries[i].Size()
+// copyFront copies the n oldest entries into a new slice. Caller must hold the lock.
+func (b *Buffer) copyFront(n int) []LogEntry {
+	out := make([]LogEntry, n)
+	first := copy(out, b.entries[b.head:min(b.head+n, b.maxSize)])
+	copy(out[first:], b.entries[:n-first])
+	return out
+}
+
+// popFront removes the n oldest entries, clearing their slots so message
+// strings can be garbage collected. Caller must hold the lock.
+func (b *Buffer) popFront(n int) {
+	for i := 0; i < n; i++ {
+		e := b.at(i)
+		b.byteSize -= e.Size()
+		*e = LogEntry{}
 	}
+	b.head = (b.head + n) % b.maxSize
+	b.count -= n
+	b.wakeWaiters()
+}
 
-	b.entries = b.entries[count:]
+// wakeWaiters releases AddBatch calls blocked on a full buffer.
+// Caller must hold the lock.
+func (b *Buffer) wakeWaiters() {
+	if b.waiters > 0 {
+		close(b.spaceFreed)
+		b.spaceFreed = make(chan struct{})
+	}
+}
 
-	return batch
+// Flush returns and clears up to batchSize entries from the buffer.
+// When the buffer is near capacity, high-priority entries are taken first.
+func (b *Buffer) Flush(batchSize int) []LogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flush(batchSize, 0, b.nearCapacity())
 }
 
-// FlushBySize returns entries up to maxBytes or batchSize, whichever comes first
+// FlushBySize returns entries up to maxBytes or batchSize, whichever comes first.
+// When the buffer is near capacity, high-priority entries are taken first.
 func (b *Buffer) FlushBySize(batchSize int, maxBytes int) []LogEntry {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	return b.flush(batchSize, maxBytes, b.nearCapacity())
+}
+
+// FlushPriority is like FlushBySize but always takes high-priority entries
+// first, so a critical flush that runs out of time has shipped the entries
+// that matter most. A maxBytes of 0 disables the byte limit.
+func (b *Buffer) FlushPriority(batchSize int, maxBytes int) []LogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flush(batchSize, maxBytes, true)
+}
 
-	if len(b.entries) == 0 {
+// nearCapacity reports whether the buffer is under pressure. Caller must hold the lock.
+func (b *Buffer) nearCapacity() bool {
+	if b.maxBytes > 0 && float64(b.byteSize) >= float64(b.maxBytes)*pressureRatio {
+		return true
+	}
+	return float64(b.count) >= float64(b.maxSize)*pressureRatio
+}
+
+// flush removes up to batchSize entries (and maxBytes, if > 0) from the
+// buffer. The returned batch keeps chronological order. Caller must hold the lock.
+func (b *Buffer) flush(batchSize, maxBytes int, prioritize bool) []LogEntry {
+	b.expire()
+	if b.count == 0 {
 		return nil
 	}
 
+	if !prioritize {
+		count := b.takeFront(batchSize, maxBytes)
+		if count == 0 {
+			return nil
+		}
+		batch := b.copyFront(count)
+		b.popFront(count)
+		return batch
+	}
+
+	// Select high-priority entries first, then fill with the rest
+	selected := make([]bool, b.count)
+	count, bytes := 0, 0
+	for _, lane := range []bool{true, false} {
+		for i := 0; i < b.count && count < batchSize; i++ {
+			e := b.at(i)
+			if selected[i] || (e.Priority >= PriorityHigh) != lane {
+				continue
+			}
+			size := e.Size()
+			if maxBytes > 0 && bytes+size > maxBytes && count > 0 {
+				break
+			}
+			selected[i] = true
+			bytes += size
+			count++
+		}
+	}
+
+	if count == 0 {
+		return nil
+	}
+
+	// Extract selected entries and compact the rest in place, preserving order
+	batch := make([]LogEntry, 0, count)
+	kept := 0
+	for i := 0; i < b.count; i++ {
+		e := *b.at(i)
+		if selected[i] {
+			batch = append(batch, e)
+			continue
+		}
+		*b.at(kept) = e
+		kept++
+	}
+	for i := kept; i < b.count; i++ {
+		*b.at(i) = LogEntry{}
+	}
+	b.count = kept
+	b.byteSize -= bytes
+	b.wakeWaiters()
+
+	return batch
+}
+
+// takeFront returns how many of the oldest entries fit within batchSize and
+// maxBytes (if > 0). At least one entry is always taken. Caller must hold the lock.
+func (b *Buffer) takeFront(batchSize, maxBytes int) int {
 	count := 0
 	bytes := 0
-	for i := 0; i < len(b.entries) && count < batchSize; i++ {
-		entrySize := b.entries[i].Size()
-		if bytes+entrySize > maxBytes && count > 0 {
+	for i := 0; i < b.count && count < batchSize; i++ {
+		entrySize := b.at(i).Size()
+		if maxBytes > 0 && bytes+entrySize > maxBytes && count > 0 {
 			break
 		}
 		bytes += entrySize
 		count++
 	}
+	return count
+}
 
-	if count == 0 {
+// Lease is a batch taken from the buffer by Take. The buffer no longer
+// holds its entries, but the batch is not settled until Ack reports it
+// delivered or Nack hands the entries back. Entries may be removed from a
+// lease before it is settled, to be discarded.
+type Lease struct {
+	Entries    []LogEntry
+	taken      int // entries leased, however many remain in Entries
+	takenBytes int
+	settled    bool
+}
+
+// Take removes a batch like FlushBySize and leases it until Ack or Nack, so
+// a batch whose push fails is not lost. Returns nil when the buffer is
+// empty.
+func (b *Buffer) Take(batchSize int, maxBytes int) *Lease {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lease(b.flush(batchSize, maxBytes, b.nearCapacity()))
+}
+
+// TakePriority is Take taking high-priority entries first, as FlushPriority does
+func (b *Buffer) TakePriority(batchSize int, maxBytes int) *Lease {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lease(b.flush(batchSize, maxBytes, true))
+}
+
+// lease wraps a batch taken from the buffer. Caller must hold the lock.
+func (b *Buffer) lease(entries []LogEntry) *Lease {
+	if len(entries) == 0 {
 		return nil
 	}
+	size := 0
+	for i := range entries {
+		size += entries[i].Size()
+	}
+	b.leased += len(entries)
+	b.leasedBytes += size
+	return &Lease{Entries: entries, taken: len(entries), takenBytes: size}
+}
 
-	batch := make([]LogEntry, count)
-	copy(batch, b.entries[:count])
+// Ack settles a lease whose entries were delivered
+func (b *Buffer) Ack(l *Lease) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.settle(l)
+}
 
-	// Update byte size
-	b.byteSize -= bytes
-	b.entries = b.entries[count:]
+// Nack returns a lease's entries to the front of the buffer, ahead of
+// entries added since, to be taken again by the next flush. They keep the
+// time they were first buffered, so the maximum age is not reset. Entries
+// nacked as many times as SetMaxAttempts allows are discarded instead and
+// counted as undeliverable, and returned so the caller can keep or report
+// them. When the rest no longer all fit, the oldest are dropped; a closed
+// buffer drops them all.
+func (b *Buffer) Nack(l *Lease) []LogEntry {
+	return b.handBack(l, true)
+}
 
-	return batch
+// Release returns a lease's entries to the front of the buffer like Nack,
+// but for a push that was cancelled rather than failed, so no delivery
+// attempt is counted
+func (b *Buffer) Release(l *Lease) {
+	b.handBack(l, false)
+}
+
+// handBack implements Nack and Release, counting an attempt when failed
+func (b *Buffer) handBack(l *Lease, failed bool) []LogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.settle(l) {
+		return nil
+	}
+
+	var undeliverable []LogEntry
+	entries := make([]LogEntry, 0, len(l.Entries))
+	for _, entry := range l.Entries {
+		entry.retried = true
+		if failed {
+			entry.attempts++
+		}
+		if b.maxAttempts > 0 && entry.attempts >= b.maxAttempts {
+			b.undeliverable++
+			undeliverable = append(undeliverable, entry)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return undeliverable
+	}
+	if b.closed {
+		b.dropped += uint64(len(entries))
+		return undeliverable
+	}
+	// Walk back from the newest, so the oldest are the ones left out
+	for i := len(entries) - 1; i >= 0; i-- {
+		size := entries[i].Size()
+		if b.full(size) {
+			b.dropped += uint64(i + 1)
+			break
+		}
+		b.head = (b.head - 1 + b.maxSize) % b.maxSize
+		b.entries[b.head] = entries[i]
+		b.count++
+		b.byteSize += size
+	}
+
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+	return undeliverable
+}
+
+// settle marks a lease settled, reporting false if it already was.
+// Caller must hold the lock.
+func (b *Buffer) settle(l *Lease) bool {
+	if l == nil || l.settled {
+		return false
+	}
+	l.settled = true
+	b.leased -= l.taken
+	b.leasedBytes -= l.takenBytes
+	b.wakeWaiters()
+	return true
+}
+
+// Leased returns the number of entries taken by Take and not yet settled
+func (b *Buffer) Leased() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.leased
 }
 
 // Drain returns all remaining entries and closes the buffer
@@ -149,9 +702,14 @@ func (b *Buffer) Drain() []LogEntry {
 	defer b.mu.Unlock()
 
 	b.closed = true
-	entries := b.entries
-	b.entries = nil
-	b.byteSize = 0
+	b.wakeWaiters()
+	b.expire()
+	if b.count == 0 {
+		return nil
+	}
+
+	entries := b.copyFront(b.count)
+	b.popFront(b.count)
 
 	return entries
 }
@@ -160,7 +718,41 @@ func (b *Buffer) Drain() []LogEntry {
 func (b *Buffer) Len() int {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	return len(b.entries)
+	return b.count
+}
+
+// Dropped returns the total number of entries discarded due to overflow
+func (b *Buffer) Dropped() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped
+}
+
+// Expired returns the total number of entries discarded for exceeding the
+// maximum age
+func (b *Buffer) Expired() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.expired
+}
+
+// Undeliverable returns the total number of entries discarded by Nack
+// after the maximum number of delivery attempts
+func (b *Buffer) Undeliverable() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.undeliverable
+}
+
+// OldestAge returns how long the oldest buffered entry has waited, or 0
+// when the buffer is empty
+func (b *Buffer) OldestAge() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.count == 0 {
+		return 0
+	}
+	return b.now().Sub(time.UnixMilli(b.at(0).enqueued))
 }
 
 // ByteSize returns the current total byte size of entries in the buffer
@@ -1,6 +1,7 @@
 package buffer
 
 import (
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -205,6 +206,144 @@ func TestBuffer_FlushPreservesOrder(t *testing.T) {
 	}
 }
 
+func TestBuffer_TakeAck(t *testing.T) {
+	buf := New(100)
+	for i := 0; i < 5; i++ {
+		buf.Add(LogEntry{Message: "msg"})
+	}
+
+	lease := buf.Take(3, 0)
+	if lease == nil || len(lease.Entries) != 3 {
+		t.Fatalf("Take(3) = %v, want 3 entries", lease)
+	}
+	if buf.Len() != 2 || buf.Leased() != 3 {
+		t.Errorf("Len() = %d, Leased() = %d; want 2 and 3", buf.Len(), buf.Leased())
+	}
+
+	buf.Ack(lease)
+	buf.Nack(lease) // settled leases are ignored
+	if buf.Len() != 2 || buf.Leased() != 0 {
+		t.Errorf("after Ack: Len() = %d, Leased() = %d; want 2 and 0", buf.Len(), buf.Leased())
+	}
+	if buf.Take(10, 0) == nil || buf.Take(10, 0) != nil {
+		t.Error("Take on an emptied buffer should return nil")
+	}
+}
+
+func TestBuffer_NackRestoresOrder(t *testing.T) {
+	buf := New(100)
+	for i := 0; i < 5; i++ {
+		buf.Add(LogEntry{Message: string(rune('A' + i))})
+	}
+
+	lease := buf.Take(3, 0)
+	buf.Add(LogEntry{Message: "F"})
+	buf.Nack(lease)
+
+	entries := buf.Flush(10)
+	got := ""
+	for _, e := range entries {
+		got += e.Message
+	}
+	if got != "ABCDEF" {
+		t.Errorf("order after Nack = %q, want ABCDEF", got)
+	}
+	if buf.Leased() != 0 {
+		t.Errorf("Leased() = %d after Nack, want 0", buf.Leased())
+	}
+}
+
+func TestBuffer_NackDropsOldestWhenFull(t *testing.T) {
+	buf := New(3)
+	for i := 0; i < 3; i++ {
+		buf.Add(LogEntry{Message: string(rune('A' + i))})
+	}
+
+	lease := buf.Take(3, 0)
+	buf.Add(LogEntry{Message: "D"})
+	buf.Add(LogEntry{Message: "E"})
+	buf.Nack(lease)
+
+	entries := buf.Flush(10)
+	if len(entries) != 3 || entries[0].Message != "C" || entries[2].Message != "E" {
+		t.Errorf("entries after Nack = %v, want C D E", entries)
+	}
+	if buf.Dropped() != 2 {
+		t.Errorf("Dropped() = %d, want 2", buf.Dropped())
+	}
+}
+
+func TestBuffer_LeasedBytesCountAgainstMaxBytes(t *testing.T) {
+	buf := New(100)
+	size := (&LogEntry{Message: "A"}).Size()
+	buf.SetMaxBytes(4 * size)
+	buf.Add(LogEntry{Message: "A"})
+	buf.Add(LogEntry{Message: "B"})
+
+	// New entries only get the room the lease leaves, so Nack can hand
+	// the batch back without dropping it as the oldest
+	lease := buf.Take(2, 0)
+	for _, msg := range []string{"C", "D", "E"} {
+		buf.Add(LogEntry{Message: msg})
+	}
+	buf.Nack(lease)
+
+	got := ""
+	for _, e := range buf.Flush(10) {
+		got += e.Message
+	}
+	if got != "ABDE" {
+		t.Errorf("entries after Nack = %q, want ABDE", got)
+	}
+	if buf.Dropped() != 1 {
+		t.Errorf("Dropped() = %d, want 1 (C, to make room while leased)", buf.Dropped())
+	}
+}
+
+func TestBuffer_NackDiscardsAfterMaxAttempts(t *testing.T) {
+	buf := New(10)
+	buf.SetMaxAttempts(2)
+	buf.Add(LogEntry{Message: "A"})
+
+	buf.Nack(buf.Take(10, 0))
+	buf.Add(LogEntry{Message: "B"})
+	lease := buf.Take(10, 0)
+	if len(lease.Entries) != 2 {
+		t.Fatalf("entries after first Nack = %d, want 2", len(lease.Entries))
+	}
+
+	// A fails its second attempt and is discarded; B goes back
+	discarded := buf.Nack(lease)
+	if len(discarded) != 1 || discarded[0].Message != "A" {
+		t.Errorf("Nack discarded %v, want A", discarded)
+	}
+	entries := buf.Flush(10)
+	if len(entries) != 1 || entries[0].Message != "B" {
+		t.Errorf("entries after second Nack = %v, want B", entries)
+	}
+	if buf.Undeliverable() != 1 {
+		t.Errorf("Undeliverable() = %d, want 1", buf.Undeliverable())
+	}
+	if buf.Dropped() != 0 {
+		t.Errorf("Dropped() = %d, want 0", buf.Dropped())
+	}
+}
+
+func TestBuffer_ReleaseCountsNoAttempt(t *testing.T) {
+	buf := New(10)
+	buf.SetMaxAttempts(1)
+	buf.Add(LogEntry{Message: "A"})
+
+	buf.Release(buf.Take(10, 0))
+	lease := buf.Take(10, 0)
+	if len(lease.Entries) != 1 || !lease.Entries[0].Retried() {
+		t.Fatalf("entries after Release = %v, want A marked retried", lease.Entries)
+	}
+	if buf.Undeliverable() != 0 {
+		t.Errorf("Undeliverable() = %d, want 0", buf.Undeliverable())
+	}
+}
+
 // TC-2.4.1: FlushBySize Within Limits
 func TestBuffer_FlushBySizeWithinLimits(t *testing.T) {
 	buf := New(100)
@@ -240,12 +379,12 @@ func TestBuffer_FlushBySizeByteLimited(t *testing.T) {
 		buf.Add(entry)
 	}
 
-	// Entry size is ~11 bytes (1+1+1+8)
-	// Limit to 30 bytes should return ~2-3 entries
-	entries := buf.FlushBySize(100, 30)
+	// Entry size is 49 bytes serialized (28 for the value, 21 for the
+	// injected request ID); a 100 byte limit fits 2 entries
+	entries := buf.FlushBySize(100, 100)
 
-	if len(entries) > 3 {
-		t.Errorf("FlushBySize returned %d entries, expected <= 3 for 30 byte limit", len(entries))
+	if len(entries) != 2 {
+		t.Errorf("FlushBySize returned %d entries, expected 2 for 100 byte limit", len(entries))
 	}
 }
 
@@ -532,18 +671,421 @@ func TestBuffer_ConcurrentByteSize(t *testing.T) {
 	wg.Wait()
 }
 
-// Test LogEntry.Size()
+// Test order is preserved when the ring wraps around its backing array
+func TestBuffer_RingWrapPreservesOrder(t *testing.T) {
+	buf := New(4)
+	for i := 0; i < 3; i++ {
+		buf.Add(LogEntry{Timestamp: int64(i)})
+	}
+	buf.Flush(2) // head now at index 2
+
+	for i := 3; i < 6; i++ {
+		buf.Add(LogEntry{Timestamp: int64(i)})
+	}
+
+	entries := buf.Flush(10)
+	if len(entries) != 4 {
+		t.Fatalf("Flush() returned %d entries, want 4", len(entries))
+	}
+	for i, e := range entries {
+		if e.Timestamp != int64(i+2) {
+			t.Errorf("entries[%d].Timestamp = %d, want %d", i, e.Timestamp, i+2)
+		}
+	}
+}
+
+// Test overflow drops oldest correctly after wraparound
+func TestBuffer_RingOverflowAfterWrap(t *testing.T) {
+	buf := New(3)
+	for i := 0; i < 10; i++ {
+		buf.Add(LogEntry{Timestamp: int64(i), Message: "m"})
+	}
+
+	if buf.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", buf.Len())
+	}
+	probe := LogEntry{Message: "m"}
+	if want := 3 * probe.Size(); buf.ByteSize() != want {
+		t.Errorf("ByteSize() = %d, want %d", buf.ByteSize(), want)
+	}
+
+	entries := buf.Drain()
+	for i, e := range entries {
+		if e.Timestamp != int64(i+7) {
+			t.Errorf("entries[%d].Timestamp = %d, want %d", i, e.Timestamp, i+7)
+		}
+	}
+}
+
+// Test steady-state add/flush does not allocate beyond the returned batch
+func TestBuffer_RingReusesStorage(t *testing.T) {
+	buf := New(100)
+	entry := LogEntry{Message: "steady"}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		for i := 0; i < 50; i++ {
+			buf.Add(entry)
+		}
+		buf.Flush(50)
+	})
+
+	// One allocation for the flushed batch slice
+	if allocs > 1 {
+		t.Errorf("allocs per add/flush cycle = %v, want <= 1", allocs)
+	}
+}
+
+// Test drop-oldest counts evicted entries
+func TestBuffer_DropOldestCountsDrops(t *testing.T) {
+	buf := New(2)
+	buf.AddBatch([]LogEntry{{Timestamp: 1}, {Timestamp: 2}, {Timestamp: 3}})
+	buf.Add(LogEntry{Timestamp: 4})
+
+	if buf.Dropped() != 2 {
+		t.Errorf("Dropped() = %d, want 2", buf.Dropped())
+	}
+	entries := buf.Flush(10)
+	if entries[0].Timestamp != 3 || entries[1].Timestamp != 4 {
+		t.Errorf("expected newest entries kept, got %+v", entries)
+	}
+}
+
+// Test drop-newest keeps existing entries
+func TestBuffer_DropNewest(t *testing.T) {
+	buf := NewWithPolicy(2, DropNewest, 0)
+	buf.AddBatch([]LogEntry{{Timestamp: 1}, {Timestamp: 2}, {Timestamp: 3}})
+	if !buf.Add(LogEntry{Timestamp: 4}) {
+		t.Error("Add() on full buffer should report capacity")
+	}
+
+	if buf.Dropped() != 2 {
+		t.Errorf("Dropped() = %d, want 2", buf.Dropped())
+	}
+	entries := buf.Flush(10)
+	if entries[0].Timestamp != 1 || entries[1].Timestamp != 2 {
+		t.Errorf("expected oldest entries kept, got %+v", entries)
+	}
+}
+
+// Test the byte cap evicts as many old entries as the new one needs
+func TestBuffer_MaxBytesDropsOldest(t *testing.T) {
+	small := LogEntry{Message: strings.Repeat("a", 100)}
+	large := LogEntry{Message: strings.Repeat("b", 250)}
+	buf := New(100)
+	buf.SetMaxBytes(3 * small.Size())
+
+	buf.AddBatch([]LogEntry{small, small, small})
+	if buf.Dropped() != 0 || buf.Len() != 3 {
+		t.Fatalf("Len() = %d, Dropped() = %d, want 3 and 0", buf.Len(), buf.Dropped())
+	}
+	buf.Add(large)
+
+	if buf.Dropped() != 3 {
+		t.Errorf("Dropped() = %d, want 3", buf.Dropped())
+	}
+	if buf.ByteSize() > 3*small.Size() {
+		t.Errorf("ByteSize() = %d, exceeds cap %d", buf.ByteSize(), 3*small.Size())
+	}
+	if entries := buf.Flush(10); len(entries) != 1 || entries[0].Message != large.Message {
+		t.Errorf("expected only the large entry kept, got %d entries", len(entries))
+	}
+}
+
+// Test the byte cap applies the overflow policy, and admits an oversized
+// entry only into an empty buffer
+func TestBuffer_MaxBytesDropNewest(t *testing.T) {
+	entry := LogEntry{Message: strings.Repeat("a", 100)}
+	buf := NewWithPolicy(100, DropNewest, 0)
+	buf.SetMaxBytes(entry.Size())
+
+	buf.AddBatch([]LogEntry{entry, entry})
+	if buf.Len() != 1 || buf.Dropped() != 1 {
+		t.Errorf("Len() = %d, Dropped() = %d, want 1 and 1", buf.Len(), buf.Dropped())
+	}
+
+	buf.Flush(10)
+	huge := LogEntry{Message: strings.Repeat("h", 1000)}
+	buf.Add(huge)
+	if buf.Len() != 1 {
+		t.Errorf("oversized entry should be accepted into an empty buffer, Len() = %d", buf.Len())
+	}
+}
+
+// Test block-with-timeout waits for a flush to free space
+func TestBuffer_BlockWithTimeoutWaitsForFlush(t *testing.T) {
+	buf := NewWithPolicy(1, BlockWithTimeout, 2*time.Second)
+	buf.Add(LogEntry{Timestamp: 1})
+
+	done := make(chan struct{})
+	go func() {
+		buf.AddBatch([]LogEntry{{Timestamp: 2}})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("AddBatch should block while buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	buf.Flush(1)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("AddBatch did not unblock after flush")
+	}
+	if buf.Dropped() != 0 {
+		t.Errorf("Dropped() = %d, want 0", buf.Dropped())
+	}
+	if entries := buf.Flush(1); len(entries) != 1 || entries[0].Timestamp != 2 {
+		t.Errorf("expected blocked entry to be stored, got %+v", entries)
+	}
+}
+
+// Test block-with-timeout drops the entry once the timeout expires
+func TestBuffer_BlockWithTimeoutDropsOnTimeout(t *testing.T) {
+	buf := NewWithPolicy(1, BlockWithTimeout, 20*time.Millisecond)
+	buf.Add(LogEntry{Timestamp: 1})
+
+	start := time.Now()
+	buf.AddBatch([]LogEntry{{Timestamp: 2}})
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("AddBatch returned after %v, want >= 20ms", elapsed)
+	}
+	if buf.Dropped() != 1 {
+		t.Errorf("Dropped() = %d, want 1", buf.Dropped())
+	}
+}
+
+// Test Add never blocks under block-with-timeout
+func TestBuffer_BlockWithTimeoutAddDoesNotBlock(t *testing.T) {
+	buf := NewWithPolicy(1, BlockWithTimeout, time.Hour)
+	buf.Add(LogEntry{Timestamp: 1})
+	buf.Add(LogEntry{Timestamp: 2})
+
+	if buf.Dropped() != 1 {
+		t.Errorf("Dropped() = %d, want 1", buf.Dropped())
+	}
+}
+
+// Test Drain releases blocked writers
+func TestBuffer_DrainUnblocksWriters(t *testing.T) {
+	buf := NewWithPolicy(1, BlockWithTimeout, time.Hour)
+	buf.Add(LogEntry{Timestamp: 1})
+
+	done := make(chan struct{})
+	go func() {
+		buf.AddBatch([]LogEntry{{Timestamp: 2}})
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	buf.Drain()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("AddBatch did not unblock after Drain")
+	}
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	tests := map[string]OverflowPolicy{
+		"drop-oldest":        DropOldest,
+		"drop-newest":        DropNewest,
+		"block-with-timeout": BlockWithTimeout,
+		"":                   DropOldest,
+		"bogus":              DropOldest,
+	}
+	for in, want := range tests {
+		if got := ParseOverflowPolicy(in); got != want {
+			t.Errorf("ParseOverflowPolicy(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// Test Flush keeps FIFO order when the buffer is not under pressure
+func TestBuffer_FlushIgnoresPriorityBelowPressure(t *testing.T) {
+	buf := New(100)
+	buf.Add(LogEntry{Timestamp: 1})
+	buf.Add(LogEntry{Timestamp: 2, Priority: PriorityHigh})
+
+	entries := buf.Flush(1)
+	if entries[0].Timestamp != 1 {
+		t.Errorf("expected oldest entry first, got %d", entries[0].Timestamp)
+	}
+}
+
+// Test Flush prefers high-priority entries when near capacity
+func TestBuffer_FlushPrefersPriorityNearCapacity(t *testing.T) {
+	buf := New(10)
+	for i := 0; i < 9; i++ {
+		p := PriorityNormal
+		if i == 4 || i == 7 {
+			p = PriorityHigh
+		}
+		buf.Add(LogEntry{Timestamp: int64(i), Priority: p})
+	}
+
+	entries := buf.Flush(3)
+	want := []int64{0, 4, 7} // both high-priority entries, then oldest normal, in time order
+	for i, e := range entries {
+		if e.Timestamp != want[i] {
+			t.Errorf("entries[%d].Timestamp = %d, want %d", i, e.Timestamp, want[i])
+		}
+	}
+
+	// Remaining entries stay in order
+	rest := buf.Flush(10)
+	wantRest := []int64{1, 2, 3, 5, 6, 8}
+	if len(rest) != len(wantRest) {
+		t.Fatalf("remaining = %d entries, want %d", len(rest), len(wantRest))
+	}
+	for i, e := range rest {
+		if e.Timestamp != wantRest[i] {
+			t.Errorf("rest[%d].Timestamp = %d, want %d", i, e.Timestamp, wantRest[i])
+		}
+	}
+	if buf.ByteSize() != 0 {
+		t.Errorf("ByteSize() = %d, want 0", buf.ByteSize())
+	}
+}
+
+// Test FlushPriority respects byte limits and wraps correctly
+func TestBuffer_FlushPriorityByteLimit(t *testing.T) {
+	buf := New(4)
+	buf.Add(LogEntry{Timestamp: 0, Message: "x"})
+	buf.Flush(1) // move head so the ring wraps
+	buf.Add(LogEntry{Timestamp: 1, Message: "normal"})
+	buf.Add(LogEntry{Timestamp: 2, Message: "error", Priority: PriorityHigh})
+	buf.Add(LogEntry{Timestamp: 3, Message: "normal"})
+	buf.Add(LogEntry{Timestamp: 4, Message: "error", Priority: PriorityHigh})
+
+	probe := LogEntry{Message: "error"}
+	entries := buf.FlushPriority(10, 2*probe.Size())
+	if len(entries) != 2 || entries[0].Timestamp != 2 || entries[1].Timestamp != 4 {
+		t.Errorf("expected both errors only, got %+v", entries)
+	}
+	if buf.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", buf.Len())
+	}
+}
+
+// LogEntry.Size() matches the entry's bytes in an encoded push body
 func TestLogEntry_Size(t *testing.T) {
-	entry := LogEntry{
-		Timestamp: 1234567890,
-		Message:   "hello",     // 5 bytes
-		Type:      "function",  // 8 bytes
-		RequestID: "req-12345", // 9 bytes
+	tests := []struct {
+		name    string
+		entry   LogEntry
+		encoded string // the entry's value tuple, separator included
+	}{
+		{"plain", LogEntry{Message: "hello"}, `["1700000000000000000","hello"],`},
+		{"escaped", LogEntry{Message: "a \"b\"\n<c>"}, `["1700000000000000000","a \"b\"\n\u003cc\u003e"],`},
+		{"request id", LogEntry{Message: `{"a":1}`, RequestID: "req-12345"}, `["1700000000000000000","{\"request_id\":\"req-12345\",\"a\":1}"],`},
+		{"trace id", LogEntry{Message: "x", Attributes: map[string]string{AttrTraceID: "1-abc"}}, `["1700000000000000000","x",{"trace_id":"1-abc"}],`},
+		{"chunk", LogEntry{Message: "x", Attributes: map[string]string{AttrTraceID: "1-abc"}, Chunk: Chunk{ID: "c-1", Index: 2, Total: 12}}, `["1700000000000000000","x",{"trace_id":"1-abc","chunk_id":"c-1","chunk_index":"2","chunk_total":"12"}],`},
+		{"outcome", LogEntry{Message: "x", Attributes: map[string]string{AttrTraceID: "1-abc", AttrOutcome: "timeout"}}, `["1700000000000000000","x",{"trace_id":"1-abc","outcome":"timeout"}],`},
+		{"cold start", LogEntry{Message: "x", Attributes: map[string]string{AttrColdStart: "true"}}, `["1700000000000000000","x",{"cold_start":"true"}],`},
 	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.entry.Size(); got != len(tt.encoded) {
+				t.Errorf("Size() = %d, want %d", got, len(tt.encoded))
+			}
+		})
+	}
+}
+
+func TestLogEntry_SetAttributeCopiesMap(t *testing.T) {
+	e := LogEntry{Message: "x"}
+	e.SetAttribute(AttrTraceID, "1-abc")
+	copied := e
 
-	// Size = len(Message) + len(Type) + len(RequestID) + 8 (timestamp)
-	expected := 5 + 8 + 9 + 8
-	if entry.Size() != expected {
-		t.Errorf("Size() = %d, want %d", entry.Size(), expected)
+	e.SetAttribute(AttrOutcome, "timeout")
+	if copied.Attribute(AttrOutcome) != "" {
+		t.Error("setting an attribute changed a copy of the entry")
+	}
+	e.SetAttribute(AttrTraceID, "")
+	e.SetAttribute(AttrOutcome, "")
+	if e.Attributes != nil {
+		t.Errorf("Attributes = %v after removing every key, want nil", e.Attributes)
+	}
+	if copied.Attribute(AttrTraceID) != "1-abc" {
+		t.Error("removing an attribute changed a copy of the entry")
+	}
+}
+
+func TestBuffer_UpdateTracksByteSize(t *testing.T) {
+	b := New(10)
+	b.Add(LogEntry{Message: "a", RequestID: "req-1"})
+	b.Add(LogEntry{Message: "b", RequestID: "req-2"})
+
+	b.Update(func(e *LogEntry) {
+		if e.RequestID == "req-1" {
+			e.SetAttribute(AttrOutcome, "timeout")
+		}
+	})
+
+	entries := b.Flush(10)
+	if entries[0].Attribute(AttrOutcome) != "timeout" || entries[1].Attribute(AttrOutcome) != "" {
+		t.Errorf("outcomes = %q, %q; want timeout, empty", entries[0].Attribute(AttrOutcome), entries[1].Attribute(AttrOutcome))
+	}
+	if b.ByteSize() != 0 {
+		t.Errorf("ByteSize() = %d after flushing everything, want 0", b.ByteSize())
+	}
+}
+
+func TestBuffer_MaxAgeExpiresOldEntries(t *testing.T) {
+	now := time.UnixMilli(1_000_000)
+	buf := NewWithPolicy(3, DropNewest, 0)
+	buf.now = func() time.Time { return now }
+	buf.SetMaxAge(time.Second)
+
+	buf.Add(LogEntry{Message: "stale 1"})
+	buf.Add(LogEntry{Message: "stale 2"})
+	now = now.Add(600 * time.Millisecond)
+	buf.Add(LogEntry{Message: "fresh"})
+	if age := buf.OldestAge(); age != 600*time.Millisecond {
+		t.Errorf("OldestAge() = %v, want 600ms", age)
+	}
+
+	// A full drop-newest buffer makes room by expiring instead of losing the new entry
+	now = now.Add(500 * time.Millisecond)
+	buf.Add(LogEntry{Message: "newest"})
+	if buf.Expired() != 2 || buf.Dropped() != 0 {
+		t.Errorf("Expired() = %d, Dropped() = %d; want 2, 0", buf.Expired(), buf.Dropped())
+	}
+
+	now = now.Add(600 * time.Millisecond)
+	got := buf.Flush(10)
+	if len(got) != 1 || got[0].Message != "newest" {
+		t.Errorf("Flush() = %v, want only the newest entry", got)
+	}
+	if buf.Expired() != 3 || buf.OldestAge() != 0 {
+		t.Errorf("Expired() = %d, OldestAge() = %v; want 3, 0", buf.Expired(), buf.OldestAge())
+	}
+}
+
+func TestBuffer_ReAddKeepsAge(t *testing.T) {
+	now := time.UnixMilli(1_000_000)
+	buf := New(10)
+	buf.now = func() time.Time { return now }
+	buf.Add(LogEntry{Message: "retry me"})
+
+	entries := buf.Flush(10)
+	now = now.Add(time.Minute)
+	buf.AddBatch(entries)
+	if age := buf.OldestAge(); age != time.Minute {
+		t.Errorf("OldestAge() = %v after re-adding, want 1m", age)
+	}
+}
+
+func TestBuffer_NoMaxAgeKeepsEntries(t *testing.T) {
+	now := time.UnixMilli(1_000_000)
+	buf := New(10)
+	buf.now = func() time.Time { return now }
+	buf.Add(LogEntry{Message: "old"})
+	now = now.Add(24 * time.Hour)
+	if got := buf.Flush(10); len(got) != 1 || buf.Expired() != 0 {
+		t.Errorf("Flush() = %v, Expired() = %d; want the entry kept", got, buf.Expired())
 	}
 }
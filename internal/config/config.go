@@ -2,13 +2,85 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+)
+
+// envPrefix gives every setting a LambdaWatch-specific name, e.g.
+// LAMBDAWATCH_BUFFER_SIZE for BUFFER_SIZE or LAMBDAWATCH_LOKI_URL for
+// LOKI_URL. The prefixed name takes precedence, so the layer can be shipped
+// org-wide without its settings colliding with a function's own variables.
+const envPrefix = "LAMBDAWATCH_"
+
+// Supported push body compression codecs. Loki's JSON push endpoint only
+// decodes gzip, so zstd and snappy are rejected rather than sent.
+const (
+	CompressionGzip = "gzip"
+	CompressionNone = "none"
+)
+
+// Loki authentication modes (LOKI_AUTH_MODE)
+const (
+	AuthModeNone   = "none"          // no credentials
+	AuthModeBasic  = "basic"         // LOKI_USERNAME/LOKI_PASSWORD
+	AuthModeBearer = "bearer"        // LOKI_API_KEY as a bearer token
+	AuthModeHeader = "custom-header" // LOKI_API_KEY in the LOKI_AUTH_HEADER header
+	// AuthModeSigV4 signs Loki requests with the function role's credentials
+	AuthModeSigV4 = "sigv4"
+)
+
+// Lambda APIs the extension can receive logs from
+const (
+	LogSourceTelemetry = "telemetry" // Telemetry API
+	LogSourceLogsAPI   = "logsapi"   // legacy Logs API, for runtimes/regions without the Telemetry API
+)
+
+// How long entries without a request ID are attributed to an invocation
+const (
+	AttributionInvocation = "invocation" // from its start until its runtimeDone
+	AttributionSticky     = "sticky"     // from its start until the next invocation starts
+)
+
+// Extensions API events the extension can register for
+const (
+	EventInvoke   = "INVOKE"
+	EventShutdown = "SHUTDOWN"
+)
+
+// Where the extension's own log lines are shipped
+const (
+	ExtensionLogsStream = "stream" // their own stream, labelled source="lambdawatch"
+	ExtensionLogsMixed  = "mixed"  // alongside the function's logs
+	ExtensionLogsOff    = "off"    // stdout only
+)
+
+// What an INVOKE does to a critical flush still in flight
+const (
+	InflightFlushContinue = "continue" // let it finish under its own deadline
+	InflightFlushCancel   = "cancel"   // cancel it and requeue its unpushed entries
+)
+
+// Per-stream timestamp ordering applied to each batch
+const (
+	OrderingOff   = "off"   // ship timestamps as received
+	OrderingClamp = "clamp" // raise an out-of-order timestamp to its predecessor's
+	OrderingSort  = "sort"  // stable-sort each stream by timestamp
 )
 
 type Config struct {
-	// Loki endpoint (required)
-	LokiEndpoint string
+	// Loki endpoint (required). LOKI_URL may list several comma-separated
+	// endpoints; LokiEndpoint is the primary and LokiEndpoints holds all of them.
+	LokiEndpoint  string
+	LokiEndpoints []string
+
+	// Failover between LokiEndpoints
+	LokiFailoverThreshold       int // Consecutive failed attempts before rotating
+	LokiFailoverProbeIntervalMs int // How often to retry the primary after failing over
 
 	// Authentication
 	LokiUsername string
@@ -16,81 +88,579 @@ type Config struct {
 	LokiAPIKey   string
 	LokiTenantID string
 
+	// LOKI_AUTH_MODE picks how requests are authenticated (AuthMode*).
+	// Unset, it follows from the credentials given; see AuthMode.
+	// sigv4 signs requests with AWS Signature Version 4 for
+	// IAM-authenticated ingestion endpoints; custom-header sends
+	// LokiAPIKey in the LokiAuthHeader header.
+	LokiAuthMode     string
+	LokiAuthHeader   string
+	LokiSigV4Service string
+	LokiSigV4Region  string
+
+	// Extra HTTP headers sent to Loki, e.g. Cloudflare Access service tokens
+	// for a gateway in front of Loki. They may not set the auth header.
+	LokiExtraHeaders map[string]string
+
+	// TLS for the Loki connection (PEM). A custom CA replaces the system
+	// roots; a client certificate and key enable mTLS.
+	LokiTLSCA   []byte
+	LokiTLSCert []byte
+	LokiTLSKey  []byte
+
+	// HTTP transport for Loki pushes
+	LokiHTTPTimeoutMs       int    // Per-request timeout
+	LokiMaxIdleConnsPerHost int    // Idle keep-alive connections kept per Loki host
+	LokiForceHTTP2          bool   // Attempt HTTP/2 even with a custom TLS config
+	LokiProxyURL            string // Proxy for pushes; overrides HTTPS_PROXY/NO_PROXY
+
+	// Tenant routing: entries are sent to the tenant named by this label's value
+	LokiTenantLabel string
+
 	// Batching
 	BatchSize           int
 	MaxBatchSizeBytes   int // Max batch size in bytes (0 = no limit)
 	FlushIntervalMs     int
-	IdleFlushMultiplier int // Multiplier for flush interval when idle (default 3x)
+	IdleFlushMultiplier int  // Multiplier for flush interval when idle (default 3x)
+	FlushOnlyOnInvoke   bool // Suspend periodic flushing outside ACTIVE invocations
+	PostInvokeWindowMs  int  // Max wait after runtimeDone for late telemetry (0 = don't wait)
+	FlushWorkers        int  // Batches pushed to Loki in parallel
+	AdaptiveBatchSize   bool // Grow/shrink BatchSize from observed push latency
+	MinBatchSize        int  // Lower bound for adaptive sizing
+	MaxBatchSize        int  // Upper bound for adaptive sizing
+
+	// What an INVOKE does to a critical flush still running: continue or cancel
+	InflightFlushPolicy string
 
 	// Reliability
 	MaxRetries           int
-	CriticalFlushRetries int // Higher retries for critical flushes (shutdown, runtimeDone)
-	EnableGzip           bool
-	CompressionThreshold int // Only compress if payload > this size (bytes)
+	CriticalFlushRetries int    // Higher retries for critical flushes (shutdown, runtimeDone)
+	RetryMaxBackoffMs    int    // Longest wait before a retry (0 = uncapped)
+	RetryMaxElapsedMs    int    // Wall time one push may spend retrying (0 = bounded by retry counts only)
+	EnableGzip           bool   // Deprecated: use Compression
+	Compression          string // Push body codec: gzip or none
+	CompressionThreshold int    // Only compress if payload > this size (bytes)
+	CompressionAuto      bool   // Raise the threshold / switch compression off for incompressible payloads
+
+	// Dead-letter: batches that exhaust critical retries are written to S3
+	DeadLetterBucket string // Empty disables dead-lettering
+	DeadLetterPrefix string
+
+	// Spool: failed batches are kept on local disk and redelivered at the
+	// next INVOKE or at SHUTDOWN
+	SpoolDir      string // Empty disables spooling
+	SpoolMaxBytes int    // Spooled batches beyond this total are evicted, oldest first
+	SpoolMaxAgeMs int    // Spooled batches older than this are discarded (0 = kept)
+
+	// Every batch that fails delivery is reported on stdout; this endpoint
+	// also receives each report as a JSON POST (empty = stdout only)
+	FailureWebhookURL string
+
+	// Kafka sink: entries are also produced to a topic when brokers are set
+	KafkaBrokers       []string
+	KafkaTopic         string
+	KafkaSASLMechanism string // PLAIN, SCRAM-SHA-256, SCRAM-SHA-512 or AWS_MSK_IAM; empty disables SASL
+	KafkaUsername      string
+	KafkaPassword      string
+	KafkaTLS           bool // Always on for AWS_MSK_IAM
+
+	// Prometheus remote-write export of the extension's own metrics
+	PromRemoteWriteURL        string // Empty disables the exporter
+	PromRemoteWriteUsername   string
+	PromRemoteWritePassword   string
+	PromRemoteWriteTenantID   string // Sent as X-Scope-OrgID (Mimir)
+	PromRemoteWriteIntervalMs int    // Minimum time between exports
 
 	// Custom labels
 	Labels map[string]string
 
 	// Buffer
-	BufferSize int
+	BufferSize           int
+	BufferMaxBytes       int    // Cap on the buffer's total entry size (0 = entry count only)
+	BufferOverflowPolicy string // drop-oldest, drop-newest or block-with-timeout
+	BufferBlockTimeoutMs int    // Max wait for space under block-with-timeout
+	MaxEntryAgeMs        int    // Entries buffered longer are discarded (0 = no limit)
+	MaxDeliveryAttempts  int    // Failed pushes after which an entry is discarded (0 = no limit)
+
+	// Lambda API subscribed to for logs: telemetry or logsapi
+	LogSource string
+
+	// Window in which entries are attributed to an invocation: invocation
+	// (until runtimeDone) or sticky (until the next invocation starts)
+	AttributionWindow string
+
+	// Extensions API events to register for. Without INVOKE the extension
+	// stays out of the invoke path and flushes on its timer alone.
+	ExtensionEvents []string
+
+	// Telemetry API destination protocol: HTTP or TCP
+	TelemetryProtocol string
+
+	// Telemetry listener port; when it is taken, up to TelemetryPortProbe
+	// successive ports are tried
+	TelemetryPort      int
+	TelemetryPortProbe int
+
+	// Telemetry API subscription buffering (how Lambda batches deliveries to us)
+	TelemetryBufferMaxItems  int
+	TelemetryBufferMaxBytes  int
+	TelemetryBufferTimeoutMs int
+
+	// Largest delivery body the receiver accepts (0 = no limit)
+	TelemetryMaxBodyBytes int
 
 	// Message limits
 	MaxLineSize int // Max bytes per log line (0 = no limit)
 
+	// Filtering and sampling of function logs before buffering
+	LogFilterExclude  string  // Regex; matching function log lines are dropped
+	LogFilterMinLevel string  // Drop function logs below this level (debug, info, warn, error)
+	LogSampleRate     float64 // Fraction of non-error function logs kept (1 = all)
+
+	// Fraction of successful, error-free invocations whose function logs are
+	// kept, decided at platform.runtimeDone (1 = all, no holding back)
+	TailSampleRate float64
+
+	// Rename common JSON field aliases (msg, ts, severity, ...) to message/timestamp/level
+	LogNormalizeJSON bool
+
+	// Wrap lines that are not JSON objects in {"message","level"} so
+	// Grafana parses every line of a stream the same way
+	WrapPlaintextJSON bool
+
+	// Base64-encode binary-looking records (labelled encoding=base64) instead
+	// of replacing their invalid UTF-8
+	LogBinaryBase64 bool
+
+	// Redaction applied to messages before buffering
+	LogRedactBuiltin  bool     // Scrub emails, card numbers, AWS keys and bearer tokens
+	LogRedactPatterns []string // Additional regexes whose matches are replaced
+
+	// Emit one structured summary entry per invocation in a type=invocation_summary stream
+	InvocationSummary bool
+
+	// Emit platform.report metrics as JSON entries in a type=report_metrics stream
+	ReportMetrics bool
+
+	// Ship an "END RequestId: ..." line per invocation, completing CloudWatch's START/END/REPORT lines
+	EndLines bool
+
+	// Label memory size, runtime and CloudWatch log group/stream from the Lambda environment
+	AutoLabels bool
+
+	// Label the OpenTelemetry resource attributes ADOT puts on traces
+	// (faas_name, faas_version, cloud_region, cloud_account_id), with
+	// faas_instance as structured metadata
+	OTelResourceLabels bool
+
+	// Label governance applied to every stream before pushing; zero limits disable a check
+	LabelAllowlist      []string // Empty allows every label
+	LabelDenylist       []string
+	MaxLabels           int // Labels per stream
+	MaxLabelValueLength int // Longer values are truncated with a hash suffix
+	MaxLabelValues      int // Distinct values per label before new ones become __overflow__
+
+	// Token-bucket limit per stream applied when batching; 0 disables it
+	StreamRateLimit float64 // Lines per second
+	StreamRateBurst int     // Lines accepted at once (defaults to one second's worth)
+
+	// Streams a function's writes are spread over by a round-robin shard
+	// label; 1 (or 0) ships every batch to the same stream
+	StreamShards int
+
+	// Hot reload of labels, filters and sampling from SSM or AppConfig
+	ReloadSource     string // ssm:<parameter> or appconfig:<application>/<environment>/<profile>
+	ReloadIntervalMs int    // Minimum time between reloads
+
 	// Request ID
-	ExtractRequestID bool // Extract and embed request_id into log message content
+	ExtractRequestID bool // Extract request_id from log message content
+	InjectRequestID  bool // Embed request_id into log message content (defaults to ExtractRequestID)
+	GroupByRequestID bool // One stream per request_id label; high cardinality
+
+	// Read span IDs as well as trace IDs from function logs: W3C traceparent
+	// and span ID fields in JSON lines, X-Amzn-Trace-Id values in plain text
+	ExtractTraceContext bool
+
+	// Collapse consecutive identical lines in a batch into one with a repeat_count
+	DedupRepeats bool
+
+	// Keep timestamps non-decreasing within each stream: off, clamp or sort
+	TimestampOrdering string
+
+	// Stream for the extension's own logs: stream, mixed or off. With off
+	// they are not mirrored into the buffer at all.
+	ExtensionLogs string
+
+	// Print batches to stdout instead of pushing them to Loki
+	DryRun bool
+
+	// Query Loki after shutdown (and on GET /verify) to confirm the last
+	// invocation's entries arrived
+	VerifyDelivery bool
+
+	// Local development: skip the Lambda APIs and read log lines from a file,
+	// named pipe or stdin instead
+	Local      bool
+	LocalInput string // Path to read from; empty reads stdin
+
+	// Deprecation notices for settings read from generic environment
+	// variable names, to be logged once the logger is up
+	Warnings []string
 }
 
 func Load() (*Config, error) {
+	file, err := loadConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	env := &envReader{file: file}
 	cfg := &Config{
-		LokiEndpoint:         os.Getenv("LOKI_URL"),
-		LokiUsername:         os.Getenv("LOKI_USERNAME"),
-		LokiPassword:         os.Getenv("LOKI_PASSWORD"),
-		LokiAPIKey:           os.Getenv("LOKI_API_KEY"),
-		LokiTenantID:         os.Getenv("LOKI_TENANT_ID"),
-		BatchSize:            getEnvInt("LOKI_BATCH_SIZE", 100),
-		MaxBatchSizeBytes:    getEnvInt("LOKI_MAX_BATCH_SIZE_BYTES", 5*1024*1024), // 5MB default
-		FlushIntervalMs:      getEnvInt("LOKI_FLUSH_INTERVAL_MS", 1000),
-		IdleFlushMultiplier:  getEnvInt("LOKI_IDLE_FLUSH_MULTIPLIER", 3),
-		MaxRetries:           getEnvInt("LOKI_MAX_RETRIES", 3),
-		CriticalFlushRetries: getEnvInt("LOKI_CRITICAL_FLUSH_RETRIES", 5),
-		EnableGzip:           getEnvBool("LOKI_ENABLE_GZIP", true),
-		CompressionThreshold: getEnvInt("LOKI_COMPRESSION_THRESHOLD", 1024), // 1KB default
-		BufferSize:           getEnvInt("BUFFER_SIZE", 10000),
-		MaxLineSize:          getEnvInt("LOKI_MAX_LINE_SIZE", 204800), // 200KB default
-		ExtractRequestID:     getEnvBool("LOKI_EXTRACT_REQUEST_ID", true),
-		Labels:               make(map[string]string),
+		LokiUsername:                env.lookup("LOKI_USERNAME"),
+		LokiPassword:                env.lookup("LOKI_PASSWORD"),
+		LokiAPIKey:                  env.lookup("LOKI_API_KEY"),
+		LokiAuthMode:                strings.ToLower(env.lookup("LOKI_AUTH_MODE")),
+		LokiAuthHeader:              env.lookup("LOKI_AUTH_HEADER"),
+		LokiSigV4Service:            env.getString("LOKI_SIGV4_SERVICE", "aps"),
+		LokiSigV4Region:             env.getString("LOKI_SIGV4_REGION", os.Getenv("AWS_REGION")),
+		LokiTenantID:                env.lookup("LOKI_TENANT_ID"),
+		LokiTenantLabel:             env.lookup("LOKI_TENANT_LABEL"),
+		LokiHTTPTimeoutMs:           env.getInt("LOKI_HTTP_TIMEOUT_MS", 10000),
+		LokiMaxIdleConnsPerHost:     env.getInt("LOKI_MAX_IDLE_CONNS_PER_HOST", 4),
+		LokiForceHTTP2:              env.getBool("LOKI_FORCE_HTTP2", true),
+		LokiProxyURL:                env.lookup("LOKI_PROXY_URL"),
+		LokiFailoverThreshold:       env.getInt("LOKI_FAILOVER_THRESHOLD", 3),
+		LokiFailoverProbeIntervalMs: env.getInt("LOKI_FAILOVER_PROBE_INTERVAL_MS", 60000),
+		BatchSize:                   env.getInt("LOKI_BATCH_SIZE", 100),
+		MaxBatchSizeBytes:           env.getInt("LOKI_MAX_BATCH_SIZE_BYTES", 5*1024*1024), // 5MB default
+		FlushIntervalMs:             env.getInt("LOKI_FLUSH_INTERVAL_MS", 1000),
+		IdleFlushMultiplier:         env.getInt("LOKI_IDLE_FLUSH_MULTIPLIER", 3),
+		FlushOnlyOnInvoke:           env.getBool("LOKI_FLUSH_ONLY_ON_INVOKE", false),
+		PostInvokeWindowMs:          env.getInt("LOKI_POST_INVOKE_WINDOW_MS", 0),
+		InflightFlushPolicy:         strings.ToLower(env.getString("LOKI_INFLIGHT_FLUSH_POLICY", InflightFlushContinue)),
+		AdaptiveBatchSize:           env.getBool("LOKI_ADAPTIVE_BATCH_SIZE", false),
+		MinBatchSize:                env.getInt("LOKI_MIN_BATCH_SIZE", 10),
+		MaxBatchSize:                env.getInt("LOKI_MAX_BATCH_SIZE", 1000),
+		FlushWorkers:                env.getInt("LOKI_FLUSH_WORKERS", 1),
+		MaxRetries:                  env.getInt("LOKI_MAX_RETRIES", 3),
+		CriticalFlushRetries:        env.getInt("LOKI_CRITICAL_FLUSH_RETRIES", 5),
+		RetryMaxBackoffMs:           env.getInt("LOKI_RETRY_MAX_BACKOFF_MS", 2000),
+		RetryMaxElapsedMs:           env.getInt("LOKI_RETRY_MAX_ELAPSED_MS", 10000),
+		EnableGzip:                  env.getBool("LOKI_ENABLE_GZIP", true),
+		CompressionThreshold:        env.getInt("LOKI_COMPRESSION_THRESHOLD", 1024), // 1KB default
+		CompressionAuto:             env.getBool("LOKI_COMPRESSION_AUTO", false),
+		DeadLetterBucket:            env.lookup("LOKI_DEAD_LETTER_BUCKET"),
+		DeadLetterPrefix:            env.getString("LOKI_DEAD_LETTER_PREFIX", "lambdawatch/"),
+		SpoolDir:                    env.lookup("LOKI_SPOOL_DIR"),
+		SpoolMaxBytes:               env.getInt("LOKI_SPOOL_MAX_BYTES", 64<<20),
+		SpoolMaxAgeMs:               env.getInt("LOKI_SPOOL_MAX_AGE_MS", 3600000),
+		FailureWebhookURL:           env.lookup("LOKI_FAILURE_WEBHOOK_URL"),
+		KafkaTopic:                  env.lookup("KAFKA_TOPIC"),
+		KafkaSASLMechanism:          strings.ToUpper(env.lookup("KAFKA_SASL_MECHANISM")),
+		KafkaUsername:               env.lookup("KAFKA_USERNAME"),
+		KafkaPassword:               env.lookup("KAFKA_PASSWORD"),
+		KafkaTLS:                    env.getBool("KAFKA_TLS", false),
+		PromRemoteWriteURL:          env.lookup("PROM_REMOTE_WRITE_URL"),
+		PromRemoteWriteUsername:     env.lookup("PROM_REMOTE_WRITE_USERNAME"),
+		PromRemoteWritePassword:     env.lookup("PROM_REMOTE_WRITE_PASSWORD"),
+		PromRemoteWriteTenantID:     env.lookup("PROM_REMOTE_WRITE_TENANT_ID"),
+		PromRemoteWriteIntervalMs:   env.getInt("PROM_REMOTE_WRITE_INTERVAL_MS", 60000),
+		BufferSize:                  env.getInt("BUFFER_SIZE", 10000),
+		BufferMaxBytes:              env.getInt("BUFFER_MAX_BYTES", 0),
+		BufferOverflowPolicy:        env.getString("BUFFER_OVERFLOW_POLICY", "drop-oldest"),
+		BufferBlockTimeoutMs:        env.getInt("BUFFER_BLOCK_TIMEOUT_MS", 500),
+		MaxEntryAgeMs:               env.getInt("MAX_ENTRY_AGE_MS", 0),
+		MaxDeliveryAttempts:         env.getInt("LOKI_MAX_DELIVERY_ATTEMPTS", 5),
+		MaxLineSize:                 env.getInt("LOKI_MAX_LINE_SIZE", 204800), // 200KB default
+		LogSource:                   strings.ToLower(env.getString("LOG_SOURCE", LogSourceTelemetry)),
+		AttributionWindow:           strings.ToLower(env.getString("LAMBDAWATCH_ATTRIBUTION_WINDOW", AttributionInvocation)),
+		TelemetryProtocol:           strings.ToUpper(env.getString("TELEMETRY_PROTOCOL", "HTTP")),
+		TelemetryPort:               env.getInt("TELEMETRY_PORT", 8080),
+		TelemetryPortProbe:          env.getInt("TELEMETRY_PORT_PROBE", 10),
+		TelemetryBufferMaxItems:     env.getInt("TELEMETRY_BUFFER_MAX_ITEMS", 1000),
+		TelemetryBufferMaxBytes:     env.getInt("TELEMETRY_BUFFER_MAX_BYTES", 262144),
+		TelemetryBufferTimeoutMs:    env.getInt("TELEMETRY_BUFFER_TIMEOUT_MS", 100),
+		TelemetryMaxBodyBytes:       env.getInt("TELEMETRY_MAX_BODY_BYTES", 4<<20), // 4MB default
+		ExtractRequestID:            env.getBool("LOKI_EXTRACT_REQUEST_ID", true),
+		ExtractTraceContext:         env.getBool("LOKI_EXTRACT_TRACE_CONTEXT", false),
+		GroupByRequestID:            env.getBool("LOKI_GROUP_BY_REQUEST_ID", false),
+		DedupRepeats:                env.getBool("LOKI_DEDUP_REPEATS", false),
+		TimestampOrdering:           strings.ToLower(env.getString("LOKI_TIMESTAMP_ORDERING", OrderingOff)),
+		ExtensionLogs:               strings.ToLower(env.getString("LOKI_EXTENSION_LOGS", ExtensionLogsStream)),
+		ReloadSource:                env.lookup("LAMBDAWATCH_RELOAD_SOURCE"),
+		ReloadIntervalMs:            env.getInt("LAMBDAWATCH_RELOAD_INTERVAL_MS", 60000),
+		DryRun:                      env.getBool("LOKI_DRY_RUN", false),
+		VerifyDelivery:              env.getBool("LOKI_VERIFY_DELIVERY", false),
+		Local:                       env.getBool("LAMBDAWATCH_LOCAL", false),
+		LocalInput:                  env.lookup("LAMBDAWATCH_LOCAL_INPUT"),
+		InvocationSummary:           env.getBool("LOKI_INVOCATION_SUMMARY", false),
+		ReportMetrics:               env.getBool("LOKI_REPORT_METRICS", false),
+		EndLines:                    env.getBool("LOKI_END_LINES", false),
+		AutoLabels:                  env.getBool("LOKI_AUTO_LABELS", false),
+		OTelResourceLabels:          env.getBool("LOKI_OTEL_RESOURCE_LABELS", false),
+		MaxLabels:                   env.getInt("LOKI_MAX_LABELS", 15),
+		MaxLabelValueLength:         env.getInt("LOKI_MAX_LABEL_VALUE_LENGTH", 2048),
+		MaxLabelValues:              env.getInt("LOKI_MAX_LABEL_VALUES", 0),
+		StreamRateLimit:             env.getFloat("LOKI_STREAM_RATE_LIMIT", 0),
+		StreamShards:                env.getInt("LOKI_STREAM_SHARDS", 1),
+		LogFilterExclude:            env.lookup("LOG_FILTER_EXCLUDE"),
+		LogFilterMinLevel:           env.lookup("LOG_FILTER_MIN_LEVEL"),
+		LogSampleRate:               env.getFloat("LOG_SAMPLE_RATE", 1),
+		TailSampleRate:              env.getFloat("LOKI_TAIL_SAMPLE_RATE", 1),
+		LogNormalizeJSON:            env.getBool("LOG_NORMALIZE_JSON", false),
+		LogBinaryBase64:             env.getBool("LOG_BINARY_BASE64", false),
+		WrapPlaintextJSON:           env.getBool("LOKI_WRAP_PLAINTEXT_JSON", false),
+		LogRedactBuiltin:            env.getBool("LOG_REDACT_BUILTIN", false),
+		Labels:                      make(map[string]string),
+	}
+
+	cfg.LokiEndpoints = splitList(env.lookup("LOKI_URL"))
+	if len(cfg.LokiEndpoints) > 0 {
+		cfg.LokiEndpoint = cfg.LokiEndpoints[0]
+	}
+
+	cfg.KafkaBrokers = splitList(env.lookup("KAFKA_BROKERS"))
+	cfg.ExtensionEvents = splitList(strings.ToUpper(env.getString("LAMBDAWATCH_EXTENSION_EVENTS", EventInvoke+","+EventShutdown)))
+	cfg.LabelAllowlist = splitList(env.lookup("LOKI_LABEL_ALLOWLIST"))
+	cfg.LabelDenylist = splitList(env.lookup("LOKI_LABEL_DENYLIST"))
+
+	// SHIP_EXTENSION_LOGS=false is shorthand for LOKI_EXTENSION_LOGS=off
+	if !env.getBool("SHIP_EXTENSION_LOGS", true) {
+		cfg.ExtensionLogs = ExtensionLogsOff
 	}
 
+	cfg.InjectRequestID = env.getBool("LOKI_INJECT_REQUEST_ID", cfg.ExtractRequestID)
+	cfg.StreamRateBurst = env.getInt("LOKI_STREAM_RATE_BURST", int(math.Ceil(cfg.StreamRateLimit)))
+
+	cfg.Compression = env.getCompression("LOKI_COMPRESSION", cfg.EnableGzip)
+
 	// Parse custom labels from JSON
-	if labelsJSON := os.Getenv("LOKI_LABELS"); labelsJSON != "" {
+	if labelsJSON := env.lookup("LOKI_LABELS"); labelsJSON != "" {
 		if err := json.Unmarshal([]byte(labelsJSON), &cfg.Labels); err != nil {
 			return nil, err
 		}
 	}
 
+	if headersJSON := env.lookup("LOKI_EXTRA_HEADERS"); headersJSON != "" {
+		if err := json.Unmarshal([]byte(headersJSON), &cfg.LokiExtraHeaders); err != nil {
+			return nil, fmt.Errorf("LOKI_EXTRA_HEADERS: %w", err)
+		}
+	}
+
+	// Parse redaction patterns from a JSON array
+	if patternsJSON := env.lookup("LOG_REDACT_PATTERNS"); patternsJSON != "" {
+		if err := json.Unmarshal([]byte(patternsJSON), &cfg.LogRedactPatterns); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := loadTLS(cfg, env); err != nil {
+		return nil, err
+	}
+
+	applyBasicAuth(cfg, env)
+
+	if err := applyGrafanaCloud(cfg, env); err != nil {
+		return nil, err
+	}
+
 	// Add service_name from SERVICE_NAME env var
-	if serviceName := os.Getenv("SERVICE_NAME"); serviceName != "" {
+	if serviceName := env.lookup("SERVICE_NAME"); serviceName != "" {
 		cfg.Labels["service_name"] = serviceName
 	}
 
+	if err := errors.Join(env.errs...); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg.Warnings = env.deprecationWarnings()
+
 	return cfg, nil
 }
 
-func getEnvInt(key string, defaultVal int) int {
-	if val := os.Getenv(key); val != "" {
-		if i, err := strconv.Atoi(val); err == nil {
-			return i
+// applyBasicAuth fills in LOKI_USERNAME/LOKI_PASSWORD from LOKI_BASIC_AUTH,
+// given as user:password. The value is never echoed in errors.
+func applyBasicAuth(cfg *Config, env *envReader) {
+	basic := env.lookup("LOKI_BASIC_AUTH")
+	if basic == "" {
+		return
+	}
+	user, password, ok := strings.Cut(basic, ":")
+	switch {
+	case !ok || user == "" || password == "":
+		env.errs = append(env.errs, errors.New("LOKI_BASIC_AUTH: must be user:password"))
+	case cfg.LokiUsername != "" || cfg.LokiPassword != "":
+		env.errs = append(env.errs, errors.New("LOKI_BASIC_AUTH cannot be combined with LOKI_USERNAME/LOKI_PASSWORD"))
+	default:
+		cfg.LokiUsername = user
+		cfg.LokiPassword = password
+	}
+}
+
+// AuthMode returns LOKI_AUTH_MODE, or when it is unset the mode implied by
+// the credentials: bearer with LOKI_API_KEY, basic with a username, else none
+func (c *Config) AuthMode() string {
+	switch {
+	case c.LokiAuthMode != "":
+		return c.LokiAuthMode
+	case c.LokiAPIKey != "":
+		return AuthModeBearer
+	case c.LokiUsername != "":
+		return AuthModeBasic
+	default:
+		return AuthModeNone
+	}
+}
+
+// RegistersInvoke reports whether the extension registers for INVOKE events
+func (c *Config) RegistersInvoke() bool {
+	for _, e := range c.ExtensionEvents {
+		if e == EventInvoke {
+			return true
 		}
 	}
-	return defaultVal
+	return false
+}
+
+// splitList splits a comma-separated value, trimming spaces and dropping empties
+func splitList(val string) []string {
+	var out []string
+	for _, part := range strings.Split(val, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// envReader reads typed environment variables, falling back to the config
+// file, and collects a parse error for every value that is set but
+// malformed instead of silently using the default
+type envReader struct {
+	file       map[string]string
+	errs       []error
+	deprecated map[string]bool // generic names read from the environment
 }
 
-func getEnvBool(key string, defaultVal bool) bool {
+// lookup returns the value for key, in order of precedence: the prefixed
+// environment variable, the plain one, then the config file's prefixed and
+// plain keys
+func (e *envReader) lookup(key string) string {
+	name := prefixed(key)
+	if val := os.Getenv(name); val != "" {
+		return val
+	}
 	if val := os.Getenv(key); val != "" {
-		if b, err := strconv.ParseBool(val); err == nil {
-			return b
+		if ambiguous(key) {
+			if e.deprecated == nil {
+				e.deprecated = make(map[string]bool)
+			}
+			e.deprecated[key] = true
 		}
+		return val
+	}
+	if val := e.file[name]; val != "" {
+		return val
+	}
+	return e.file[key]
+}
+
+// prefixed returns the LambdaWatch-specific name of a setting
+func prefixed(key string) string {
+	if strings.HasPrefix(key, envPrefix) {
+		return key
+	}
+	return envPrefix + key
+}
+
+// ambiguous reports whether key is a generic name, such as BUFFER_SIZE,
+// that a function may well use for its own purposes. SERVICE_NAME is meant
+// to be shared with the function and is not.
+func ambiguous(key string) bool {
+	for _, p := range []string{envPrefix, "LOKI_", "GRAFANA_CLOUD_"} {
+		if strings.HasPrefix(key, p) {
+			return false
+		}
+	}
+	return key != "SERVICE_NAME"
+}
+
+// deprecationWarnings returns a notice per generic name read from the
+// environment, in name order
+func (e *envReader) deprecationWarnings() []string {
+	var warnings []string
+	for key := range e.deprecated {
+		warnings = append(warnings, fmt.Sprintf("%s is deprecated; set %s instead", key, prefixed(key)))
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+func (e *envReader) fail(key, val, want string) {
+	e.errs = append(e.errs, fmt.Errorf("%s: %q is not a valid %s", key, val, want))
+}
+
+func (e *envReader) getString(key, defaultVal string) string {
+	if val := e.lookup(key); val != "" {
+		return val
 	}
 	return defaultVal
 }
+
+func (e *envReader) getInt(key string, defaultVal int) int {
+	val := e.lookup(key)
+	if val == "" {
+		return defaultVal
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		e.fail(key, val, "integer")
+		return defaultVal
+	}
+	return i
+}
+
+// getCompression reads the compression codec, defaulting to gzip or none
+// based on the legacy LOKI_ENABLE_GZIP flag when unset.
+func (e *envReader) getCompression(key string, enableGzip bool) string {
+	switch val := strings.ToLower(e.lookup(key)); val {
+	case CompressionGzip, CompressionNone:
+		return val
+	case "":
+	case "zstd", "snappy":
+		e.fail(key, val, "codec for Loki's JSON push endpoint, which only decodes gzip (gzip or none)")
+	default:
+		e.fail(key, val, "codec (gzip or none)")
+	}
+	if enableGzip {
+		return CompressionGzip
+	}
+	return CompressionNone
+}
+
+func (e *envReader) getFloat(key string, defaultVal float64) float64 {
+	val := e.lookup(key)
+	if val == "" {
+		return defaultVal
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		e.fail(key, val, "number")
+		return defaultVal
+	}
+	return f
+}
+
+func (e *envReader) getBool(key string, defaultVal bool) bool {
+	val := e.lookup(key)
+	if val == "" {
+		return defaultVal
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		e.fail(key, val, "boolean")
+		return defaultVal
+	}
+	return b
+}
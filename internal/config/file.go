@@ -0,0 +1,85 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFileEnv names an explicit config file; otherwise the first of
+// defaultConfigFiles that exists is used
+const configFileEnv = "LAMBDAWATCH_CONFIG_FILE"
+
+// defaultConfigFiles are where a layer ships its config (layers unpack to /opt)
+var defaultConfigFiles = []string{
+	"/opt/lambdawatch.yaml",
+	"/opt/lambdawatch.yml",
+	"/opt/lambdawatch.json",
+}
+
+// loadConfigFile reads the optional YAML or JSON config file. Keys are the
+// environment variable names (case-insensitive); environment variables
+// override file values. Nested values such as LOKI_LABELS may be written as
+// maps or lists and are passed on as JSON.
+func loadConfigFile() (map[string]string, error) {
+	path, explicit := os.LookupEnv(configFileEnv)
+	if !explicit || path == "" {
+		explicit = false
+		for _, candidate := range defaultConfigFiles {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+	}
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s: %w", configFileEnv, err)
+	}
+
+	values, err := ParseValues(data)
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// ParseValues decodes a YAML or JSON document of environment-variable-named
+// settings into string values as they would appear in the environment
+func ParseValues(data []byte) (map[string]string, error) {
+	// YAML is a superset of JSON, so one decoder handles both formats
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, val := range raw {
+		switch v := val.(type) {
+		case nil:
+			continue
+		case string:
+			values[strings.ToUpper(key)] = v
+		case map[string]interface{}, []interface{}:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			values[strings.ToUpper(key)] = string(encoded)
+		default:
+			values[strings.ToUpper(key)] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeConfigFile writes content to a temp file and points LAMBDAWATCH_CONFIG_FILE at it
+func writeConfigFile(t *testing.T, name, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	setEnv(t, configFileEnv, path)
+}
+
+func TestLoad_YAMLConfigFile(t *testing.T) {
+	clearAllEnvVars(t)
+	writeConfigFile(t, "lambdawatch.yaml", `
+LOKI_URL: https://loki.example.com/loki/api/v1/push
+loki_batch_size: 250
+LOKI_ENABLE_GZIP: false
+LOG_SAMPLE_RATE: 0.5
+LOKI_LABELS:
+  env: prod
+  team: payments
+LOG_REDACT_PATTERNS:
+  - "ssn=\\d+"
+`)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.LokiEndpoint != "https://loki.example.com/loki/api/v1/push" {
+		t.Errorf("LokiEndpoint = %q", cfg.LokiEndpoint)
+	}
+	if cfg.BatchSize != 250 {
+		t.Errorf("BatchSize = %d, want 250", cfg.BatchSize)
+	}
+	if cfg.EnableGzip || cfg.Compression != CompressionNone {
+		t.Errorf("EnableGzip = %v, Compression = %q, want false/none", cfg.EnableGzip, cfg.Compression)
+	}
+	if cfg.LogSampleRate != 0.5 {
+		t.Errorf("LogSampleRate = %v, want 0.5", cfg.LogSampleRate)
+	}
+	if cfg.Labels["env"] != "prod" || cfg.Labels["team"] != "payments" {
+		t.Errorf("Labels = %v", cfg.Labels)
+	}
+	if len(cfg.LogRedactPatterns) != 1 || cfg.LogRedactPatterns[0] != `ssn=\d+` {
+		t.Errorf("LogRedactPatterns = %v", cfg.LogRedactPatterns)
+	}
+}
+
+func TestLoad_JSONConfigFile(t *testing.T) {
+	clearAllEnvVars(t)
+	writeConfigFile(t, "lambdawatch.json", `{"LOKI_URL": "https://loki.example.com", "BUFFER_SIZE": 500}`)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.BufferSize != 500 {
+		t.Errorf("BufferSize = %d, want 500", cfg.BufferSize)
+	}
+}
+
+func TestLoad_EnvOverridesConfigFile(t *testing.T) {
+	clearAllEnvVars(t)
+	writeConfigFile(t, "lambdawatch.yaml", "LOKI_URL: https://file.example.com\nLOKI_BATCH_SIZE: 250\n")
+	setEnv(t, "LOKI_BATCH_SIZE", "50")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.BatchSize != 50 {
+		t.Errorf("BatchSize = %d, want env value 50", cfg.BatchSize)
+	}
+	if cfg.LokiEndpoint != "https://file.example.com" {
+		t.Errorf("LokiEndpoint = %q, want file value", cfg.LokiEndpoint)
+	}
+}
+
+func TestLoad_ConfigFileErrors(t *testing.T) {
+	clearAllEnvVars(t)
+	setEnv(t, configFileEnv, "/nonexistent/lambdawatch.yaml")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for missing explicit config file")
+	}
+
+	writeConfigFile(t, "bad.yaml", "LOKI_URL: [unclosed\n")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for malformed config file")
+	}
+
+	writeConfigFile(t, "typo.yaml", "LOKI_URL: https://loki.example.com\nLOKI_FLUSH_INTERVAL_MS: fast\n")
+	if _, err := Load(); err == nil {
+		t.Error("expected validation error for malformed file value")
+	}
+}
+
+// Prefixed keys win within the config file too, but the environment wins over both
+func TestLoad_PrefixedConfigFileKeys(t *testing.T) {
+	clearAllEnvVars(t)
+	writeConfigFile(t, "lambdawatch.yaml", `
+LOKI_URL: https://loki.example.com
+BUFFER_SIZE: 100
+LAMBDAWATCH_BUFFER_SIZE: 300
+`)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.BufferSize != 300 {
+		t.Errorf("BufferSize = %d, want 300 from the prefixed key", cfg.BufferSize)
+	}
+	if len(cfg.Warnings) != 0 {
+		t.Errorf("file keys should not be reported as deprecated: %v", cfg.Warnings)
+	}
+
+	setEnv(t, "BUFFER_SIZE", "700")
+	if cfg, _ = Load(); cfg.BufferSize != 700 {
+		t.Errorf("BufferSize = %d, want 700 from the environment", cfg.BufferSize)
+	}
+}
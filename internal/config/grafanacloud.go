@@ -0,0 +1,56 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// grafanaCloudPushPath is appended to GRAFANA_CLOUD_LOGS_HOST
+const grafanaCloudPushPath = "/loki/api/v1/push"
+
+// applyGrafanaCloud fills in the Loki URL and basic auth from the Grafana
+// Cloud shortcut variables. Grafana Cloud derives the tenant from the
+// basic-auth user, so no org ID header is needed.
+func applyGrafanaCloud(cfg *Config, env *envReader) error {
+	user := env.lookup("GRAFANA_CLOUD_LOGS_USER")
+	apiKey := env.lookup("GRAFANA_CLOUD_API_KEY")
+	host := env.lookup("GRAFANA_CLOUD_LOGS_HOST")
+	if user == "" && apiKey == "" && host == "" {
+		return nil
+	}
+
+	var errs []error
+	if user == "" || apiKey == "" || host == "" {
+		errs = append(errs, errors.New("GRAFANA_CLOUD_LOGS_USER, GRAFANA_CLOUD_API_KEY and GRAFANA_CLOUD_LOGS_HOST must be set together"))
+	}
+	if user != "" && strings.Trim(user, "0123456789") != "" {
+		errs = append(errs, fmt.Errorf("GRAFANA_CLOUD_LOGS_USER: %q is not a numeric user ID (see the Loki data source details of your stack)", user))
+	}
+	if len(cfg.LokiEndpoints) > 0 {
+		errs = append(errs, errors.New("LOKI_URL cannot be combined with the GRAFANA_CLOUD_* variables"))
+	}
+	if cfg.LokiUsername != "" || cfg.LokiPassword != "" || cfg.LokiAPIKey != "" {
+		errs = append(errs, errors.New("LOKI_USERNAME/LOKI_PASSWORD/LOKI_API_KEY cannot be combined with the GRAFANA_CLOUD_* variables"))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	cfg.LokiEndpoint = grafanaCloudURL(host)
+	cfg.LokiEndpoints = []string{cfg.LokiEndpoint}
+	cfg.LokiUsername = user
+	cfg.LokiPassword = apiKey
+	return nil
+}
+
+// grafanaCloudURL builds the push URL from a host such as
+// logs-prod-006.grafana.net, tolerating a scheme, trailing slash or the
+// full push path
+func grafanaCloudURL(host string) string {
+	host = strings.TrimPrefix(host, "https://")
+	host = strings.TrimPrefix(host, "http://")
+	host = strings.TrimSuffix(host, "/")
+	host = strings.TrimSuffix(host, grafanaCloudPushPath)
+	return "https://" + host + grafanaCloudPushPath
+}
@@ -0,0 +1,68 @@
+package config
+
+import "testing"
+
+func TestLoad_GrafanaCloudShortcut(t *testing.T) {
+	clearAllEnvVars(t)
+	setEnv(t, "GRAFANA_CLOUD_LOGS_USER", "123456")
+	setEnv(t, "GRAFANA_CLOUD_API_KEY", "glc_secret")
+	setEnv(t, "GRAFANA_CLOUD_LOGS_HOST", "logs-prod-006.grafana.net")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.LokiEndpoint != "https://logs-prod-006.grafana.net/loki/api/v1/push" {
+		t.Errorf("LokiEndpoint = %q", cfg.LokiEndpoint)
+	}
+	if cfg.LokiUsername != "123456" || cfg.LokiPassword != "glc_secret" {
+		t.Errorf("basic auth = %q/%q", cfg.LokiUsername, cfg.LokiPassword)
+	}
+	if cfg.LokiTenantID != "" {
+		t.Errorf("LokiTenantID = %q, want none for Grafana Cloud", cfg.LokiTenantID)
+	}
+}
+
+func TestGrafanaCloudURL(t *testing.T) {
+	want := "https://logs-prod-eu-west-0.grafana.net/loki/api/v1/push"
+	for _, host := range []string{
+		"logs-prod-eu-west-0.grafana.net",
+		"https://logs-prod-eu-west-0.grafana.net",
+		"https://logs-prod-eu-west-0.grafana.net/",
+		"https://logs-prod-eu-west-0.grafana.net/loki/api/v1/push",
+	} {
+		if got := grafanaCloudURL(host); got != want {
+			t.Errorf("grafanaCloudURL(%q) = %q", host, got)
+		}
+	}
+}
+
+func TestLoad_GrafanaCloudMisconfigured(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"missing host", map[string]string{
+			"GRAFANA_CLOUD_LOGS_USER": "123456", "GRAFANA_CLOUD_API_KEY": "key"}},
+		{"non-numeric user", map[string]string{
+			"GRAFANA_CLOUD_LOGS_USER": "mystack", "GRAFANA_CLOUD_API_KEY": "key",
+			"GRAFANA_CLOUD_LOGS_HOST": "logs-prod-006.grafana.net"}},
+		{"combined with LOKI_URL", map[string]string{
+			"GRAFANA_CLOUD_LOGS_USER": "123456", "GRAFANA_CLOUD_API_KEY": "key",
+			"GRAFANA_CLOUD_LOGS_HOST": "logs-prod-006.grafana.net", "LOKI_URL": "https://loki.example.com"}},
+		{"combined with LOKI_API_KEY", map[string]string{
+			"GRAFANA_CLOUD_LOGS_USER": "123456", "GRAFANA_CLOUD_API_KEY": "key",
+			"GRAFANA_CLOUD_LOGS_HOST": "logs-prod-006.grafana.net", "LOKI_API_KEY": "token"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearAllEnvVars(t)
+			for k, v := range tt.env {
+				setEnv(t, k, v)
+			}
+			if _, err := Load(); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// ReloadableKeys are the settings that may change between invocations
+var ReloadableKeys = []string{"LOKI_LABELS", "LOG_FILTER_EXCLUDE", "LOG_FILTER_MIN_LEVEL", "LOG_SAMPLE_RATE"}
+
+// WithReloaded returns a copy of c with the reloadable settings present in
+// values applied. Settings absent from values keep their current value.
+// Reloaded values win over the environment, since the point of reloading
+// is to change behaviour without redeploying.
+func (c *Config) WithReloaded(values map[string]string) (*Config, error) {
+	next := *c
+
+	if labelsJSON, ok := values["LOKI_LABELS"]; ok {
+		labels := make(map[string]string)
+		if labelsJSON != "" {
+			if err := json.Unmarshal([]byte(labelsJSON), &labels); err != nil {
+				return nil, fmt.Errorf("LOKI_LABELS: %w", err)
+			}
+		}
+		// Read SERVICE_NAME as Load does, prefix and config file included
+		file, err := loadConfigFile()
+		if err != nil {
+			return nil, err
+		}
+		env := &envReader{file: file}
+		if serviceName := env.lookup("SERVICE_NAME"); serviceName != "" {
+			labels["service_name"] = serviceName
+		}
+		next.Labels = labels
+	}
+	if v, ok := values["LOG_FILTER_EXCLUDE"]; ok {
+		next.LogFilterExclude = v
+	}
+	if v, ok := values["LOG_FILTER_MIN_LEVEL"]; ok {
+		next.LogFilterMinLevel = v
+	}
+	if v, ok := values["LOG_SAMPLE_RATE"]; ok {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("LOG_SAMPLE_RATE: %q is not a valid number", v)
+		}
+		next.LogSampleRate = rate
+	}
+
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
@@ -0,0 +1,92 @@
+package config
+
+import "testing"
+
+func TestWithReloaded_AppliesPresentKeys(t *testing.T) {
+	clearAllEnvVars(t)
+	setEnv(t, "LOKI_URL", "https://loki.example.com")
+	setEnv(t, "LOG_FILTER_MIN_LEVEL", "warn")
+	setEnv(t, "LOG_SAMPLE_RATE", "0.1")
+	base, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	next, err := base.WithReloaded(map[string]string{
+		"LOG_SAMPLE_RATE": "1",
+		"LOKI_LABELS":     `{"incident":"INC-42"}`,
+	})
+	if err != nil {
+		t.Fatalf("WithReloaded() error = %v", err)
+	}
+	if next.LogSampleRate != 1 {
+		t.Errorf("LogSampleRate = %v, want reloaded 1", next.LogSampleRate)
+	}
+	if next.LogFilterMinLevel != "warn" {
+		t.Errorf("LogFilterMinLevel = %q, want unchanged warn", next.LogFilterMinLevel)
+	}
+	if next.Labels["incident"] != "INC-42" {
+		t.Errorf("Labels = %v", next.Labels)
+	}
+	if base.LogSampleRate != 0.1 {
+		t.Error("WithReloaded must not modify the original config")
+	}
+}
+
+// Reloaded labels keep the service_name Load found, from the prefixed name
+// as from any other
+func TestWithReloaded_KeepsPrefixedServiceName(t *testing.T) {
+	clearAllEnvVars(t)
+	setEnv(t, "LOKI_URL", "https://loki.example.com")
+	setEnv(t, "LAMBDAWATCH_SERVICE_NAME", "orders")
+	base, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	next, err := base.WithReloaded(map[string]string{"LOKI_LABELS": `{"team":"payments"}`})
+	if err != nil {
+		t.Fatalf("WithReloaded() error = %v", err)
+	}
+	if next.Labels["service_name"] != base.Labels["service_name"] || next.Labels["service_name"] != "orders" {
+		t.Errorf("service_name = %q after reload, want %q as loaded", next.Labels["service_name"], base.Labels["service_name"])
+	}
+}
+
+func TestWithReloaded_RejectsInvalid(t *testing.T) {
+	clearAllEnvVars(t)
+	setEnv(t, "LOKI_URL", "https://loki.example.com")
+	base, _ := Load()
+
+	for _, values := range []map[string]string{
+		{"LOG_SAMPLE_RATE": "lots"},
+		{"LOG_SAMPLE_RATE": "3"},
+		{"LOKI_LABELS": "not json"},
+	} {
+		if _, err := base.WithReloaded(values); err == nil {
+			t.Errorf("WithReloaded(%v) expected error", values)
+		}
+	}
+}
+
+func TestLoad_ReloadSettings(t *testing.T) {
+	clearAllEnvVars(t)
+	setEnv(t, "LOKI_URL", "https://loki.example.com")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.ReloadSource != "" || cfg.ReloadIntervalMs != 60000 {
+		t.Errorf("defaults = (%q, %d), want (\"\", 60000)", cfg.ReloadSource, cfg.ReloadIntervalMs)
+	}
+
+	setEnv(t, "LAMBDAWATCH_RELOAD_SOURCE", "ssm:/lambdawatch/fn")
+	setEnv(t, "LAMBDAWATCH_RELOAD_INTERVAL_MS", "5000")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.ReloadSource != "ssm:/lambdawatch/fn" || cfg.ReloadIntervalMs != 5000 {
+		t.Errorf("got (%q, %d)", cfg.ReloadSource, cfg.ReloadIntervalMs)
+	}
+}
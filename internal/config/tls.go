@@ -0,0 +1,62 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// loadTLS reads the Loki client TLS material from files or base64 env
+// variants and checks it parses, so a bad certificate fails at startup
+// instead of on the first push.
+func loadTLS(cfg *Config, env *envReader) error {
+	var err error
+	if cfg.LokiTLSCA, err = env.getPEM("LOKI_TLS_CA_FILE", "LOKI_TLS_CA_BASE64"); err != nil {
+		return err
+	}
+	if cfg.LokiTLSCert, err = env.getPEM("LOKI_TLS_CERT", "LOKI_TLS_CERT_BASE64"); err != nil {
+		return err
+	}
+	if cfg.LokiTLSKey, err = env.getPEM("LOKI_TLS_KEY", "LOKI_TLS_KEY_BASE64"); err != nil {
+		return err
+	}
+
+	if len(cfg.LokiTLSCA) > 0 {
+		if !x509.NewCertPool().AppendCertsFromPEM(cfg.LokiTLSCA) {
+			return errors.New("LOKI_TLS_CA: no valid PEM certificates found")
+		}
+	}
+
+	if (len(cfg.LokiTLSCert) > 0) != (len(cfg.LokiTLSKey) > 0) {
+		return errors.New("LOKI_TLS_CERT and LOKI_TLS_KEY must be set together")
+	}
+	if len(cfg.LokiTLSCert) > 0 {
+		if _, err := tls.X509KeyPair(cfg.LokiTLSCert, cfg.LokiTLSKey); err != nil {
+			return fmt.Errorf("invalid Loki client certificate: %w", err)
+		}
+	}
+	return nil
+}
+
+// getPEM returns PEM data from the file named by fileKey, or decoded from
+// the base64 value of b64Key. The file takes precedence.
+func (e *envReader) getPEM(fileKey, b64Key string) ([]byte, error) {
+	if path := e.lookup(fileKey); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fileKey, err)
+		}
+		return data, nil
+	}
+	if val := e.lookup(b64Key); val != "" {
+		data, err := base64.StdEncoding.DecodeString(val)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", b64Key, err)
+		}
+		return data, nil
+	}
+	return nil, nil
+}
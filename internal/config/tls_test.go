@@ -0,0 +1,110 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestCert returns a self-signed certificate and key as PEM
+func newTestCert(t *testing.T) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestLoad_TLSFromFiles(t *testing.T) {
+	clearAllEnvVars(t)
+	setEnv(t, "LOKI_URL", "https://loki.example.com")
+
+	certPEM, keyPEM := newTestCert(t)
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "client.crt")
+	keyPath := filepath.Join(dir, "client.key")
+	_ = os.WriteFile(certPath, certPEM, 0o600)
+	_ = os.WriteFile(keyPath, keyPEM, 0o600)
+
+	setEnv(t, "LOKI_TLS_CA_FILE", certPath)
+	setEnv(t, "LOKI_TLS_CERT", certPath)
+	setEnv(t, "LOKI_TLS_KEY", keyPath)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if string(cfg.LokiTLSCA) != string(certPEM) || string(cfg.LokiTLSKey) != string(keyPEM) {
+		t.Error("expected TLS material read from files")
+	}
+}
+
+func TestLoad_TLSFromBase64(t *testing.T) {
+	clearAllEnvVars(t)
+	setEnv(t, "LOKI_URL", "https://loki.example.com")
+
+	certPEM, keyPEM := newTestCert(t)
+	setEnv(t, "LOKI_TLS_CERT_BASE64", base64.StdEncoding.EncodeToString(certPEM))
+	setEnv(t, "LOKI_TLS_KEY_BASE64", base64.StdEncoding.EncodeToString(keyPEM))
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if string(cfg.LokiTLSCert) != string(certPEM) {
+		t.Error("expected client certificate decoded from base64")
+	}
+	if cfg.LokiTLSCA != nil {
+		t.Error("expected no custom CA")
+	}
+}
+
+func TestLoad_TLSErrors(t *testing.T) {
+	certPEM, _ := newTestCert(t)
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"missing file", map[string]string{"LOKI_TLS_CA_FILE": "/nonexistent/ca.pem"}},
+		{"invalid base64", map[string]string{"LOKI_TLS_CA_BASE64": "not base64!"}},
+		{"CA without certificates", map[string]string{"LOKI_TLS_CA_BASE64": base64.StdEncoding.EncodeToString([]byte("junk"))}},
+		{"cert without key", map[string]string{"LOKI_TLS_CERT_BASE64": base64.StdEncoding.EncodeToString(certPEM)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearAllEnvVars(t)
+			setEnv(t, "LOKI_URL", "https://loki.example.com")
+			for k, v := range tt.env {
+				setEnv(t, k, v)
+			}
+			if _, err := Load(); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// reservedHeaders describe the push body and cannot be set through
+// LOKI_EXTRA_HEADERS
+var reservedHeaders = map[string]bool{
+	"Content-Type":     true,
+	"Content-Encoding": true,
+	"Content-Length":   true,
+	"Host":             true,
+}
+
+// Validate reports every invalid setting at once, naming the environment
+// variable to fix
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	for _, endpoint := range c.LokiEndpoints {
+		check(validURL(endpoint), "LOKI_URL: %q is not an absolute http(s) URL", RedactURL(endpoint))
+	}
+
+	// The credentials set must be the ones LOKI_AUTH_MODE uses, so no
+	// setting is silently ignored in favour of another
+	mode := c.AuthMode()
+	basic := c.LokiUsername != "" || c.LokiPassword != ""
+	check(c.LokiAPIKey == "" || !basic,
+		"LOKI_API_KEY and LOKI_USERNAME/LOKI_PASSWORD are mutually exclusive")
+	check((c.LokiUsername == "") == (c.LokiPassword == ""),
+		"LOKI_USERNAME and LOKI_PASSWORD must be set together")
+	check(c.LokiAuthHeader == "" || mode == AuthModeHeader,
+		"LOKI_AUTH_HEADER: only used with LOKI_AUTH_MODE=%s", AuthModeHeader)
+
+	authHeader := ""
+	switch mode {
+	case AuthModeNone:
+		check(c.LokiAPIKey == "" && !basic,
+			"LOKI_AUTH_MODE=none cannot be combined with LOKI_API_KEY or basic auth")
+	case AuthModeBasic:
+		check(c.LokiUsername != "", "LOKI_AUTH_MODE=basic: LOKI_USERNAME and LOKI_PASSWORD are required")
+		authHeader = "Authorization"
+	case AuthModeBearer:
+		check(c.LokiAPIKey != "", "LOKI_AUTH_MODE=bearer: LOKI_API_KEY is required")
+		authHeader = "Authorization"
+	case AuthModeHeader:
+		check(c.LokiAPIKey != "", "LOKI_AUTH_MODE=custom-header: LOKI_API_KEY is required")
+		check(!basic, "LOKI_AUTH_MODE=custom-header cannot be combined with basic auth")
+		check(validHeaderName(c.LokiAuthHeader), "LOKI_AUTH_HEADER: %q is not a valid header name", c.LokiAuthHeader)
+		check(!reservedHeaders[http.CanonicalHeaderKey(c.LokiAuthHeader)] && http.CanonicalHeaderKey(c.LokiAuthHeader) != "X-Scope-Orgid",
+			"LOKI_AUTH_HEADER: %q is set by the extension", c.LokiAuthHeader)
+		authHeader = c.LokiAuthHeader
+	case AuthModeSigV4:
+		check(c.LokiAPIKey == "" && !basic,
+			"LOKI_AUTH_MODE=sigv4 cannot be combined with LOKI_API_KEY or basic auth")
+		check(c.LokiSigV4Region != "", "LOKI_SIGV4_REGION: must be set when AWS_REGION is not")
+		authHeader = "Authorization"
+	default:
+		check(false, "LOKI_AUTH_MODE: unknown mode %q (want none, basic, bearer, custom-header or sigv4)", c.LokiAuthMode)
+	}
+
+	for name := range c.LokiExtraHeaders {
+		check(validHeaderName(name), "LOKI_EXTRA_HEADERS: %q is not a valid header name", name)
+		check(!reservedHeaders[http.CanonicalHeaderKey(name)], "LOKI_EXTRA_HEADERS: %q is set by the extension and cannot be overridden", name)
+		// Extra headers used to override the credentials; rather than let
+		// either silently win, the auth header can only be set one way
+		check(authHeader == "" || http.CanonicalHeaderKey(name) != http.CanonicalHeaderKey(authHeader),
+			"LOKI_EXTRA_HEADERS: %q conflicts with LOKI_AUTH_MODE=%s, which sets it; remove it, or remove the mode's credentials to send it as given", name, mode)
+	}
+
+	check(c.BatchSize > 0, "LOKI_BATCH_SIZE: must be positive, got %d", c.BatchSize)
+	check(c.MaxBatchSizeBytes >= 0, "LOKI_MAX_BATCH_SIZE_BYTES: must not be negative, got %d", c.MaxBatchSizeBytes)
+	check(c.FlushIntervalMs > 0, "LOKI_FLUSH_INTERVAL_MS: must be positive, got %d", c.FlushIntervalMs)
+	check(c.IdleFlushMultiplier > 0, "LOKI_IDLE_FLUSH_MULTIPLIER: must be positive, got %d", c.IdleFlushMultiplier)
+	check(c.FlushWorkers > 0, "LOKI_FLUSH_WORKERS: must be positive, got %d", c.FlushWorkers)
+	check(c.PostInvokeWindowMs >= 0, "LOKI_POST_INVOKE_WINDOW_MS: must not be negative, got %d", c.PostInvokeWindowMs)
+	if c.AdaptiveBatchSize {
+		check(c.MinBatchSize > 0 && c.MinBatchSize <= c.MaxBatchSize,
+			"LOKI_MIN_BATCH_SIZE/LOKI_MAX_BATCH_SIZE: need 0 < min <= max, got %d and %d", c.MinBatchSize, c.MaxBatchSize)
+	}
+	check(c.MaxRetries >= 0, "LOKI_MAX_RETRIES: must not be negative, got %d", c.MaxRetries)
+	check(c.CriticalFlushRetries >= 0, "LOKI_CRITICAL_FLUSH_RETRIES: must not be negative, got %d", c.CriticalFlushRetries)
+	check(c.RetryMaxBackoffMs >= 0, "LOKI_RETRY_MAX_BACKOFF_MS: must not be negative, got %d", c.RetryMaxBackoffMs)
+	check(c.RetryMaxElapsedMs >= 0, "LOKI_RETRY_MAX_ELAPSED_MS: must not be negative, got %d", c.RetryMaxElapsedMs)
+	check(c.SpoolMaxBytes >= 0, "LOKI_SPOOL_MAX_BYTES: must not be negative, got %d", c.SpoolMaxBytes)
+	check(c.SpoolMaxAgeMs >= 0, "LOKI_SPOOL_MAX_AGE_MS: must not be negative, got %d", c.SpoolMaxAgeMs)
+	check(c.LokiHTTPTimeoutMs > 0, "LOKI_HTTP_TIMEOUT_MS: must be positive, got %d", c.LokiHTTPTimeoutMs)
+
+	check(c.BufferSize > 0, "BUFFER_SIZE: must be positive, got %d", c.BufferSize)
+	check(c.BufferMaxBytes >= 0, "BUFFER_MAX_BYTES: must not be negative, got %d", c.BufferMaxBytes)
+	switch c.BufferOverflowPolicy {
+	case "drop-oldest", "drop-newest", "block-with-timeout":
+	default:
+		check(false, "BUFFER_OVERFLOW_POLICY: unknown policy %q", c.BufferOverflowPolicy)
+	}
+	check(c.MaxDeliveryAttempts >= 0, "LOKI_MAX_DELIVERY_ATTEMPTS: must not be negative, got %d", c.MaxDeliveryAttempts)
+	check(c.MaxEntryAgeMs >= 0, "MAX_ENTRY_AGE_MS: must not be negative, got %d", c.MaxEntryAgeMs)
+	switch c.TimestampOrdering {
+	case "", OrderingOff, OrderingClamp, OrderingSort:
+	default:
+		check(false, "LOKI_TIMESTAMP_ORDERING: must be off, clamp or sort, got %q", c.TimestampOrdering)
+	}
+	switch c.InflightFlushPolicy {
+	case InflightFlushContinue, InflightFlushCancel:
+	default:
+		check(false, "LOKI_INFLIGHT_FLUSH_POLICY: must be continue or cancel, got %q", c.InflightFlushPolicy)
+	}
+	switch c.ExtensionLogs {
+	case ExtensionLogsStream, ExtensionLogsMixed, ExtensionLogsOff:
+	default:
+		check(false, "LOKI_EXTENSION_LOGS: must be stream, mixed or off, got %q", c.ExtensionLogs)
+	}
+	check(c.MaxLineSize >= 0, "LOKI_MAX_LINE_SIZE: must not be negative, got %d", c.MaxLineSize)
+
+	check(c.LogSampleRate >= 0 && c.LogSampleRate <= 1, "LOG_SAMPLE_RATE: must be between 0 and 1, got %v", c.LogSampleRate)
+	check(c.TailSampleRate >= 0 && c.TailSampleRate <= 1, "LOKI_TAIL_SAMPLE_RATE: must be between 0 and 1, got %v", c.TailSampleRate)
+	check(c.LogSource == LogSourceTelemetry || c.LogSource == LogSourceLogsAPI,
+		"LOG_SOURCE: must be telemetry or logsapi, got %q", c.LogSource)
+	check(c.AttributionWindow == AttributionInvocation || c.AttributionWindow == AttributionSticky,
+		"LAMBDAWATCH_ATTRIBUTION_WINDOW: must be invocation or sticky, got %q", c.AttributionWindow)
+	shutdown := false
+	for _, e := range c.ExtensionEvents {
+		switch e {
+		case EventInvoke:
+		case EventShutdown:
+			shutdown = true
+		default:
+			check(false, "LAMBDAWATCH_EXTENSION_EVENTS: unknown event %q", e)
+		}
+	}
+	check(shutdown, "LAMBDAWATCH_EXTENSION_EVENTS: must include SHUTDOWN, got %q", strings.Join(c.ExtensionEvents, ","))
+	check(!c.FlushOnlyOnInvoke || c.RegistersInvoke(),
+		"LOKI_FLUSH_ONLY_ON_INVOKE: requires INVOKE in LAMBDAWATCH_EXTENSION_EVENTS")
+	check(c.TelemetryProtocol == "HTTP" || c.TelemetryProtocol == "TCP",
+		"TELEMETRY_PROTOCOL: must be HTTP or TCP, got %q", c.TelemetryProtocol)
+	check(c.TelemetryPort > 0 && c.TelemetryPort <= 65535, "TELEMETRY_PORT: must be between 1 and 65535, got %d", c.TelemetryPort)
+	check(c.TelemetryPortProbe >= 0 && c.TelemetryPort+c.TelemetryPortProbe <= 65535,
+		"TELEMETRY_PORT_PROBE: must not be negative or probe past port 65535, got %d", c.TelemetryPortProbe)
+	check(c.TelemetryMaxBodyBytes >= 0, "TELEMETRY_MAX_BODY_BYTES: must not be negative, got %d", c.TelemetryMaxBodyBytes)
+	if len(c.KafkaBrokers) > 0 {
+		check(c.KafkaTopic != "", "KAFKA_TOPIC: required when KAFKA_BROKERS is set")
+		switch c.KafkaSASLMechanism {
+		case "", "AWS_MSK_IAM":
+		case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+			check(c.KafkaUsername != "" && c.KafkaPassword != "",
+				"KAFKA_USERNAME and KAFKA_PASSWORD are required for %s", c.KafkaSASLMechanism)
+		default:
+			check(false, "KAFKA_SASL_MECHANISM: unknown mechanism %q", c.KafkaSASLMechanism)
+		}
+	}
+	if c.LokiProxyURL != "" {
+		check(validURL(c.LokiProxyURL), "LOKI_PROXY_URL: %q is not an absolute http(s) URL", RedactURL(c.LokiProxyURL))
+	}
+	if c.FailureWebhookURL != "" {
+		check(validURL(c.FailureWebhookURL), "LOKI_FAILURE_WEBHOOK_URL: %q is not an absolute http(s) URL", RedactURL(c.FailureWebhookURL))
+	}
+	if c.PromRemoteWriteURL != "" {
+		check(validURL(c.PromRemoteWriteURL), "PROM_REMOTE_WRITE_URL: %q is not an absolute http(s) URL", RedactURL(c.PromRemoteWriteURL))
+	}
+	check(c.PromRemoteWriteIntervalMs >= 0, "PROM_REMOTE_WRITE_INTERVAL_MS: must not be negative, got %d", c.PromRemoteWriteIntervalMs)
+	check(c.MaxLabels >= 0, "LOKI_MAX_LABELS: must not be negative, got %d", c.MaxLabels)
+	check(c.MaxLabelValueLength >= 0, "LOKI_MAX_LABEL_VALUE_LENGTH: must not be negative, got %d", c.MaxLabelValueLength)
+	check(c.MaxLabelValues >= 0, "LOKI_MAX_LABEL_VALUES: must not be negative, got %d", c.MaxLabelValues)
+	check(c.StreamRateLimit >= 0, "LOKI_STREAM_RATE_LIMIT: must not be negative, got %v", c.StreamRateLimit)
+	if c.StreamRateLimit > 0 {
+		check(c.StreamRateBurst > 0, "LOKI_STREAM_RATE_BURST: must be positive, got %d", c.StreamRateBurst)
+	}
+	check(c.StreamShards >= 0, "LOKI_STREAM_SHARDS: must not be negative, got %d", c.StreamShards)
+	check(c.ReloadIntervalMs >= 0, "LAMBDAWATCH_RELOAD_INTERVAL_MS: must not be negative, got %d", c.ReloadIntervalMs)
+
+	return errors.Join(errs...)
+}
+
+// validURL reports whether s is an absolute http or https URL with a host
+func validURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// RedactURL masks any password in s so it is safe to include in errors
+// and logs
+func RedactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "<unparseable>"
+	}
+	return u.Redacted()
+}
+
+// validHeaderName reports whether name can be sent as an HTTP header name
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	return !strings.ContainsFunc(name, func(r rune) bool {
+		return r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r)
+	})
+}
@@ -0,0 +1,35 @@
+package deadletter
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+)
+
+// ReadBatch decodes a batch written to S3 or the spool. Both are gzipped
+// JSON with the push request's streams; only spool files carry the tenant,
+// which S3 keeps in the object's metadata. An uncompressed body, as an
+// HTTP client that decoded the object's Content-Encoding returns, is read
+// as is.
+func ReadBatch(r io.Reader) (*loki.PushRequest, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	} else {
+		r = br
+	}
+
+	var batch spooledBatch
+	if err := json.NewDecoder(r).Decode(&batch); err != nil {
+		return nil, err
+	}
+	return &loki.PushRequest{Streams: batch.Streams, TenantID: batch.TenantID}, nil
+}
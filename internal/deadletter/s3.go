@@ -0,0 +1,114 @@
+package deadletter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+	"github.com/mumzworld-tech/lambdawatch/internal/sigv4"
+)
+
+const httpClientTimeout = 5 * time.Second
+
+// S3Writer stores batches that could not be delivered to Loki as gzipped
+// JSON objects in S3. Each object body is the original Loki push request,
+// so it can be replayed by POSTing it with Content-Encoding: gzip.
+type S3Writer struct {
+	endpoint     string // https://<bucket>.s3.<region>.amazonaws.com
+	prefix       string
+	region       string
+	functionName string
+	httpClient   *http.Client
+	credentials  func() sigv4.Credentials
+	now          func() time.Time
+}
+
+// NewS3Writer creates a writer for the given bucket and key prefix, using the
+// region and credentials of the Lambda execution environment
+func NewS3Writer(bucket, prefix string) *S3Writer {
+	region := os.Getenv("AWS_REGION")
+	return &S3Writer{
+		endpoint:     fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region),
+		prefix:       prefix,
+		region:       region,
+		functionName: os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+		httpClient:   &http.Client{Timeout: httpClientTimeout},
+		credentials:  sigv4.CredentialsFromEnv,
+		now:          time.Now,
+	}
+}
+
+// Write uploads req as a single object and returns its key
+func (w *S3Writer) Write(ctx context.Context, req *loki.PushRequest) (string, error) {
+	if req == nil || len(req.Streams) == 0 {
+		return "", nil
+	}
+
+	creds := w.credentials()
+	if !creds.Valid() {
+		return "", fmt.Errorf("no AWS credentials available for dead-letter upload")
+	}
+
+	jsonBody, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal dead-letter batch: %w", err)
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(jsonBody); err != nil {
+		return "", fmt.Errorf("failed to gzip dead-letter batch: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return "", fmt.Errorf("failed to close gzip writer: %w", err)
+	}
+	body := buf.Bytes()
+
+	key := w.objectKey()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPut, w.endpoint+"/"+key, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create dead-letter request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Content-Encoding", "gzip")
+	httpReq.Header.Set("X-Amz-Content-Sha256", sigv4.HashPayload(body))
+	if req.TenantID != "" {
+		httpReq.Header.Set("X-Amz-Meta-Tenant-Id", req.TenantID)
+	}
+	sigv4.Sign(httpReq, body, "s3", w.region, creds, w.now())
+
+	resp, err := w.httpClient.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("dead-letter upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("dead-letter upload failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return key, nil
+}
+
+// objectKey builds <prefix><function>/YYYY/MM/DD/<unix-nanos>-<random>.json.gz
+// so objects sort by time and concurrent environments never collide
+func (w *S3Writer) objectKey() string {
+	now := w.now().UTC()
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+
+	name := fmt.Sprintf("%d-%s.json.gz", now.UnixNano(), hex.EncodeToString(suffix))
+	return w.prefix + path.Join(w.functionName, now.Format("2006/01/02"), name)
+}
@@ -0,0 +1,106 @@
+package deadletter
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+	"github.com/mumzworld-tech/lambdawatch/internal/sigv4"
+)
+
+func newTestWriter(endpoint string) *S3Writer {
+	return &S3Writer{
+		endpoint:     endpoint,
+		prefix:       "dlq/",
+		region:       "us-east-1",
+		functionName: "test-fn",
+		httpClient:   &http.Client{Timeout: time.Second},
+		credentials: func() sigv4.Credentials {
+			return sigv4.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+		},
+		now: func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+}
+
+func newTestRequest() *loki.PushRequest {
+	req := loki.NewPushRequest(map[string]string{"source": "lambda"}, [][]string{{"1000000", "hello"}})
+	req.TenantID = "payments"
+	return req
+}
+
+func TestS3Writer_Write(t *testing.T) {
+	var gotPath, gotAuth, gotTenant, gotEncoding string
+	var gotReq loki.PushRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		gotTenant = r.Header.Get("X-Amz-Meta-Tenant-Id")
+		gotEncoding = r.Header.Get("Content-Encoding")
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("body not gzipped: %v", err)
+			return
+		}
+		_ = json.NewDecoder(gr).Decode(&gotReq)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	key, err := newTestWriter(server.URL).Write(context.Background(), newTestRequest())
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if !strings.HasPrefix(key, "dlq/test-fn/2026/01/02/") || !strings.HasSuffix(key, ".json.gz") {
+		t.Errorf("unexpected key %q", key)
+	}
+	if gotPath != "/"+key {
+		t.Errorf("path = %q, want /%s", gotPath, key)
+	}
+	if !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKID/20260102/us-east-1/s3/aws4_request") {
+		t.Errorf("unexpected Authorization: %s", gotAuth)
+	}
+	if gotTenant != "payments" {
+		t.Errorf("tenant metadata = %q, want payments", gotTenant)
+	}
+	if gotEncoding != "gzip" {
+		t.Errorf("Content-Encoding = %q, want gzip", gotEncoding)
+	}
+	if len(gotReq.Streams) != 1 || gotReq.Streams[0].Values[0][1] != "hello" {
+		t.Errorf("unexpected stored batch: %+v", gotReq)
+	}
+}
+
+func TestS3Writer_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	if _, err := newTestWriter(server.URL).Write(context.Background(), newTestRequest()); err == nil {
+		t.Error("expected error on 403")
+	}
+}
+
+func TestS3Writer_NoCredentials(t *testing.T) {
+	w := newTestWriter("http://unused")
+	w.credentials = func() sigv4.Credentials { return sigv4.Credentials{} }
+
+	if _, err := w.Write(context.Background(), newTestRequest()); err == nil {
+		t.Error("expected error without credentials")
+	}
+}
+
+func TestS3Writer_EmptyRequest(t *testing.T) {
+	key, err := newTestWriter("http://unused").Write(context.Background(), nil)
+	if err != nil || key != "" {
+		t.Errorf("Write(nil) = %q, %v; want empty, nil", key, err)
+	}
+}
@@ -0,0 +1,134 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+	"github.com/mumzworld-tech/lambdawatch/internal/sigv4"
+)
+
+// S3Reader lists and reads the objects an S3Writer stored, so dead-lettered
+// batches can be replayed
+type S3Reader struct {
+	endpoint    string // https://<bucket>.s3.<region>.amazonaws.com
+	region      string
+	httpClient  *http.Client
+	credentials func() sigv4.Credentials
+	now         func() time.Time
+}
+
+// NewS3Reader creates a reader for bucket in region, using credentials from
+// the standard AWS environment variables
+func NewS3Reader(bucket, region string) *S3Reader {
+	return &S3Reader{
+		endpoint:    fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region),
+		region:      region,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		credentials: sigv4.CredentialsFromEnv,
+		now:         time.Now,
+	}
+}
+
+// listResult is the part of a ListObjectsV2 response the reader uses
+type listResult struct {
+	Keys                  []string `xml:"Contents>Key"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken"`
+}
+
+// List returns the keys of the batches under prefix in key order, which for
+// an S3Writer's keys is the order they were written in
+func (r *S3Reader) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := r.get(ctx, "/?"+query.Encode())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list dead-letter objects: %w", err)
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode dead-letter listing: %w", err)
+		}
+
+		for _, key := range result.Keys {
+			if strings.HasSuffix(key, spoolExt) {
+				keys = append(keys, key)
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Read downloads the batch stored under key, with the tenant from the
+// object's metadata
+func (r *S3Reader) Read(ctx context.Context, key string) (*loki.PushRequest, error) {
+	resp, err := r.get(ctx, "/"+escapeKey(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead-letter object %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	req, err := ReadBatch(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode dead-letter object %s: %w", key, err)
+	}
+	if tenant := resp.Header.Get("X-Amz-Meta-Tenant-Id"); tenant != "" {
+		req.TenantID = tenant
+	}
+	return req, nil
+}
+
+// get sends a signed GET for pathAndQuery and returns a 2xx response
+func (r *S3Reader) get(ctx context.Context, pathAndQuery string) (*http.Response, error) {
+	creds := r.credentials()
+	if !creds.Valid() {
+		return nil, fmt.Errorf("no AWS credentials available")
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, r.endpoint+pathAndQuery, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Objects are stored with Content-Encoding: gzip; ask for the bytes as
+	// stored so the client does not decode them
+	httpReq.Header.Set("Accept-Encoding", "identity")
+	httpReq.Header.Set("X-Amz-Content-Sha256", sigv4.HashPayload(nil))
+	sigv4.Sign(httpReq, nil, "s3", r.region, creds, r.now())
+
+	resp, err := r.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+	}
+	return resp, nil
+}
+
+// escapeKey escapes each segment of an object key for use in a URL path
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,106 @@
+package deadletter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/sigv4"
+)
+
+func newTestReader(endpoint string) *S3Reader {
+	return &S3Reader{
+		endpoint:   endpoint,
+		region:     "us-east-1",
+		httpClient: &http.Client{Timeout: time.Second},
+		credentials: func() sigv4.Credentials {
+			return sigv4.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+		},
+		now: func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+}
+
+func TestS3Reader_List(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			t.Error("list request not signed")
+		}
+		if got := r.URL.Query().Get("prefix"); got != "dlq/" {
+			t.Errorf("prefix = %q, want dlq/", got)
+		}
+		if r.URL.Query().Get("continuation-token") == "" {
+			fmt.Fprint(w, `<ListBucketResult><Contents><Key>dlq/fn/1-a.json.gz</Key></Contents>`+
+				`<Contents><Key>dlq/fn/notes.txt</Key></Contents>`+
+				`<IsTruncated>true</IsTruncated><NextContinuationToken>next</NextContinuationToken></ListBucketResult>`)
+			return
+		}
+		fmt.Fprint(w, `<ListBucketResult><Contents><Key>dlq/fn/2-b.json.gz</Key></Contents><IsTruncated>false</IsTruncated></ListBucketResult>`)
+	}))
+	defer server.Close()
+
+	keys, err := newTestReader(server.URL).List(context.Background(), "dlq/")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	want := []string{"dlq/fn/1-a.json.gz", "dlq/fn/2-b.json.gz"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+}
+
+func TestS3Reader_ReadsWrittenBatch(t *testing.T) {
+	var stored []byte
+	var tenant string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			var buf bytes.Buffer
+			buf.ReadFrom(r.Body)
+			stored, tenant = buf.Bytes(), r.Header.Get("X-Amz-Meta-Tenant-Id")
+		case http.MethodGet:
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Set("X-Amz-Meta-Tenant-Id", tenant)
+			w.Write(stored)
+		}
+	}))
+	defer server.Close()
+
+	want := newTestRequest()
+	key, err := newTestWriter(server.URL).Write(context.Background(), want)
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	got, err := newTestReader(server.URL).Read(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReadBatch_Uncompressed(t *testing.T) {
+	body, _ := json.Marshal(newTestRequest())
+	req, err := ReadBatch(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("ReadBatch() error = %v", err)
+	}
+	if len(req.Streams) != 1 || req.Streams[0].Values[0][1] != "hello" {
+		t.Errorf("ReadBatch() = %+v", req)
+	}
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(body)
+	gw.Close()
+	if _, err := ReadBatch(&gz); err != nil {
+		t.Errorf("ReadBatch(gzipped) error = %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package deadletter
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+)
+
+// spoolExt names the files a Spool owns; anything else in its directory is
+// left alone
+const spoolExt = ".json.gz"
+
+// Spool keeps batches that could not be delivered on local disk (normally
+// under /tmp) so a warm execution environment can retry them on a later
+// invocation. Files hold the gzipped Loki push request, as S3 objects do,
+// plus its tenant, and are named by write time so they are redelivered
+// oldest first.
+type Spool struct {
+	dir      string
+	maxBytes int64         // total size kept on disk; oldest files go first (0 = unlimited)
+	maxAge   time.Duration // files older than this are discarded unsent (0 = kept)
+	now      func() time.Time
+
+	mu          sync.Mutex // serializes writes and pruning
+	redeliverMu sync.Mutex // one redelivery at a time
+}
+
+// NewSpool creates a spool in dir, which is created on first write
+func NewSpool(dir string, maxBytes int64, maxAge time.Duration) *Spool {
+	return &Spool{
+		dir:      dir,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+		now:      time.Now,
+	}
+}
+
+// spooledBatch is the content of a spool file. Unlike the S3 object it
+// carries the tenant, which PushRequest keeps out of the body.
+type spooledBatch struct {
+	TenantID string        `json:"tenant_id,omitempty"`
+	Streams  []loki.Stream `json:"streams"`
+}
+
+// spoolFile is one spooled batch
+type spoolFile struct {
+	path    string
+	size    int64
+	written time.Time
+}
+
+// Write stores req and returns the file name. Older files are evicted to
+// keep the spool within its size limit.
+func (s *Spool) Write(ctx context.Context, req *loki.PushRequest) (string, error) {
+	if req == nil || len(req.Streams) == 0 {
+		return "", nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	// Written under a temporary name and renamed, so a freeze mid-write
+	// never leaves a truncated batch to redeliver
+	name := s.fileName()
+	tmp, err := os.CreateTemp(s.dir, ".spool-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create spool file: %w", err)
+	}
+	gw := gzip.NewWriter(tmp)
+	err = json.NewEncoder(gw).Encode(spooledBatch{TenantID: req.TenantID, Streams: req.Streams})
+	if err == nil {
+		err = gw.Close()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write spool file: %w", err)
+	}
+
+	s.prune()
+	return name, nil
+}
+
+// Redeliver pushes spooled batches oldest first, deleting each once push
+// accepts it. It stops at the first failure, leaving that batch and the
+// newer ones for the next attempt, and returns how many were delivered.
+// It returns at once if another redelivery is running. Writes are not held
+// up while batches are pushed.
+func (s *Spool) Redeliver(ctx context.Context, push func(context.Context, *loki.PushRequest) error) (int, error) {
+	if !s.redeliverMu.TryLock() {
+		return 0, nil
+	}
+	defer s.redeliverMu.Unlock()
+
+	s.mu.Lock()
+	files := s.prune()
+	s.mu.Unlock()
+
+	delivered := 0
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return delivered, err
+		}
+		req, err := readSpoolFile(f.path)
+		if err != nil {
+			// Unreadable now means unreadable forever
+			os.Remove(f.path)
+			continue
+		}
+		if err := push(ctx, req); err != nil {
+			return delivered, err
+		}
+		os.Remove(f.path)
+		delivered++
+	}
+	return delivered, nil
+}
+
+// Len returns the number of spooled batches
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.files())
+}
+
+// prune deletes files past maxAge, then the oldest until the rest fit in
+// maxBytes, and returns what is left, oldest first. Caller must hold mu.
+func (s *Spool) prune() []spoolFile {
+	files := s.files()
+	now := s.now()
+
+	kept := files[:0]
+	var total int64
+	for _, f := range files {
+		if s.maxAge > 0 && now.Sub(f.written) > s.maxAge {
+			os.Remove(f.path)
+			continue
+		}
+		kept = append(kept, f)
+		total += f.size
+	}
+	for s.maxBytes > 0 && total > s.maxBytes && len(kept) > 0 {
+		os.Remove(kept[0].path)
+		total -= kept[0].size
+		kept = kept[1:]
+	}
+	return kept
+}
+
+// files lists the spooled batches, oldest first
+func (s *Spool) files() []spoolFile {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil
+	}
+
+	var files []spoolFile
+	for _, e := range dirEntries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, spoolExt) {
+			continue
+		}
+		nanos, err := strconv.ParseInt(strings.SplitN(name, "-", 2)[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, spoolFile{
+			path:    filepath.Join(s.dir, name),
+			size:    info.Size(),
+			written: time.Unix(0, nanos),
+		})
+	}
+	// Names start with the zero-padded write time, so they sort by it
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files
+}
+
+// fileName builds <unix-nanos>-<random>.json.gz
+func (s *Spool) fileName() string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%019d-%s%s", s.now().UnixNano(), hex.EncodeToString(suffix), spoolExt)
+}
+
+func readSpoolFile(path string) (*loki.PushRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadBatch(f)
+}
@@ -0,0 +1,123 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+)
+
+func TestSpool_RedeliversOldestFirst(t *testing.T) {
+	s := NewSpool(t.TempDir(), 0, 0)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	for _, line := range []string{"first", "second"} {
+		req := loki.NewPushRequest(map[string]string{"source": "lambda"}, [][]string{{"1000000", line}})
+		req.TenantID = "payments"
+		if _, err := s.Write(context.Background(), req); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		now = now.Add(time.Second)
+	}
+
+	var got []string
+	delivered, err := s.Redeliver(context.Background(), func(ctx context.Context, req *loki.PushRequest) error {
+		if req.TenantID != "payments" {
+			t.Errorf("TenantID = %q, want payments", req.TenantID)
+		}
+		got = append(got, req.Streams[0].Values[0][1])
+		return nil
+	})
+	if err != nil || delivered != 2 {
+		t.Fatalf("Redeliver() = %d, %v, want 2, nil", delivered, err)
+	}
+	if len(got) != 2 || got[0] != "first" || got[1] != "second" {
+		t.Errorf("redelivered %v, want [first second]", got)
+	}
+	if s.Len() != 0 {
+		t.Errorf("Len() = %d after redelivery, want 0", s.Len())
+	}
+}
+
+func TestSpool_StopsAtFirstFailure(t *testing.T) {
+	s := NewSpool(t.TempDir(), 0, 0)
+	for i := 0; i < 3; i++ {
+		if _, err := s.Write(context.Background(), newTestRequest()); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	pushErr := errors.New("loki down")
+	calls := 0
+	delivered, err := s.Redeliver(context.Background(), func(ctx context.Context, req *loki.PushRequest) error {
+		calls++
+		if calls == 2 {
+			return pushErr
+		}
+		return nil
+	})
+	if !errors.Is(err, pushErr) || delivered != 1 {
+		t.Fatalf("Redeliver() = %d, %v, want 1, %v", delivered, err, pushErr)
+	}
+	if s.Len() != 2 {
+		t.Errorf("Len() = %d, want 2 left for the next attempt", s.Len())
+	}
+}
+
+func TestSpool_Caps(t *testing.T) {
+	dir := t.TempDir()
+	s := NewSpool(dir, 0, time.Hour)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	if _, err := s.Write(context.Background(), newTestRequest()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	now = now.Add(2 * time.Hour)
+	if _, err := s.Write(context.Background(), newTestRequest()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if s.Len() != 1 {
+		t.Fatalf("Len() = %d, want the expired batch discarded", s.Len())
+	}
+
+	entries, _ := os.ReadDir(dir)
+	info, _ := entries[0].Info()
+	s.maxBytes = info.Size() + info.Size()/2
+	now = now.Add(time.Second)
+	newest, err := s.Write(context.Background(), newTestRequest())
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if s.Len() != 1 {
+		t.Fatalf("Len() = %d, want the oldest batch evicted", s.Len())
+	}
+	if _, err := os.Stat(filepath.Join(dir, newest)); err != nil {
+		t.Errorf("newest batch was evicted: %v", err)
+	}
+}
+
+func TestSpool_DiscardsUnreadableFile(t *testing.T) {
+	dir := t.TempDir()
+	s := NewSpool(dir, 0, 0)
+	bad := filepath.Join(dir, s.fileName())
+	if err := os.WriteFile(bad, []byte("not gzip"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	delivered, err := s.Redeliver(context.Background(), func(ctx context.Context, req *loki.PushRequest) error {
+		t.Error("push called for an unreadable file")
+		return nil
+	})
+	if err != nil || delivered != 0 {
+		t.Errorf("Redeliver() = %d, %v, want 0, nil", delivered, err)
+	}
+	if _, err := os.Stat(bad); !os.IsNotExist(err) {
+		t.Errorf("unreadable file kept: %v", err)
+	}
+}
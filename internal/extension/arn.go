@@ -0,0 +1,75 @@
+package extension
+
+import (
+	"strconv"
+	"strings"
+)
+
+// functionARN holds the parts of an invoked function ARN used as labels
+type functionARN struct {
+	Region    string
+	AccountID string
+	Qualifier string // alias, version or $LATEST; empty for unqualified ARNs
+}
+
+// parseFunctionARN splits arn:partition:lambda:region:account:function:name[:qualifier]
+func parseFunctionARN(arn string) (functionARN, bool) {
+	parts := strings.Split(arn, ":")
+	if len(parts) < 7 || len(parts) > 8 || parts[0] != "arn" || parts[2] != "lambda" || parts[5] != "function" {
+		return functionARN{}, false
+	}
+	parsed := functionARN{Region: parts[3], AccountID: parts[4]}
+	if len(parts) == 8 {
+		parsed.Qualifier = parts[7]
+	}
+	return parsed, true
+}
+
+// alias returns the qualifier when it names an alias. Versions and
+// $LATEST are already reported by the function_version label.
+func (a functionARN) alias() string {
+	if a.Qualifier == "" || a.Qualifier == "$LATEST" {
+		return ""
+	}
+	if _, err := strconv.Atoi(a.Qualifier); err == nil {
+		return ""
+	}
+	return a.Qualifier
+}
+
+// addARNLabels sets account_id, region and alias from arn. It does nothing
+// until an INVOKE has supplied the ARN.
+func addARNLabels(labels map[string]string, arn functionARN) {
+	if arn.AccountID == "" {
+		return
+	}
+	labels["account_id"] = arn.AccountID
+	labels["region"] = arn.Region
+	delete(labels, "alias")
+	if alias := arn.alias(); alias != "" {
+		labels["alias"] = alias
+	}
+}
+
+// applyInvokedARN updates the ARN-derived labels when an INVOKE's function
+// ARN differs from the previous one. The label map is replaced rather than
+// modified because batches in flight may still hold the old one.
+func (m *Manager) applyInvokedARN(arn string) {
+	parsed, ok := parseFunctionARN(arn)
+	if !ok || parsed == m.invokedARN {
+		return
+	}
+	m.invokedARN = parsed
+
+	m.labelsMu.Lock()
+	defer m.labelsMu.Unlock()
+	labels := make(map[string]string, len(m.labels)+3)
+	for k, v := range m.labels {
+		labels[k] = v
+	}
+	addARNLabels(labels, parsed)
+	if m.cfg.OTelResourceLabels {
+		addResourceARNLabels(labels, parsed)
+	}
+	m.labels = labels
+}
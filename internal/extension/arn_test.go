@@ -0,0 +1,56 @@
+package extension
+
+import "testing"
+
+func TestParseFunctionARN(t *testing.T) {
+	tests := []struct {
+		arn   string
+		want  functionARN
+		alias string
+		ok    bool
+	}{
+		{"arn:aws:lambda:eu-west-1:123456789012:function:orders", functionARN{"eu-west-1", "123456789012", ""}, "", true},
+		{"arn:aws:lambda:eu-west-1:123456789012:function:orders:live", functionARN{"eu-west-1", "123456789012", "live"}, "live", true},
+		{"arn:aws:lambda:eu-west-1:123456789012:function:orders:7", functionARN{"eu-west-1", "123456789012", "7"}, "", true},
+		{"arn:aws:lambda:eu-west-1:123456789012:function:orders:$LATEST", functionARN{"eu-west-1", "123456789012", "$LATEST"}, "", true},
+		{"arn:aws-cn:lambda:cn-north-1:123456789012:function:orders", functionARN{"cn-north-1", "123456789012", ""}, "", true},
+		{"", functionARN{}, "", false},
+		{"arn:aws:s3:::bucket", functionARN{}, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := parseFunctionARN(tt.arn)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseFunctionARN(%q) = %+v, %v; want %+v, %v", tt.arn, got, ok, tt.want, tt.ok)
+		}
+		if got.alias() != tt.alias {
+			t.Errorf("alias(%q) = %q, want %q", tt.arn, got.alias(), tt.alias)
+		}
+	}
+}
+
+func TestApplyInvokedARN_UpdatesLabels(t *testing.T) {
+	m := newTestManager(newTestConfig())
+	m.labels = m.buildLabels(m.cfg, &RegisterResponse{FunctionName: "orders", FunctionVersion: "7"})
+	initial := m.currentLabels()
+
+	m.applyInvokedARN("arn:aws:lambda:eu-west-1:123456789012:function:orders:live")
+	labels := m.currentLabels()
+	if labels["account_id"] != "123456789012" || labels["region"] != "eu-west-1" || labels["alias"] != "live" {
+		t.Errorf("labels = %v", labels)
+	}
+	if _, ok := initial["account_id"]; ok {
+		t.Error("previous label map was modified in place")
+	}
+
+	// A later INVOKE through the unqualified ARN drops the alias
+	m.applyInvokedARN("arn:aws:lambda:eu-west-1:123456789012:function:orders")
+	if _, ok := m.currentLabels()["alias"]; ok {
+		t.Errorf("alias label kept: %v", m.currentLabels())
+	}
+
+	// Rebuilt labels (e.g. after a reload) keep the ARN labels
+	rebuilt := m.buildLabels(m.cfg, &RegisterResponse{FunctionName: "orders", FunctionVersion: "7"})
+	if rebuilt["account_id"] != "123456789012" {
+		t.Errorf("rebuilt labels = %v", rebuilt)
+	}
+}
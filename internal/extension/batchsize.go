@@ -0,0 +1,92 @@
+package extension
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+// Adaptive batch sizing: grow gently while pushes are fast, back off
+// sharply when they are slow or rate limited.
+const (
+	batchGrowthFactor = 1.25
+	batchShrinkFactor = 0.5
+	fastPushFraction  = 10 // a push faster than timeout/10 is fast
+	slowPushFraction  = 2  // a push slower than timeout/2 is slow
+)
+
+// batchSizer adjusts the batch size from observed push latency
+type batchSizer struct {
+	mu      sync.Mutex
+	current int
+	min     int
+	max     int
+	fast    time.Duration
+	slow    time.Duration
+}
+
+// newAdaptiveBatchSizer returns a sizer seeded from LOKI_BATCH_SIZE, or nil
+// when adaptive sizing is disabled
+func newAdaptiveBatchSizer(cfg *config.Config) *batchSizer {
+	if !cfg.AdaptiveBatchSize {
+		return nil
+	}
+	return newBatchSizer(cfg.BatchSize, cfg.MinBatchSize, cfg.MaxBatchSize,
+		time.Duration(cfg.LokiHTTPTimeoutMs)*time.Millisecond)
+}
+
+func newBatchSizer(initial, min, max int, pushTimeout time.Duration) *batchSizer {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	if pushTimeout <= 0 {
+		pushTimeout = flushPushTimeout
+	}
+	b := &batchSizer{
+		min:  min,
+		max:  max,
+		fast: pushTimeout / fastPushFraction,
+		slow: pushTimeout / slowPushFraction,
+	}
+	b.current = b.clamp(initial)
+	return b
+}
+
+// size returns the current batch size
+func (b *batchSizer) size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.current
+}
+
+// observe records one push. Rate limiting or a push nearing the timeout
+// halves the batch size; a fast successful push grows it.
+func (b *batchSizer) observe(latency time.Duration, rateLimited bool, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case rateLimited || latency >= b.slow:
+		b.current = b.clamp(int(float64(b.current) * batchShrinkFactor))
+	case !failed && latency < b.fast:
+		grown := int(float64(b.current) * batchGrowthFactor)
+		if grown == b.current {
+			grown++
+		}
+		b.current = b.clamp(grown)
+	}
+}
+
+func (b *batchSizer) clamp(n int) int {
+	if n < b.min {
+		return b.min
+	}
+	if n > b.max {
+		return b.max
+	}
+	return n
+}
@@ -0,0 +1,85 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+)
+
+func TestBatchSizer_GrowsOnFastPushes(t *testing.T) {
+	b := newBatchSizer(100, 10, 1000, 10*time.Second)
+	b.observe(50*time.Millisecond, false, false)
+	if got := b.size(); got != 125 {
+		t.Errorf("size() = %d, want 125", got)
+	}
+	for i := 0; i < 50; i++ {
+		b.observe(50*time.Millisecond, false, false)
+	}
+	if got := b.size(); got != 1000 {
+		t.Errorf("size() = %d, want capped at 1000", got)
+	}
+}
+
+func TestBatchSizer_ShrinksOnSlowOrRateLimited(t *testing.T) {
+	b := newBatchSizer(100, 10, 1000, 10*time.Second)
+	b.observe(6*time.Second, false, false)
+	if got := b.size(); got != 50 {
+		t.Errorf("size() = %d after slow push, want 50", got)
+	}
+	b.observe(10*time.Millisecond, true, true)
+	if got := b.size(); got != 25 {
+		t.Errorf("size() = %d after 429, want 25", got)
+	}
+	for i := 0; i < 10; i++ {
+		b.observe(10*time.Millisecond, true, true)
+	}
+	if got := b.size(); got != 10 {
+		t.Errorf("size() = %d, want floored at 10", got)
+	}
+}
+
+func TestBatchSizer_SteadyInBetween(t *testing.T) {
+	b := newBatchSizer(100, 10, 1000, 10*time.Second)
+	b.observe(2*time.Second, false, false)
+	b.observe(10*time.Millisecond, false, true) // fast failure is not a growth signal
+	if got := b.size(); got != 100 {
+		t.Errorf("size() = %d, want unchanged 100", got)
+	}
+}
+
+func TestBatchSizer_SmallSizesStillGrow(t *testing.T) {
+	b := newBatchSizer(1, 1, 10, time.Second)
+	b.observe(time.Millisecond, false, false)
+	if got := b.size(); got != 2 {
+		t.Errorf("size() = %d, want 2", got)
+	}
+}
+
+func TestManager_AdaptiveBatchShrinksOn429(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.MaxRetries = 0
+	cfg.AdaptiveBatchSize = true
+	cfg.MinBatchSize = 10
+	cfg.MaxBatchSize = 1000
+	cfg.LokiHTTPTimeoutMs = 10000
+	m := newManagerWithMockLoki(cfg, server.URL)
+	m.batchSizer = newAdaptiveBatchSizer(cfg)
+	for i := 0; i < 100; i++ {
+		m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: fmt.Sprintf("log %d", i)})
+	}
+
+	m.flush(context.Background())
+	if got := m.batchSize(); got != 50 {
+		t.Errorf("batchSize() = %d after 429, want 50", got)
+	}
+}
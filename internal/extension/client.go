@@ -21,6 +21,7 @@ type Client struct {
 	httpClient    *http.Client
 	extensionID   string
 	extensionName string
+	events        []EventType
 }
 
 // NewClient creates a new Extensions API client
@@ -35,10 +36,20 @@ func NewClient() *Client {
 	}
 }
 
+// SetEvents sets the events Register subscribes to; INVOKE and SHUTDOWN by
+// default
+func (c *Client) SetEvents(events []EventType) {
+	c.events = events
+}
+
 // Register registers the extension with Lambda
 func (c *Client) Register(ctx context.Context) (*RegisterResponse, error) {
-	body := map[string][]string{
-		"events": {string(Invoke), string(Shutdown)},
+	events := c.events
+	if len(events) == 0 {
+		events = []EventType{Invoke, Shutdown}
+	}
+	body := map[string][]EventType{
+		"events": events,
 	}
 
 	jsonBody, err := json.Marshal(body)
@@ -0,0 +1,131 @@
+package extension
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+	"github.com/mumzworld-tech/lambdawatch/internal/lambdatest"
+)
+
+// startSandbox runs a Manager against a fake Lambda environment and returns
+// the environment and a channel receiving Run's result
+func startSandbox(t *testing.T, cfg *config.Config) (*lambdatest.Env, <-chan error) {
+	t.Helper()
+	env := lambdatest.New(t)
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", env.RuntimeAPI)
+	cfg.LokiEndpoint = env.LokiURL
+
+	m := NewManager(cfg)
+	m.telemetryPort = lambdatest.FreePort(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+	return env, done
+}
+
+// waitExit waits for Run to return after SHUTDOWN
+func waitExit(t *testing.T, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after SHUTDOWN")
+	}
+}
+
+func TestE2E_InvocationsDeliveredBeforeNextEvent(t *testing.T) {
+	env, done := startSandbox(t, newTestConfig())
+
+	for _, id := range []string{"req-1", "req-2", "req-3"} {
+		env.Invoke(id, "handled "+id)
+
+		// The critical flush completes before the extension asks for the
+		// next event, so the invocation's logs must already be in Loki
+		lines := env.FunctionLines("handled " + id)
+		if len(lines) != 1 {
+			t.Fatalf("%s: got %d lines after invocation, delivered:\n%s", id, len(lines), env)
+		}
+		if !strings.Contains(lines[0].Message, id) {
+			t.Errorf("%s: request ID not injected: %q", id, lines[0].Message)
+		}
+		if lines[0].Labels["function_name"] != lambdatest.FunctionName || lines[0].Labels["account_id"] != "123456789012" {
+			t.Errorf("%s: labels = %v", id, lines[0].Labels)
+		}
+	}
+
+	env.Shutdown()
+	waitExit(t, done)
+
+	if n := len(env.FunctionLines("handled req-")); n != 3 {
+		t.Errorf("expected each line delivered once, got %d:\n%s", n, env)
+	}
+	if len(env.FunctionLines("REPORT RequestId: req-3")) != 1 {
+		t.Errorf("last platform.report not delivered by shutdown:\n%s", env)
+	}
+}
+
+func TestE2E_InitLogsDeliveredBeforeFirstInvoke(t *testing.T) {
+	env, done := startSandbox(t, newTestConfig())
+
+	env.Init("loading model")
+	if lines := env.WaitForLines("loading model", 1); len(lines) != 1 {
+		t.Fatalf("INIT logs not delivered on initRuntimeDone:\n%s", env)
+	}
+
+	env.Invoke("req-1", "first request")
+	env.Shutdown()
+	waitExit(t, done)
+
+	if len(env.FunctionLines("loading model")) != 1 {
+		t.Errorf("INIT log delivered more than once:\n%s", env)
+	}
+}
+
+func TestE2E_MissingLokiURLKeepsConsumingTelemetry(t *testing.T) {
+	env := lambdatest.New(t)
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", env.RuntimeAPI)
+	cfg := newTestConfig()
+	cfg.LokiEndpoint = ""
+
+	m := NewManager(cfg)
+	m.telemetryPort = lambdatest.FreePort(t)
+	done := make(chan error, 1)
+	go func() { done <- m.Run(context.Background()) }()
+
+	env.Init("loading model")
+	env.Invoke("req-1", "handled req-1")
+	env.Shutdown()
+	waitExit(t, done)
+
+	if !cfg.DryRun {
+		t.Error("expected batches to be printed when LOKI_URL is missing")
+	}
+	if n := len(env.Pushes()); n != 0 {
+		t.Errorf("expected no pushes without LOKI_URL, got %d", n)
+	}
+}
+
+func TestE2E_LogsAPISource(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.LogSource = config.LogSourceLogsAPI
+	env, done := startSandbox(t, cfg)
+
+	env.Invoke("req-1", "handled req-1")
+	if lines := env.FunctionLines("handled req-1"); len(lines) != 1 {
+		t.Fatalf("got %d lines after invocation, delivered:\n%s", len(lines), env)
+	}
+	if got := env.SubscribedTo(); got != "/2020-08-15/logs" {
+		t.Errorf("subscribed to %s, want the Logs API", got)
+	}
+
+	env.Shutdown()
+	waitExit(t, done)
+}
@@ -0,0 +1,34 @@
+package extension
+
+import (
+	"os"
+	"strings"
+)
+
+// envLabels maps standard Lambda environment variables to the labels added
+// when LOKI_AUTO_LABELS is enabled
+var envLabels = []struct {
+	env   string
+	label string
+}{
+	{"AWS_LAMBDA_FUNCTION_MEMORY_SIZE", "memory_size"},
+	{"AWS_EXECUTION_ENV", "runtime"},
+	{"AWS_LAMBDA_LOG_GROUP_NAME", "log_group"},
+	{"AWS_LAMBDA_LOG_STREAM_NAME", "log_stream"},
+}
+
+// addEnvLabels adds a label for each standard Lambda variable that is set.
+// The runtime drops AWS_EXECUTION_ENV's "AWS_Lambda_" prefix, so
+// AWS_Lambda_python3.12 becomes python3.12.
+func addEnvLabels(labels map[string]string) {
+	for _, l := range envLabels {
+		value := os.Getenv(l.env)
+		if value == "" {
+			continue
+		}
+		if l.label == "runtime" {
+			value = strings.TrimPrefix(value, "AWS_Lambda_")
+		}
+		labels[l.label] = value
+	}
+}
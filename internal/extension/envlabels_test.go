@@ -0,0 +1,48 @@
+package extension
+
+import "testing"
+
+func TestBuildLabels_AutoLabels(t *testing.T) {
+	t.Setenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE", "512")
+	t.Setenv("AWS_EXECUTION_ENV", "AWS_Lambda_python3.12")
+	t.Setenv("AWS_LAMBDA_LOG_GROUP_NAME", "/aws/lambda/orders")
+	t.Setenv("AWS_LAMBDA_LOG_STREAM_NAME", "2026/02/05/[$LATEST]abc")
+
+	cfg := newTestConfig()
+	m := newTestManager(cfg)
+	reg := &RegisterResponse{FunctionName: "orders", FunctionVersion: "1"}
+
+	if labels := m.buildLabels(cfg, reg); labels["memory_size"] != "" {
+		t.Errorf("auto labels added while disabled: %v", labels)
+	}
+
+	cfg.AutoLabels = true
+	labels := m.buildLabels(cfg, reg)
+	want := map[string]string{
+		"memory_size": "512",
+		"runtime":     "python3.12",
+		"log_group":   "/aws/lambda/orders",
+		"log_stream":  "2026/02/05/[$LATEST]abc",
+	}
+	for k, v := range want {
+		if labels[k] != v {
+			t.Errorf("%s = %q, want %q", k, labels[k], v)
+		}
+	}
+}
+
+func TestBuildLabels_AutoLabelsSkipUnset(t *testing.T) {
+	t.Setenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE", "")
+	t.Setenv("AWS_EXECUTION_ENV", "")
+	t.Setenv("AWS_LAMBDA_LOG_GROUP_NAME", "")
+	t.Setenv("AWS_LAMBDA_LOG_STREAM_NAME", "")
+
+	cfg := newTestConfig()
+	cfg.AutoLabels = true
+	labels := newTestManager(cfg).buildLabels(cfg, &RegisterResponse{FunctionName: "f", FunctionVersion: "1"})
+	for _, l := range envLabels {
+		if _, ok := labels[l.label]; ok {
+			t.Errorf("unexpected %s label for unset %s", l.label, l.env)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package extension
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+)
+
+// failureRecordType tags every failure record, so a CloudWatch metric
+// filter such as { $.type = "lambdawatch.delivery_failure" } matches them
+const failureRecordType = "lambdawatch.delivery_failure"
+
+// failureWebhookTimeout bounds each POST to LOKI_FAILURE_WEBHOOK_URL, which
+// holds up the flush whose batch failed
+const failureWebhookTimeout = time.Second
+
+// What became of a batch that failed delivery
+const (
+	failureSpooled      = "spooled"       // kept on disk for a later invocation
+	failureDeadLettered = "dead_lettered" // written to S3
+	failureRequeued     = "requeued"      // returned to the buffer
+	failureDropped      = "dropped"       // rejected by Loki, or nowhere left to keep it
+)
+
+// failureRecord describes one batch that failed delivery. Its fields are a
+// fixed schema for alerting and must not be renamed.
+type failureRecord struct {
+	Type           string `json:"type"`
+	Time           string `json:"time"`
+	Entries        int    `json:"entries"`
+	Bytes          int    `json:"bytes"`
+	FirstTimestamp string `json:"first_timestamp,omitempty"`
+	LastTimestamp  string `json:"last_timestamp,omitempty"`
+	Tenant         string `json:"tenant,omitempty"`
+	Critical       bool   `json:"critical"`
+	Action         string `json:"action"`
+	Error          string `json:"error"`
+}
+
+// failureReporter writes a failureRecord to stdout for every batch that
+// fails delivery, bypassing the logger so the line is neither reformatted
+// nor buffered for the Loki that just failed, and optionally POSTs it to
+// LOKI_FAILURE_WEBHOOK_URL
+type failureReporter struct {
+	out     io.Writer
+	webhook string
+	client  *http.Client
+
+	mu sync.Mutex // one record per line on out
+}
+
+func newFailureReporter(webhook string) *failureReporter {
+	return &failureReporter{
+		out:     os.Stdout,
+		webhook: webhook,
+		client:  &http.Client{Timeout: failureWebhookTimeout},
+	}
+}
+
+// reportFailure records that pushReq failed with err and what was done with
+// it. Safe to call with no reporter configured.
+func (m *Manager) reportFailure(ctx context.Context, pushReq *loki.PushRequest, critical bool, err error, action string) {
+	if m.failures == nil {
+		return
+	}
+	record := newFailureRecord(pushReq, err, action, time.Now())
+	record.Critical = critical
+	m.failures.report(ctx, record)
+}
+
+func newFailureRecord(pushReq *loki.PushRequest, err error, action string, now time.Time) failureRecord {
+	record := failureRecord{
+		Type:   failureRecordType,
+		Time:   now.UTC().Format(time.RFC3339Nano),
+		Tenant: pushReq.TenantID,
+		Action: action,
+		Error:  err.Error(),
+	}
+
+	var first, last int64
+	for _, stream := range pushReq.Streams {
+		for _, value := range stream.Values {
+			record.Entries++
+			record.Bytes += len(value[1])
+			ts, err := strconv.ParseInt(value[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			if first == 0 || ts < first {
+				first = ts
+			}
+			if ts > last {
+				last = ts
+			}
+		}
+	}
+	if first > 0 {
+		record.FirstTimestamp = time.Unix(0, first).UTC().Format(time.RFC3339Nano)
+		record.LastTimestamp = time.Unix(0, last).UTC().Format(time.RFC3339Nano)
+	}
+	return record
+}
+
+// report writes record as one JSON line and sends it to the webhook. The
+// push's retries may have used up ctx, so the webhook gets a short grace
+// period once it has expired, as dead-letter writes do.
+func (f *failureReporter) report(ctx context.Context, record failureRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	f.mu.Lock()
+	fmt.Fprintf(f.out, "%s\n", line)
+	f.mu.Unlock()
+
+	if f.webhook == "" {
+		return
+	}
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), deadLetterGrace)
+		defer cancel()
+	}
+	if err := f.post(ctx, line); err != nil {
+		logger.Warnf("Failed to send delivery failure to webhook %s: %v", config.RedactURL(f.webhook), err)
+	}
+}
+
+func (f *failureReporter) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		// The error repeats the URL, which may carry credentials
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = config.RedactURL(urlErr.URL)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package extension
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+)
+
+func TestNewFailureRecord(t *testing.T) {
+	pushReq := &loki.PushRequest{
+		TenantID: "team-a",
+		Streams: []loki.Stream{
+			{Values: [][]string{{"2000000000", "second"}, {"1000000000", "first"}}},
+			{Values: [][]string{{"3000000000", "third!"}}},
+		},
+	}
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	record := newFailureRecord(pushReq, errors.New("loki unavailable"), failureSpooled, now)
+	want := failureRecord{
+		Type:           failureRecordType,
+		Time:           "2024-01-02T03:04:05Z",
+		Entries:        3,
+		Bytes:          17,
+		FirstTimestamp: "1970-01-01T00:00:01Z",
+		LastTimestamp:  "1970-01-01T00:00:03Z",
+		Tenant:         "team-a",
+		Action:         failureSpooled,
+		Error:          "loki unavailable",
+	}
+	if record != want {
+		t.Errorf("record = %+v, want %+v", record, want)
+	}
+}
+
+func TestCriticalFlush_ReportsFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	webhookBodies := make(chan []byte, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		webhookBodies <- body
+	}))
+	defer webhook.Close()
+
+	m := newManagerWithMockLoki(newTestConfig(), server.URL)
+	var out bytes.Buffer
+	m.failures = newFailureReporter(webhook.URL)
+	m.failures.out = &out
+
+	for i := 0; i < 3; i++ {
+		m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: "test"})
+	}
+	m.criticalFlush(context.Background())
+
+	var record failureRecord
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("stdout record %q is not JSON: %v", out.String(), err)
+	}
+	if record.Type != failureRecordType || record.Entries != 3 || !record.Critical || record.Action != failureDropped {
+		t.Errorf("record = %+v, want 3 critical entries dropped", record)
+	}
+
+	select {
+	case body := <-webhookBodies:
+		if !bytes.Equal(bytes.TrimSpace(out.Bytes()), body) {
+			t.Errorf("webhook got %s, want the stdout record", body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("webhook did not receive the record")
+	}
+}
+
+func TestFailureReporter_PostErrorRedactsURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	webhook := strings.Replace(server.URL, "http://", "http://alerts:hunter2@", 1)
+	server.Close()
+
+	err := newFailureReporter(webhook).post(context.Background(), []byte("{}"))
+	if err == nil {
+		t.Fatal("expected an error posting to a closed server")
+	}
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("error leaks webhook password: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package extension
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+)
+
+// errFlushSuperseded is the cause of a critical flush cancelled because the
+// next invocation started (LOKI_INFLIGHT_FLUSH_POLICY=cancel)
+var errFlushSuperseded = errors.New("critical flush superseded by a new invocation")
+
+// trackFlush derives a critical flush's context so that supersedeFlush can
+// cancel it, and returns a function to call once the flush is done.
+// Caller must hold criticalFlushMu.
+func (m *Manager) trackFlush(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	m.inflightMu.Lock()
+	m.inflightCancel = cancel
+	m.inflightMu.Unlock()
+
+	return ctx, func() {
+		m.inflightMu.Lock()
+		m.inflightCancel = nil
+		m.inflightMu.Unlock()
+		cancel(nil)
+	}
+}
+
+// supersedeFlush applies LOKI_INFLIGHT_FLUSH_POLICY to a critical flush,
+// such as INIT's, that is still pushing when an INVOKE arrives. By default
+// it finishes under its own deadline. With cancel it is stopped, so the new
+// invocation's runtimeDone flush does not queue behind criticalFlushMu for
+// a slow push, and the entries it had taken are requeued for that flush.
+func (m *Manager) supersedeFlush() {
+	if m.cfg.InflightFlushPolicy != config.InflightFlushCancel {
+		return
+	}
+	m.inflightMu.Lock()
+	cancel := m.inflightCancel
+	m.inflightMu.Unlock()
+	if cancel != nil {
+		logger.Debugf("Cancelling critical flush still in flight at INVOKE")
+		cancel(errFlushSuperseded)
+	}
+}
+
+// superseded reports whether ctx belongs to a flush cancelled by supersedeFlush
+func superseded(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errFlushSuperseded)
+}
+
+// requeue returns the entries of a cancelled or failed push to the front of
+// the buffer. They keep the time they were first buffered, so
+// MAX_ENTRY_AGE_MS is not reset. Tenants whose push completed before the
+// cancellation receive them again, which Loki ignores for identical lines.
+// Only a push that failed with err counts towards LOKI_MAX_DELIVERY_ATTEMPTS;
+// entries that reach it are spooled or dead-lettered when configured, and
+// reported either way.
+func (m *Manager) requeue(ctx context.Context, lease *buffer.Lease, critical bool, err error) {
+	logger.Debugf("Requeued %d entries of an unfinished flush", len(lease.Entries))
+	if errors.Is(ctx.Err(), context.Canceled) {
+		// Superseded or shut down: the push never got its chance
+		m.buffer.Release(lease)
+		return
+	}
+	undeliverable := m.buffer.Nack(lease)
+	if len(undeliverable) == 0 {
+		return
+	}
+	for _, pushReq := range m.buildPushRequests(undeliverable) {
+		action := failureDropped
+		switch {
+		case m.spoolBatch(ctx, pushReq):
+			action = failureSpooled
+		case m.writeDeadLetter(ctx, pushReq):
+			action = failureDeadLettered
+		}
+		m.reportFailure(ctx, pushReq, critical, err, action)
+	}
+}
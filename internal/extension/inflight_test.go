@@ -0,0 +1,94 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+// stalledLoki accepts pushes only once release is closed, reporting each
+// request on started
+func stalledLoki(t *testing.T) (server *httptest.Server, started chan struct{}, release chan struct{}) {
+	started = make(chan struct{}, 10)
+	release = make(chan struct{})
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-release:
+			w.WriteHeader(http.StatusNoContent)
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	})
+	return server, started, release
+}
+
+func TestSupersedeFlush_CancelRequeuesEntries(t *testing.T) {
+	server, started, _ := stalledLoki(t)
+	cfg := newTestConfig()
+	cfg.InflightFlushPolicy = config.InflightFlushCancel
+	m := newManagerWithMockLoki(cfg, server.URL)
+	// A counted attempt would discard the entries rather than requeue them
+	m.buffer.SetMaxAttempts(1)
+	for i := 0; i < 5; i++ {
+		m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: fmt.Sprintf("init log %d", i)})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.criticalFlush(context.Background())
+		close(done)
+	}()
+	<-started
+
+	m.supersedeFlush()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("critical flush kept running after the next INVOKE")
+	}
+	if n := m.buffer.Len(); n != 5 {
+		t.Errorf("buffer holds %d entries after cancelling, want all 5 requeued", n)
+	}
+	if f := m.pushFailures.Load(); f != 0 {
+		t.Errorf("a cancelled push counted as %d failures", f)
+	}
+}
+
+func TestSupersedeFlush_ContinueByDefault(t *testing.T) {
+	server, started, release := stalledLoki(t)
+	m := newManagerWithMockLoki(newTestConfig(), server.URL)
+	m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: "init log"})
+
+	done := make(chan struct{})
+	go func() {
+		m.criticalFlush(context.Background())
+		close(done)
+	}()
+	<-started
+
+	m.supersedeFlush()
+	select {
+	case <-done:
+		t.Fatal("critical flush was cancelled under the continue policy")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-done
+	if n := m.buffer.Len(); n != 0 {
+		t.Errorf("buffer holds %d entries, want 0", n)
+	}
+}
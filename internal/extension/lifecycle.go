@@ -3,14 +3,20 @@ package extension
 import (
 	"context"
 	"os"
+	"os/signal"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
 	"github.com/mumzworld-tech/lambdawatch/internal/config"
+	"github.com/mumzworld-tech/lambdawatch/internal/deadletter"
+	"github.com/mumzworld-tech/lambdawatch/internal/kafka"
 	"github.com/mumzworld-tech/lambdawatch/internal/logger"
 	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+	"github.com/mumzworld-tech/lambdawatch/internal/metrics"
+	"github.com/mumzworld-tech/lambdawatch/internal/reload"
 	"github.com/mumzworld-tech/lambdawatch/internal/telemetryapi"
 )
 
@@ -18,10 +24,14 @@ const (
 	telemetryServerPort = 8080
 
 	// Timeouts and intervals
-	flushDeadlineMargin = 500 * time.Millisecond // safety buffer before Lambda kills the process
-	flushPushTimeout    = 15 * time.Second       // bounds periodic push to prevent indefinite blocking
-	shutdownTimeout     = 2 * time.Second
-	finalDeliveryWait   = 100 * time.Millisecond
+	flushDeadlineMargin    = 500 * time.Millisecond // safety buffer before Lambda kills the process
+	flushPushTimeout       = 15 * time.Second       // bounds periodic push to prevent indefinite blocking
+	shutdownTimeout        = 2 * time.Second        // Lambda's SHUTDOWN window when no deadline is given
+	finalDeliveryWait      = 100 * time.Millisecond
+	initFlushTimeout       = 2 * time.Second        // bounds flushes of INIT-phase logs
+	deadLetterGrace        = 400 * time.Millisecond // fits inside flushDeadlineMargin
+	failedFlushGrace       = 400 * time.Millisecond // flush time for an invocation past its deadline
+	postInvokePollInterval = 10 * time.Millisecond  // buffer checks while awaiting late telemetry
 )
 
 // State represents the extension's current operational state
@@ -46,26 +56,81 @@ func (s State) String() string {
 	}
 }
 
+// deadLetterWriter persists batches that could not be delivered to Loki
+type deadLetterWriter interface {
+	Write(ctx context.Context, req *loki.PushRequest) (string, error)
+}
+
 // Manager orchestrates the extension lifecycle
 type Manager struct {
 	cfg             *config.Config
 	extClient       *Client
-	telemetryClient *telemetryapi.Client
+	subscriber      Subscriber // Telemetry API or Logs API client
 	telemetryServer *telemetryapi.Server
 	lokiClient      *loki.Client
+	deadLetter      deadLetterWriter // nil when dead-lettering is disabled
+	kafka           *kafka.Producer  // nil unless KAFKA_BROKERS is set
+	batchSizer      *batchSizer      // nil unless adaptive batch sizing is enabled
+	ledger          *deliveryLedger  // nil unless LOKI_VERIFY_DELIVERY is set
+	batcher         *loki.Batcher
+	spool           *deadletter.Spool // nil unless LOKI_SPOOL_DIR is set
+	failures        *failureReporter  // nil until setup
 	buffer          *buffer.Buffer
-	labels          map[string]string
+	telemetryPort   int
 	stopFlush       chan struct{}
+	restarting      atomic.Bool // a failed telemetry receiver is being restarted
+	shuttingDown    atomic.Bool // SHUTDOWN received; failed batches are no longer spooled
+
+	// Flush loop, awaited by shutdown; nil until startFlushLoop
+	flushLoopDone   chan struct{}      // closed once the loop has returned
+	cancelFlushLoop context.CancelFunc // cancels the loop's pushes
+
+	// Stream labels; replaced when settings are reloaded
+	labels   map[string]string
+	labelsMu sync.RWMutex
+
+	// Hot reload of labels and filters between invocations
+	regResp      *RegisterResponse
+	reloadSource reload.Source // nil unless LAMBDAWATCH_RELOAD_SOURCE is set
+	lastReload   time.Time
+
+	// Loki push outcomes reported on /health
+	lastPushSuccess atomic.Int64 // UnixMilli, 0 until the first success
+	pushFailures    atomic.Int64 // consecutive failed pushes
+	pushResults     pushResults  // callbacks and recent failures, also in the shutdown summary
+
+	// Extension metrics exported via Prometheus remote-write
+	metrics       *metrics.Registry
+	metricsWriter *metrics.Writer // nil unless PROM_REMOTE_WRITE_URL is set
+	lastExport    time.Time
 
 	// State management for adaptive intervals
 	state atomic.Int32
 
+	// Set once the first INVOKE has been seen; only the event loop touches it
+	warm bool
+
+	// Parsed ARN of the last INVOKE, source of the account_id/region/alias
+	// labels; only the event loop touches it
+	invokedARN functionARN
+
 	// DeadlineMs from the last INVOKE event, used to derive the critical flush context
 	invocationDeadline atomic.Int64
 
 	// Critical flush synchronization
 	criticalFlushMu sync.Mutex
 
+	// Cancels the critical flush in progress, nil between flushes; guarded
+	// by inflightMu
+	inflightCancel context.CancelCauseFunc
+	inflightMu     sync.Mutex
+
+	// Buffer overflow drops, expiries and undeliverable entries already
+	// reported, guarded by criticalFlushMu
+	reportedDrops         uint64
+	reportedExpired       uint64
+	reportedUndeliverable uint64
+
 	// Channel to signal interval changes
 	intervalChange chan struct{}
 
@@ -79,75 +144,221 @@ type Manager struct {
 func NewManager(cfg *config.Config) *Manager {
 	m := &Manager{
 		cfg:            cfg,
-		buffer:         buffer.New(cfg.BufferSize),
+		buffer:         newBuffer(cfg),
+		batchSizer:     newAdaptiveBatchSizer(cfg),
+		metrics:        metrics.NewRegistry(),
+		batcher:        loki.NewBatcher(cfg),
+		telemetryPort:  telemetryPort(cfg),
 		stopFlush:      make(chan struct{}),
 		intervalChange: make(chan struct{}, 1),
 	}
 	m.state.Store(int32(StateIdle))
 
 	// Set buffer in logger so extension logs go to both stdout and buffer
-	// Telemetry API won't capture our own extension logs, so we add them directly
-	logger.SetBuffer(m.buffer)
+	// Telemetry API won't capture our own extension logs, so we add them directly.
+	// With LOKI_EXTENSION_LOGS=off they stay out of the buffer, so debug
+	// logging of a flush does not add entries to the next one.
+	if cfg.ExtensionLogs == config.ExtensionLogsOff {
+		logger.SetBuffer(nil)
+	} else {
+		logger.SetBuffer(m.buffer)
+	}
 
 	return m
 }
 
+// telemetryPort returns the configured telemetry listener port, falling
+// back to the default for configs built without Load
+func telemetryPort(cfg *config.Config) int {
+	if cfg.TelemetryPort > 0 {
+		return cfg.TelemetryPort
+	}
+	return telemetryServerPort
+}
+
+// newBuffer creates the log buffer with the configured overflow policy and
+// entry age limit
+func newBuffer(cfg *config.Config) *buffer.Buffer {
+	buf := buffer.NewWithPolicy(
+		cfg.BufferSize,
+		buffer.ParseOverflowPolicy(cfg.BufferOverflowPolicy),
+		time.Duration(cfg.BufferBlockTimeoutMs)*time.Millisecond,
+	)
+	buf.SetMaxAge(time.Duration(cfg.MaxEntryAgeMs) * time.Millisecond)
+	buf.SetMaxBytes(cfg.BufferMaxBytes)
+	buf.SetMaxAttempts(cfg.MaxDeliveryAttempts)
+	return buf
+}
+
 // Run runs the extension lifecycle
-func (m *Manager) Run(ctx context.Context) error {
+func (m *Manager) Run(ctx context.Context) (err error) {
+	// Lambda sends SIGTERM when it kills the extension without a SHUTDOWN
+	// event, e.g. after it overran its deadline
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize components
 	if err := m.init(ctx); err != nil {
+		// Ship whatever was captured during INIT before exiting
+		m.flushInitLogs()
 		return err
 	}
 
 	// Start background flush goroutine
-	go m.flushLoop(ctx)
+	m.startFlushLoop(ctx)
 
 	// Main event loop
-	return m.eventLoop(ctx)
+	defer m.recoverEventLoop(&err)
+	err = m.eventLoop(ctx)
+	if ctx.Err() != nil {
+		m.endOfLife()
+	}
+	return err
 }
 
 func (m *Manager) init(ctx context.Context) error {
 	// Register with Lambda Extensions API
 	m.extClient = NewClient()
-	regResp, err := m.extClient.Register(ctx)
+	m.extClient.SetEvents(registeredEvents(m.cfg))
+	var regResp *RegisterResponse
+	err := retryInit(ctx, "Registering extension", func(ctx context.Context) error {
+		var err error
+		regResp, err = m.extClient.Register(ctx)
+		return err
+	})
 	if err != nil {
 		return err
 	}
 	logger.Infof("Registered extension for function: %s", regResp.FunctionName)
 
+	if err := m.setup(regResp); err != nil {
+		return err
+	}
+	// Subscribe to the Telemetry API (or the Logs API)
+	return m.subscribe(ctx)
+}
+
+// registeredEvents converts LAMBDAWATCH_EXTENSION_EVENTS to event types
+func registeredEvents(cfg *config.Config) []EventType {
+	events := make([]EventType, len(cfg.ExtensionEvents))
+	for i, e := range cfg.ExtensionEvents {
+		events[i] = EventType(e)
+	}
+	return events
+}
+
+// setup creates the sinks and the telemetry receiver (not yet started) for
+// the function described by regResp
+func (m *Manager) setup(regResp *RegisterResponse) error {
+	for _, w := range m.cfg.Warnings {
+		logger.Warn(w)
+	}
+
 	// Build labels from config and Lambda environment
-	m.labels = m.buildLabels(regResp)
+	m.regResp = regResp
+	m.labels = m.buildLabels(m.cfg, regResp)
+
+	var err error
+	if m.cfg.ReloadSource != "" {
+		m.reloadSource, err = reload.NewSource(m.cfg.ReloadSource)
+		if err != nil {
+			return err
+		}
+		logger.Debugf("Settings reload enabled from %s", m.cfg.ReloadSource)
+	}
+
+	// Without a Loki endpoint, keep consuming telemetry and print batches
+	// rather than failing the function's INIT
+	if m.cfg.LokiEndpoint == "" && !m.cfg.DryRun {
+		logger.Warn("LOKI_URL (or GRAFANA_CLOUD_LOGS_USER/GRAFANA_CLOUD_API_KEY/GRAFANA_CLOUD_LOGS_HOST) is not set; printing batches to stdout instead of pushing")
+		m.cfg.DryRun = true
+	} else if m.cfg.DryRun {
+		logger.Infof("Dry run: batches are printed to stdout instead of pushed to Loki")
+	}
 
 	// Create Loki client
 	m.lokiClient = loki.NewClient(m.cfg)
+	m.lokiClient.SetResultHook(m.handlePushResult)
+
+	m.metricsWriter = m.newMetricsWriter(regResp)
+	if m.metricsWriter != nil {
+		logger.Debugf("Metrics export enabled: %s", config.RedactURL(m.cfg.PromRemoteWriteURL))
+	}
+
+	if m.cfg.DeadLetterBucket != "" {
+		m.deadLetter = deadletter.NewS3Writer(m.cfg.DeadLetterBucket, m.cfg.DeadLetterPrefix)
+		logger.Debugf("Dead-letter delivery enabled: s3://%s/%s", m.cfg.DeadLetterBucket, m.cfg.DeadLetterPrefix)
+	}
+	m.failures = newFailureReporter(m.cfg.FailureWebhookURL)
+	if m.cfg.SpoolDir != "" {
+		m.spool = deadletter.NewSpool(m.cfg.SpoolDir, int64(m.cfg.SpoolMaxBytes), time.Duration(m.cfg.SpoolMaxAgeMs)*time.Millisecond)
+		logger.Debugf("Spooling undelivered batches to %s", m.cfg.SpoolDir)
+	}
 
-	// Start HTTP server to receive telemetry with runtimeDone handler
+	if len(m.cfg.KafkaBrokers) > 0 {
+		m.kafka, err = kafka.NewProducer(m.cfg)
+		if err != nil {
+			return err
+		}
+		logger.Debugf("Kafka sink enabled: topic %s", m.cfg.KafkaTopic)
+	}
+
+	// Create the telemetry receiver with runtimeDone handler
 	m.telemetryServer = telemetryapi.NewServer(
 		m.buffer,
-		telemetryServerPort,
+		m.telemetryPort,
 		m.cfg.MaxLineSize,
-		m.cfg.ExtractRequestID,
+		m.cfg.ExtractRequestID || m.cfg.GroupByRequestID,
 		m.onRuntimeDone,
 	)
-	if err := m.telemetryServer.Start(); err != nil {
+	m.telemetryServer.SetInitDoneHandler(m.onInitDone)
+	m.telemetryServer.SetPanicHandler(m.onTelemetryPanic)
+	m.telemetryServer.SetListenerFailureHandler(m.onListenerFailure)
+	m.telemetryServer.SetPushStats(m.pushStats)
+	m.telemetryServer.SetRecentErrors(m.RecentPushErrors)
+	m.telemetryServer.SetProtocol(m.cfg.TelemetryProtocol)
+	m.telemetryServer.SetPortProbe(m.cfg.TelemetryPortProbe)
+	m.telemetryServer.SetMaxBodyBytes(m.cfg.TelemetryMaxBodyBytes)
+	m.telemetryServer.SetAttributionWindow(m.cfg.AttributionWindow)
+	pipeline, err := telemetryapi.NewPipeline(m.cfg)
+	if err != nil {
 		return err
 	}
-
-	// Subscribe to Telemetry API
-	m.telemetryClient = telemetryapi.NewClient(m.extClient.GetExtensionID())
-	if err := m.telemetryClient.Subscribe(ctx, m.telemetryServer.ListenerURI()); err != nil {
-		return err
+	m.telemetryServer.SetPipeline(pipeline)
+	if m.cfg.InvocationSummary {
+		m.telemetryServer.EnableInvocationSummaries()
+	}
+	if m.cfg.ReportMetrics {
+		m.telemetryServer.EnableReportMetrics()
+	}
+	if m.cfg.EndLines {
+		m.telemetryServer.EnableEndLines(m.cfg.LogSource == config.LogSourceLogsAPI)
+	}
+	if m.cfg.ExtractTraceContext {
+		m.telemetryServer.EnableTraceContext()
+	}
+	if m.cfg.TailSampleRate < 1 {
+		m.telemetryServer.SetTailSampling(m.cfg.TailSampleRate, m.cfg.BufferSize, m.cfg.BufferMaxBytes)
+	}
+	if m.metricsWriter != nil {
+		m.telemetryServer.SetReportHandler(m.observeReport)
+	}
+	if m.cfg.VerifyDelivery {
+		if m.cfg.DryRun {
+			logger.Warn("LOKI_VERIFY_DELIVERY ignored in dry run")
+		} else {
+			m.ledger = &deliveryLedger{}
+			m.telemetryServer.SetVerifyHandler(m.verifyDelivery)
+		}
 	}
-	logger.Debugf("Subscribed to Telemetry API")
-
 	return nil
 }
 
-func (m *Manager) buildLabels(regResp *RegisterResponse) map[string]string {
+func (m *Manager) buildLabels(cfg *config.Config, regResp *RegisterResponse) map[string]string {
 	labels := make(map[string]string)
 
 	// Add configured labels
-	for k, v := range m.cfg.Labels {
+	for k, v := range cfg.Labels {
 		labels[k] = v
 	}
 
@@ -158,6 +369,14 @@ func (m *Manager) buildLabels(regResp *RegisterResponse) map[string]string {
 	if region := os.Getenv("AWS_REGION"); region != "" {
 		labels["region"] = region
 	}
+	addARNLabels(labels, m.invokedARN)
+	if cfg.AutoLabels {
+		addEnvLabels(labels)
+	}
+	if cfg.OTelResourceLabels {
+		loki.AddResourceLabels(labels, regResp.FunctionName, regResp.FunctionVersion)
+		addResourceARNLabels(labels, m.invokedARN)
+	}
 
 	// Add source label
 	labels["source"] = "lambda"
@@ -174,29 +393,66 @@ func (m *Manager) eventLoop(ctx context.Context) error {
 
 		switch event.EventType {
 		case Invoke:
+			m.supersedeFlush()
+
 			// Store Lambda's deadline so onRuntimeDone can derive the flush context
 			m.invocationDeadline.Store(event.DeadlineMs)
 
-			// Create a new channel to wait for this invocation's runtimeDone
+			m.applyInvokedARN(event.InvokedFunctionArn)
+
+			// A warm sandbox gets another chance at what earlier invocations failed to push
+			if m.spool != nil {
+				go func(deadlineMs int64) {
+					defer m.recoverWorker(nil)
+					redeliverCtx, cancel := m.newFlushContext(deadlineMs)
+					defer cancel()
+					m.redeliverSpooled(redeliverCtx)
+				}(event.DeadlineMs)
+			}
+			m.ledger.begin(event.RequestID)
+
+			// Attribute lines delivered ahead of platform.start to this invocation
+			if m.telemetryServer != nil {
+				m.telemetryServer.StartInvocation(event.RequestID, time.Now())
+			}
+
+			// Propagate the X-Ray trace so this invocation's logs can be correlated
+			if event.Tracing != nil && m.telemetryServer != nil {
+				m.telemetryServer.SetTracing(event.RequestID, event.Tracing.Value)
+			}
+
+			// The first INVOKE after registration runs in a freshly initialised sandbox
+			if !m.warm {
+				m.warm = true
+				if m.telemetryServer != nil {
+					m.telemetryServer.SetColdStart(event.RequestID)
+				}
+			}
+
+			// Create a new channel to wait for this invocation's runtimeDone.
+			// The local copy is waited on because onRuntimeDone clears the
+			// field, possibly before the select below is reached.
+			done := make(chan struct{})
 			m.invocationMu.Lock()
-			m.invocationDone = make(chan struct{})
+			m.invocationDone = done
 			m.invocationMu.Unlock()
 
 			m.setState(StateActive)
-			logger.Debugf("Received INVOKE event for request: %s (state: ACTIVE)", event.RequestID)
+			logger.With("request_id", event.RequestID).Debug("Received INVOKE event (state: ACTIVE)")
 
 			// Wait for runtimeDone to be processed before calling NextEvent again
 			// This ensures critical flush completes before we signal readiness for next invocation
 			select {
-			case <-m.invocationDone:
+			case <-done:
 				logger.Debugf("Invocation complete, ready for next event")
+				m.maybeReload(ctx)
 			case <-ctx.Done():
 				return ctx.Err()
 			}
 
 		case Shutdown:
 			logger.Infof("Received SHUTDOWN event, reason: %s", event.ShutdownReason)
-			shutCtx, shutCancel := m.newFlushContext(event.DeadlineMs)
+			shutCtx, shutCancel := m.newShutdownContext(event.DeadlineMs)
 			defer shutCancel()
 			return m.shutdown(shutCtx)
 		}
@@ -230,6 +486,11 @@ func (m *Manager) getFlushInterval() time.Duration {
 		// Normal interval during active invocation
 		return baseInterval
 	case StateIdle:
+		// Without INVOKE events there is no ACTIVE state to speed up in,
+		// so the timer keeps the normal interval
+		if !m.cfg.RegistersInvoke() {
+			return baseInterval
+		}
 		// Longer interval when idle (default 3x)
 		return baseInterval * time.Duration(m.cfg.IdleFlushMultiplier)
 	case StateFlushing:
@@ -247,10 +508,34 @@ func (m *Manager) newFlushContext(deadlineMs int64) (context.Context, context.Ca
 	return context.WithDeadline(context.Background(), deadline)
 }
 
+// newShutdownContext bounds the whole shutdown sequence by the SHUTDOWN
+// event's deadline. Without one, Lambda's fixed window is assumed.
+func (m *Manager) newShutdownContext(deadlineMs int64) (context.Context, context.CancelFunc) {
+	if deadlineMs <= 0 {
+		return context.WithTimeout(context.Background(), shutdownTimeout-flushDeadlineMargin)
+	}
+	return m.newFlushContext(deadlineMs)
+}
+
+// startFlushLoop runs the supervised flush loop in the background until
+// ctx is done or shutdown stops it
+func (m *Manager) startFlushLoop(ctx context.Context) {
+	ctx, m.cancelFlushLoop = context.WithCancel(ctx)
+	m.flushLoopDone = make(chan struct{})
+	go func() {
+		defer close(m.flushLoopDone)
+		m.supervise(ctx, "flush loop", m.flushLoop)
+	}()
+}
+
 func (m *Manager) flushLoop(ctx context.Context) {
 	interval := m.getFlushInterval()
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	suspended := m.flushSuspended()
+	if suspended {
+		ticker.Stop()
+	}
 
 	logger.Debugf("Flush loop started with interval: %v (state: %s)", interval, m.getState())
 
@@ -263,37 +548,57 @@ func (m *Manager) flushLoop(ctx context.Context) {
 		case <-m.intervalChange:
 			// State changed, adjust the ticker interval
 			newInterval := m.getFlushInterval()
-			if newInterval != interval {
+			wasSuspended := suspended
+			suspended = m.flushSuspended()
+			switch {
+			case suspended && !wasSuspended:
+				ticker.Stop()
+				logger.Debugf("Flush loop suspended (state: %s)", m.getState())
+			case !suspended && (wasSuspended || newInterval != interval):
 				interval = newInterval
 				ticker.Reset(interval)
 				logger.Debugf("Flush interval adjusted to: %v (state: %s)", interval, m.getState())
 			}
 		case <-ticker.C:
-			m.flush(ctx)
+			if !suspended {
+				m.flush(ctx)
+			}
 		case <-m.buffer.Ready():
 			// Check if we have enough for a batch (by count or bytes)
-			if m.shouldFlush() {
+			if !suspended && m.shouldFlush() {
 				m.flush(ctx)
 			}
 		}
 	}
 }
 
+// flushSuspended reports whether periodic flushing is paused: with
+// LOKI_FLUSH_ONLY_ON_INVOKE, only while an invocation is ACTIVE does the
+// flush loop push; everything else ships at runtimeDone or shutdown
+func (m *Manager) flushSuspended() bool {
+	return m.cfg.FlushOnlyOnInvoke && m.getState() != StateActive
+}
+
 // shouldFlush returns true if buffer has enough data to flush
 func (m *Manager) shouldFlush() bool {
-	if m.buffer.Len() >= m.cfg.BatchSize {
-		return true
-	}
-	if m.cfg.MaxBatchSizeBytes > 0 && m.buffer.ByteSize() >= m.cfg.MaxBatchSizeBytes {
-		return true
-	}
-	return false
+	return m.batcher.Full(m.currentLabels(), m.buffer, m.batchSize())
 }
 
 // onRuntimeDone is called when platform.runtimeDone is received
-// This triggers a critical flush to ensure all logs are shipped at invocation end
-func (m *Manager) onRuntimeDone(requestID string) {
-	logger.Debugf("Received PLATFORM_RUNTIME_DONE event for request: %s", requestID)
+// This triggers a critical flush to ensure all logs are shipped at invocation end.
+// A failed or timed-out invocation's flush retries until the deadline.
+func (m *Manager) onRuntimeDone(requestID, status string) {
+	log := logger.With("request_id", requestID, "status", status)
+	log.Debug("Received PLATFORM_RUNTIME_DONE event")
+
+	// Without INVOKE, Lambda does not wait for the extension after an
+	// invocation, so a flush here could be frozen halfway; leave it to the timer
+	if !m.cfg.RegistersInvoke() {
+		return
+	}
+
+	// Release the event loop even if the flush panics
+	defer m.finishInvocation()
 
 	// Transition to flushing state
 	m.setState(StateFlushing)
@@ -301,10 +606,66 @@ func (m *Manager) onRuntimeDone(requestID string) {
 	// Derive flush context from Lambda's deadline for this invocation
 	ctx, cancel := m.newFlushContext(m.invocationDeadline.Load())
 	defer cancel()
+	if telemetryapi.IsFailedStatus(status) {
+		log.Warn("Invocation did not succeed; escalating flush")
+		ctx, cancel = m.escalatedFlushContext(ctx)
+		defer cancel()
+	}
+	start := time.Now()
 	m.criticalFlush(ctx)
+	flushed := time.Since(start)
+	m.awaitLateTelemetry(ctx, requestID)
+	m.exportMetrics(ctx, false)
+	m.observeOverhead(log, time.Since(start), flushed)
+}
+
+// escalatedFlushContext marks ctx so pushes retry until it ends. A timed-out
+// invocation has usually used up its deadline already, so an expired ctx is
+// given failedFlushGrace instead.
+func (m *Manager) escalatedFlushContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	cancel := context.CancelFunc(func() {})
+	if ctx.Err() != nil {
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), failedFlushGrace)
+	}
+	return loki.Escalate(ctx), cancel
+}
+
+// awaitLateTelemetry keeps flushing after runtimeDone until the invocation's
+// platform.report has arrived with nothing left buffered, or until
+// LOKI_POST_INVOKE_WINDOW_MS has passed. Lines logged at the very end of a
+// handler are often delivered just after runtimeDone and would otherwise
+// sit in the buffer while the sandbox is frozen.
+func (m *Manager) awaitLateTelemetry(ctx context.Context, requestID string) {
+	window := time.Duration(m.cfg.PostInvokeWindowMs) * time.Millisecond
+	if window <= 0 || m.telemetryServer == nil {
+		return
+	}
+	expired := time.After(window)
+	poll := time.NewTicker(postInvokePollInterval)
+	defer poll.Stop()
+
+	for {
+		if m.buffer.Len() > 0 {
+			m.criticalFlush(ctx)
+		}
+		if m.telemetryServer.Reported(requestID) && m.buffer.Len() == 0 {
+			return
+		}
+		select {
+		case <-poll.C:
+		case <-expired:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// finishInvocation returns to IDLE and signals that invocation processing
+// is complete
+func (m *Manager) finishInvocation() {
 	m.setState(StateIdle)
 
-	// Signal that invocation processing is complete
 	m.invocationMu.Lock()
 	if m.invocationDone != nil {
 		close(m.invocationDone)
@@ -313,24 +674,125 @@ func (m *Manager) onRuntimeDone(requestID string) {
 	m.invocationMu.Unlock()
 }
 
-// flushBatch extracts a batch of entries from the buffer and returns a push request
-// Returns nil if no entries are available
-func (m *Manager) flushBatch() (*loki.PushRequest, int) {
-	var entries []buffer.LogEntry
-	if m.cfg.MaxBatchSizeBytes > 0 {
-		entries = m.buffer.FlushBySize(m.cfg.BatchSize, m.cfg.MaxBatchSizeBytes)
+// onInitDone is called when platform.initRuntimeDone (or SnapStart's
+// platform.restoreRuntimeDone) is received.
+// A failed INIT produces logs only in this window, so they are flushed
+// immediately rather than waiting for an INVOKE that may never come.
+func (m *Manager) onInitDone(status string) {
+	logger.Debugf("Received PLATFORM_INIT_RUNTIME_DONE event, status: %s", status)
+	m.flushInitLogs()
+}
+
+// flushInitLogs critically flushes logs buffered before the first INVOKE.
+// No invocation deadline exists yet, so the flush is bounded by initFlushTimeout.
+func (m *Manager) flushInitLogs() {
+	if m.lokiClient == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), initFlushTimeout)
+	defer cancel()
+	m.criticalFlush(ctx)
+}
+
+// flushBatch leases a batch of entries from the buffer and returns its push
+// requests, one per Loki tenant. Returns nil if no entries are available,
+// or if building the batch panicked, in which case it is handed back as a
+// push worker's would be.
+func (m *Manager) flushBatch() (pushReqs []*loki.PushRequest, lease *buffer.Lease) {
+	defer m.recoverWorker(&lease)
+	if m.takeBatch(false, &lease) == nil {
+		return nil, nil
+	}
+	return m.buildPushRequests(lease.Entries), lease
+}
+
+// takeBatch leases the next batch from the buffer; the caller settles it
+// with commitBatch or buffer.Nack. The lease is also stored in held as soon
+// as it is taken, before anything that may panic, so recoverWorker can hand
+// it back. With prioritize set, high-priority entries (errors, faults) are
+// taken first regardless of buffer pressure, so a critical flush cut short
+// by the deadline has already shipped the entries that matter most.
+func (m *Manager) takeBatch(prioritize bool, held **buffer.Lease) *buffer.Lease {
+	var lease *buffer.Lease
+	if prioritize {
+		lease = m.buffer.TakePriority(m.batchSize(), m.batchByteLimit())
 	} else {
-		entries = m.buffer.Flush(m.cfg.BatchSize)
+		lease = m.buffer.Take(m.batchSize(), m.batchByteLimit())
+	}
+	if lease == nil {
+		return nil
 	}
+	*held = lease
+
+	// Entries are attributed only now, once late platform.start events have
+	// had a chance to arrive, and rate limited by the streams that gives them
+	m.telemetryServer.AssignRequestIDs(lease.Entries)
+	lease.Entries = m.batcher.Admit(m.currentLabels(), lease.Entries)
+	return lease
+}
 
-	if len(entries) == 0 {
-		return nil, 0
+// commitBatch settles a lease whose entries are done with, pushed or handed
+// to the spool or dead-letter writer, and queues them for Kafka. Entries
+// returned to the buffer are queued only once they are committed, so Kafka
+// gets each of them once.
+func (m *Manager) commitBatch(lease *buffer.Lease) {
+	m.buffer.Ack(lease)
+	m.produceKafka(lease.Entries)
+}
+
+// batchByteLimit returns the entry bytes per batch for the current labels,
+// or 0 when LOKI_MAX_BATCH_SIZE_BYTES is unset
+func (m *Manager) batchByteLimit() int {
+	return m.batcher.ByteLimit(m.currentLabels())
+}
+
+// batchSize returns the entry count per batch, adapted to push latency
+// when LOKI_ADAPTIVE_BATCH_SIZE is enabled
+func (m *Manager) batchSize() int {
+	if m.batchSizer != nil {
+		return m.batchSizer.size()
 	}
+	return m.cfg.BatchSize
+}
 
-	batch := loki.NewBatch(m.labels, m.cfg.ExtractRequestID)
-	batch.Add(entries)
+// observePush records a push outcome for /health and the metrics exporter,
+// and feeds it to the adaptive batch sizer
+func (m *Manager) observePush(start time.Time, err error) {
+	if err != nil {
+		m.pushFailures.Add(1)
+	} else {
+		m.lastPushSuccess.Store(time.Now().UnixMilli())
+		m.pushFailures.Store(0)
+	}
+	if m.metrics != nil {
+		m.metrics.ObservePush(time.Since(start), err)
+	}
+	if m.batchSizer == nil {
+		return
+	}
+	m.batchSizer.observe(time.Since(start), loki.IsRateLimited(err), err != nil)
+}
+
+// pushStats reports push outcomes to the telemetry server's /health route
+func (m *Manager) pushStats() (time.Time, int) {
+	var last time.Time
+	if ms := m.lastPushSuccess.Load(); ms > 0 {
+		last = time.UnixMilli(ms)
+	}
+	return last, int(m.pushFailures.Load())
+}
+
+// buildPushRequests converts entries into push requests, partitioned by
+// tenant when LOKI_TENANT_LABEL is configured
+func (m *Manager) buildPushRequests(entries []buffer.LogEntry) []*loki.PushRequest {
+	return m.batcher.PushRequests(m.currentLabels(), entries)
+}
 
-	return batch.ToPushRequest(), len(entries)
+// currentLabels returns the stream labels in effect
+func (m *Manager) currentLabels() map[string]string {
+	m.labelsMu.RLock()
+	defer m.labelsMu.RUnlock()
+	return m.labels
 }
 
 // flush performs a regular flush with standard retries.
@@ -340,55 +802,243 @@ func (m *Manager) flush(ctx context.Context) {
 		return
 	}
 
-	pushReq, count := m.flushBatch()
-	if pushReq == nil {
-		return
-	}
-
-	logger.Debugf("Pushing %d log entries to Loki", count)
-
 	pushCtx, cancel := context.WithTimeout(ctx, flushPushTimeout)
 	defer cancel()
 
-	if err := m.lokiClient.Push(pushCtx, pushReq); err != nil {
-		logger.Warnf("Failed to push logs to Loki: %v", err)
+	// The first batch always goes; extra workers only take full batches
+	var wg sync.WaitGroup
+	for i := 0; i < m.flushWorkers(); i++ {
+		if i > 0 && !m.shouldFlush() {
+			break
+		}
+		pushReqs, lease := m.flushBatch()
+		if pushReqs == nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer m.recoverWorker(&lease)
+			log := logger.With("batch_size", len(lease.Entries))
+			log.Debug("Pushing log entries to Loki")
+			var retryErr error
+			for _, pushReq := range pushReqs {
+				start := time.Now()
+				err := m.lokiClient.Push(pushCtx, pushReq)
+				m.observePush(start, err)
+				if err != nil {
+					log.Warnf("Failed to push logs to Loki: %v", err)
+					if loki.IsRejected(err) {
+						m.reportFailure(pushCtx, pushReq, false, err, failureDropped)
+					} else {
+						retryErr = err
+					}
+				} else {
+					m.ledger.record(pushReq)
+				}
+			}
+			// A batch that may yet be accepted goes back to the buffer for
+			// the next flush
+			if retryErr != nil {
+				m.requeue(pushCtx, lease, false, retryErr)
+				return
+			}
+			m.commitBatch(lease)
+		}()
 	}
+	wg.Wait()
 }
 
-// criticalFlush flushes all buffered logs with higher retry count
+// criticalFlush flushes all buffered logs with higher retry count,
+// pushing up to LOKI_FLUSH_WORKERS batches in parallel
 func (m *Manager) criticalFlush(ctx context.Context) {
 	m.criticalFlushMu.Lock()
 	defer m.criticalFlushMu.Unlock()
 
+	// Records queued for Kafka, including those from earlier regular
+	// flushes, must be acknowledged before Lambda freezes us
+	defer m.flushKafka(ctx)
+
+	ctx, release := m.trackFlush(ctx)
+	defer release()
+
+	m.reportDrops()
+
 	// Snapshot count before any logging to avoid infinite loop
-	remaining := m.buffer.Len()
-	if remaining == 0 {
+	var remaining atomic.Int64
+	remaining.Store(int64(m.buffer.Len()))
+	if remaining.Load() == 0 {
 		return
 	}
 
-	logger.Debugf("Critical flush: %d entries", remaining)
+	logger.With("entries", remaining.Load()).Debug("Critical flush")
 
-	// Flush only the entries that existed when we started
-	for remaining > 0 {
-		pushReq, n := m.flushBatch()
-		if pushReq == nil {
-			break
+	// Flush only the entries that existed when we started. Workers stop
+	// once any push fails, since Loki is then unlikely to accept the rest.
+	var failed atomic.Bool
+	worker := func(held **buffer.Lease) {
+		for remaining.Load() > 0 && !failed.Load() {
+			lease := m.takeBatch(true, held)
+			if lease == nil {
+				return
+			}
+
+			remaining.Add(-int64(len(lease.Entries)))
+			err := m.pushAllCritical(ctx, m.buildPushRequests(lease.Entries))
+			if err != nil && (superseded(ctx) || (!m.keepsFailedBatches() && !loki.IsRejected(err))) {
+				// Left for the flush that follows: the next invocation's,
+				// when superseded, else the next regular or critical flush
+				m.requeue(ctx, lease, true, err)
+				failed.Store(true)
+				return
+			}
+			m.commitBatch(lease)
+			if err != nil {
+				logger.Errorf("Critical flush error: %v", err)
+				failed.Store(true)
+				return
+			}
 		}
+	}
 
-		remaining -= n
-		if err := m.lokiClient.PushCritical(ctx, pushReq); err != nil {
-			logger.Errorf("Critical flush error: %v", err)
-			break
+	var wg sync.WaitGroup
+	for i := 0; i < m.flushWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var lease *buffer.Lease
+			defer m.recoverWorker(&lease)
+			worker(&lease)
+		}()
+	}
+	wg.Wait()
+}
+
+// produceKafka queues entries for the Kafka sink, if configured
+func (m *Manager) produceKafka(entries []buffer.LogEntry) {
+	if m.kafka != nil {
+		m.kafka.Produce(entries, m.currentLabels())
+	}
+}
+
+// flushKafka waits for queued Kafka records to be acknowledged
+func (m *Manager) flushKafka(ctx context.Context) {
+	if m.kafka == nil {
+		return
+	}
+	if err := m.kafka.Flush(ctx); err != nil {
+		logger.Warnf("Kafka sink: %v", err)
+	}
+}
+
+// flushWorkers returns how many batches may be pushed concurrently
+func (m *Manager) flushWorkers() int {
+	if m.cfg.FlushWorkers < 1 {
+		return 1
+	}
+	return m.cfg.FlushWorkers
+}
+
+// pushAllCritical pushes every request with critical retries, continuing past
+// failures so one unavailable tenant does not block the others.
+// Requests that still fail are spooled for a later invocation or, when
+// that is not possible, handed to the dead-letter writer.
+func (m *Manager) pushAllCritical(ctx context.Context, pushReqs []*loki.PushRequest) error {
+	var firstErr error
+	for _, pushReq := range pushReqs {
+		start := time.Now()
+		err := m.lokiClient.PushCritical(ctx, pushReq)
+		if err != nil && superseded(ctx) {
+			// Neither a failure nor dead-lettered: the batch is requeued
+			return err
 		}
+		m.observePush(start, err)
+		if err != nil {
+			m.reportFailure(ctx, pushReq, true, err, m.keepFailedBatch(ctx, pushReq, err))
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		m.ledger.record(pushReq)
+	}
+	return firstErr
+}
+
+// keepFailedBatch spools or dead-letters a batch that failed critical
+// retries and returns what became of it
+func (m *Manager) keepFailedBatch(ctx context.Context, pushReq *loki.PushRequest, err error) string {
+	switch {
+	case m.spoolBatch(ctx, pushReq):
+		return failureSpooled
+	case m.writeDeadLetter(ctx, pushReq):
+		return failureDeadLettered
+	case m.keepsFailedBatches() || loki.IsRejected(err):
+		// Spooling or dead-lettering was attempted and failed, or Loki
+		// will never accept the batch: it is not requeued
+		return failureDropped
+	default:
+		return failureRequeued
+	}
+}
+
+// writeDeadLetter stores an undeliverable batch in S3 for later replay and
+// reports whether it did. Retries may have consumed the flush context, so a
+// short grace period (still inside Lambda's deadline margin) is used once
+// it has expired.
+func (m *Manager) writeDeadLetter(ctx context.Context, pushReq *loki.PushRequest) bool {
+	if m.deadLetter == nil {
+		return false
+	}
+
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), deadLetterGrace)
+		defer cancel()
+	}
+
+	key, err := m.deadLetter.Write(ctx, pushReq)
+	if err != nil {
+		logger.Errorf("Failed to write dead-letter batch: %v", err)
+		return false
+	}
+	logger.Warnf("Wrote undelivered batch to dead-letter object: %s", key)
+	return true
+}
+
+// reportDrops logs entries lost to buffer overflow, expiry or repeated push
+// failures since the last report.
+// Caller must hold criticalFlushMu.
+func (m *Manager) reportDrops() {
+	dropped := m.buffer.Dropped()
+	if dropped > m.reportedDrops {
+		logger.Warnf("Buffer overflow (%s) dropped %d log entries (total %d)",
+			m.cfg.BufferOverflowPolicy, dropped-m.reportedDrops, dropped)
+		m.reportedDrops = dropped
+	}
+	expired := m.buffer.Expired()
+	if expired > m.reportedExpired {
+		logger.Warnf("Expired %d log entries buffered longer than %dms (total %d)",
+			expired-m.reportedExpired, m.cfg.MaxEntryAgeMs, expired)
+		m.reportedExpired = expired
+	}
+	undeliverable := m.buffer.Undeliverable()
+	if undeliverable > m.reportedUndeliverable {
+		logger.Warnf("Discarded %d log entries after %d failed pushes (total %d)",
+			undeliverable-m.reportedUndeliverable, m.cfg.MaxDeliveryAttempts, undeliverable)
+		m.reportedUndeliverable = undeliverable
 	}
 }
 
 func (m *Manager) shutdown(ctx context.Context) error {
+	m.shuttingDown.Store(true)
+
 	// Stop the flush loop
 	close(m.stopFlush)
 
-	// Shutdown telemetry server
-	shutdownCtx, cancel := context.WithTimeout(ctx, shutdownTimeout)
+	// Shutdown telemetry server, leaving most of the budget for the final push
+	shutdownCtx, cancel := context.WithTimeout(ctx, serverShutdownBudget(ctx))
 	defer cancel()
 
 	if err := m.telemetryServer.Shutdown(shutdownCtx); err != nil {
@@ -396,24 +1046,105 @@ func (m *Manager) shutdown(ctx context.Context) error {
 	}
 
 	// Give telemetry API a moment to deliver any final logs
-	time.Sleep(finalDeliveryWait)
+	select {
+	case <-time.After(finalDeliveryWait):
+	case <-ctx.Done():
+	}
+
+	// A push still in flight holds its batch; wait for it to be handed back,
+	// as Drain closes the buffer to entries returned afterwards
+	m.awaitFlushes(ctx)
 
 	// Drain and flush all remaining logs with critical retries
 	logger.Debugf("Draining buffer...")
+	m.telemetryServer.ReleaseHeld()
 	entries := m.buffer.Drain()
 
 	if len(entries) > 0 {
-		logger.Debugf("Flushing %d remaining log entries with critical retries", len(entries))
-		batch := loki.NewBatch(m.labels, m.cfg.ExtractRequestID)
-		batch.Add(entries)
-
-		pushReq := batch.ToPushRequest()
-		if err := m.lokiClient.PushCritical(ctx, pushReq); err != nil {
+		logger.With("entries", len(entries)).Debug("Flushing remaining log entries with critical retries")
+		m.telemetryServer.AssignRequestIDs(entries)
+		entries = m.batcher.Admit(m.currentLabels(), entries)
+		m.produceKafka(entries)
+		if err := m.pushAllCritical(ctx, m.buildPushRequests(entries)); err != nil {
 			logger.Errorf("Failed to push final logs to Loki: %v", err)
 			// Continue shutdown even on error
 		}
 	}
+	// Last chance for batches earlier invocations spooled
+	m.redeliverSpooled(ctx)
+	m.flushKafka(ctx)
+	if m.kafka != nil {
+		m.kafka.Close()
+	}
+	m.verifyLastInvocation(ctx)
+	m.logPushSummary()
+	m.exportMetrics(ctx, true)
 
 	logger.Infof("Shutdown complete")
 	return nil
 }
+
+// awaitFlushes waits, bounded by ctx, for the flush loop to return and for
+// every leased batch to be settled. A regular flush still pushing after the
+// same share of the shutdown window as the telemetry server gets is
+// cancelled, which hands its batch back for the final push.
+func (m *Manager) awaitFlushes(ctx context.Context) {
+	if m.flushLoopDone != nil {
+		grace, cancel := context.WithTimeout(ctx, serverShutdownBudget(ctx))
+		defer cancel()
+		select {
+		case <-m.flushLoopDone:
+		case <-grace.Done():
+			logger.Warnf("Cancelling regular flush still in flight at SHUTDOWN")
+			m.cancelFlushLoop()
+			select {
+			case <-m.flushLoopDone:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	ticker := time.NewTicker(postInvokePollInterval)
+	defer ticker.Stop()
+	for m.buffer.Leased() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			logger.Warnf("Draining with %d entries still leased", m.buffer.Leased())
+			return
+		}
+	}
+}
+
+// endOfLife pushes what is buffered when Run is stopped by SIGTERM or a
+// cancelled context rather than a SHUTDOWN event, within Lambda's usual
+// shutdown window. Nothing is done once SHUTDOWN has been handled.
+func (m *Manager) endOfLife() {
+	if m.shuttingDown.Swap(true) || m.lokiClient == nil {
+		return
+	}
+	ctx, cancel := m.newShutdownContext(0)
+	defer cancel()
+
+	if m.telemetryServer != nil {
+		m.telemetryServer.ReleaseHeld()
+	}
+	logger.Warnf("Stopped without a SHUTDOWN event, flushing %d buffered entries", m.buffer.Len())
+	m.criticalFlush(ctx)
+	m.flushKafka(ctx)
+}
+
+// serverShutdownBudget is the share of the remaining shutdown time given to
+// stopping the telemetry server
+func serverShutdownBudget(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return shutdownTimeout
+	}
+	budget := time.Until(deadline) / 4
+	if budget > shutdownTimeout {
+		return shutdownTimeout
+	}
+	return budget
+}
@@ -1,18 +1,25 @@
 package extension
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
 	"github.com/mumzworld-tech/lambdawatch/internal/config"
+	"github.com/mumzworld-tech/lambdawatch/internal/deadletter"
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
 	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+	"github.com/mumzworld-tech/lambdawatch/internal/telemetryapi"
 )
 
 func newTestConfig() *config.Config {
@@ -24,11 +31,25 @@ func newTestConfig() *config.Config {
 		IdleFlushMultiplier:  3,
 		MaxRetries:           3,
 		CriticalFlushRetries: 5,
+		FlushWorkers:         1,
+		LokiHTTPTimeoutMs:    10000,
 		EnableGzip:           false,
 		CompressionThreshold: 1024,
 		BufferSize:           10000,
+		BufferOverflowPolicy: "drop-oldest",
 		MaxLineSize:          204800,
+		LogSampleRate:        1,
+		TailSampleRate:       1,
+		LogSource:            "telemetry",
+		AttributionWindow:    "invocation",
+		ExtensionLogs:        "stream",
+		InflightFlushPolicy:  "continue",
+		ExtensionEvents:      []string{"INVOKE", "SHUTDOWN"},
+		TelemetryProtocol:    "HTTP",
+		TelemetryPort:        8080,
+		TelemetryPortProbe:   10,
 		ExtractRequestID:     true,
+		InjectRequestID:      true,
 		Labels:               map[string]string{},
 	}
 }
@@ -37,6 +58,7 @@ func newTestManager(cfg *config.Config) *Manager {
 	m := &Manager{
 		cfg:            cfg,
 		buffer:         buffer.New(cfg.BufferSize),
+		batcher:        loki.NewBatcher(cfg),
 		stopFlush:      make(chan struct{}),
 		intervalChange: make(chan struct{}, 1),
 	}
@@ -162,6 +184,16 @@ func TestFlushInterval_Idle(t *testing.T) {
 	}
 }
 
+func TestFlushInterval_IdleWithoutInvoke(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.FlushIntervalMs = 1000
+	cfg.ExtensionEvents = []string{"SHUTDOWN"}
+	m := newTestManager(cfg)
+	if got := m.getFlushInterval(); got != time.Second {
+		t.Errorf("expected 1s on the timer alone, got %v", got)
+	}
+}
+
 func TestFlushInterval_Flushing(t *testing.T) {
 	cfg := newTestConfig()
 	cfg.FlushIntervalMs = 1000
@@ -298,6 +330,34 @@ func TestFlush_PushesToLoki(t *testing.T) {
 	}
 }
 
+func TestFlush_FailedBatchStaysBuffered(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.MaxRetries = 0
+	m := newManagerWithMockLoki(cfg, server.URL)
+	for i := 0; i < 5; i++ {
+		m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: fmt.Sprintf("log %d", i)})
+	}
+
+	m.flush(context.Background())
+	if m.buffer.Len() != 5 || m.buffer.Leased() != 0 {
+		t.Fatalf("buffered = %d, leased = %d after a failed push; want 5 and 0", m.buffer.Len(), m.buffer.Leased())
+	}
+
+	// Entries Loki rejects outright are not retried
+	status.Store(http.StatusBadRequest)
+	m.flush(context.Background())
+	if m.buffer.Len() != 0 {
+		t.Errorf("buffered = %d after a rejected push, want 0", m.buffer.Len())
+	}
+}
+
 func TestFlush_EmptyBufferNoPush(t *testing.T) {
 	server, pushCount, _ := startMockLoki(t)
 	defer server.Close()
@@ -352,11 +412,11 @@ func TestFlushBatch_RespectsCountLimit(t *testing.T) {
 		m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: "test"})
 	}
 
-	req, count := m.flushBatch()
+	req, lease := m.flushBatch()
 	if req == nil {
 		t.Fatal("expected non-nil push request")
 	}
-	if count != 5 {
+	if count := len(lease.Entries); count != 5 {
 		t.Errorf("expected 5 entries, got %d", count)
 	}
 	if m.buffer.Len() != 15 {
@@ -375,17 +435,17 @@ func TestFlushBatch_RespectsByteLimit(t *testing.T) {
 		m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: "a]message that is about forty bytes long"})
 	}
 
-	_, count := m.flushBatch()
-	if count >= 10 {
+	_, lease := m.flushBatch()
+	if count := len(lease.Entries); count >= 10 {
 		t.Errorf("expected byte limit to cap entries, got %d", count)
 	}
 }
 
 func TestFlushBatch_EmptyBuffer(t *testing.T) {
 	m := newManagerWithMockLoki(newTestConfig(), "http://unused")
-	req, count := m.flushBatch()
-	if req != nil || count != 0 {
-		t.Errorf("expected nil/0 for empty buffer, got %v/%d", req, count)
+	req, lease := m.flushBatch()
+	if req != nil || lease != nil {
+		t.Errorf("expected nil/nil for empty buffer, got %v/%v", req, lease)
 	}
 }
 
@@ -539,6 +599,104 @@ func TestFlushLoop_FlushesOnTimer(t *testing.T) {
 	}
 }
 
+func TestFlushLoop_FlushOnlyOnInvokeSuspendsWhileIdle(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.FlushIntervalMs = 20
+	cfg.IdleFlushMultiplier = 1
+	cfg.FlushOnlyOnInvoke = true
+	cfg.BatchSize = 2
+	server, _, _ := startMockLoki(t)
+	defer server.Close()
+	m := newManagerWithMockLoki(cfg, server.URL)
+
+	for i := 0; i < 5; i++ {
+		m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: "test"})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.flushLoop(ctx)
+
+	// Neither the timer nor a full batch flushes while IDLE
+	time.Sleep(150 * time.Millisecond)
+	if n := m.buffer.Len(); n != 5 {
+		t.Fatalf("buffer = %d entries while idle, want 5 (no flush)", n)
+	}
+
+	m.setState(StateActive)
+	deadline := time.Now().Add(2 * time.Second)
+	for m.buffer.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := m.buffer.Len(); n != 0 {
+		t.Errorf("buffer = %d entries after becoming ACTIVE, want 0", n)
+	}
+
+	m.setState(StateIdle)
+	time.Sleep(50 * time.Millisecond)
+	m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: "late"})
+	time.Sleep(100 * time.Millisecond)
+	if n := m.buffer.Len(); n != 1 {
+		t.Errorf("buffer = %d entries after returning to IDLE, want 1", n)
+	}
+}
+
+func TestAwaitLateTelemetry_FlushesUntilReport(t *testing.T) {
+	server, pushCount, bodies := startMockLoki(t)
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.PostInvokeWindowMs = 2000
+	m := newManagerWithMockLoki(cfg, server.URL)
+	m.telemetryServer = telemetryapi.NewServer(m.buffer, 0, 0, false, nil)
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		m.telemetryServer.Ingest([]telemetryapi.TelemetryEvent{
+			{Time: now, Type: telemetryapi.EventTypeFunction, Record: "late line"},
+			{Time: now, Type: telemetryapi.EventTypePlatformReport, Record: map[string]interface{}{
+				"requestId": "req-1",
+				"status":    "success",
+				"metrics":   map[string]interface{}{"durationMs": 1.0},
+			}},
+		})
+	}()
+
+	start := time.Now()
+	m.awaitLateTelemetry(context.Background(), "req-1")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("awaitLateTelemetry took %v, want early return once the report arrived", elapsed)
+	}
+	if m.buffer.Len() != 0 {
+		t.Errorf("buffer = %d entries, want 0", m.buffer.Len())
+	}
+	if *pushCount == 0 || !strings.Contains(string(bytes.Join(*bodies, nil)), "late line") {
+		t.Error("late line was not pushed")
+	}
+}
+
+func TestAwaitLateTelemetry_StopsAtWindow(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.PostInvokeWindowMs = 50
+	m := newTestManager(cfg)
+	m.telemetryServer = telemetryapi.NewServer(m.buffer, 0, 0, false, nil)
+
+	start := time.Now()
+	m.awaitLateTelemetry(context.Background(), "req-1")
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("awaitLateTelemetry took %v without a report, want about 50ms", elapsed)
+	}
+
+	// Disabled by default
+	m.cfg.PostInvokeWindowMs = 0
+	start = time.Now()
+	m.awaitLateTelemetry(context.Background(), "req-1")
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("awaitLateTelemetry took %v with the window disabled, want immediate return", elapsed)
+	}
+}
+
 func TestFlushLoop_IntervalChangesOnStateTransition(t *testing.T) {
 	cfg := newTestConfig()
 	cfg.FlushIntervalMs = 100
@@ -559,6 +717,130 @@ func TestFlushLoop_IntervalChangesOnStateTransition(t *testing.T) {
 	// No panic/deadlock = pass. Interval change was processed.
 }
 
+type fakeDeadLetter struct {
+	mu   sync.Mutex
+	reqs []*loki.PushRequest
+}
+
+func (f *fakeDeadLetter) Write(ctx context.Context, req *loki.PushRequest) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reqs = append(f.reqs, req)
+	return "key", nil
+}
+
+func TestCriticalFlush_DeadLettersFailedBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	m := newManagerWithMockLoki(newTestConfig(), server.URL)
+	dl := &fakeDeadLetter{}
+	m.deadLetter = dl
+
+	for i := 0; i < 3; i++ {
+		m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: "test"})
+	}
+	m.criticalFlush(context.Background())
+
+	if len(dl.reqs) != 1 {
+		t.Fatalf("expected 1 dead-lettered batch, got %d", len(dl.reqs))
+	}
+	if got := len(dl.reqs[0].Streams[0].Values); got != 3 {
+		t.Errorf("expected 3 entries in dead-letter batch, got %d", got)
+	}
+}
+
+func TestCriticalFlush_NoDeadLetterOnSuccess(t *testing.T) {
+	server, _, _ := startMockLoki(t)
+	defer server.Close()
+
+	m := newManagerWithMockLoki(newTestConfig(), server.URL)
+	dl := &fakeDeadLetter{}
+	m.deadLetter = dl
+
+	m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: "test"})
+	m.criticalFlush(context.Background())
+
+	if len(dl.reqs) != 0 {
+		t.Errorf("expected no dead-letter writes, got %d", len(dl.reqs))
+	}
+}
+
+func TestCriticalFlush_SpoolsFailedBatch(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer failing.Close()
+
+	cfg := newTestConfig()
+	m := newManagerWithMockLoki(cfg, failing.URL)
+	m.spool = deadletter.NewSpool(t.TempDir(), 0, 0)
+	dl := &fakeDeadLetter{}
+	m.deadLetter = dl
+
+	m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: "test"})
+	m.criticalFlush(context.Background())
+
+	if m.spool.Len() != 1 {
+		t.Fatalf("expected 1 spooled batch, got %d", m.spool.Len())
+	}
+	if len(dl.reqs) != 0 {
+		t.Errorf("expected no dead-letter writes for a spooled batch, got %d", len(dl.reqs))
+	}
+
+	// The next INVOKE finds Loki back up
+	server, pushCount, _ := startMockLoki(t)
+	defer server.Close()
+	cfg.LokiEndpoint = server.URL
+	m.lokiClient = loki.NewClient(cfg)
+
+	m.redeliverSpooled(context.Background())
+	if *pushCount != 1 || m.spool.Len() != 0 {
+		t.Errorf("pushes = %d, spooled = %d; want the batch redelivered", *pushCount, m.spool.Len())
+	}
+}
+
+func TestFlush_DeadLettersUndeliverableEntries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	m := newManagerWithMockLoki(newTestConfig(), server.URL)
+	m.buffer.SetMaxAttempts(1)
+	dl := &fakeDeadLetter{}
+	m.deadLetter = dl
+
+	m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: "test"})
+	m.flush(context.Background())
+
+	if m.buffer.Len() != 0 || len(dl.reqs) != 1 {
+		t.Errorf("buffered = %d, dead-lettered = %d; want 0 and 1", m.buffer.Len(), len(dl.reqs))
+	}
+}
+
+func TestPushAllCritical_DeadLettersDuringShutdown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	m := newManagerWithMockLoki(newTestConfig(), server.URL)
+	m.spool = deadletter.NewSpool(t.TempDir(), 0, 0)
+	dl := &fakeDeadLetter{}
+	m.deadLetter = dl
+	m.shuttingDown.Store(true)
+
+	req := loki.NewPushRequest(m.labels, [][]string{{"1000000", "test"}})
+	_ = m.pushAllCritical(context.Background(), []*loki.PushRequest{req})
+
+	if m.spool.Len() != 0 || len(dl.reqs) != 1 {
+		t.Errorf("spooled = %d, dead-lettered = %d; want 0 and 1", m.spool.Len(), len(dl.reqs))
+	}
+}
+
 // =====================
 // 7.4 onRuntimeDone
 // =====================
@@ -585,7 +867,7 @@ func TestOnRuntimeDone_TriggersFlushAndSignals(t *testing.T) {
 
 	done := make(chan struct{})
 	go func() {
-		m.onRuntimeDone("req-123")
+		m.onRuntimeDone("req-123", "success")
 		close(done)
 	}()
 
@@ -611,13 +893,32 @@ func TestOnRuntimeDone_TriggersFlushAndSignals(t *testing.T) {
 	}
 }
 
+func TestOnRuntimeDone_WithoutInvokeLeavesFlushToTimer(t *testing.T) {
+	server, pushCount, _ := startMockLoki(t)
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.ExtensionEvents = []string{"SHUTDOWN"}
+	m := newManagerWithMockLoki(cfg, server.URL)
+	m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: "test"})
+
+	m.onRuntimeDone("req-123", "success")
+
+	if *pushCount != 0 {
+		t.Errorf("expected no critical flush without INVOKE, got %d pushes", *pushCount)
+	}
+	if m.getState() != StateIdle {
+		t.Errorf("expected state to stay IDLE, got %s", m.getState())
+	}
+}
+
 // =====================
 // 7.6 Label Building
 // =====================
 
 func TestBuildLabels_FunctionLabels(t *testing.T) {
 	m := newTestManager(newTestConfig())
-	labels := m.buildLabels(&RegisterResponse{
+	labels := m.buildLabels(m.cfg, &RegisterResponse{
 		FunctionName:    "my-func",
 		FunctionVersion: "$LATEST",
 	})
@@ -631,7 +932,7 @@ func TestBuildLabels_FunctionLabels(t *testing.T) {
 
 func TestBuildLabels_SourceLabel(t *testing.T) {
 	m := newTestManager(newTestConfig())
-	labels := m.buildLabels(&RegisterResponse{FunctionName: "f", FunctionVersion: "1"})
+	labels := m.buildLabels(m.cfg, &RegisterResponse{FunctionName: "f", FunctionVersion: "1"})
 	if labels["source"] != "lambda" {
 		t.Errorf("expected source=lambda, got %s", labels["source"])
 	}
@@ -641,7 +942,7 @@ func TestBuildLabels_CustomLabelsMerged(t *testing.T) {
 	cfg := newTestConfig()
 	cfg.Labels = map[string]string{"custom": "value", "env": "prod"}
 	m := newTestManager(cfg)
-	labels := m.buildLabels(&RegisterResponse{FunctionName: "f", FunctionVersion: "1"})
+	labels := m.buildLabels(m.cfg, &RegisterResponse{FunctionName: "f", FunctionVersion: "1"})
 	if labels["custom"] != "value" {
 		t.Errorf("expected custom=value, got %s", labels["custom"])
 	}
@@ -654,7 +955,7 @@ func TestBuildLabels_AutoLabelsOverrideCustom(t *testing.T) {
 	cfg := newTestConfig()
 	cfg.Labels = map[string]string{"function_name": "should-be-overridden"}
 	m := newTestManager(cfg)
-	labels := m.buildLabels(&RegisterResponse{FunctionName: "real-name", FunctionVersion: "1"})
+	labels := m.buildLabels(m.cfg, &RegisterResponse{FunctionName: "real-name", FunctionVersion: "1"})
 	if labels["function_name"] != "real-name" {
 		t.Errorf("expected auto label to win, got %s", labels["function_name"])
 	}
@@ -698,6 +999,37 @@ func TestClient_Register(t *testing.T) {
 	}
 }
 
+func TestClient_RegisterEvents(t *testing.T) {
+	var got map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set(extensionIDHeader, "test-ext-id")
+		_ = json.NewEncoder(w).Encode(RegisterResponse{FunctionName: "test-func"})
+	}))
+	defer server.Close()
+
+	c := &Client{
+		baseURL:       server.URL + "/2020-01-01/extension",
+		httpClient:    &http.Client{},
+		extensionName: "lambdawatch",
+	}
+
+	if _, err := c.Register(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(got["events"], ",") != "INVOKE,SHUTDOWN" {
+		t.Errorf("default events = %v, want INVOKE and SHUTDOWN", got["events"])
+	}
+
+	c.SetEvents(registeredEvents(&config.Config{ExtensionEvents: []string{"SHUTDOWN"}}))
+	if _, err := c.Register(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(got["events"], ",") != "SHUTDOWN" {
+		t.Errorf("events = %v, want SHUTDOWN only", got["events"])
+	}
+}
+
 func TestClient_Register_Failure(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -773,3 +1105,244 @@ func TestClient_NextEvent_Shutdown(t *testing.T) {
 		t.Errorf("expected spindown, got %s", event.ShutdownReason)
 	}
 }
+
+// --- Shutdown deadline ---
+
+func TestNewShutdownContext_UsesEventDeadline(t *testing.T) {
+	m := newTestManager(newTestConfig())
+	deadline := time.Now().Add(2 * time.Second)
+
+	ctx, cancel := m.newShutdownContext(deadline.UnixMilli())
+	defer cancel()
+
+	got, ok := ctx.Deadline()
+	if !ok {
+		t.Fatal("expected a deadline")
+	}
+	want := deadline.Add(-flushDeadlineMargin)
+	if diff := got.Sub(want); diff > time.Millisecond || diff < -time.Millisecond {
+		t.Errorf("deadline = %v, want %v", got, want)
+	}
+}
+
+func TestNewShutdownContext_MissingDeadlineFallsBack(t *testing.T) {
+	m := newTestManager(newTestConfig())
+
+	ctx, cancel := m.newShutdownContext(0)
+	defer cancel()
+
+	if ctx.Err() != nil {
+		t.Fatal("expected fallback context to be live, not already expired")
+	}
+	got, _ := ctx.Deadline()
+	if remaining := time.Until(got); remaining > shutdownTimeout {
+		t.Errorf("fallback deadline %v exceeds the shutdown window", remaining)
+	}
+}
+
+func TestEscalatedFlushContext_ExpiredGetsGrace(t *testing.T) {
+	m := newTestManager(newTestConfig())
+
+	// A timed-out invocation reaches runtimeDone after its deadline
+	expired, cancelExpired := m.newFlushContext(time.Now().Add(-time.Second).UnixMilli())
+	defer cancelExpired()
+
+	ctx, cancel := m.escalatedFlushContext(expired)
+	defer cancel()
+
+	if ctx.Err() != nil {
+		t.Fatal("expected escalated context to be live")
+	}
+	got, ok := ctx.Deadline()
+	if !ok || time.Until(got) > failedFlushGrace {
+		t.Errorf("deadline %v, want within %v", got, failedFlushGrace)
+	}
+}
+
+func TestShutdown_BoundedByDeadline(t *testing.T) {
+	unblock := make(chan struct{})
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer slowServer.Close()
+	defer close(unblock)
+
+	cfg := newTestConfig()
+	m := newManagerWithMockLoki(cfg, slowServer.URL)
+	m.telemetryServer = telemetryapi.NewServer(m.buffer, 0, 0, false, nil)
+	m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: "final"})
+
+	ctx, cancel := m.newShutdownContext(time.Now().Add(time.Second).UnixMilli())
+	defer cancel()
+
+	start := time.Now()
+	if err := m.shutdown(ctx); err != nil {
+		t.Fatalf("shutdown() error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("shutdown took %v, expected to finish before the SHUTDOWN deadline", elapsed)
+	}
+}
+
+func TestShutdown_KeepsBatchOfFailedInFlightPush(t *testing.T) {
+	started := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case started <- struct{}{}:
+			time.Sleep(300 * time.Millisecond)
+		default:
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	m := newManagerWithMockLoki(newTestConfig(), server.URL)
+	m.telemetryServer = telemetryapi.NewServer(m.buffer, 0, 0, false, nil)
+	dl := &fakeDeadLetter{}
+	m.deadLetter = dl
+	for i := 0; i < 3; i++ {
+		m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: fmt.Sprintf("log %d", i)})
+	}
+
+	go m.flush(context.Background())
+	<-started
+
+	ctx, cancel := m.newShutdownContext(time.Now().Add(5 * time.Second).UnixMilli())
+	defer cancel()
+	if err := m.shutdown(ctx); err != nil {
+		t.Fatalf("shutdown() error: %v", err)
+	}
+
+	var kept int
+	for _, req := range dl.reqs {
+		kept += len(req.Streams[0].Values)
+	}
+	if kept != 3 || m.buffer.Dropped() != 0 {
+		t.Errorf("dead-lettered = %d, dropped = %d; want all 3 dead-lettered", kept, m.buffer.Dropped())
+	}
+}
+
+func TestEndOfLife_FlushesBuffer(t *testing.T) {
+	server, pushCount, _ := startMockLoki(t)
+	defer server.Close()
+
+	m := newManagerWithMockLoki(newTestConfig(), server.URL)
+	m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: "last words"})
+
+	m.endOfLife()
+	if *pushCount != 1 || m.buffer.Len() != 0 {
+		t.Errorf("pushes = %d, buffered = %d; want the buffer flushed", *pushCount, m.buffer.Len())
+	}
+
+	// Run stopping after a SHUTDOWN event does not flush again
+	m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: "late"})
+	m.endOfLife()
+	if *pushCount != 1 {
+		t.Errorf("pushes = %d after a second endOfLife, want 1", *pushCount)
+	}
+}
+
+// --- Concurrent flush workers ---
+
+// startConcurrencyLoki returns a mock Loki that records the peak number of
+// in-flight pushes
+func startConcurrencyLoki(t *testing.T, delay time.Duration) (*httptest.Server, *atomic.Int32, *atomic.Int32) {
+	var inFlight, peak, pushes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(delay)
+		inFlight.Add(-1)
+		pushes.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server, &peak, &pushes
+}
+
+func TestCriticalFlush_ParallelWorkers(t *testing.T) {
+	server, peak, pushes := startConcurrencyLoki(t, 50*time.Millisecond)
+
+	cfg := newTestConfig()
+	cfg.FlushWorkers = 4
+	m := newManagerWithMockLoki(cfg, server.URL)
+	for i := 0; i < 400; i++ {
+		m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: fmt.Sprintf("log %d", i)})
+	}
+
+	m.criticalFlush(context.Background())
+
+	if pushes.Load() != 4 {
+		t.Errorf("expected 4 pushes, got %d", pushes.Load())
+	}
+	if peak.Load() < 2 {
+		t.Errorf("expected batches pushed in parallel, peak in-flight was %d", peak.Load())
+	}
+	if peak.Load() > 4 {
+		t.Errorf("peak in-flight %d exceeds worker count", peak.Load())
+	}
+}
+
+func TestFlush_ParallelWorkersOnlyForFullBatches(t *testing.T) {
+	server, _, pushes := startConcurrencyLoki(t, 0)
+
+	cfg := newTestConfig()
+	cfg.FlushWorkers = 4
+	m := newManagerWithMockLoki(cfg, server.URL)
+	for i := 0; i < 250; i++ {
+		m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: fmt.Sprintf("log %d", i)})
+	}
+
+	m.flush(context.Background())
+
+	// Two full batches go out together; the 50-entry remainder waits
+	if pushes.Load() != 2 {
+		t.Errorf("expected 2 pushes, got %d", pushes.Load())
+	}
+	if m.buffer.Len() != 50 {
+		t.Errorf("expected 50 entries left, got %d", m.buffer.Len())
+	}
+}
+
+func TestNewManager_ExtensionLogsOffSkipsBuffer(t *testing.T) {
+	defer logger.SetBuffer(nil)
+
+	cfg := newTestConfig()
+	m := NewManager(cfg)
+	logger.Info("mirrored")
+	if m.buffer.Len() != 1 {
+		t.Errorf("buffer holds %d entries, want the extension's log line", m.buffer.Len())
+	}
+
+	cfg.ExtensionLogs = config.ExtensionLogsOff
+	m = NewManager(cfg)
+	logger.Info("stdout only")
+	if m.buffer.Len() != 0 {
+		t.Errorf("buffer holds %d entries with LOKI_EXTENSION_LOGS=off, want 0", m.buffer.Len())
+	}
+}
+
+func TestManager_PushStatsTrackConsecutiveFailures(t *testing.T) {
+	m := newTestManager(newTestConfig())
+
+	if last, failures := m.pushStats(); !last.IsZero() || failures != 0 {
+		t.Fatalf("initial stats = (%v, %d)", last, failures)
+	}
+
+	m.observePush(time.Now(), errors.New("push failed"))
+	m.observePush(time.Now(), errors.New("push failed"))
+	if _, failures := m.pushStats(); failures != 2 {
+		t.Errorf("failures = %d, want 2", failures)
+	}
+
+	m.observePush(time.Now(), nil)
+	last, failures := m.pushStats()
+	if failures != 0 || last.IsZero() {
+		t.Errorf("after success stats = (%v, %d)", last, failures)
+	}
+}
@@ -0,0 +1,99 @@
+package extension
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+	"github.com/mumzworld-tech/lambdawatch/internal/telemetryapi"
+)
+
+// localFunctionName names the function in local mode when
+// AWS_LAMBDA_FUNCTION_NAME is not set
+const localFunctionName = "local"
+
+// RunLocal runs the extension outside Lambda. Nothing is registered with the
+// Extensions or Telemetry APIs; instead every line read from r is handled as
+// a function log line and goes through the same pipeline, batching and sinks.
+// It returns after a final flush once r is exhausted or ctx is cancelled.
+func (m *Manager) RunLocal(ctx context.Context, r io.Reader) error {
+	if err := m.setup(localRegisterResponse()); err != nil {
+		return err
+	}
+	logger.Infof("Local mode: shipping lines for function %s", m.regResp.FunctionName)
+
+	m.setState(StateActive)
+	m.startFlushLoop(ctx)
+
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	go readLines(r, lines, readErr)
+
+	var err error
+loop:
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				err = <-readErr
+				break loop
+			}
+			m.telemetryServer.Ingest([]telemetryapi.TelemetryEvent{{
+				Time:   time.Now().UTC().Format(time.RFC3339Nano),
+				Type:   telemetryapi.EventTypeFunction,
+				Record: line,
+			}})
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	shutCtx, cancel := m.newShutdownContext(0)
+	defer cancel()
+	if shutErr := m.shutdown(shutCtx); err == nil {
+		err = shutErr
+	}
+	return err
+}
+
+// localRegisterResponse stands in for the registration response, taking the
+// function's identity from the standard Lambda variables when they are set
+func localRegisterResponse() *RegisterResponse {
+	resp := &RegisterResponse{
+		FunctionName:    os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+		FunctionVersion: os.Getenv("AWS_LAMBDA_FUNCTION_VERSION"),
+	}
+	if resp.FunctionName == "" {
+		resp.FunctionName = localFunctionName
+	}
+	if resp.FunctionVersion == "" {
+		resp.FunctionVersion = "$LATEST"
+	}
+	return resp
+}
+
+// readLines sends each line of r, without its line ending, until r is
+// exhausted. It then closes lines and reports the read error, if any.
+func readLines(r io.Reader, lines chan<- string, readErr chan<- error) {
+	defer close(lines)
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			lines <- line
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			readErr <- err
+			return
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package extension
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/lambdatest"
+)
+
+func TestRunLocal_ShipsInputLines(t *testing.T) {
+	env := lambdatest.New(t)
+	t.Setenv("AWS_LAMBDA_FUNCTION_NAME", "")
+	cfg := newTestConfig()
+	cfg.LokiEndpoint = env.LokiURL
+
+	m := NewManager(cfg)
+	input := strings.NewReader("local line 1\r\n\nlocal line 2\nlocal line 3")
+	if err := m.RunLocal(context.Background(), input); err != nil {
+		t.Fatalf("RunLocal() error = %v", err)
+	}
+
+	lines := env.FunctionLines("local line")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, delivered:\n%s", len(lines), env)
+	}
+	for i, l := range lines {
+		if want := "local line " + string(rune('1'+i)); l.Message != want {
+			t.Errorf("line %d = %q, want %q", i, l.Message, want)
+		}
+		if l.Labels["function_name"] != localFunctionName {
+			t.Errorf("line %d labels = %v", i, l.Labels)
+		}
+	}
+}
+
+func TestRunLocal_StopsOnCancel(t *testing.T) {
+	env := lambdatest.New(t)
+	cfg := newTestConfig()
+	cfg.LokiEndpoint = env.LokiURL
+
+	m := NewManager(cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.RunLocal(ctx, blockingReader{}) }()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("RunLocal() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunLocal() did not return after cancel")
+	}
+}
+
+// blockingReader never returns, like an idle terminal or pipe
+type blockingReader struct{}
+
+func (blockingReader) Read([]byte) (int, error) {
+	select {}
+}
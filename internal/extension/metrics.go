@@ -0,0 +1,105 @@
+package extension
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+	"github.com/mumzworld-tech/lambdawatch/internal/metrics"
+	"github.com/mumzworld-tech/lambdawatch/internal/telemetryapi"
+)
+
+// newMetricsWriter creates the remote-write exporter when PROM_REMOTE_WRITE_URL
+// is set. Each sandbox gets its own series via the instance label.
+func (m *Manager) newMetricsWriter(regResp *RegisterResponse) *metrics.Writer {
+	if m.cfg.PromRemoteWriteURL == "" {
+		return nil
+	}
+	labels := map[string]string{
+		"job":           "lambdawatch",
+		"function_name": regResp.FunctionName,
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		labels["region"] = region
+	}
+	if stream := os.Getenv("AWS_LAMBDA_LOG_STREAM_NAME"); stream != "" {
+		labels["instance"] = stream
+	}
+	return metrics.NewWriter(m.cfg, labels)
+}
+
+// exportMetrics sends the extension's metrics once
+// PROM_REMOTE_WRITE_INTERVAL_MS has passed, or unconditionally when force
+// is set. It runs after the critical flush so it never delays log delivery.
+func (m *Manager) exportMetrics(ctx context.Context, force bool) {
+	if m.metricsWriter == nil {
+		return
+	}
+	interval := time.Duration(m.cfg.PromRemoteWriteIntervalMs) * time.Millisecond
+	if !force && !m.lastExport.IsZero() && time.Since(m.lastExport) < interval {
+		return
+	}
+	m.lastExport = time.Now()
+
+	samples := m.metrics.Snapshot(m.buffer.Len(), m.buffer.Dropped())
+	samples = append(samples, labelGuardSamples(m.batcher.LabelGuardStats())...)
+	samples = append(samples,
+		metrics.Sample{Name: "lambdawatch_rate_limited_entries_total", Value: float64(m.batcher.RateLimited())},
+		metrics.Sample{Name: "lambdawatch_tail_sampled_entries_total", Value: float64(m.telemetryServer.TailSampledOut())},
+		metrics.Sample{Name: "lambdawatch_tail_dropped_early_entries_total", Value: float64(m.telemetryServer.TailDroppedEarly())},
+		metrics.Sample{Name: "lambdawatch_entries_expired_total", Value: float64(m.buffer.Expired())},
+		metrics.Sample{Name: "lambdawatch_entries_undeliverable_total", Value: float64(m.buffer.Undeliverable())},
+		metrics.Sample{Name: "lambdawatch_buffer_oldest_entry_age_seconds", Value: m.buffer.OldestAge().Seconds()},
+	)
+	if m.kafka != nil {
+		samples = append(samples, metrics.Sample{Name: "lambdawatch_kafka_records_dropped_total", Value: float64(m.kafka.Dropped())})
+	}
+	samples = append(samples, compressionSamples(m.lokiClient.CompressionStats())...)
+	if err := m.metricsWriter.Write(ctx, samples, m.lastExport); err != nil {
+		logger.Warnf("Metrics export failed: %v", err)
+	}
+}
+
+// observeReport feeds an invocation's platform.report into the exported metrics
+func (m *Manager) observeReport(r telemetryapi.ReportMetrics) {
+	m.metrics.ObserveInvocation(r.DurationMs, r.MaxMemoryUsedMB, r.MemorySizeMB, r.ColdStart)
+}
+
+// observeOverhead records how long runtimeDone handling held up the
+// invocation in total and how much of that the critical flush took
+func (m *Manager) observeOverhead(log *logger.Logger, total, flush time.Duration) {
+	if m.metrics == nil {
+		return
+	}
+	m.metrics.ObserveOverhead(total, flush)
+	log.Debugf("Post-invoke overhead %v (critical flush %v); sandbox p50 %v, p95 %v",
+		total.Round(time.Microsecond), flush.Round(time.Microsecond),
+		m.metrics.OverheadQuantile(0.5).Round(time.Microsecond), m.metrics.OverheadQuantile(0.95).Round(time.Microsecond))
+}
+
+// labelGuardSamples reports label governance interventions by action
+func labelGuardSamples(stats loki.LabelGuardStats) []metrics.Sample {
+	const name = "lambdawatch_label_guard_interventions_total"
+	return []metrics.Sample{
+		{Name: name, Labels: map[string]string{"action": "sanitized"}, Value: float64(stats.Sanitized)},
+		{Name: name, Labels: map[string]string{"action": "dropped"}, Value: float64(stats.Dropped)},
+		{Name: name, Labels: map[string]string{"action": "truncated"}, Value: float64(stats.Truncated)},
+		{Name: name, Labels: map[string]string{"action": "overflowed"}, Value: float64(stats.Overflowed)},
+	}
+}
+
+// compressionSamples reports the achieved compression ratio and the
+// auto-tuner's decision
+func compressionSamples(stats loki.CompressionStats) []metrics.Sample {
+	enabled := 0.0
+	if stats.Enabled {
+		enabled = 1
+	}
+	return []metrics.Sample{
+		{Name: "lambdawatch_compression_ratio", Value: stats.Ratio},
+		{Name: "lambdawatch_compression_threshold_bytes", Value: float64(stats.Threshold)},
+		{Name: "lambdawatch_compression_enabled", Value: enabled},
+	}
+}
@@ -0,0 +1,90 @@
+package extension
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/metrics"
+	"github.com/mumzworld-tech/lambdawatch/internal/telemetryapi"
+)
+
+func TestExportMetrics_RespectsInterval(t *testing.T) {
+	var writes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writes.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	cfg := newTestConfig()
+	cfg.PromRemoteWriteURL = srv.URL
+	cfg.PromRemoteWriteIntervalMs = 60000
+	m := newTestManager(cfg)
+	m.metrics = metrics.NewRegistry()
+	m.metricsWriter = m.newMetricsWriter(&RegisterResponse{FunctionName: "fn"})
+
+	m.observePush(time.Now(), nil)
+	m.exportMetrics(context.Background(), false)
+	m.exportMetrics(context.Background(), false)
+	if got := writes.Load(); got != 1 {
+		t.Fatalf("expected 1 export within the interval, got %d", got)
+	}
+
+	// Shutdown exports regardless of the interval
+	m.exportMetrics(context.Background(), true)
+	if got := writes.Load(); got != 2 {
+		t.Errorf("expected forced export, got %d writes", got)
+	}
+}
+
+func TestExportMetrics_DisabledWithoutURL(t *testing.T) {
+	m := newTestManager(newTestConfig())
+	if m.newMetricsWriter(&RegisterResponse{FunctionName: "fn"}) != nil {
+		t.Fatal("expected no writer without PROM_REMOTE_WRITE_URL")
+	}
+	m.exportMetrics(context.Background(), true) // must not panic
+}
+
+func TestObserveReport_FeedsRegistry(t *testing.T) {
+	m := newTestManager(newTestConfig())
+	m.metrics = metrics.NewRegistry()
+	m.observeReport(telemetryapi.ReportMetrics{DurationMs: 1500, MemorySizeMB: 256, MaxMemoryUsedMB: 64, ColdStart: true})
+
+	values := map[string]float64{}
+	for _, s := range m.metrics.Snapshot(0, 0) {
+		values[s.Name] = s.Value
+	}
+	if values["lambdawatch_invocation_duration_seconds_sum"] != 1.5 ||
+		values["lambdawatch_cold_starts_total"] != 1 ||
+		values["lambdawatch_memory_utilization_ratio"] != 0.25 {
+		t.Errorf("unexpected metrics %v", values)
+	}
+}
+
+func TestOnRuntimeDone_ObservesOverhead(t *testing.T) {
+	server, _, _ := startMockLoki(t)
+	defer server.Close()
+
+	m := newManagerWithMockLoki(newTestConfig(), server.URL)
+	m.metrics = metrics.NewRegistry()
+	m.invocationDeadline.Store(time.Now().Add(time.Minute).UnixMilli())
+	m.buffer.Add(buffer.LogEntry{Timestamp: time.Now().UnixMilli(), Message: "log"})
+	m.onRuntimeDone("req-1", "success")
+
+	values := map[string]float64{}
+	for _, s := range m.metrics.Snapshot(0, 0) {
+		if s.Labels["quantile"] == "" {
+			values[s.Name] = s.Value
+		}
+	}
+	if values["lambdawatch_post_invoke_overhead_seconds_count"] != 1 ||
+		values["lambdawatch_post_invoke_flush_seconds_sum"] <= 0 ||
+		values["lambdawatch_post_invoke_flush_seconds_sum"] > values["lambdawatch_post_invoke_overhead_seconds_sum"] {
+		t.Errorf("unexpected overhead metrics %v", values)
+	}
+}
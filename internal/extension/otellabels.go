@@ -0,0 +1,12 @@
+package extension
+
+// addResourceARNLabels sets cloud_account_id and cloud_region from arn, to
+// complete loki.AddResourceLabels. It does nothing until an INVOKE has
+// supplied the ARN.
+func addResourceARNLabels(labels map[string]string, arn functionARN) {
+	if arn.AccountID == "" {
+		return
+	}
+	labels["cloud_account_id"] = arn.AccountID
+	labels["cloud_region"] = arn.Region
+}
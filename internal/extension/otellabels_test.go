@@ -0,0 +1,40 @@
+package extension
+
+import "testing"
+
+func TestBuildLabels_OTelResourceLabels(t *testing.T) {
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_LAMBDA_LOG_STREAM_NAME", "2026/02/05/[$LATEST]abc")
+
+	cfg := newTestConfig()
+	m := newTestManager(cfg)
+	reg := &RegisterResponse{FunctionName: "orders", FunctionVersion: "7"}
+
+	if labels := m.buildLabels(cfg, reg); labels["faas_name"] != "" {
+		t.Errorf("resource labels added while disabled: %v", labels)
+	}
+
+	cfg.OTelResourceLabels = true
+	m.labels = m.buildLabels(cfg, reg)
+	want := map[string]string{
+		"faas_name":    "orders",
+		"faas_version": "7",
+		"cloud_region": "eu-west-1",
+	}
+	for k, v := range want {
+		if m.labels[k] != v {
+			t.Errorf("%s = %q, want %q", k, m.labels[k], v)
+		}
+	}
+	if _, ok := m.labels["faas_instance"]; ok {
+		t.Error("faas_instance set as a label, want structured metadata")
+	}
+	if _, ok := m.labels["cloud_account_id"]; ok {
+		t.Error("cloud_account_id set before the first INVOKE")
+	}
+
+	m.applyInvokedARN("arn:aws:lambda:eu-west-1:123456789012:function:orders")
+	if got := m.currentLabels()["cloud_account_id"]; got != "123456789012" {
+		t.Errorf("cloud_account_id = %q after INVOKE, want 123456789012", got)
+	}
+}
@@ -0,0 +1,108 @@
+package extension
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+	"github.com/mumzworld-tech/lambdawatch/internal/telemetryapi"
+)
+
+// pushErrorHistory is how many failed pushes are kept for /health and the
+// shutdown summary
+const pushErrorHistory = 10
+
+// pushResults fans Loki push results out to registered callbacks and keeps
+// the most recent failures in memory
+type pushResults struct {
+	mu        sync.Mutex
+	callbacks []func(loki.PushResult)
+	errors    []telemetryapi.PushFailure // ring of the last pushErrorHistory failures
+	next      int                        // ring slot overwritten by the next failure
+	failed    uint64
+	succeeded uint64
+}
+
+// OnPushResult registers fn to receive the result of every Loki push,
+// including the status code, attempt count and duration. Register before
+// Run; fn is called from flush workers and must not block.
+func (m *Manager) OnPushResult(fn func(loki.PushResult)) {
+	m.pushResults.mu.Lock()
+	defer m.pushResults.mu.Unlock()
+	m.pushResults.callbacks = append(m.pushResults.callbacks, fn)
+}
+
+// RecentPushErrors returns the last failed pushes, oldest first
+func (m *Manager) RecentPushErrors() []telemetryapi.PushFailure {
+	return m.pushResults.recent()
+}
+
+// handlePushResult is the Loki client's result hook
+func (m *Manager) handlePushResult(r loki.PushResult) {
+	m.pushResults.record(r, time.Now())
+}
+
+func (p *pushResults) record(r loki.PushResult, now time.Time) {
+	p.mu.Lock()
+	if r.Success {
+		p.succeeded++
+	} else {
+		p.failed++
+		failure := telemetryapi.PushFailure{
+			Time:       now,
+			Error:      r.Err.Error(),
+			StatusCode: r.StatusCode,
+			Attempts:   r.Attempts,
+			DurationMs: r.Duration.Milliseconds(),
+			Endpoint:   config.RedactURL(r.Endpoint),
+			Critical:   r.Critical,
+			Entries:    r.Entries,
+		}
+		if len(p.errors) < pushErrorHistory {
+			p.errors = append(p.errors, failure)
+		} else {
+			p.errors[p.next] = failure
+		}
+		p.next = (p.next + 1) % pushErrorHistory
+	}
+	callbacks := p.callbacks
+	p.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(r)
+	}
+}
+
+func (p *pushResults) recent() []telemetryapi.PushFailure {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.errors) < pushErrorHistory {
+		return append([]telemetryapi.PushFailure(nil), p.errors...)
+	}
+	out := make([]telemetryapi.PushFailure, 0, pushErrorHistory)
+	out = append(out, p.errors[p.next:]...)
+	return append(out, p.errors[:p.next]...)
+}
+
+func (p *pushResults) counts() (succeeded, failed uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.succeeded, p.failed
+}
+
+// logPushSummary reports push totals and the recent failures at shutdown
+func (m *Manager) logPushSummary() {
+	succeeded, failed := m.pushResults.counts()
+	log := logger.With("pushes_succeeded", succeeded, "pushes_failed", failed)
+	if failed == 0 {
+		log.Debug("Push summary")
+		return
+	}
+	log.Warn("Push summary")
+	for _, f := range m.pushResults.recent() {
+		logger.With("status", f.StatusCode, "attempts", f.Attempts, "duration_ms", f.DurationMs, "endpoint", f.Endpoint).
+			Warnf("Recent push failure at %s: %s", f.Time.UTC().Format(time.RFC3339), f.Error)
+	}
+}
@@ -0,0 +1,75 @@
+package extension
+
+import (
+	"context"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+	"github.com/mumzworld-tech/lambdawatch/internal/logsapi"
+	"github.com/mumzworld-tech/lambdawatch/internal/telemetryapi"
+)
+
+// Receiver is the listener Lambda delivers logs to. The Telemetry API and
+// the legacy Logs API share the {time, type, record} delivery envelope, so
+// telemetryapi.Server serves both; only the subscription differs.
+type Receiver interface {
+	Start() error
+	Restart() error
+	Shutdown(ctx context.Context) error
+	ListenerURI() string
+	Protocol() string
+}
+
+// Subscriber points a Lambda log API at a Receiver's listener
+type Subscriber interface {
+	Subscribe(ctx context.Context, listenerURI string) error
+}
+
+var _ Receiver = (*telemetryapi.Server)(nil)
+
+// newSubscriber returns the subscription client for LOG_SOURCE, delivering
+// to r with the configured buffering
+func (m *Manager) newSubscriber(extensionID string, r Receiver) Subscriber {
+	var c *telemetryapi.Client
+	if m.cfg.LogSource == config.LogSourceLogsAPI {
+		c = logsapi.NewClient(extensionID)
+	} else {
+		c = telemetryapi.NewClient(extensionID)
+	}
+	c.SetProtocol(r.Protocol())
+	c.SetBuffering(telemetryapi.BufferConfig{
+		MaxItems:  m.cfg.TelemetryBufferMaxItems,
+		MaxBytes:  m.cfg.TelemetryBufferMaxBytes,
+		TimeoutMs: m.cfg.TelemetryBufferTimeoutMs,
+	})
+	return c
+}
+
+// subscribe starts the receiver and subscribes it to the log source. If
+// the subscription still fails after retrying, INIT goes on degraded and
+// the subscription is retried in the background.
+func (m *Manager) subscribe(ctx context.Context) error {
+	if err := m.telemetryServer.Start(); err != nil {
+		return err
+	}
+	m.subscriber = m.newSubscriber(m.extClient.GetExtensionID(), m.telemetryServer)
+	err := retryInit(ctx, "Subscribing to "+m.logSourceName(), func(ctx context.Context) error {
+		return m.subscriber.Subscribe(ctx, m.telemetryServer.ListenerURI())
+	})
+	if err != nil {
+		logger.Errorf("Not subscribed to %s, continuing without function logs until a retry succeeds: %v", m.logSourceName(), err)
+		m.telemetryServer.SetDegraded("not subscribed to " + m.logSourceName())
+		go m.supervise(ctx, "subscription retry", m.retrySubscribe)
+		return nil
+	}
+	logger.Debugf("Subscribed to %s", m.logSourceName())
+	return nil
+}
+
+// logSourceName names the subscribed API for logs
+func (m *Manager) logSourceName() string {
+	if m.cfg.LogSource == config.LogSourceLogsAPI {
+		return "Logs API"
+	}
+	return "Telemetry API"
+}
@@ -0,0 +1,90 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+)
+
+const (
+	restartDelay   = 100 * time.Millisecond // pause before restarting a goroutine that panicked
+	salvageTimeout = 2 * time.Second        // bounds the best-effort flush after a panic
+)
+
+// supervise runs loop until it returns, restarting it after a panic so one
+// bad batch cannot stop it for the rest of the sandbox's life
+func (m *Manager) supervise(ctx context.Context, name string, loop func(context.Context)) {
+	for !m.runRecovered(ctx, name, loop) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.stopFlush:
+			return
+		case <-time.After(restartDelay):
+		}
+		logger.Warnf("Restarting %s", name)
+	}
+}
+
+// runRecovered runs loop, reporting whether it returned without panicking
+func (m *Manager) runRecovered(ctx context.Context, name string, loop func(context.Context)) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("Recovered from panic in %s: %v\n%s", name, r, debug.Stack())
+			m.salvage()
+		}
+	}()
+	loop(ctx)
+	return true
+}
+
+// recoverEventLoop turns a panic in the event loop into Run's error. The
+// extension exits with it, so what is buffered is shipped first.
+func (m *Manager) recoverEventLoop(err *error) {
+	if r := recover(); r != nil {
+		logger.Errorf("Recovered from panic in event loop: %v\n%s", r, debug.Stack())
+		m.salvage()
+		*err = fmt.Errorf("event loop panic: %v", r)
+	}
+}
+
+// onTelemetryPanic is called after the telemetry server recovered from a
+// panic while handling a delivery
+func (m *Manager) onTelemetryPanic(interface{}) {
+	m.salvage()
+}
+
+// salvage makes a best-effort attempt to ship what is buffered after a
+// panic, in case the extension does not survive it
+func (m *Manager) salvage() {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("Best-effort flush after panic failed: %v", r)
+		}
+	}()
+	if m.lokiClient == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), salvageTimeout)
+	defer cancel()
+	m.criticalFlush(ctx)
+}
+
+// recoverWorker keeps a panic in a push worker from crashing the extension.
+// The batch the worker leased, if lease points to one it had not settled,
+// goes back to the buffer. The panic counts as a failed delivery attempt, so
+// a batch that panics every time is eventually discarded, and counted by
+// reportDrops; it is not spooled, as building its push requests may be what
+// panicked.
+func (m *Manager) recoverWorker(lease **buffer.Lease) {
+	if r := recover(); r != nil {
+		logger.Errorf("Recovered from panic in push worker: %v\n%s", r, debug.Stack())
+		if lease != nil {
+			m.buffer.Nack(*lease)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package extension
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+)
+
+func TestSupervise_RestartsAfterPanic(t *testing.T) {
+	m := newTestManager(newTestConfig())
+	runs := 0
+	done := make(chan struct{})
+	go func() {
+		m.supervise(context.Background(), "test loop", func(context.Context) {
+			runs++
+			if runs < 3 {
+				panic("bad batch")
+			}
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervise did not return")
+	}
+	if runs != 3 {
+		t.Errorf("loop ran %d times, want 3", runs)
+	}
+}
+
+func TestSupervise_StopsRestartingOnStopFlush(t *testing.T) {
+	m := newTestManager(newTestConfig())
+	close(m.stopFlush)
+	runs := 0
+	m.supervise(context.Background(), "test loop", func(context.Context) {
+		runs++
+		panic("bad batch")
+	})
+	if runs != 1 {
+		t.Errorf("loop ran %d times after stop, want 1", runs)
+	}
+}
+
+func TestRecoverEventLoop_ReturnsError(t *testing.T) {
+	m := newTestManager(newTestConfig())
+	run := func() (err error) {
+		defer m.recoverEventLoop(&err)
+		panic("bad event")
+	}
+	if err := run(); err == nil || err.Error() != "event loop panic: bad event" {
+		t.Errorf("error = %v", err)
+	}
+}
+
+// A push that panics hands its batch back to the buffer, and neither crashes
+// the extension nor leaves the event loop waiting for runtimeDone processing
+func TestOnRuntimeDone_ReleasesEventLoopWhenFlushPanics(t *testing.T) {
+	m := newTestManager(newTestConfig()) // no Loki client: pushing panics
+	m.buffer.Add(buffer.LogEntry{Timestamp: 1, Message: "hello", Type: "function"})
+	m.invocationDeadline.Store(time.Now().Add(5 * time.Second).UnixMilli())
+	done := make(chan struct{})
+	m.invocationDone = done
+
+	m.onRuntimeDone("req-1", "success")
+
+	select {
+	case <-done:
+	default:
+		t.Fatal("invocation not signalled complete")
+	}
+	if m.getState() != StateIdle {
+		t.Errorf("state = %s, want IDLE", m.getState())
+	}
+	if m.buffer.Len() != 1 || m.buffer.Leased() != 0 {
+		t.Errorf("buffer = %d entries (%d leased), want the batch handed back", m.buffer.Len(), m.buffer.Leased())
+	}
+}
@@ -0,0 +1,67 @@
+package extension
+
+import (
+	"context"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+	"github.com/mumzworld-tech/lambdawatch/internal/telemetryapi"
+)
+
+// reloadTimeout bounds a settings fetch so it cannot hold up the next INVOKE
+const reloadTimeout = time.Second
+
+// maybeReload re-resolves labels, filters and sampling from the reload
+// source once LAMBDAWATCH_RELOAD_INTERVAL_MS has passed. It runs between
+// invocations; on any error the current settings are kept.
+func (m *Manager) maybeReload(ctx context.Context) {
+	if m.reloadSource == nil {
+		return
+	}
+	interval := time.Duration(m.cfg.ReloadIntervalMs) * time.Millisecond
+	if !m.lastReload.IsZero() && time.Since(m.lastReload) < interval {
+		return
+	}
+	m.lastReload = time.Now()
+
+	fetchCtx, cancel := context.WithTimeout(ctx, reloadTimeout)
+	defer cancel()
+
+	data, err := m.reloadSource.Fetch(fetchCtx)
+	if err != nil {
+		logger.Warnf("Settings reload failed: %v", err)
+		return
+	}
+	if err := m.applyReload(data); err != nil {
+		logger.Warnf("Ignoring reloaded settings: %v", err)
+	}
+}
+
+// applyReload parses a settings document and swaps in the new labels and
+// pipeline. Nothing is applied unless the whole document is valid.
+func (m *Manager) applyReload(data []byte) error {
+	values, err := config.ParseValues(data)
+	if err != nil {
+		return err
+	}
+	cfg, err := m.cfg.WithReloaded(values)
+	if err != nil {
+		return err
+	}
+	pipeline, err := telemetryapi.NewPipeline(cfg)
+	if err != nil {
+		return err
+	}
+
+	labels := m.buildLabels(cfg, m.regResp)
+	m.labelsMu.Lock()
+	m.labels = labels
+	m.labelsMu.Unlock()
+	if m.telemetryServer != nil {
+		m.telemetryServer.SetPipeline(pipeline)
+	}
+
+	logger.Infof("Reloaded settings (labels: %d, sample rate: %v)", len(cfg.Labels), cfg.LogSampleRate)
+	return nil
+}
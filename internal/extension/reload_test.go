@@ -0,0 +1,77 @@
+package extension
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/telemetryapi"
+)
+
+type fakeSource struct {
+	data  []byte
+	err   error
+	calls int
+}
+
+func (f *fakeSource) Fetch(ctx context.Context) ([]byte, error) {
+	f.calls++
+	return f.data, f.err
+}
+
+func TestApplyReload_SwapsLabelsAndPipeline(t *testing.T) {
+	cfg := newTestConfig()
+	startRate := cfg.LogSampleRate
+	m := newTestManager(cfg)
+	m.telemetryServer = telemetryapi.NewServer(m.buffer, 0, 0, false, nil)
+	m.labels = m.buildLabels(cfg, &RegisterResponse{FunctionName: "fn"})
+	m.regResp = &RegisterResponse{FunctionName: "fn"}
+
+	err := m.applyReload([]byte("LOKI_LABELS: '{\"incident\":\"INC-7\"}'\nLOG_SAMPLE_RATE: 0.5\n"))
+	if err != nil {
+		t.Fatalf("applyReload() error: %v", err)
+	}
+	if got := m.currentLabels()["incident"]; got != "INC-7" {
+		t.Errorf("incident label = %q, want INC-7", got)
+	}
+	if cfg.LogSampleRate != startRate {
+		t.Errorf("startup config must not be modified, got sample rate %v", cfg.LogSampleRate)
+	}
+}
+
+func TestApplyReload_InvalidKeepsCurrent(t *testing.T) {
+	cfg := newTestConfig()
+	m := newTestManager(cfg)
+	m.regResp = &RegisterResponse{FunctionName: "fn"}
+	m.labels = map[string]string{"service_name": "fn"}
+
+	if err := m.applyReload([]byte("LOG_SAMPLE_RATE: 7\n")); err == nil {
+		t.Fatal("expected error for invalid sample rate")
+	}
+	if len(m.currentLabels()) != 1 {
+		t.Errorf("labels changed after rejected reload: %v", m.currentLabels())
+	}
+}
+
+func TestMaybeReload_RespectsInterval(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.ReloadIntervalMs = 60000
+	m := newTestManager(cfg)
+	m.regResp = &RegisterResponse{FunctionName: "fn"}
+	src := &fakeSource{data: []byte("LOG_FILTER_MIN_LEVEL: warn\n")}
+	m.reloadSource = src
+
+	m.maybeReload(context.Background())
+	m.maybeReload(context.Background())
+	if src.calls != 1 {
+		t.Errorf("expected 1 fetch within interval, got %d", src.calls)
+	}
+
+	m.lastReload = time.Now().Add(-2 * time.Minute)
+	src.err = errors.New("unavailable")
+	m.maybeReload(context.Background())
+	if src.calls != 2 {
+		t.Errorf("expected fetch after interval elapsed, got %d", src.calls)
+	}
+}
@@ -0,0 +1,113 @@
+package extension
+
+import (
+	"context"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+)
+
+const (
+	resubscribeBaseDelay = 100 * time.Millisecond // first pause before restarting a failed receiver
+	resubscribeMaxDelay  = 5 * time.Second
+	resubscribeTimeout   = 2 * time.Second // bounds each Subscribe call
+
+	// Register and Subscribe are retried this often during INIT, which
+	// Lambda bounds for all extensions together, so the backoff stays short
+	initRetryAttempts  = 4
+	initRetryBaseDelay = 50 * time.Millisecond
+	initRetryMaxDelay  = time.Second
+)
+
+// retryInit calls fn until it succeeds or initRetryAttempts calls have
+// failed, backing off between them, and returns the last error. A hiccup
+// of the Extensions or Telemetry API at cold start should not cost the
+// sandbox its logs.
+func retryInit(ctx context.Context, what string, fn func(context.Context) error) error {
+	delay := initRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt == initRetryAttempts {
+			return err
+		}
+		logger.Warnf("%s failed (attempt %d of %d): %v", what, attempt, initRetryAttempts, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, initRetryMaxDelay)
+	}
+}
+
+// retrySubscribe keeps renewing a subscription that failed during INIT.
+// Until it succeeds the extension runs degraded: it answers Lambda's events
+// and ships its own logs, but receives no function logs.
+func (m *Manager) retrySubscribe(ctx context.Context) {
+	delay := resubscribeBaseDelay
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.stopFlush:
+			return
+		case <-time.After(delay):
+		}
+
+		subCtx, cancel := context.WithTimeout(ctx, resubscribeTimeout)
+		err := m.subscriber.Subscribe(subCtx, m.telemetryServer.ListenerURI())
+		cancel()
+		if err == nil {
+			m.telemetryServer.SetDegraded("")
+			logger.Infof("Subscribed to %s after %d further attempt(s)", m.logSourceName(), attempt)
+			return
+		}
+		logger.Debugf("Subscription retry %d failed: %v", attempt, err)
+		if delay *= 2; delay > resubscribeMaxDelay {
+			delay = resubscribeMaxDelay
+		}
+	}
+}
+
+// onListenerFailure is called when the telemetry receiver's listener stops
+// with an error. Lambda keeps delivering to the subscribed URI, so without
+// a listener every later log line would be lost; the receiver is started
+// again and the subscription renewed with the registered extension ID.
+func (m *Manager) onListenerFailure(err error) {
+	if !m.restarting.CompareAndSwap(false, true) {
+		return
+	}
+	defer m.restarting.Store(false)
+
+	delay := resubscribeBaseDelay
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-m.stopFlush:
+			return
+		case <-time.After(delay):
+		}
+
+		if err = m.resubscribe(); err == nil {
+			logger.Infof("Telemetry receiver restarted and re-subscribed after %d attempt(s)", attempt)
+			return
+		}
+		logger.Warnf("Failed to restart telemetry receiver (attempt %d): %v", attempt, err)
+		if delay *= 2; delay > resubscribeMaxDelay {
+			delay = resubscribeMaxDelay
+		}
+	}
+}
+
+// resubscribe restarts the telemetry receiver and renews the log source's
+// subscription to its listener
+func (m *Manager) resubscribe() error {
+	if err := m.telemetryServer.Restart(); err != nil {
+		return err
+	}
+	if m.subscriber == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resubscribeTimeout)
+	defer cancel()
+	return m.subscriber.Subscribe(ctx, m.telemetryServer.ListenerURI())
+}
@@ -0,0 +1,131 @@
+package extension
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/lambdatest"
+	"github.com/mumzworld-tech/lambdawatch/internal/telemetryapi"
+)
+
+func TestOnListenerFailure_RestartsAndResubscribes(t *testing.T) {
+	var subscribes atomic.Int32
+	runtime := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Lambda-Extension-Identifier") != "ext-id" {
+			t.Errorf("subscribe without the registered extension ID")
+		}
+		subscribes.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer runtime.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", runtime.URL[len("http://"):])
+
+	m := newTestManager(newTestConfig())
+	m.telemetryServer = telemetryapi.NewServer(m.buffer, lambdatest.FreePort(t), 0, false, nil)
+	m.subscriber = telemetryapi.NewClient("ext-id")
+	if err := m.telemetryServer.Start(); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	defer m.telemetryServer.Shutdown(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		m.onListenerFailure(errors.New("listener gone"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("receiver was not restarted")
+	}
+	if n := subscribes.Load(); n != 1 {
+		t.Errorf("subscribes = %d, want 1", n)
+	}
+}
+
+func TestOnListenerFailure_StopsAtShutdown(t *testing.T) {
+	m := newTestManager(newTestConfig())
+	m.telemetryServer = telemetryapi.NewServer(m.buffer, 0, 0, false, nil)
+	_ = m.telemetryServer.Shutdown(context.Background())
+	close(m.stopFlush)
+
+	done := make(chan struct{})
+	go func() {
+		m.onListenerFailure(errors.New("listener gone"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("restart loop kept running after shutdown")
+	}
+}
+
+func TestRetryInit_SucceedsAfterFailures(t *testing.T) {
+	calls := 0
+	err := retryInit(context.Background(), "test", func(context.Context) error {
+		if calls++; calls < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("retryInit() error: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+}
+
+func TestRetryInit_GivesUp(t *testing.T) {
+	calls := 0
+	err := retryInit(context.Background(), "test", func(context.Context) error {
+		calls++
+		return errors.New("down")
+	})
+	if err == nil {
+		t.Fatal("expected the last error")
+	}
+	if calls != initRetryAttempts {
+		t.Errorf("calls = %d, want %d", calls, initRetryAttempts)
+	}
+}
+
+func TestSubscribe_DegradedUntilRetrySucceeds(t *testing.T) {
+	var subscribes atomic.Int32
+	runtime := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subscribes.Add(1) <= initRetryAttempts {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer runtime.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", runtime.URL[len("http://"):])
+
+	m := newTestManager(newTestConfig())
+	m.extClient = NewClient()
+	m.telemetryServer = telemetryapi.NewServer(m.buffer, lambdatest.FreePort(t), 0, false, nil)
+	defer m.telemetryServer.Shutdown(context.Background())
+	defer close(m.stopFlush)
+
+	if err := m.subscribe(context.Background()); err != nil {
+		t.Fatalf("subscribe() error: %v", err)
+	}
+	if m.telemetryServer.Degraded() == "" {
+		t.Error("not degraded after the subscription failed")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for m.telemetryServer.Degraded() != "" {
+		if time.Now().After(deadline) {
+			t.Fatal("background retry did not clear the degraded status")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
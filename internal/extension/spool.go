@@ -0,0 +1,51 @@
+package extension
+
+import (
+	"context"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+)
+
+// spoolBatch keeps a batch that failed critical retries on disk for a later
+// INVOKE to redeliver, and reports whether it did. Nothing is spooled once
+// SHUTDOWN has begun, since no INVOKE will follow.
+func (m *Manager) spoolBatch(ctx context.Context, pushReq *loki.PushRequest) bool {
+	if m.spool == nil || m.shuttingDown.Load() {
+		return false
+	}
+	name, err := m.spool.Write(ctx, pushReq)
+	if err != nil {
+		logger.Errorf("Failed to spool undelivered batch: %v", err)
+		return false
+	}
+	logger.Warnf("Spooled undelivered batch for redelivery: %s", name)
+	return true
+}
+
+// keepsFailedBatches reports whether a batch that fails critical retries is
+// spooled or dead-lettered rather than returned to the buffer
+func (m *Manager) keepsFailedBatches() bool {
+	return m.deadLetter != nil || (m.spool != nil && !m.shuttingDown.Load())
+}
+
+// redeliverSpooled pushes the batches earlier invocations spooled, oldest
+// first, until one fails
+func (m *Manager) redeliverSpooled(ctx context.Context) {
+	if m.spool == nil {
+		return
+	}
+	delivered, err := m.spool.Redeliver(ctx, func(ctx context.Context, pushReq *loki.PushRequest) error {
+		start := time.Now()
+		err := m.lokiClient.Push(ctx, pushReq)
+		m.observePush(start, err)
+		return err
+	})
+	if delivered > 0 {
+		logger.Infof("Redelivered %d spooled batches", delivered)
+	}
+	if err != nil {
+		logger.Warnf("Spooled batches left for a later attempt (%d remaining): %v", m.spool.Len(), err)
+	}
+}
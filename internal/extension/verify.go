@@ -0,0 +1,141 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+	"github.com/mumzworld-tech/lambdawatch/internal/telemetryapi"
+)
+
+// verifyRetryDelay is how long to wait before querying again when Loki
+// does not yet return every pushed entry
+const verifyRetryDelay = 250 * time.Millisecond
+
+// deliveryLedger counts the entries pushed for the latest invocation, so
+// they can be compared with what Loki returns. An entry belongs to the
+// invocation when its line contains the request ID, which is also how
+// Loki is queried.
+type deliveryLedger struct {
+	mu        sync.Mutex
+	requestID string
+	pushed    int
+	first     int64 // earliest entry timestamp (ns)
+	last      int64 // latest entry timestamp (ns)
+}
+
+// begin starts counting for a new invocation
+func (l *deliveryLedger) begin(requestID string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requestID = requestID
+	l.pushed, l.first, l.last = 0, 0, 0
+}
+
+// record counts the invocation's entries in a successfully pushed request
+func (l *deliveryLedger) record(req *loki.PushRequest) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.requestID == "" {
+		return
+	}
+	for _, stream := range req.Streams {
+		for _, value := range stream.Values {
+			if len(value) < 2 || !strings.Contains(value[1], l.requestID) {
+				continue
+			}
+			ts, err := strconv.ParseInt(value[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			if l.pushed == 0 || ts < l.first {
+				l.first = ts
+			}
+			if ts > l.last {
+				l.last = ts
+			}
+			l.pushed++
+		}
+	}
+}
+
+// snapshot returns the invocation being counted, its pushed entry count
+// and their time span
+func (l *deliveryLedger) snapshot() (requestID string, pushed int, first, last time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.requestID, l.pushed, time.Unix(0, l.first), time.Unix(0, l.last)
+}
+
+// verifyDelivery queries Loki for the entries of requestID (the latest
+// invocation when empty) and compares the count with what was pushed.
+// Only the latest invocation can be verified.
+func (m *Manager) verifyDelivery(ctx context.Context, requestID string) (telemetryapi.Verification, error) {
+	latest, pushed, first, last := m.ledger.snapshot()
+	if requestID == "" {
+		requestID = latest
+	}
+	v := telemetryapi.Verification{RequestID: requestID, Pushed: pushed}
+	if requestID == "" {
+		return v, fmt.Errorf("no invocation to verify yet")
+	}
+	if requestID != latest {
+		return v, fmt.Errorf("only the latest invocation (%s) can be verified", latest)
+	}
+	if pushed == 0 {
+		return v, nil
+	}
+
+	query := loki.LogSelector(map[string]string{"function_name": m.regResp.FunctionName}, requestID)
+	start, end := first.Add(-time.Millisecond), last.Add(time.Millisecond)
+	found, err := m.lokiClient.CountEntries(ctx, query, start, end)
+	if err == nil && found < pushed {
+		// Recently pushed entries may not be queryable yet
+		select {
+		case <-time.After(verifyRetryDelay):
+			found, err = m.lokiClient.CountEntries(ctx, query, start, end)
+		case <-ctx.Done():
+		}
+	}
+	if m.metrics != nil {
+		m.metrics.ObserveVerification(pushed-found, err)
+	}
+	if err != nil {
+		return v, fmt.Errorf("delivery verification query failed: %w", err)
+	}
+
+	v.Found = found
+	if found < pushed {
+		v.Missing = pushed - found
+	}
+	return v, nil
+}
+
+// verifyLastInvocation logs whether the latest invocation's entries are
+// all in Loki, when LOKI_VERIFY_DELIVERY is enabled
+func (m *Manager) verifyLastInvocation(ctx context.Context) {
+	if m.ledger == nil {
+		return
+	}
+	v, err := m.verifyDelivery(ctx, "")
+	if err != nil {
+		logger.Warnf("Delivery verification: %v", err)
+		return
+	}
+	if v.Missing > 0 {
+		logger.Warnf("Delivery verification for %s: %d of %d pushed entries missing from Loki", v.RequestID, v.Missing, v.Pushed)
+		return
+	}
+	logger.Infof("Delivery verification for %s: all %d pushed entries found in Loki", v.RequestID, v.Pushed)
+}
@@ -0,0 +1,84 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+)
+
+// startVerifyingLoki accepts pushes and answers query_range with found
+func startVerifyingLoki(t *testing.T, found *atomic.Int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/loki/api/v1/query_range" {
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"values":[[1,"%d"]]}]}}`, found.Load())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func TestDeliveryLedger_CountsLatestInvocation(t *testing.T) {
+	l := &deliveryLedger{}
+	l.begin("req-1")
+	l.record(&loki.PushRequest{Streams: []loki.Stream{
+		{Values: [][]string{{"3000", "[request_id=req-1] a"}, {"1000", "[request_id=req-1] b"}, {"2000", "other"}}},
+		{Values: [][]string{{"5000", "START RequestId: req-1"}}},
+	}})
+
+	id, pushed, first, last := l.snapshot()
+	if id != "req-1" || pushed != 3 {
+		t.Errorf("snapshot = %s, %d; want req-1, 3", id, pushed)
+	}
+	if first.UnixNano() != 1000 || last.UnixNano() != 5000 {
+		t.Errorf("span = %d..%d, want 1000..5000", first.UnixNano(), last.UnixNano())
+	}
+
+	l.begin("req-2")
+	if _, pushed, _, _ := l.snapshot(); pushed != 0 {
+		t.Errorf("pushed = %d after a new invocation, want 0", pushed)
+	}
+
+	// Disabled ledger
+	var none *deliveryLedger
+	none.begin("req-3")
+	none.record(&loki.PushRequest{})
+}
+
+func TestVerifyDelivery_ReportsMissingEntries(t *testing.T) {
+	var found atomic.Int32
+	server := startVerifyingLoki(t, &found)
+	defer server.Close()
+
+	cfg := newTestConfig()
+	m := newManagerWithMockLoki(cfg, server.URL+"/loki/api/v1/push")
+	m.regResp = &RegisterResponse{FunctionName: "test-fn"}
+	m.ledger = &deliveryLedger{}
+	m.ledger.begin("req-1")
+	m.ledger.record(&loki.PushRequest{Streams: []loki.Stream{
+		{Values: [][]string{{"1000", "req-1 a"}, {"2000", "req-1 b"}, {"3000", "req-1 c"}}},
+	}})
+
+	found.Store(2)
+	v, err := m.verifyDelivery(context.Background(), "")
+	if err != nil {
+		t.Fatalf("verifyDelivery() error = %v", err)
+	}
+	if v.RequestID != "req-1" || v.Pushed != 3 || v.Found != 2 || v.Missing != 1 {
+		t.Errorf("verification = %+v, want 1 of 3 missing", v)
+	}
+
+	found.Store(3)
+	if v, err = m.verifyDelivery(context.Background(), "req-1"); err != nil || v.Missing != 0 {
+		t.Errorf("verification = %+v, %v; want nothing missing", v, err)
+	}
+
+	if _, err := m.verifyDelivery(context.Background(), "req-0"); err == nil {
+		t.Error("expected error verifying an earlier invocation")
+	}
+}
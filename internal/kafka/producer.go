@@ -0,0 +1,199 @@
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/aws"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+	"github.com/mumzworld-tech/lambdawatch/internal/sigv4"
+)
+
+// producerLinger lets records from one flush share a produce request
+const producerLinger = 5 * time.Millisecond
+
+// A slow or unreachable cluster must not hold up Loki delivery: records
+// beyond maxBufferedRecords are dropped rather than waited for, and records
+// not acknowledged within recordDeliveryTimeout fail
+const (
+	maxBufferedRecords    = 10000
+	recordDeliveryTimeout = 10 * time.Second
+)
+
+// Record is the JSON value produced for each log entry
+type Record struct {
+	Timestamp int64             `json:"timestamp"` // Unix milliseconds
+	Message   string            `json:"message"`
+	Type      string            `json:"type"`
+	RequestID string            `json:"request_id,omitempty"`
+	TraceID   string            `json:"trace_id,omitempty"`
+	Labels    map[string]string `json:"labels"`
+
+	// Attributes are the entry's attributes (level, cold_start, outcome…),
+	// trace_id included
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Producer mirrors log entries to a Kafka topic, keyed by request ID so an
+// invocation's logs land on one partition in order
+type Producer struct {
+	client  *kgo.Client
+	topic   string
+	failed  atomic.Int64 // records rejected since the last Flush
+	dropped atomic.Uint64
+}
+
+// NewProducer creates a producer for KAFKA_BROKERS/KAFKA_TOPIC. Brokers are
+// contacted lazily, so an unreachable cluster does not fail INIT.
+func NewProducer(cfg *config.Config) (*Producer, error) {
+	return newProducer(cfg, maxBufferedRecords)
+}
+
+func newProducer(cfg *config.Config, maxBuffered int) (*Producer, error) {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cfg.KafkaBrokers...),
+		kgo.DefaultProduceTopic(cfg.KafkaTopic),
+		kgo.ClientID("lambdawatch"),
+		kgo.ProducerLinger(producerLinger),
+		kgo.ProducerBatchCompression(kgo.SnappyCompression(), kgo.NoCompression()),
+		kgo.MaxBufferedRecords(maxBuffered),
+		kgo.RecordDeliveryTimeout(recordDeliveryTimeout),
+	}
+
+	mechanism, err := saslMechanism(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if mechanism != nil {
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+	if cfg.KafkaTLS || cfg.KafkaSASLMechanism == "AWS_MSK_IAM" {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}))
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+	return &Producer{client: client, topic: cfg.KafkaTopic}, nil
+}
+
+// saslMechanism returns the configured SASL mechanism, or nil when SASL is
+// disabled. MSK IAM signs with the Lambda execution role's credentials,
+// re-read on every connection so rotated session tokens are picked up.
+func saslMechanism(cfg *config.Config) (sasl.Mechanism, error) {
+	switch cfg.KafkaSASLMechanism {
+	case "":
+		return nil, nil
+	case "PLAIN":
+		return plain.Auth{User: cfg.KafkaUsername, Pass: cfg.KafkaPassword}.AsMechanism(), nil
+	case "SCRAM-SHA-256":
+		return scram.Auth{User: cfg.KafkaUsername, Pass: cfg.KafkaPassword}.AsSha256Mechanism(), nil
+	case "SCRAM-SHA-512":
+		return scram.Auth{User: cfg.KafkaUsername, Pass: cfg.KafkaPassword}.AsSha512Mechanism(), nil
+	case "AWS_MSK_IAM":
+		return aws.ManagedStreamingIAM(func(context.Context) (aws.Auth, error) {
+			creds := sigv4.CredentialsFromEnv()
+			if !creds.Valid() {
+				return aws.Auth{}, fmt.Errorf("no AWS credentials available for MSK IAM auth")
+			}
+			return aws.Auth{
+				AccessKey:    creds.AccessKeyID,
+				SecretKey:    creds.SecretAccessKey,
+				SessionToken: creds.SessionToken,
+				UserAgent:    "lambdawatch",
+			}, nil
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown Kafka SASL mechanism %q", cfg.KafkaSASLMechanism)
+	}
+}
+
+// Produce queues entries for delivery without waiting for acknowledgement
+// or for room in the client's buffer; records that do not fit are dropped.
+// labels are the stream labels in effect; per-entry stream labels are
+// merged over them. Call Flush to wait for delivery.
+func (p *Producer) Produce(entries []buffer.LogEntry, labels map[string]string) {
+	for _, entry := range entries {
+		rec, err := newRecord(entry, labels)
+		if err != nil {
+			p.fail(err)
+			continue
+		}
+		p.client.TryProduce(context.Background(), rec, func(_ *kgo.Record, err error) {
+			if err != nil {
+				p.fail(err)
+			}
+		})
+	}
+}
+
+// fail counts a record that was not produced
+func (p *Producer) fail(err error) {
+	p.failed.Add(1)
+	p.dropped.Add(1)
+	logger.Debugf("Kafka produce failed: %v", err)
+}
+
+// Dropped returns how many records have not been produced since startup
+func (p *Producer) Dropped() uint64 {
+	return p.dropped.Load()
+}
+
+// Flush waits until every queued record is acknowledged or ctx expires, and
+// reports records that could not be produced since the previous Flush
+func (p *Producer) Flush(ctx context.Context) error {
+	if err := p.client.Flush(ctx); err != nil {
+		return fmt.Errorf("kafka flush: %w", err)
+	}
+	if failed := p.failed.Swap(0); failed > 0 {
+		return fmt.Errorf("kafka: %d records could not be produced to %s", failed, p.topic)
+	}
+	return nil
+}
+
+// Close releases the client's connections
+func (p *Producer) Close() {
+	p.client.Close()
+}
+
+// newRecord converts entry into a Kafka record keyed by its request ID
+func newRecord(entry buffer.LogEntry, labels map[string]string) (*kgo.Record, error) {
+	merged := make(map[string]string, len(labels)+len(entry.StreamLabels))
+	for k, v := range labels {
+		merged[k] = v
+	}
+	for k, v := range entry.StreamLabels {
+		merged[k] = v
+	}
+
+	value, err := json.Marshal(Record{
+		Timestamp:  entry.Timestamp,
+		Message:    entry.Message,
+		Type:       entry.Type,
+		RequestID:  entry.RequestID,
+		TraceID:    entry.Attribute(buffer.AttrTraceID),
+		Labels:     merged,
+		Attributes: entry.Attributes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &kgo.Record{Value: value, Timestamp: time.UnixMilli(entry.Timestamp)}
+	if entry.RequestID != "" {
+		rec.Key = []byte(entry.RequestID)
+	}
+	return rec, nil
+}
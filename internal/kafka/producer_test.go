@@ -0,0 +1,126 @@
+package kafka
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+func TestNewRecord(t *testing.T) {
+	entry := buffer.LogEntry{
+		Timestamp:    1700000000123,
+		Message:      "hello",
+		Type:         "function",
+		RequestID:    "req-1",
+		Attributes:   map[string]string{buffer.AttrTraceID: "trace-1", buffer.AttrLevel: "info"},
+		StreamLabels: map[string]string{"error": "true"},
+	}
+	rec, err := newRecord(entry, map[string]string{"function_name": "fn", "error": "false"})
+	if err != nil {
+		t.Fatalf("newRecord() error: %v", err)
+	}
+	if string(rec.Key) != "req-1" {
+		t.Errorf("Key = %q, want req-1", rec.Key)
+	}
+	if rec.Timestamp.UnixMilli() != entry.Timestamp {
+		t.Errorf("Timestamp = %v", rec.Timestamp)
+	}
+
+	var got Record
+	if err := json.Unmarshal(rec.Value, &got); err != nil {
+		t.Fatalf("invalid record JSON: %v", err)
+	}
+	if got.Message != "hello" || got.Type != "function" || got.RequestID != "req-1" || got.TraceID != "trace-1" || got.Attributes[buffer.AttrLevel] != "info" {
+		t.Errorf("unexpected record %+v", got)
+	}
+	if got.Labels["function_name"] != "fn" || got.Labels["error"] != "true" {
+		t.Errorf("stream labels should override base labels, got %v", got.Labels)
+	}
+}
+
+func TestNewRecord_NoRequestIDHasNoKey(t *testing.T) {
+	rec, err := newRecord(buffer.LogEntry{Message: "init"}, nil)
+	if err != nil {
+		t.Fatalf("newRecord() error: %v", err)
+	}
+	if rec.Key != nil {
+		t.Errorf("Key = %q, want nil so records spread across partitions", rec.Key)
+	}
+}
+
+func TestSASLMechanism(t *testing.T) {
+	tests := []struct {
+		mechanism string
+		wantName  string
+		wantErr   bool
+	}{
+		{"", "", false},
+		{"PLAIN", "PLAIN", false},
+		{"SCRAM-SHA-256", "SCRAM-SHA-256", false},
+		{"SCRAM-SHA-512", "SCRAM-SHA-512", false},
+		{"AWS_MSK_IAM", "AWS_MSK_IAM", false},
+		{"GSSAPI", "", true},
+	}
+	for _, tt := range tests {
+		cfg := &config.Config{KafkaSASLMechanism: tt.mechanism, KafkaUsername: "u", KafkaPassword: "p"}
+		m, err := saslMechanism(cfg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, wantErr %v", tt.mechanism, err, tt.wantErr)
+			continue
+		}
+		name := ""
+		if m != nil {
+			name = m.Name()
+		}
+		if name != tt.wantName {
+			t.Errorf("%q: mechanism = %q, want %q", tt.mechanism, name, tt.wantName)
+		}
+	}
+}
+
+func TestNewProducer_DoesNotDialAtStartup(t *testing.T) {
+	p, err := NewProducer(&config.Config{
+		KafkaBrokers: []string{"127.0.0.1:1"},
+		KafkaTopic:   "logs",
+	})
+	if err != nil {
+		t.Fatalf("NewProducer() error: %v", err)
+	}
+	p.Close()
+}
+
+// An unreachable cluster fills the buffer; further records are dropped
+// instead of blocking the flush
+func TestProducer_FullBufferDropsWithoutBlocking(t *testing.T) {
+	p, err := newProducer(&config.Config{
+		KafkaBrokers: []string{"127.0.0.1:1"},
+		KafkaTopic:   "logs",
+	}, 2)
+	if err != nil {
+		t.Fatalf("newProducer() error: %v", err)
+	}
+	defer p.Close()
+
+	entries := make([]buffer.LogEntry, 5)
+	done := make(chan struct{})
+	go func() {
+		p.Produce(entries, nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Produce blocked on a full buffer")
+	}
+	// Failed records' promises run on the client's goroutine
+	deadline := time.Now().Add(2 * time.Second)
+	for p.Dropped() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if p.Dropped() != 3 {
+		t.Errorf("Dropped() = %d, want 3", p.Dropped())
+	}
+}
@@ -0,0 +1,383 @@
+// Package lambdatest emulates the Lambda Extensions API, the Telemetry API
+// and a Loki endpoint in-process, so the extension can be driven through
+// INIT → INVOKE×N → SHUTDOWN in tests and its deliveries asserted on.
+package lambdatest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+)
+
+// FunctionName is reported by the fake Extensions API at registration
+const FunctionName = "lambdatest-fn"
+
+// stepTimeout bounds every wait on the extension, so a lifecycle bug fails
+// the test instead of hanging it
+const stepTimeout = 10 * time.Second
+
+// Env is one fake Lambda sandbox with its Loki endpoint
+type Env struct {
+	t       testing.TB
+	runtime *httptest.Server
+	loki    *httptest.Server
+
+	// RuntimeAPI is the host:port to use as AWS_LAMBDA_RUNTIME_API
+	RuntimeAPI string
+	// LokiURL is the push URL to use as LOKI_URL
+	LokiURL string
+
+	ready  chan struct{}    // signalled each time the extension calls /event/next
+	events chan interface{} // next event to hand to the extension
+
+	// Owned by the test goroutine
+	idle      bool      // the extension is known to be waiting on /event/next
+	eventTime time.Time // timestamp of the last telemetry event
+
+	mu            sync.Mutex
+	listener      string        // telemetry destination, rewritten to loopback
+	subscribedTo  string        // path of the API subscribed to
+	bufferTimeout time.Duration // subscription's buffering window
+	subscribed    chan struct{}
+	pushes        []loki.PushRequest
+	lokiStatus    int
+}
+
+// New starts the fake APIs. They are closed when the test ends.
+func New(t testing.TB) *Env {
+	e := &Env{
+		t:          t,
+		ready:      make(chan struct{}, 1),
+		events:     make(chan interface{}),
+		subscribed: make(chan struct{}),
+		lokiStatus: http.StatusNoContent,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/2020-01-01/extension/register", e.handleRegister)
+	mux.HandleFunc("/2020-01-01/extension/event/next", e.handleNext)
+	mux.HandleFunc("/2022-07-01/telemetry", e.handleSubscribe)
+	mux.HandleFunc("/2020-08-15/logs", e.handleSubscribe)
+	e.runtime = httptest.NewServer(mux)
+	e.loki = httptest.NewServer(http.HandlerFunc(e.handlePush))
+
+	e.RuntimeAPI = strings.TrimPrefix(e.runtime.URL, "http://")
+	e.LokiURL = e.loki.URL + "/loki/api/v1/push"
+	t.Cleanup(func() {
+		// Unblock a pending /event/next so the servers can close
+		close(e.events)
+		e.runtime.Close()
+		e.loki.Close()
+	})
+	return e
+}
+
+// FreePort returns a loopback port that was free at the time of the call,
+// for the extension's telemetry listener
+func FreePort(t testing.TB) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("lambdatest: no free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func (e *Env) handleRegister(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Lambda-Extension-Identifier", "lambdatest-extension-id")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"functionName":    FunctionName,
+		"functionVersion": "$LATEST",
+		"handler":         "index.handler",
+	})
+}
+
+func (e *Env) handleNext(w http.ResponseWriter, r *http.Request) {
+	select {
+	case e.ready <- struct{}{}:
+	default:
+	}
+	select {
+	case event, ok := <-e.events:
+		if !ok {
+			http.Error(w, "sandbox closed", http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(event)
+	case <-r.Context().Done():
+	}
+}
+
+func (e *Env) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Destination struct {
+			URI string `json:"URI"`
+		} `json:"destination"`
+		Buffering struct {
+			TimeoutMs int `json:"timeoutMs"`
+		} `json:"buffering"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	e.mu.Lock()
+	first := e.listener == ""
+	e.listener = strings.Replace(req.Destination.URI, "sandbox.localdomain", "127.0.0.1", 1)
+	e.subscribedTo = r.URL.Path
+	e.bufferTimeout = time.Duration(req.Buffering.TimeoutMs) * time.Millisecond
+	e.mu.Unlock()
+	if first {
+		close(e.subscribed)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (e *Env) handlePush(w http.ResponseWriter, r *http.Request) {
+	body := io.Reader(r.Body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = gz
+	}
+	var req loki.PushRequest
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e.mu.Lock()
+	status := e.lokiStatus
+	if status < 300 {
+		e.pushes = append(e.pushes, req)
+	}
+	e.mu.Unlock()
+	w.WriteHeader(status)
+}
+
+// SubscribedTo returns the path of the log API (Telemetry API or Logs API)
+// the extension last subscribed to
+func (e *Env) SubscribedTo() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.subscribedTo
+}
+
+// SetLokiStatus makes the fake Loki answer every push with status. Pushes
+// are only recorded while the status is 2xx.
+func (e *Env) SetLokiStatus(status int) {
+	e.mu.Lock()
+	e.lokiStatus = status
+	e.mu.Unlock()
+}
+
+// waitReady blocks until the extension is waiting on /event/next
+func (e *Env) waitReady() {
+	e.t.Helper()
+	if e.idle {
+		return
+	}
+	select {
+	case <-e.ready:
+		e.idle = true
+	case <-time.After(stepTimeout):
+		e.t.Fatalf("lambdatest: extension never asked for the next event")
+	}
+}
+
+// send hands event to the extension's pending /event/next
+func (e *Env) send(event map[string]interface{}) {
+	e.t.Helper()
+	e.waitReady()
+	e.idle = false
+	e.events <- event
+}
+
+// Init delivers the INIT phase's telemetry: platform.initStart, the
+// function's log lines and a successful platform.initRuntimeDone. Call it
+// before the first Invoke.
+func (e *Env) Init(logs ...string) {
+	e.t.Helper()
+	e.waitSubscribed()
+
+	e.eventTime = time.Now()
+	events := []map[string]interface{}{e.event("platform.initStart", map[string]interface{}{
+		"initializationType": "on-demand",
+		"phase":              "init",
+	})}
+	for _, line := range logs {
+		events = append(events, e.event("function", line))
+	}
+	events = append(events, e.event("platform.initRuntimeDone", map[string]interface{}{
+		"initializationType": "on-demand",
+		"phase":              "init",
+		"status":             "success",
+	}))
+	e.deliver(events)
+}
+
+// waitSubscribed blocks until the extension has subscribed to telemetry
+func (e *Env) waitSubscribed() {
+	e.t.Helper()
+	select {
+	case <-e.subscribed:
+	case <-time.After(stepTimeout):
+		e.t.Fatalf("lambdatest: extension never subscribed to the Telemetry API")
+	}
+}
+
+// Invoke runs one invocation: it hands the extension an INVOKE, delivers
+// platform.start, the function's log lines, platform.runtimeDone and
+// platform.report through the Telemetry API, and returns once the
+// extension asks for the next event, i.e. after its critical flush.
+func (e *Env) Invoke(requestID string, logs ...string) {
+	e.t.Helper()
+	e.waitSubscribed()
+
+	e.eventTime = time.Now()
+	e.send(map[string]interface{}{
+		"eventType":          "INVOKE",
+		"deadlineMs":         time.Now().Add(3 * time.Second).UnixMilli(),
+		"requestId":          requestID,
+		"invokedFunctionArn": "arn:aws:lambda:us-east-1:123456789012:function:" + FunctionName,
+	})
+
+	events := []map[string]interface{}{e.event("platform.start", map[string]interface{}{"requestId": requestID, "version": "$LATEST"})}
+	for _, line := range logs {
+		events = append(events, e.event("function", line))
+	}
+	events = append(events,
+		e.event("platform.runtimeDone", map[string]interface{}{"requestId": requestID, "status": "success"}),
+		e.event("platform.report", map[string]interface{}{
+			"requestId": requestID,
+			"status":    "success",
+			"metrics":   map[string]interface{}{"durationMs": 12.5, "billedDurationMs": 13.0, "memorySizeMB": 128.0, "maxMemoryUsedMB": 64.0},
+		}),
+	)
+	e.deliver(events)
+	e.waitReady()
+}
+
+// Shutdown hands the extension a SHUTDOWN event once it is idle
+func (e *Env) Shutdown() {
+	e.t.Helper()
+	e.send(map[string]interface{}{
+		"eventType":      "SHUTDOWN",
+		"deadlineMs":     time.Now().Add(2 * time.Second).UnixMilli(),
+		"shutdownReason": "spindown",
+	})
+}
+
+// event builds a telemetry event stamped slightly after the previous one
+func (e *Env) event(typ string, record interface{}) map[string]interface{} {
+	e.eventTime = e.eventTime.Add(time.Millisecond)
+	return map[string]interface{}{"time": e.eventTime.UTC().Format(time.RFC3339Nano), "type": typ, "record": record}
+}
+
+// deliver posts events to the extension's telemetry listener, retrying
+// while the listener is still starting. Like Lambda, events are held for
+// the subscription's buffering window first, which also gives the
+// extension time to act on the event that produced them.
+func (e *Env) deliver(events []map[string]interface{}) {
+	e.t.Helper()
+	body, err := json.Marshal(events)
+	if err != nil {
+		e.t.Fatalf("lambdatest: %v", err)
+	}
+	e.mu.Lock()
+	listener, wait := e.listener, e.bufferTimeout
+	e.mu.Unlock()
+	time.Sleep(wait)
+
+	deadline := time.Now().Add(stepTimeout)
+	for {
+		resp, err := http.Post(listener, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				e.t.Fatalf("lambdatest: telemetry listener returned %d", resp.StatusCode)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			e.t.Fatalf("lambdatest: telemetry listener %s unreachable: %v", listener, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Pushes returns the push requests Loki has accepted so far
+func (e *Env) Pushes() []loki.PushRequest {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]loki.PushRequest(nil), e.pushes...)
+}
+
+// Line is one delivered log line with its stream labels
+type Line struct {
+	Labels  map[string]string
+	Message string
+}
+
+// Lines returns every delivered line in push order
+func (e *Env) Lines() []Line {
+	var lines []Line
+	for _, req := range e.Pushes() {
+		for _, s := range req.Streams {
+			for _, v := range s.Values {
+				lines = append(lines, Line{Labels: s.Stream, Message: v[1]})
+			}
+		}
+	}
+	return lines
+}
+
+// FunctionLines returns delivered lines containing substr, ignoring the
+// extension's own log lines
+func (e *Env) FunctionLines(substr string) []Line {
+	var lines []Line
+	for _, l := range e.Lines() {
+		if strings.Contains(l.Message, substr) && !strings.Contains(l.Message, "LambdaWatch") {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// WaitForLines polls until at least n delivered lines contain substr,
+// for deliveries that are not tied to an invocation (INIT, shutdown)
+func (e *Env) WaitForLines(substr string, n int) []Line {
+	e.t.Helper()
+	deadline := time.Now().Add(stepTimeout)
+	for {
+		lines := e.FunctionLines(substr)
+		if len(lines) >= n || time.Now().After(deadline) {
+			return lines
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// String describes what was delivered, for test failure messages
+func (e *Env) String() string {
+	var b strings.Builder
+	for _, l := range e.Lines() {
+		fmt.Fprintf(&b, "%v %q\n", l.Labels, l.Message)
+	}
+	return b.String()
+}
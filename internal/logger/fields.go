@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// badKey names a value passed to With without a key
+const badKey = "!BADKEY"
+
+// reservedKeys are the standard entry keys; fields using them are written
+// as field_<key> so they cannot shadow the entry itself
+var reservedKeys = map[string]bool{
+	"level": true, "timestamp": true, "app_name": true,
+	"environment": true, "context": true, "message": true,
+}
+
+type field struct {
+	key   string
+	value any
+}
+
+// Logger writes entries carrying structured fields. Fields are emitted as
+// top-level keys in JSON output and as key=value pairs in logfmt/text.
+type Logger struct {
+	fields []field
+}
+
+// With returns a Logger that adds the given alternating key/value pairs to
+// every entry, e.g. logger.With("request_id", id).Info("flushed")
+func With(keyvals ...any) *Logger {
+	return (&Logger{}).With(keyvals...)
+}
+
+// With returns a copy of l with additional key/value pairs
+func (l *Logger) With(keyvals ...any) *Logger {
+	fields := make([]field, len(l.fields), len(l.fields)+(len(keyvals)+1)/2)
+	copy(fields, l.fields)
+	for i := 0; i < len(keyvals); i += 2 {
+		if i+1 == len(keyvals) {
+			fields = append(fields, field{badKey, keyvals[i]})
+			break
+		}
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyvals[i])
+		}
+		if reservedKeys[key] {
+			key = "field_" + key
+		}
+		fields = append(fields, field{key, keyvals[i+1]})
+	}
+	return &Logger{fields: fields}
+}
+
+func (l *Logger) Info(msg string)  { logFields("info", msg, l.fields) }
+func (l *Logger) Debug(msg string) { logFields("debug", msg, l.fields) }
+func (l *Logger) Warn(msg string)  { logFields("warn", msg, l.fields) }
+func (l *Logger) Error(msg string) { logFields("error", msg, l.fields) }
+func (l *Logger) Infof(format string, a ...any) {
+	logFields("info", fmt.Sprintf(format, a...), l.fields)
+}
+func (l *Logger) Debugf(format string, a ...any) {
+	logFields("debug", fmt.Sprintf(format, a...), l.fields)
+}
+func (l *Logger) Warnf(format string, a ...any) {
+	logFields("warn", fmt.Sprintf(format, a...), l.fields)
+}
+func (l *Logger) Errorf(format string, a ...any) {
+	logFields("error", fmt.Sprintf(format, a...), l.fields)
+}
+func (l *Logger) Fatal(msg string) { logFields("fatal", msg, l.fields); os.Exit(1) }
+
+// Fprint writes an entry with l's fields to w only, never to the buffer
+func (l *Logger) Fprint(w io.Writer, level, msg string) { fprint(w, level, msg, l.fields) }
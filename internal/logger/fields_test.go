@@ -0,0 +1,83 @@
+package logger
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+)
+
+func captureEntry(t *testing.T, log func()) string {
+	t.Helper()
+	buf := buffer.New(10)
+	SetBuffer(buf)
+	defer SetBuffer(nil)
+	log()
+	entries := buf.Flush(10)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	return entries[0].Message
+}
+
+func TestWith_JSONTopLevelFields(t *testing.T) {
+	Init()
+	line := captureEntry(t, func() {
+		With("request_id", "abc-123").With("batch_size", 42).Info("pushed")
+	})
+
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", line, err)
+	}
+	if got["request_id"] != "abc-123" {
+		t.Errorf("request_id = %v", got["request_id"])
+	}
+	if got["batch_size"] != float64(42) {
+		t.Errorf("batch_size = %v", got["batch_size"])
+	}
+	if got["message"] != "pushed" || got["context"] != "LambdaWatch" {
+		t.Errorf("standard keys missing: %v", got)
+	}
+}
+
+func TestWith_ReservedAndMalformedKeys(t *testing.T) {
+	Init()
+	line := captureEntry(t, func() {
+		With("message", "shadow", "dangling").Warn("real")
+	})
+
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", line, err)
+	}
+	if got["message"] != "real" || got["field_message"] != "shadow" {
+		t.Errorf("reserved key not renamed: %v", got)
+	}
+	if got[badKey] != "dangling" {
+		t.Errorf("dangling value not kept: %v", got)
+	}
+}
+
+func TestWith_DoesNotModifyParent(t *testing.T) {
+	parent := With("a", 1)
+	_ = parent.With("b", 2)
+	if len(parent.fields) != 1 {
+		t.Errorf("parent fields = %v", parent.fields)
+	}
+}
+
+func TestWith_Logfmt(t *testing.T) {
+	os.Setenv("LOG_FORMAT", "logfmt")
+	defer func() { os.Unsetenv("LOG_FORMAT"); Init() }()
+	Init()
+
+	line := captureEntry(t, func() {
+		With("request_id", "abc-123", "error", "timed out").Error("push failed")
+	})
+	if !strings.HasSuffix(line, ` message="push failed" request_id=abc-123 error="timed out"`) {
+		t.Errorf("unexpected logfmt line %q", line)
+	}
+}
@@ -3,19 +3,37 @@ package logger
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
 )
 
+// Output formats selectable with LOG_FORMAT
+const (
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+	FormatText   = "text"
+)
+
+// levels orders severities for LOG_LEVEL gating
+var levels = map[string]int{"debug": 0, "info": 1, "warn": 2, "error": 3, "fatal": 4}
+
 var (
 	appName     string
 	environment string
 	logBuffer   *buffer.Buffer
-	debugMode   bool
+	minLevel    = levels["info"]
+	format      = FormatJSON
 )
 
+// Init reads the logger settings from the environment. LOG_LEVEL sets the
+// minimum level (default info; DEBUG_MODE=true still enables debug) and
+// LOG_FORMAT selects json, logfmt or text output; LAMBDAWATCH_LOG_LEVEL,
+// LAMBDAWATCH_LOG_FORMAT and LAMBDAWATCH_DEBUG_MODE take precedence, as
+// for every setting. Unknown values fall back to the defaults with a warning.
 func Init() {
 	appName = os.Getenv("APP_NAME")
 	if appName == "" {
@@ -25,8 +43,42 @@ func Init() {
 	if environment == "" {
 		environment = "unknown"
 	}
-	debugEnv := os.Getenv("DEBUG_MODE")
-	debugMode = debugEnv == "true" || debugEnv == "1"
+
+	var warnings []string
+
+	minLevel = levels["info"]
+	if lvl := strings.ToLower(getenv("LOG_LEVEL")); lvl != "" {
+		if n, ok := levels[lvl]; ok {
+			minLevel = n
+		} else {
+			warnings = append(warnings, fmt.Sprintf("LOG_LEVEL: %q is not a valid level, using info", lvl))
+		}
+	}
+	debugEnv := getenv("DEBUG_MODE")
+	if debugEnv == "true" || debugEnv == "1" {
+		minLevel = levels["debug"]
+	}
+
+	format = FormatJSON
+	switch f := strings.ToLower(getenv("LOG_FORMAT")); f {
+	case "", FormatJSON:
+	case FormatLogfmt, FormatText:
+		format = f
+	default:
+		warnings = append(warnings, fmt.Sprintf("LOG_FORMAT: %q is not a valid format, using json", f))
+	}
+
+	for _, w := range warnings {
+		Warn(w)
+	}
+}
+
+// getenv returns the LAMBDAWATCH_-prefixed variable for key, or key itself
+func getenv(key string) string {
+	if val := os.Getenv("LAMBDAWATCH_" + key); val != "" {
+		return val
+	}
+	return os.Getenv(key)
 }
 
 // SetBuffer sets the buffer for extension logs to be written directly
@@ -36,46 +88,154 @@ func SetBuffer(buf *buffer.Buffer) {
 }
 
 type logEntry struct {
-	Level       string `json:"level"`
-	Timestamp   string `json:"timestamp"`
-	AppName     string `json:"app_name"`
-	Environment string `json:"environment"`
-	Context     string `json:"context"`
-	Message     string `json:"message"`
+	Level       string  `json:"level"`
+	Timestamp   string  `json:"timestamp"`
+	AppName     string  `json:"app_name"`
+	Environment string  `json:"environment"`
+	Context     string  `json:"context"`
+	Message     string  `json:"message"`
+	Fields      []field `json:"-"`
 }
 
-func log(level, msg string) {
-	// Skip debug logs if debug mode is disabled
-	if level == "debug" && !debugMode {
+func log(level, msg string) { logFields(level, msg, nil) }
+
+func logFields(level, msg string, fields []field) {
+	// Skip logs below LOG_LEVEL
+	if levels[level] < minLevel {
 		return
 	}
 
-	entry := logEntry{
-		Level:       level,
-		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
-		AppName:     appName,
-		Environment: environment,
-		Context:     "LambdaWatch",
-		Message:     msg,
-	}
-	b, _ := json.Marshal(entry)
-	logLine := string(b)
+	logLine := newEntry(level, msg, fields).format()
 
 	// Always write to stdout for CloudWatch
 	fmt.Println(logLine)
 
 	// Also write directly to buffer for Loki (Telemetry API won't capture our own logs)
 	if logBuffer != nil {
+		priority := buffer.PriorityNormal
+		if level == "error" || level == "fatal" {
+			priority = buffer.PriorityHigh
+		}
 		logBuffer.Add(buffer.LogEntry{
 			Timestamp: time.Now().UnixMilli(),
 			Message:   logLine,
 			Type:      "extension",
+			Priority:  priority,
+			Internal:  true,
 		})
 		// Signal that logs are ready for flushing
 		logBuffer.SignalReady()
 	}
 }
 
+func newEntry(level, msg string, fields []field) logEntry {
+	return logEntry{
+		Level:       level,
+		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+		AppName:     appName,
+		Environment: environment,
+		Context:     "LambdaWatch",
+		Message:     strings.ToValidUTF8(msg, "\uFFFD"), // Loki rejects invalid UTF-8
+		Fields:      fields,
+	}
+}
+
+// fprint writes an entry to w alone, whatever LOG_LEVEL. The entry is never
+// added to the buffer, so it suits reports about entries being dropped or
+// withheld from Loki, which must not be shipped in their place; its context
+// still keeps it from being re-ingested through the Telemetry API.
+func fprint(w io.Writer, level, msg string, fields []field) {
+	fmt.Fprintln(w, newEntry(level, msg, fields).format())
+}
+
+// format renders the entry in the configured LOG_FORMAT
+func (e logEntry) format() string {
+	switch format {
+	case FormatLogfmt:
+		var sb strings.Builder
+		for i, kv := range [][2]string{
+			{"level", e.Level},
+			{"timestamp", e.Timestamp},
+			{"app_name", e.AppName},
+			{"environment", e.Environment},
+			{"context", e.Context},
+			{"message", e.Message},
+		} {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(kv[0])
+			sb.WriteByte('=')
+			sb.WriteString(logfmtValue(kv[1]))
+		}
+		for _, f := range e.Fields {
+			sb.WriteByte(' ')
+			sb.WriteString(f.key)
+			sb.WriteByte('=')
+			sb.WriteString(logfmtValue(fmt.Sprint(f.value)))
+		}
+		return sb.String()
+	case FormatText:
+		line := fmt.Sprintf("%s %-5s [%s] %s", e.Timestamp, strings.ToUpper(e.Level), e.Context, e.Message)
+		for _, f := range e.Fields {
+			line += " " + f.key + "=" + logfmtValue(fmt.Sprint(f.value))
+		}
+		return line
+	default:
+		b, _ := json.Marshal(e)
+		if len(e.Fields) == 0 {
+			return string(b)
+		}
+		// Append fields as top-level keys after the standard ones
+		var sb strings.Builder
+		sb.Write(b[:len(b)-1])
+		for _, f := range e.Fields {
+			key, _ := json.Marshal(f.key)
+			value, err := json.Marshal(f.value)
+			if err != nil {
+				value, _ = json.Marshal(fmt.Sprint(f.value))
+			}
+			sb.WriteByte(',')
+			sb.Write(key)
+			sb.WriteByte(':')
+			sb.Write(value)
+		}
+		sb.WriteByte('}')
+		return sb.String()
+	}
+}
+
+// ownMarkers identify this logger's lines in each LOG_FORMAT
+var ownMarkers = []string{`"context":"LambdaWatch"`, " context=LambdaWatch ", "[LambdaWatch] "}
+
+// IsOwnLine reports whether line was written by this logger, whatever the
+// LOG_FORMAT
+func IsOwnLine(line string) bool {
+	for _, marker := range ownMarkers {
+		if strings.Contains(line, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// logfmtValue quotes v when it is empty or contains spaces, quotes, '='
+// or control characters
+func logfmtValue(v string) string {
+	if v == "" {
+		return `""`
+	}
+	if strings.IndexFunc(v, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == 0x7f
+	}) == -1 {
+		return v
+	}
+	return fmt.Sprintf("%q", v)
+}
+
+// Fprint writes an entry to w only; see fprint
+func Fprint(w io.Writer, level, msg string) { fprint(w, level, msg, nil) }
+
 func Info(msg string)                { log("info", msg) }
 func Debug(msg string)               { log("debug", msg) }
 func Warn(msg string)                { log("warn", msg) }
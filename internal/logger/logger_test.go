@@ -1,7 +1,9 @@
 package logger
 
 import (
+	"bytes"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
@@ -71,6 +73,26 @@ func TestSetBuffer_NilBufferNoWrite(t *testing.T) {
 	Info("test message")
 }
 
+func TestFprint_SkipsBufferAndLevel(t *testing.T) {
+	buf := buffer.New(100)
+	SetBuffer(buf)
+	defer SetBuffer(nil)
+	os.Setenv("LOG_LEVEL", "error")
+	defer func() { os.Unsetenv("LOG_LEVEL"); Init() }()
+	Init()
+
+	var out bytes.Buffer
+	With("entries", 3).Fprint(&out, "info", "dropped")
+
+	line := out.String()
+	if !strings.Contains(line, `"message":"dropped"`) || !strings.Contains(line, `"entries":3`) || !IsOwnLine(line) {
+		t.Errorf("unexpected line %q", line)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no buffered entries, got %d", buf.Len())
+	}
+}
+
 func TestLogLevels(t *testing.T) {
 	os.Setenv("DEBUG_MODE", "true")
 	defer os.Unsetenv("DEBUG_MODE")
@@ -106,3 +128,105 @@ func TestLogFormatFunctions(t *testing.T) {
 		t.Errorf("expected 3 entries, got %d", buf.Len())
 	}
 }
+
+func TestErrorLogsAreHighPriority(t *testing.T) {
+	buf := buffer.New(100)
+	SetBuffer(buf)
+	defer SetBuffer(nil)
+
+	Info("routine")
+	Error("broken")
+
+	entries := buf.Flush(10)
+	if entries[0].Priority != buffer.PriorityNormal {
+		t.Errorf("info priority = %d, want normal", entries[0].Priority)
+	}
+	if entries[1].Priority != buffer.PriorityHigh {
+		t.Errorf("error priority = %d, want high", entries[1].Priority)
+	}
+}
+
+func TestLogLevel_GatesInfoAndWarn(t *testing.T) {
+	os.Setenv("LOG_LEVEL", "error")
+	defer os.Unsetenv("LOG_LEVEL")
+	Init()
+	defer func() { os.Unsetenv("LOG_LEVEL"); Init() }()
+
+	buf := buffer.New(100)
+	SetBuffer(buf)
+	defer SetBuffer(nil)
+
+	Debug("debug msg")
+	Info("info msg")
+	Warn("warn msg")
+	Error("error msg")
+
+	if buf.Len() != 1 {
+		t.Errorf("expected only the error entry, got %d", buf.Len())
+	}
+}
+
+func TestLogLevel_PrefixedNameTakesPrecedence(t *testing.T) {
+	os.Setenv("LOG_LEVEL", "debug")
+	os.Setenv("LAMBDAWATCH_LOG_LEVEL", "error")
+	Init()
+	defer func() { os.Unsetenv("LOG_LEVEL"); os.Unsetenv("LAMBDAWATCH_LOG_LEVEL"); Init() }()
+
+	buf := buffer.New(100)
+	SetBuffer(buf)
+	defer SetBuffer(nil)
+
+	Info("info msg")
+	Error("error msg")
+
+	if buf.Len() != 1 {
+		t.Errorf("expected only the error entry, got %d", buf.Len())
+	}
+}
+
+func TestLogLevel_DebugModeOverrides(t *testing.T) {
+	os.Setenv("LOG_LEVEL", "warn")
+	os.Setenv("DEBUG_MODE", "true")
+	defer os.Unsetenv("LOG_LEVEL")
+	defer os.Unsetenv("DEBUG_MODE")
+	Init()
+	defer func() { os.Unsetenv("LOG_LEVEL"); os.Unsetenv("DEBUG_MODE"); Init() }()
+
+	buf := buffer.New(100)
+	SetBuffer(buf)
+	defer SetBuffer(nil)
+
+	Debug("debug msg")
+	if buf.Len() != 1 {
+		t.Errorf("expected DEBUG_MODE to enable debug logs, got %d entries", buf.Len())
+	}
+}
+
+func TestLogFormat(t *testing.T) {
+	defer func() { os.Unsetenv("LOG_FORMAT"); Init() }()
+	entry := logEntry{
+		Level:       "warn",
+		Timestamp:   "2024-01-01T00:00:00Z",
+		AppName:     "",
+		Environment: "prod",
+		Context:     "LambdaWatch",
+		Message:     `push failed: status="503"`,
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"json", `{"level":"warn","timestamp":"2024-01-01T00:00:00Z","app_name":"","environment":"prod","context":"LambdaWatch","message":"push failed: status=\"503\""}`},
+		{"logfmt", `level=warn timestamp=2024-01-01T00:00:00Z app_name="" environment=prod context=LambdaWatch message="push failed: status=\"503\""`},
+		{"text", `2024-01-01T00:00:00Z WARN  [LambdaWatch] push failed: status="503"`},
+		{"bogus", `{"level":"warn","timestamp":"2024-01-01T00:00:00Z","app_name":"","environment":"prod","context":"LambdaWatch","message":"push failed: status=\"503\""}`},
+	}
+	for _, tt := range tests {
+		os.Setenv("LOG_FORMAT", tt.format)
+		Init()
+		if got := entry.format(); got != tt.want {
+			t.Errorf("LOG_FORMAT=%s:\n got %s\nwant %s", tt.format, got, tt.want)
+		}
+	}
+}
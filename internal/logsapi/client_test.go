@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/telemetryapi"
 )
 
 func TestClient_Subscribe_Success(t *testing.T) {
@@ -13,11 +16,17 @@ func TestClient_Subscribe_Success(t *testing.T) {
 		if r.Method != http.MethodPut {
 			t.Errorf("expected PUT, got %s", r.Method)
 		}
-		if r.Header.Get(extensionIDHeader) != "ext-123" {
-			t.Errorf("expected extension ID header ext-123, got %s", r.Header.Get(extensionIDHeader))
+		if r.URL.Path != "/2020-08-15/logs" {
+			t.Errorf("expected Logs API path, got %s", r.URL.Path)
+		}
+		if r.Header.Get("Lambda-Extension-Identifier") != "ext-123" {
+			t.Errorf("expected extension ID header ext-123, got %s", r.Header.Get("Lambda-Extension-Identifier"))
 		}
-		var req SubscribeRequest
+		var req telemetryapi.SubscribeRequest
 		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.SchemaVersion != "2021-03-18" {
+			t.Errorf("expected schema 2021-03-18, got %s", req.SchemaVersion)
+		}
 		if len(req.Types) != 3 {
 			t.Errorf("expected 3 types, got %d", len(req.Types))
 		}
@@ -30,13 +39,9 @@ func TestClient_Subscribe_Success(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 	}))
 	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", strings.TrimPrefix(server.URL, "http://"))
 
-	c := &Client{
-		baseURL:     server.URL,
-		httpClient:  &http.Client{},
-		extensionID: "ext-123",
-	}
-	err := c.Subscribe(context.Background(), "http://sandbox.localdomain:8080")
+	err := NewClient("ext-123").Subscribe(context.Background(), "http://sandbox.localdomain:8080")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -47,13 +52,9 @@ func TestClient_Subscribe_Failure(t *testing.T) {
 		w.WriteHeader(http.StatusInternalServerError)
 	}))
 	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", strings.TrimPrefix(server.URL, "http://"))
 
-	c := &Client{
-		baseURL:     server.URL,
-		httpClient:  &http.Client{},
-		extensionID: "ext-123",
-	}
-	err := c.Subscribe(context.Background(), "http://sandbox.localdomain:8080")
+	err := NewClient("ext-123").Subscribe(context.Background(), "http://sandbox.localdomain:8080")
 	if err == nil {
 		t.Error("expected error on 500 response")
 	}
@@ -0,0 +1,56 @@
+package loki
+
+import (
+	"net/http"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+// authenticator adds credentials to a push request. It runs after the
+// tenant and LOKI_EXTRA_HEADERS headers are set, so a signing mode covers
+// them too.
+type authenticator interface {
+	authenticate(req *http.Request, body []byte) error
+}
+
+// newAuthenticator returns the authenticator for cfg's LOKI_AUTH_MODE
+func newAuthenticator(cfg *config.Config) authenticator {
+	switch cfg.AuthMode() {
+	case config.AuthModeBasic:
+		return basicAuth{username: cfg.LokiUsername, password: cfg.LokiPassword}
+	case config.AuthModeBearer:
+		return headerAuth{name: "Authorization", value: "Bearer " + cfg.LokiAPIKey}
+	case config.AuthModeHeader:
+		return headerAuth{name: cfg.LokiAuthHeader, value: cfg.LokiAPIKey}
+	case config.AuthModeSigV4:
+		return newRequestSigner(cfg)
+	default:
+		return noAuth{}
+	}
+}
+
+// noAuth sends requests without credentials
+type noAuth struct{}
+
+func (noAuth) authenticate(*http.Request, []byte) error { return nil }
+
+// basicAuth sends HTTP basic auth credentials
+type basicAuth struct {
+	username, password string
+}
+
+func (a basicAuth) authenticate(req *http.Request, _ []byte) error {
+	req.SetBasicAuth(a.username, a.password)
+	return nil
+}
+
+// headerAuth sends a fixed credential header, a bearer token or an API key
+// under a gateway's own header name
+type headerAuth struct {
+	name, value string
+}
+
+func (a headerAuth) authenticate(req *http.Request, _ []byte) error {
+	req.Header.Set(a.name, a.value)
+	return nil
+}
@@ -0,0 +1,74 @@
+package loki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+func TestNewAuthenticator_Modes(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.Config
+		header string
+		want   string
+	}{
+		{"inferred none", config.Config{}, "Authorization", ""},
+		{"inferred bearer", config.Config{LokiAPIKey: "tok"}, "Authorization", "Bearer tok"},
+		{"inferred basic", config.Config{LokiUsername: "user", LokiPassword: "pass"}, "Authorization", "Basic dXNlcjpwYXNz"},
+		{"explicit none", config.Config{LokiAuthMode: config.AuthModeNone}, "Authorization", ""},
+		{"explicit basic", config.Config{LokiAuthMode: config.AuthModeBasic, LokiUsername: "user", LokiPassword: "pass"}, "Authorization", "Basic dXNlcjpwYXNz"},
+		{"explicit bearer", config.Config{LokiAuthMode: config.AuthModeBearer, LokiAPIKey: "tok"}, "Authorization", "Bearer tok"},
+		{"custom header", config.Config{LokiAuthMode: config.AuthModeHeader, LokiAuthHeader: "X-Api-Key", LokiAPIKey: "tok"}, "X-Api-Key", "tok"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "http://loki/push", nil)
+			if err := newAuthenticator(&tt.cfg).authenticate(req, nil); err != nil {
+				t.Fatalf("authenticate() error = %v", err)
+			}
+			if got := req.Header.Get(tt.header); got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.header, got, tt.want)
+			}
+			if tt.header != "Authorization" && req.Header.Get("Authorization") != "" {
+				t.Errorf("Authorization set in %s mode", tt.cfg.LokiAuthMode)
+			}
+		})
+	}
+
+	sigv4 := &config.Config{LokiAuthMode: config.AuthModeSigV4, LokiSigV4Region: "eu-west-1"}
+	if _, ok := newAuthenticator(sigv4).(*requestSigner); !ok {
+		t.Error("sigv4 mode should sign requests")
+	}
+}
+
+// The custom header is sent alongside the tenant and extra headers
+func TestClient_Push_CustomHeaderAuth(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.LokiAuthMode = config.AuthModeHeader
+	cfg.LokiAuthHeader = "X-Api-Key"
+	cfg.LokiAPIKey = "tok"
+	cfg.LokiTenantID = "tenant-123"
+	cfg.LokiExtraHeaders = map[string]string{"X-Org": "shop"}
+
+	if err := NewClient(cfg).Push(context.Background(), newTestRequest()); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if received.Get("X-Api-Key") != "tok" || received.Get("X-Scope-OrgID") != "tenant-123" || received.Get("X-Org") != "shop" {
+		t.Errorf("headers = %v", received)
+	}
+	if received.Get("Authorization") != "" {
+		t.Errorf("Authorization = %q, want none", received.Get("Authorization"))
+	}
+}
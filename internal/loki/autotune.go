@@ -0,0 +1,94 @@
+package loki
+
+import "sync"
+
+// Compression auto-tuning (LOKI_COMPRESSION_AUTO)
+const (
+	poorCompressionRatio  = 0.8     // a push saving less than 20% is not worth the CPU
+	disableAfterPoor      = 3       // consecutive poor pushes before compression is switched off
+	compressionProbeEvery = 50      // pushes sent uncompressed between probes while switched off
+	maxAutoThreshold      = 1 << 20 // highest threshold the tuner raises to
+	ratioSmoothing        = 0.2     // weight of the latest push in the average ratio
+)
+
+// CompressionStats describes compression as currently applied
+type CompressionStats struct {
+	Enabled   bool    // false while auto-tuning has switched compression off
+	Threshold int     // bodies up to this size are sent uncompressed
+	Ratio     float64 // moving average of compressed/raw size; 0 before the first compressed push
+}
+
+// compressionTuner tracks the ratio achieved by each compressed push and,
+// when auto-tuning is on, raises the threshold after pushes that barely
+// compress and switches compression off after several in a row. While off,
+// every compressionProbeEvery-th push is still compressed to notice when
+// the content becomes compressible again.
+type compressionTuner struct {
+	auto bool
+	base int
+
+	mu        sync.Mutex
+	threshold int
+	poor      int  // consecutive poorly compressing pushes
+	disabled  bool // compression switched off by the tuner
+	skipped   int  // pushes sent uncompressed while disabled
+	ratio     float64
+}
+
+func newCompressionTuner(threshold int, auto bool) *compressionTuner {
+	return &compressionTuner{auto: auto, base: threshold, threshold: threshold}
+}
+
+// shouldCompress reports whether a body of size bytes should be compressed
+func (t *compressionTuner) shouldCompress(size int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.disabled {
+		t.skipped++
+		if t.skipped < compressionProbeEvery {
+			return false
+		}
+		t.skipped = 0
+		return true
+	}
+	return size > t.threshold
+}
+
+// observe records the outcome of compressing raw bytes into encoded bytes
+func (t *compressionTuner) observe(raw, encoded int) {
+	if raw <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ratio := float64(encoded) / float64(raw)
+	if t.ratio == 0 {
+		t.ratio = ratio
+	} else {
+		t.ratio += ratioSmoothing * (ratio - t.ratio)
+	}
+	if !t.auto {
+		return
+	}
+
+	if ratio <= poorCompressionRatio {
+		// Compressible again: step the threshold back towards the configured one
+		t.poor = 0
+		t.disabled = false
+		t.threshold = max(t.base, t.threshold/2)
+		return
+	}
+	t.poor++
+	t.threshold = min(max(t.threshold*2, raw), maxAutoThreshold)
+	if t.poor >= disableAfterPoor {
+		t.disabled = true
+	}
+}
+
+// stats returns the current compression decision
+func (t *compressionTuner) stats() CompressionStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return CompressionStats{Enabled: !t.disabled, Threshold: t.threshold, Ratio: t.ratio}
+}
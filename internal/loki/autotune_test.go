@@ -0,0 +1,104 @@
+package loki
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCompressionTuner_StaticThreshold(t *testing.T) {
+	tuner := newCompressionTuner(1024, false)
+	if tuner.shouldCompress(1024) || !tuner.shouldCompress(1025) {
+		t.Error("expected compression only above the threshold")
+	}
+	for i := 0; i < 10; i++ {
+		tuner.observe(2000, 1990)
+	}
+	if s := tuner.stats(); !s.Enabled || s.Threshold != 1024 {
+		t.Errorf("stats = %+v, want threshold unchanged without auto-tuning", s)
+	}
+	if s := tuner.stats(); s.Ratio < 0.99 || s.Ratio > 1 {
+		t.Errorf("ratio = %v, want about 0.995", s.Ratio)
+	}
+}
+
+func TestCompressionTuner_DisablesAndRecovers(t *testing.T) {
+	tuner := newCompressionTuner(1024, true)
+
+	tuner.observe(2000, 1950)
+	if s := tuner.stats(); s.Threshold != 2048 || !s.Enabled {
+		t.Errorf("after one poor push: %+v, want threshold 2048", s)
+	}
+	tuner.observe(5000, 4900) // raised at least past this body
+	tuner.observe(9000, 8900)
+	if s := tuner.stats(); s.Enabled || s.Threshold != 10000 {
+		t.Errorf("after %d poor pushes: %+v, want compression off with threshold 10000", disableAfterPoor, s)
+	}
+
+	// Only every compressionProbeEvery-th push is compressed while off
+	probes := 0
+	for i := 0; i < 2*compressionProbeEvery; i++ {
+		if tuner.shouldCompress(1 << 30) {
+			probes++
+		}
+	}
+	if probes != 2 {
+		t.Errorf("probed %d times, want 2", probes)
+	}
+
+	// A probe that compresses well switches compression back on
+	tuner.observe(9000, 1000)
+	s := tuner.stats()
+	if !s.Enabled || s.Threshold != 5000 {
+		t.Errorf("after a good probe: %+v, want compression on with threshold halved", s)
+	}
+}
+
+func TestClient_CompressionAutoSkipsIncompressibleBodies(t *testing.T) {
+	var mu sync.Mutex
+	var encodings []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.CompressionThreshold = 100
+	cfg.CompressionAuto = true
+	client := NewClient(cfg)
+
+	// Each poor push raises the threshold past its size, so growing bodies
+	// are needed to reach the point where compression is switched off
+	for _, size := range []int{1000, 2000, 4000, 4000, 4000} {
+		req := NewPushRequest(map[string]string{"function_name": "f"}, [][]string{{"1", randomText(size)}})
+		if err := client.Push(context.Background(), req); err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(encodings, ","); got != "gzip,gzip,gzip,," {
+		t.Errorf("Content-Encoding per push = %q, want gzip until compression is switched off", got)
+	}
+	if s := client.CompressionStats(); s.Enabled || s.Ratio < poorCompressionRatio {
+		t.Errorf("stats = %+v, want compression off with a poor ratio", s)
+	}
+}
+
+// randomText returns n high-entropy printable characters that need no JSON escaping
+func randomText(n int) string {
+	const alphabet = "!#$%()*+,-./0123456789:;=?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[]^_`abcdefghijklmnopqrstuvwxyz{|}~"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[rand.Intn(len(alphabet))]
+	}
+	return string(b)
+}
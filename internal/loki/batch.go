@@ -1,20 +1,33 @@
 package loki
 
 import (
+	"encoding/json"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
 )
 
+// ExtensionSource is the source label of the extension's own log stream
+const ExtensionSource = "lambdawatch"
+
 // Batch collects log entries for a single Loki push request.
-// All entries are sent in one stream — request_id is injected into the
-// message content rather than used as a label, following Loki's best
-// practice of keeping label cardinality low.
+// By default all entries are sent in one stream — request_id is injected
+// into the message content rather than used as a label, following Loki's
+// best practice of keeping label cardinality low.
 type Batch struct {
 	entries          []buffer.LogEntry
 	labels           map[string]string
 	extractRequestID bool
+	groupByRequestID bool
+	dedupRepeats     bool
+	ordering         string            // config.Ordering*; empty leaves timestamps as received
+	extensionLogs    string            // config.ExtensionLogs*; empty ships them mixed
+	guard            *LabelGuard       // nil ships labels as built
+	limiter          *StreamLimiter    // nil ships every entry
+	metadata         map[string]string // structured metadata on every entry
 }
 
 // NewBatch creates a new batch with the given stream labels.
@@ -28,8 +41,108 @@ func NewBatch(labels map[string]string, extractRequestID bool) *Batch {
 	}
 }
 
-// Add appends entries to the batch.
+// GroupByRequestID splits entries into one stream per request ID, with
+// request_id as a stream label. This creates a stream per invocation, so it
+// is only suitable for low-traffic functions.
+func (b *Batch) GroupByRequestID() {
+	b.groupByRequestID = true
+}
+
+// DedupRepeats collapses consecutive identical lines within a stream into
+// the first occurrence, annotated with a repeat_count structured metadata
+// field giving the total number of occurrences.
+func (b *Batch) DedupRepeats() {
+	b.dedupRepeats = true
+}
+
+// SetOrdering selects how out-of-order timestamps within a stream are
+// fixed: config.OrderingClamp, config.OrderingSort or config.OrderingOff
+func (b *Batch) SetOrdering(mode string) {
+	b.ordering = mode
+}
+
+// SetExtensionLogs selects where the extension's own entries go:
+// config.ExtensionLogsStream puts them in a stream of their own, labelled
+// source=ExtensionSource, config.ExtensionLogsOff leaves them out and
+// config.ExtensionLogsMixed ships them with the function's logs
+func (b *Batch) SetExtensionLogs(mode string) {
+	b.extensionLogs = mode
+}
+
+// SetMetadata attaches metadata as structured metadata to every entry
+func (b *Batch) SetMetadata(metadata map[string]string) {
+	b.metadata = metadata
+}
+
+// SetLabelGuard applies label governance to every stream of the batch
+func (b *Batch) SetLabelGuard(g *LabelGuard) {
+	b.guard = g
+}
+
+// SetRateLimiter sets the limiter Admit applies. The first line shipped
+// after drops carries a rate_limited structured metadata field with the
+// number of lines dropped before it.
+func (b *Batch) SetRateLimiter(l *StreamLimiter) {
+	b.limiter = l
+}
+
+// Admit drops entries of streams over their rate limit, returning those
+// that may be shipped. It is applied once, when entries are taken from the
+// buffer: entries handed back by a failed push were admitted when first
+// taken, so a retry neither spends tokens again nor loses them.
+func (b *Batch) Admit(entries []buffer.LogEntry) []buffer.LogEntry {
+	if b.limiter == nil {
+		return entries
+	}
+	kept := entries[:0]
+	for _, entry := range entries {
+		// Entries Add leaves out do not count against the limit
+		skipped := entry.Internal && b.extensionLogs == config.ExtensionLogsOff
+		if entry.Retried() || skipped {
+			kept = append(kept, entry)
+			continue
+		}
+		key := streamKey(b.extraLabels(entry))
+		if !b.limiter.allow(key, entry.Timestamp) {
+			continue
+		}
+		if dropped := b.limiter.takeDropped(key); dropped > 0 {
+			entry.SetAttribute("rate_limited", strconv.Itoa(dropped))
+		}
+		kept = append(kept, entry)
+	}
+	return kept
+}
+
+// SetSharder assigns the batch the sharder's next shard, added to every
+// stream's labels. Each batch built for a flush advances the rotation.
+func (b *Batch) SetSharder(s *Sharder) {
+	shard, ok := s.take()
+	if !ok {
+		return
+	}
+	labels := make(map[string]string, len(b.labels)+1)
+	for k, v := range b.labels {
+		labels[k] = v
+	}
+	labels[ShardLabel] = shard
+	b.labels = labels
+}
+
+// EnvelopeSize returns the bytes an encoded push body with one stream
+// labelled labels spends outside its values. Together with each entry's
+// buffer.LogEntry.Size it gives the body size before compression.
+func EnvelopeSize(labels map[string]string) int {
+	encoded, _ := json.Marshal(labels)
+	return len(`{"streams":[{"stream":,"values":[]}]}`) + len(encoded) + 1 // Encode adds a newline
+}
+
+// Add appends entries to the batch. The extension's own entries are
+// skipped under config.ExtensionLogsOff, so it must be set first.
 func (b *Batch) Add(entries []buffer.LogEntry) {
+	if b.extensionLogs == config.ExtensionLogsOff {
+		entries = withoutInternal(entries)
+	}
 	b.entries = append(b.entries, entries...)
 }
 
@@ -45,18 +158,212 @@ func (b *Batch) ToPushRequest() *PushRequest {
 		return nil
 	}
 
-	values := make([][]string, len(b.entries))
-	for i, entry := range b.entries {
+	return b.pushRequest(b.entries)
+}
+
+// ToTenantPushRequests partitions the batch by tenant and returns one
+// PushRequest per tenant, in the order each tenant was first seen.
+//
+// An entry's tenant is the value of tenantLabel in its JSON message body,
+// falling back to the batch's stream label of the same name. Entries with
+// no value are left on the client's default tenant (empty TenantID).
+// When tenantLabel is empty this is equivalent to ToPushRequest.
+func (b *Batch) ToTenantPushRequests(tenantLabel string) []*PushRequest {
+	if len(b.entries) == 0 {
+		return nil
+	}
+	if tenantLabel == "" {
+		return []*PushRequest{b.ToPushRequest()}
+	}
+
+	var tenants []string
+	partitions := make(map[string][]buffer.LogEntry)
+	for _, entry := range b.entries {
+		tenant := b.tenantFor(entry, tenantLabel)
+		if _, ok := partitions[tenant]; !ok {
+			tenants = append(tenants, tenant)
+		}
+		partitions[tenant] = append(partitions[tenant], entry)
+	}
+
+	reqs := make([]*PushRequest, 0, len(tenants))
+	for _, tenant := range tenants {
+		req := b.pushRequest(partitions[tenant])
+		req.TenantID = tenant
+		reqs = append(reqs, req)
+	}
+	return reqs
+}
+
+// tenantFor resolves the tenant for a single entry.
+func (b *Batch) tenantFor(entry buffer.LogEntry, tenantLabel string) string {
+	if strings.HasPrefix(strings.TrimSpace(entry.Message), "{") {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(entry.Message), &fields); err == nil {
+			if v, ok := fields[tenantLabel].(string); ok && v != "" {
+				return v
+			}
+		}
+	}
+	return b.labels[tenantLabel]
+}
+
+// pushRequest converts entries into a PushRequest. Entries share the batch's
+// stream unless they carry extra StreamLabels, in which case they are grouped
+// into one stream per distinct label set. Trace IDs and the cold-start flag are
+// attached as structured metadata so Grafana can link logs to traces without
+// turning them into labels. The extension's own entries are first merged
+// into the telemetry entries by timestamp.
+func (b *Batch) pushRequest(entries []buffer.LogEntry) *PushRequest {
+	entries = mergeInternal(entries)
+	req := &PushRequest{}
+	streamIdx := make(map[string]int)
+	repeats := make(map[int]int) // stream index → occurrences of its last line
+
+	for _, entry := range entries {
+		extra := b.extraLabels(entry)
+		key := streamKey(extra)
+		idx, ok := streamIdx[key]
+		if !ok {
+			idx = len(req.Streams)
+			streamIdx[key] = idx
+			req.Streams = append(req.Streams, Stream{Stream: b.guard.Apply(b.streamLabels(extra))})
+		}
+		stream := &req.Streams[idx]
+
 		tsNano := entry.Timestamp * 1_000_000 // milliseconds → nanoseconds
 		ts := strconv.FormatInt(tsNano, 10)
 		msg := entry.Message
 		if b.extractRequestID {
 			msg = injectRequestID(msg, entry.RequestID)
 		}
-		values[i] = []string{ts, msg}
+
+		if b.dedupRepeats && isRepeat(stream, msg, entry.Attribute(buffer.AttrTraceID)) {
+			repeats[idx]++
+			continue
+		}
+		flushRepeats(stream, repeats[idx])
+		repeats[idx] = 1
+
+		stream.Values = append(stream.Values, []string{ts, msg})
+		for k, v := range b.metadata {
+			annotateLast(stream, k, v)
+		}
+		for k, v := range entry.Attributes {
+			annotateLast(stream, k, v)
+		}
+		if entry.Chunk.Total > 0 {
+			annotateLast(stream, "chunk_id", entry.Chunk.ID)
+			annotateLast(stream, "chunk_index", strconv.Itoa(entry.Chunk.Index))
+			annotateLast(stream, "chunk_total", strconv.Itoa(entry.Chunk.Total))
+		}
 	}
 
-	return NewPushRequest(b.labels, values)
+	for idx := range req.Streams {
+		flushRepeats(&req.Streams[idx], repeats[idx])
+	}
+	orderStreams(req, b.ordering)
+
+	return req
+}
+
+// isRepeat reports whether msg repeats the stream's last line and trace ID
+func isRepeat(stream *Stream, msg, traceID string) bool {
+	n := len(stream.Values)
+	if n == 0 || stream.Values[n-1][1] != msg {
+		return false
+	}
+	lastTrace := ""
+	if len(stream.Metadata) == n {
+		lastTrace = stream.Metadata[n-1]["trace_id"]
+	}
+	return lastTrace == traceID
+}
+
+// flushRepeats records how many times the stream's last line occurred
+func flushRepeats(stream *Stream, count int) {
+	if count > 1 {
+		annotateLast(stream, "repeat_count", strconv.Itoa(count))
+	}
+}
+
+// annotateLast adds a structured metadata field to the stream's last value
+func annotateLast(stream *Stream, key, value string) {
+	for len(stream.Metadata) < len(stream.Values) {
+		stream.Metadata = append(stream.Metadata, nil)
+	}
+	last := len(stream.Values) - 1
+	if stream.Metadata[last] == nil {
+		stream.Metadata[last] = make(map[string]string, 1)
+	}
+	stream.Metadata[last][key] = value
+}
+
+// extraLabels returns the labels an entry adds to the batch labels
+func (b *Batch) extraLabels(entry buffer.LogEntry) map[string]string {
+	byRequest := b.groupByRequestID && entry.RequestID != ""
+	separate := entry.Internal && b.extensionLogs == config.ExtensionLogsStream
+	if !byRequest && !separate {
+		return entry.StreamLabels
+	}
+	extra := make(map[string]string, len(entry.StreamLabels)+2)
+	for k, v := range entry.StreamLabels {
+		extra[k] = v
+	}
+	if byRequest {
+		extra["request_id"] = entry.RequestID
+	}
+	if separate {
+		extra["source"] = ExtensionSource
+	}
+	return extra
+}
+
+// withoutInternal returns entries without the extension's own
+func withoutInternal(entries []buffer.LogEntry) []buffer.LogEntry {
+	kept := make([]buffer.LogEntry, 0, len(entries))
+	for _, e := range entries {
+		if !e.Internal {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// streamLabels merges an entry's extra labels over the batch labels
+func (b *Batch) streamLabels(extra map[string]string) map[string]string {
+	if len(extra) == 0 {
+		return b.labels
+	}
+	labels := make(map[string]string, len(b.labels)+len(extra))
+	for k, v := range b.labels {
+		labels[k] = v
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	return labels
+}
+
+// streamKey returns a canonical key for a set of extra labels
+func streamKey(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(labels[k])
+		sb.WriteByte(',')
+	}
+	return sb.String()
 }
 
 // injectRequestID embeds the request ID into the log message so it is
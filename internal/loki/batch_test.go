@@ -1,9 +1,13 @@
 package loki
 
 import (
+	"bytes"
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
 )
 
 func TestBatch_NewBatch(t *testing.T) {
@@ -154,3 +158,341 @@ func TestBatch_LeavesMessagesUnchangedWhenDisabled(t *testing.T) {
 		t.Errorf("message should be unchanged: %s", values[1][1])
 	}
 }
+
+// --- tenant partitioning ---
+
+func TestBatch_ToTenantPushRequests_NoLabel(t *testing.T) {
+	b := NewBatch(map[string]string{"source": "lambda"}, false)
+	b.Add([]buffer.LogEntry{{Timestamp: 1000, Message: `{"team":"a"}`}})
+
+	reqs := b.ToTenantPushRequests("")
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(reqs))
+	}
+	if reqs[0].TenantID != "" {
+		t.Errorf("expected default tenant, got %q", reqs[0].TenantID)
+	}
+}
+
+func TestBatch_ToTenantPushRequests_PartitionsByMessageField(t *testing.T) {
+	b := NewBatch(map[string]string{"source": "lambda"}, false)
+	b.Add([]buffer.LogEntry{
+		{Timestamp: 1000, Message: `{"team":"payments","msg":"a"}`},
+		{Timestamp: 2000, Message: `{"team":"search","msg":"b"}`},
+		{Timestamp: 3000, Message: `{"team":"payments","msg":"c"}`},
+		{Timestamp: 4000, Message: "plain text"},
+	})
+
+	reqs := b.ToTenantPushRequests("team")
+	if len(reqs) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(reqs))
+	}
+
+	want := []struct {
+		tenant string
+		count  int
+	}{{"payments", 2}, {"search", 1}, {"", 1}}
+	for i, w := range want {
+		if reqs[i].TenantID != w.tenant {
+			t.Errorf("request %d: tenant = %q, want %q", i, reqs[i].TenantID, w.tenant)
+		}
+		if got := len(reqs[i].Streams[0].Values); got != w.count {
+			t.Errorf("request %d: %d values, want %d", i, got, w.count)
+		}
+	}
+}
+
+func TestBatch_ToTenantPushRequests_FallsBackToStreamLabel(t *testing.T) {
+	b := NewBatch(map[string]string{"team": "platform"}, false)
+	b.Add([]buffer.LogEntry{
+		{Timestamp: 1000, Message: "plain text"},
+		{Timestamp: 2000, Message: `{"team":"search"}`},
+	})
+
+	reqs := b.ToTenantPushRequests("team")
+	if len(reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(reqs))
+	}
+	if reqs[0].TenantID != "platform" || reqs[1].TenantID != "search" {
+		t.Errorf("tenants = %q, %q; want platform, search", reqs[0].TenantID, reqs[1].TenantID)
+	}
+}
+
+// --- structured metadata ---
+
+func TestBatch_TraceIDAsStructuredMetadata(t *testing.T) {
+	b := NewBatch(map[string]string{"source": "lambda"}, false)
+	b.Add([]buffer.LogEntry{
+		{Timestamp: 1000, Message: "with trace", Attributes: map[string]string{buffer.AttrTraceID: "1-abc"}},
+		{Timestamp: 2000, Message: "without trace"},
+	})
+
+	body, err := json.Marshal(b.ToPushRequest())
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	want := `"values":[["1000000000","with trace",{"trace_id":"1-abc"}],["2000000000","without trace"]]`
+	if !strings.Contains(string(body), want) {
+		t.Errorf("body = %s, want to contain %s", body, want)
+	}
+
+	var decoded PushRequest
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	stream := decoded.Streams[0]
+	if stream.Values[0][1] != "with trace" || stream.Metadata[0]["trace_id"] != "1-abc" {
+		t.Errorf("round trip lost metadata: %+v", stream)
+	}
+	if stream.Metadata[1] != nil {
+		t.Errorf("expected no metadata on second value, got %v", stream.Metadata[1])
+	}
+}
+
+func TestBatch_OutcomeAsStructuredMetadata(t *testing.T) {
+	b := NewBatch(map[string]string{"source": "lambda"}, false)
+	b.Add([]buffer.LogEntry{
+		{Timestamp: 1000, Message: "slow", Attributes: map[string]string{buffer.AttrOutcome: "timeout"}},
+		{Timestamp: 2000, Message: "ok"},
+	})
+
+	md := b.ToPushRequest().Streams[0].Metadata
+	if md[0]["outcome"] != "timeout" {
+		t.Errorf("metadata[0] = %v, want outcome timeout", md[0])
+	}
+	if len(md) > 1 && md[1] != nil {
+		t.Errorf("expected no metadata on successful entry, got %v", md[1])
+	}
+}
+
+func TestBatch_ChunkAsStructuredMetadata(t *testing.T) {
+	b := NewBatch(map[string]string{"source": "lambda"}, false)
+	b.Add([]buffer.LogEntry{
+		{Timestamp: 1000, Message: "first half ", Chunk: buffer.Chunk{ID: "c-1", Index: 1, Total: 2}},
+		{Timestamp: 1001, Message: "second half", Chunk: buffer.Chunk{ID: "c-1", Index: 2, Total: 2}},
+	})
+
+	md := b.ToPushRequest().Streams[0].Metadata
+	for i, want := range []string{"1", "2"} {
+		if md[i]["chunk_id"] != "c-1" || md[i]["chunk_index"] != want || md[i]["chunk_total"] != "2" {
+			t.Errorf("metadata[%d] = %v", i, md[i])
+		}
+	}
+}
+
+func TestBatch_ColdStartAsStructuredMetadata(t *testing.T) {
+	b := NewBatch(map[string]string{"source": "lambda"}, false)
+	b.Add([]buffer.LogEntry{
+		{Timestamp: 1000, Message: "cold", Attributes: map[string]string{buffer.AttrTraceID: "1-abc", buffer.AttrColdStart: "true"}},
+		{Timestamp: 2000, Message: "warm"},
+	})
+
+	req := b.ToPushRequest()
+	if len(req.Streams) != 1 {
+		t.Fatalf("cold start must not split streams, got %d", len(req.Streams))
+	}
+	md := req.Streams[0].Metadata
+	if md[0]["cold_start"] != "true" || md[0]["trace_id"] != "1-abc" {
+		t.Errorf("metadata[0] = %v", md[0])
+	}
+	if len(md) > 1 && md[1] != nil {
+		t.Errorf("expected no metadata on warm entry, got %v", md[1])
+	}
+}
+
+func TestBatch_NoMetadataKeepsPlainTuples(t *testing.T) {
+	b := NewBatch(map[string]string{"source": "lambda"}, false)
+	b.Add([]buffer.LogEntry{{Timestamp: 1000, Message: "hello"}})
+
+	body, _ := json.Marshal(b.ToPushRequest())
+	if !strings.Contains(string(body), `"values":[["1000000000","hello"]]`) {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
+
+func TestBatch_StreamLabelsSplitStreams(t *testing.T) {
+	b := NewBatch(map[string]string{"source": "lambda"}, false)
+	b.Add([]buffer.LogEntry{
+		{Timestamp: 1000, Message: "a"},
+		{Timestamp: 2000, Message: "summary", StreamLabels: map[string]string{"type": "invocation_summary"}},
+		{Timestamp: 3000, Message: "b"},
+	})
+
+	req := b.ToPushRequest()
+	if len(req.Streams) != 2 {
+		t.Fatalf("expected 2 streams, got %d", len(req.Streams))
+	}
+	if len(req.Streams[0].Values) != 2 || req.Streams[0].Stream["type"] != "" {
+		t.Errorf("unexpected default stream: %+v", req.Streams[0])
+	}
+	summary := req.Streams[1]
+	if summary.Stream["type"] != "invocation_summary" || summary.Stream["source"] != "lambda" {
+		t.Errorf("unexpected summary labels: %v", summary.Stream)
+	}
+	if b.labels["type"] != "" {
+		t.Error("batch labels must not be mutated")
+	}
+}
+
+func TestBatch_GroupByRequestID(t *testing.T) {
+	b := NewBatch(map[string]string{"source": "lambda"}, false)
+	b.GroupByRequestID()
+	b.Add([]buffer.LogEntry{
+		{Timestamp: 1000, Message: "a1", RequestID: "req-a"},
+		{Timestamp: 1001, Message: "b1", RequestID: "req-b"},
+		{Timestamp: 1002, Message: "a2", RequestID: "req-a"},
+		{Timestamp: 1003, Message: "no request"},
+	})
+
+	req := b.ToPushRequest()
+	if len(req.Streams) != 3 {
+		t.Fatalf("expected 3 streams, got %d", len(req.Streams))
+	}
+	if req.Streams[0].Stream["request_id"] != "req-a" || len(req.Streams[0].Values) != 2 {
+		t.Errorf("unexpected first stream: %+v", req.Streams[0])
+	}
+	if req.Streams[1].Stream["request_id"] != "req-b" {
+		t.Errorf("unexpected second stream labels: %v", req.Streams[1].Stream)
+	}
+	if _, ok := req.Streams[2].Stream["request_id"]; ok {
+		t.Errorf("entry without request ID should stay in the base stream")
+	}
+	if req.Streams[0].Values[0][1] != "a1" {
+		t.Errorf("request ID should not be injected when disabled, got %q", req.Streams[0].Values[0][1])
+	}
+}
+
+func TestBatch_DedupRepeats(t *testing.T) {
+	b := NewBatch(map[string]string{"source": "lambda"}, false)
+	b.DedupRepeats()
+	b.Add([]buffer.LogEntry{
+		{Timestamp: 1000, Message: "retrying"},
+		{Timestamp: 1001, Message: "retrying"},
+		{Timestamp: 1002, Message: "fault", StreamLabels: map[string]string{"error": "true"}},
+		{Timestamp: 1003, Message: "retrying"},
+		{Timestamp: 1004, Message: "done"},
+		{Timestamp: 1005, Message: "retrying"},
+	})
+
+	req := b.ToPushRequest()
+	values := req.Streams[0].Values
+	if len(values) != 3 {
+		t.Fatalf("expected 3 values after dedup, got %v", values)
+	}
+	if values[0][0] != "1000000000" || values[0][1] != "retrying" {
+		t.Errorf("first occurrence should be kept, got %v", values[0])
+	}
+	if got := req.Streams[0].Metadata[0]["repeat_count"]; got != "3" {
+		t.Errorf("repeat_count = %q, want 3 (interleaved streams do not break a run)", got)
+	}
+	if len(req.Streams[0].Metadata) > 2 && req.Streams[0].Metadata[2] != nil {
+		t.Errorf("single occurrence should not be annotated, got %v", req.Streams[0].Metadata[2])
+	}
+
+	body, err := json.Marshal(req.Streams[0])
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(body), `["1000000000","retrying",{"repeat_count":"3"}]`) {
+		t.Errorf("unexpected encoding %s", body)
+	}
+}
+
+func TestBatch_DedupRepeatsKeepsDistinctTraces(t *testing.T) {
+	b := NewBatch(map[string]string{}, false)
+	b.DedupRepeats()
+	b.Add([]buffer.LogEntry{
+		{Timestamp: 1000, Message: "same", Attributes: map[string]string{buffer.AttrTraceID: "t1"}},
+		{Timestamp: 1001, Message: "same", Attributes: map[string]string{buffer.AttrTraceID: "t2"}},
+		{Timestamp: 1002, Message: "same", Attributes: map[string]string{buffer.AttrTraceID: "t2"}},
+	})
+
+	stream := b.ToPushRequest().Streams[0]
+	if len(stream.Values) != 2 {
+		t.Fatalf("expected 2 values, got %d", len(stream.Values))
+	}
+	if stream.Metadata[1]["trace_id"] != "t2" || stream.Metadata[1]["repeat_count"] != "2" {
+		t.Errorf("unexpected metadata %v", stream.Metadata[1])
+	}
+}
+
+func TestBatch_NoDedupByDefault(t *testing.T) {
+	b := NewBatch(map[string]string{}, false)
+	b.Add([]buffer.LogEntry{{Timestamp: 1, Message: "x"}, {Timestamp: 2, Message: "x"}})
+	if n := len(b.ToPushRequest().Streams[0].Values); n != 2 {
+		t.Errorf("expected 2 values without dedup, got %d", n)
+	}
+}
+
+// Entry sizes plus the envelope bound the encoded body, within the one
+// separator the last value does not need
+func TestBatch_ExtensionLogsStream(t *testing.T) {
+	b := NewBatch(map[string]string{"source": "lambda", "function_name": "f"}, false)
+	b.SetExtensionLogs(config.ExtensionLogsStream)
+	b.Add([]buffer.LogEntry{
+		{Timestamp: 1, Message: "function line"},
+		{Timestamp: 2, Message: "extension line", Internal: true},
+	})
+
+	req := b.ToPushRequest()
+	if len(req.Streams) != 2 {
+		t.Fatalf("expected function and extension streams, got %d", len(req.Streams))
+	}
+	for _, s := range req.Streams {
+		want := "lambda"
+		if s.Values[0][1] == "extension line" {
+			want = ExtensionSource
+		}
+		if s.Stream["source"] != want || s.Stream["function_name"] != "f" || len(s.Values) != 1 {
+			t.Errorf("stream %v holds %v, want source=%s", s.Stream, s.Values, want)
+		}
+	}
+}
+
+func TestBatch_ExtensionLogsOff(t *testing.T) {
+	b := NewBatch(map[string]string{"source": "lambda"}, false)
+	b.SetExtensionLogs(config.ExtensionLogsOff)
+	b.Add([]buffer.LogEntry{{Timestamp: 1, Message: "extension line", Internal: true}})
+	if b.Len() != 0 || b.ToPushRequest() != nil {
+		t.Error("extension entries should be left out")
+	}
+
+	b.Add([]buffer.LogEntry{{Timestamp: 2, Message: "function line"}})
+	if req := b.ToPushRequest(); len(req.Streams) != 1 || len(req.Streams[0].Values) != 1 {
+		t.Errorf("expected only the function line, got %+v", req.Streams)
+	}
+}
+
+func TestBatch_ExtensionLogsMixedByDefault(t *testing.T) {
+	b := NewBatch(map[string]string{"source": "lambda"}, false)
+	b.Add([]buffer.LogEntry{
+		{Timestamp: 1, Message: "function line"},
+		{Timestamp: 2, Message: "extension line", Internal: true},
+	})
+	if req := b.ToPushRequest(); len(req.Streams) != 1 || len(req.Streams[0].Values) != 2 {
+		t.Errorf("expected one shared stream, got %+v", req.Streams)
+	}
+}
+
+func TestEnvelopeSize_MatchesEncodedBody(t *testing.T) {
+	labels := map[string]string{"function_name": "orders", "source": "lambda"}
+	entries := []buffer.LogEntry{
+		{Timestamp: 1700000000000, Message: "plain line"},
+		{Timestamp: 1700000000001, Message: `{"level":"info","msg":"<ok> & \"quoted\""}`, RequestID: "req-1"},
+		{Timestamp: 1700000000002, Message: "traced\tline\n", Attributes: map[string]string{buffer.AttrTraceID: "1-abc-def"}},
+	}
+	b := NewBatch(labels, true)
+	b.Add(entries)
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(b.ToPushRequest()); err != nil {
+		t.Fatal(err)
+	}
+	estimate := EnvelopeSize(labels)
+	for i := range entries {
+		estimate += entries[i].Size()
+	}
+	if estimate < body.Len() || estimate > body.Len()+1 {
+		t.Errorf("estimated %d bytes, encoded body is %d: %s", estimate, body.Len(), body.String())
+	}
+}
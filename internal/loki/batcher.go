@@ -0,0 +1,95 @@
+package loki
+
+import (
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+// Batcher builds batches configured from LOKI_* settings, so the extension
+// and the in-process shipper turn buffered entries into the same pushes.
+// The label guard, rate limiter and sharder it owns keep their state across
+// batches.
+type Batcher struct {
+	cfg      *config.Config
+	guard    *LabelGuard
+	limiter  *StreamLimiter    // nil unless LOKI_STREAM_RATE_LIMIT is set
+	sharder  *Sharder          // nil unless LOKI_STREAM_SHARDS exceeds 1
+	metadata map[string]string // faas_instance when LOKI_OTEL_RESOURCE_LABELS is set
+}
+
+// NewBatcher creates a batcher for cfg
+func NewBatcher(cfg *config.Config) *Batcher {
+	b := &Batcher{
+		cfg:     cfg,
+		guard:   NewLabelGuard(cfg),
+		limiter: NewStreamLimiter(cfg),
+		sharder: NewSharder(cfg),
+	}
+	if cfg.OTelResourceLabels {
+		b.metadata = resourceMetadata()
+	}
+	return b
+}
+
+// Admit applies the stream rate limit to entries just taken from the
+// buffer, as Batch.Admit does
+func (b *Batcher) Admit(labels map[string]string, entries []buffer.LogEntry) []buffer.LogEntry {
+	return b.newBatch(labels).Admit(entries)
+}
+
+// PushRequests converts entries into push requests, one per Loki tenant,
+// on the sharder's next shard
+func (b *Batcher) PushRequests(labels map[string]string, entries []buffer.LogEntry) []*PushRequest {
+	batch := b.newBatch(labels)
+	batch.SetSharder(b.sharder)
+	batch.Add(entries)
+	return batch.ToTenantPushRequests(b.cfg.LokiTenantLabel)
+}
+
+// ByteLimit returns LOKI_MAX_BATCH_SIZE_BYTES less the push body's stream
+// envelope (including any shard label), so that a batch cut by entry sizes
+// stays within the limit once serialized. Returns 0 when there is no limit.
+func (b *Batcher) ByteLimit(labels map[string]string) int {
+	if b.cfg.MaxBatchSizeBytes <= 0 {
+		return 0
+	}
+	return max(b.cfg.MaxBatchSizeBytes-EnvelopeSize(labels)-b.sharder.LabelSize(), 1)
+}
+
+// Full reports whether buf holds a batch worth flushing: batchSize entries,
+// or ByteLimit bytes of them
+func (b *Batcher) Full(labels map[string]string, buf *buffer.Buffer, batchSize int) bool {
+	if buf.Len() >= batchSize {
+		return true
+	}
+	limit := b.ByteLimit(labels)
+	return limit > 0 && buf.ByteSize() >= limit
+}
+
+// LabelGuardStats returns the label guard's interventions so far
+func (b *Batcher) LabelGuardStats() LabelGuardStats {
+	return b.guard.Stats()
+}
+
+// RateLimited returns the number of lines the rate limiter dropped
+func (b *Batcher) RateLimited() uint64 {
+	return b.limiter.Dropped()
+}
+
+// newBatch returns a batch without a shard, so that creating one does not
+// advance the rotation
+func (b *Batcher) newBatch(labels map[string]string) *Batch {
+	batch := NewBatch(labels, b.cfg.InjectRequestID)
+	if b.cfg.GroupByRequestID {
+		batch.GroupByRequestID()
+	}
+	if b.cfg.DedupRepeats {
+		batch.DedupRepeats()
+	}
+	batch.SetOrdering(b.cfg.TimestampOrdering)
+	batch.SetExtensionLogs(b.cfg.ExtensionLogs)
+	batch.SetLabelGuard(b.guard)
+	batch.SetRateLimiter(b.limiter)
+	batch.SetMetadata(b.metadata)
+	return batch
+}
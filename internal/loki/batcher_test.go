@@ -0,0 +1,89 @@
+package loki
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+func TestBatcher_PushRequestsApplyConfig(t *testing.T) {
+	b := NewBatcher(&config.Config{
+		ExtensionLogs: config.ExtensionLogsStream,
+		StreamShards:  2,
+	})
+	labels := map[string]string{"function_name": "f"}
+	entries := []buffer.LogEntry{
+		{Timestamp: 1, Message: "function line", Type: "function"},
+		{Timestamp: 2, Message: "extension line", Type: "extension", Internal: true},
+	}
+
+	for _, want := range []string{"0", "1"} {
+		reqs := b.PushRequests(labels, entries)
+		if len(reqs) != 1 || len(reqs[0].Streams) != 2 {
+			t.Fatalf("requests = %+v, want one with a function and an extension stream", reqs)
+		}
+		if got := reqs[0].Streams[1].Stream["source"]; got != ExtensionSource {
+			t.Errorf("extension stream source = %q, want %q", got, ExtensionSource)
+		}
+		if got := reqs[0].Streams[0].Stream[ShardLabel]; got != want {
+			t.Errorf("shard = %q, want %q", got, want)
+		}
+	}
+
+	// Admitting entries does not advance the shard rotation
+	b.Admit(labels, entries)
+	if got := b.PushRequests(labels, entries)[0].Streams[0].Stream[ShardLabel]; got != "0" {
+		t.Errorf("shard after Admit = %q, want 0", got)
+	}
+}
+
+func TestBatcher_ByteLimit(t *testing.T) {
+	labels := map[string]string{"function_name": "f"}
+	if got := NewBatcher(&config.Config{}).ByteLimit(labels); got != 0 {
+		t.Errorf("ByteLimit() = %d, want 0 without LOKI_MAX_BATCH_SIZE_BYTES", got)
+	}
+	b := NewBatcher(&config.Config{MaxBatchSizeBytes: 1000, StreamShards: 10})
+	if got, want := b.ByteLimit(labels), 1000-EnvelopeSize(labels)-b.sharder.LabelSize(); got != want {
+		t.Errorf("ByteLimit() = %d, want %d", got, want)
+	}
+	if got := NewBatcher(&config.Config{MaxBatchSizeBytes: 1}).ByteLimit(labels); got != 1 {
+		t.Errorf("ByteLimit() = %d, want at least 1", got)
+	}
+}
+
+func TestBatcher_ResourceMetadata(t *testing.T) {
+	t.Setenv("AWS_LAMBDA_LOG_STREAM_NAME", "2026/02/05/[$LATEST]abc")
+	labels := map[string]string{"function_name": "f"}
+	entries := []buffer.LogEntry{{Timestamp: 1, Message: "line"}}
+
+	stream := NewBatcher(&config.Config{}).PushRequests(labels, entries)[0].Streams[0]
+	if len(stream.Metadata) != 0 {
+		t.Errorf("metadata = %v, want none while disabled", stream.Metadata)
+	}
+
+	stream = NewBatcher(&config.Config{OTelResourceLabels: true}).PushRequests(labels, entries)[0].Streams[0]
+	if len(stream.Metadata) != 1 || stream.Metadata[0]["faas_instance"] != "2026/02/05/[$LATEST]abc" {
+		t.Errorf("metadata = %v, want faas_instance", stream.Metadata)
+	}
+	if _, ok := stream.Stream["faas_instance"]; ok {
+		t.Error("faas_instance set as a label")
+	}
+}
+
+func TestBatcher_Full(t *testing.T) {
+	labels := map[string]string{"function_name": "f"}
+	buf := buffer.New(10)
+	buf.Add(buffer.LogEntry{Timestamp: 1, Message: strings.Repeat("x", 100)})
+
+	if NewBatcher(&config.Config{}).Full(labels, buf, 2) {
+		t.Error("Full() = true below the batch size without a byte limit")
+	}
+	if !NewBatcher(&config.Config{}).Full(labels, buf, 1) {
+		t.Error("Full() = false at the batch size")
+	}
+	if !NewBatcher(&config.Config{MaxBatchSizeBytes: 1}).Full(labels, buf, 2) {
+		t.Error("Full() = false past the byte limit")
+	}
+}
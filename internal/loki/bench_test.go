@@ -0,0 +1,117 @@
+package loki
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+var benchLabels = map[string]string{
+	"source":        "lambda",
+	"function_name": "orders-api",
+	"environment":   "production",
+}
+
+// benchEntries returns n JSON function log lines spread over one second,
+// one invocation per 100 lines, with every 50th line an error
+func benchEntries(n int) []buffer.LogEntry {
+	entries := make([]buffer.LogEntry, n)
+	for i := range entries {
+		level, priority := "info", buffer.PriorityNormal
+		if i%50 == 0 {
+			level, priority = "error", buffer.PriorityHigh
+		}
+		entries[i] = buffer.LogEntry{
+			Timestamp:  1700000000000 + int64(i*1000/n),
+			Message:    fmt.Sprintf(`{"level":%q,"message":"order processed","order_id":"ord-%d","duration_ms":%d}`, level, i, i%300),
+			Type:       "function",
+			RequestID:  fmt.Sprintf("8f5c0a2e-1b7d-4c3e-9a6f-%012d", i/100),
+			Attributes: map[string]string{buffer.AttrTraceID: "1-65a1b2c3-4d5e6f7a8b9c0d1e2f3a4b5c"},
+			Priority:   priority,
+		}
+	}
+	return entries
+}
+
+// encodeBody marshals and, with a codec, compresses req the way the client does
+func encodeBody(b *testing.B, req *PushRequest, codec string) int {
+	jsonBuf := getBuffer()
+	defer putBuffer(jsonBuf)
+	if err := json.NewEncoder(jsonBuf).Encode(req); err != nil {
+		b.Fatal(err)
+	}
+	compressed := getBuffer()
+	defer putBuffer(compressed)
+	body, _, err := compress(codec, jsonBuf.Bytes(), compressed)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return len(body)
+}
+
+func BenchmarkBatch_PushRequest(b *testing.B) {
+	entries := benchEntries(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		batch := NewBatch(benchLabels, true)
+		batch.Add(entries)
+		_ = batch.ToPushRequest()
+	}
+}
+
+func BenchmarkEncode_JSON(b *testing.B) {
+	batch := NewBatch(benchLabels, true)
+	batch.Add(benchEntries(1000))
+	req := batch.ToPushRequest()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		encodeBody(b, req, config.CompressionNone)
+	}
+}
+
+func BenchmarkEncode_Gzip(b *testing.B) {
+	batch := NewBatch(benchLabels, true)
+	batch.Add(benchEntries(1000))
+	req := batch.ToPushRequest()
+	b.SetBytes(int64(encodeBody(b, req, config.CompressionNone)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		encodeBody(b, req, config.CompressionGzip)
+	}
+}
+
+// Benchmark10kEntriesPerSecond builds and gzips one second of our heaviest
+// function's output, 10k lines, in batches of 1000 as the flush loop would.
+// ns/op must stay well under a second for the extension to keep up.
+func Benchmark10kEntriesPerSecond(b *testing.B) {
+	entries := benchEntries(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for start := 0; start < len(entries); start += 1000 {
+			batch := NewBatch(benchLabels, true)
+			batch.Add(entries[start : start+1000])
+			encodeBody(b, batch.ToPushRequest(), config.CompressionGzip)
+		}
+	}
+}
+
+// Allocation budgets for building a push request and compressing its body.
+// Raising one should be a deliberate decision, not a side effect.
+func TestBatch_AllocBudget(t *testing.T) {
+	entries := benchEntries(1000)
+	allocs := testing.AllocsPerRun(20, func() {
+		batch := NewBatch(benchLabels, true)
+		batch.Add(entries)
+		_ = batch.ToPushRequest()
+	})
+	if perEntry := allocs / float64(len(entries)); perEntry > 6 {
+		t.Errorf("push request allocs per entry = %.2f, want <= 6", perEntry)
+	}
+}
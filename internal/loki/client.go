@@ -2,51 +2,104 @@ package loki
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
+	"math/rand"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/mumzworld-tech/lambdawatch/internal/config"
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
 )
 
 const (
-	httpClientTimeout = 10 * time.Second
+	httpClientTimeout = 10 * time.Second // default per-request timeout
 	baseBackoffDelay  = 100 * time.Millisecond
+	maxRetryAfter     = 30 * time.Second // caps server-requested Retry-After delays
+
+	// maxEscalatedBackoffAttempt caps the backoff exponent of escalated
+	// pushes, whose retries are bounded only by their context
+	maxEscalatedBackoffAttempt = 6
+	maxErrorBodyBytes          = 1024 // response body kept in push errors
 )
 
 // Client is a Loki HTTP client
 type Client struct {
-	endpoint             string
-	httpClient           *http.Client
-	username             string
-	password             string
-	apiKey               string
-	tenantID             string
-	enableGzip           bool
-	compressionThreshold int
-	maxRetries           int
-	criticalRetries      int
+	endpoints        *endpointPool
+	httpClient       *http.Client
+	auth             authenticator
+	tenantID         string
+	extraHeaders     map[string]string
+	compression      string
+	compressionTuner *compressionTuner
+	maxRetries       int
+	criticalRetries  int
+	rejectLog        io.Writer // where entries dropped after a 400 are dumped; kept off the logger so they are not re-buffered
+	dryRun           bool      // print batches to dryRunLog instead of pushing
+	dryRunLog        io.Writer
+	onResult         func(PushResult) // nil unless SetResultHook was called
+
+	// Longest computed wait between attempts, and the wall time one push
+	// may spend unless escalated; 0 leaves either unbounded
+	maxBackoff  time.Duration
+	retryBudget time.Duration
 }
 
 // NewClient creates a new Loki client
 func NewClient(cfg *config.Config) *Client {
 	return &Client{
-		endpoint:             cfg.LokiEndpoint,
-		httpClient:           &http.Client{Timeout: httpClientTimeout},
-		username:             cfg.LokiUsername,
-		password:             cfg.LokiPassword,
-		apiKey:               cfg.LokiAPIKey,
-		tenantID:             cfg.LokiTenantID,
-		enableGzip:           cfg.EnableGzip,
-		compressionThreshold: cfg.CompressionThreshold,
-		maxRetries:           cfg.MaxRetries,
-		criticalRetries:      cfg.CriticalFlushRetries,
+		endpoints:        newEndpointPool(lokiEndpoints(cfg), cfg.LokiFailoverThreshold, time.Duration(cfg.LokiFailoverProbeIntervalMs)*time.Millisecond),
+		httpClient:       &http.Client{Timeout: requestTimeout(cfg), Transport: newTransport(cfg)},
+		auth:             newAuthenticator(cfg),
+		tenantID:         cfg.LokiTenantID,
+		extraHeaders:     cfg.LokiExtraHeaders,
+		compression:      compressionCodec(cfg),
+		compressionTuner: newCompressionTuner(cfg.CompressionThreshold, cfg.CompressionAuto),
+		maxRetries:       cfg.MaxRetries,
+		criticalRetries:  cfg.CriticalFlushRetries,
+		maxBackoff:       time.Duration(cfg.RetryMaxBackoffMs) * time.Millisecond,
+		retryBudget:      time.Duration(cfg.RetryMaxElapsedMs) * time.Millisecond,
+		rejectLog:        os.Stderr,
+		dryRun:           cfg.DryRun,
+		dryRunLog:        os.Stdout,
+	}
+}
+
+// lokiEndpoints returns the configured push URLs, primary first
+func lokiEndpoints(cfg *config.Config) []string {
+	if len(cfg.LokiEndpoints) > 0 {
+		return cfg.LokiEndpoints
+	}
+	return []string{cfg.LokiEndpoint}
+}
+
+// compressionCodec resolves the codec from config, honoring the legacy
+// EnableGzip flag when Compression is unset
+func compressionCodec(cfg *config.Config) string {
+	if cfg.Compression != "" {
+		return cfg.Compression
+	}
+	if cfg.EnableGzip {
+		return config.CompressionGzip
+	}
+	return config.CompressionNone
+}
+
+// CompressionStats reports the compression ratio achieved and, with
+// LOKI_COMPRESSION_AUTO, the tuner's current decision
+func (c *Client) CompressionStats() CompressionStats {
+	if c == nil {
+		return CompressionStats{}
 	}
+	stats := c.compressionTuner.stats()
+	stats.Enabled = stats.Enabled && c.compression != config.CompressionNone
+	return stats
 }
 
 // Push sends a push request to Loki with retries (regular flush)
@@ -59,65 +112,165 @@ func (c *Client) PushCritical(ctx context.Context, req *PushRequest) error {
 	return c.push(ctx, req, true)
 }
 
+type escalatedKey struct{}
+
+// Escalate marks ctx so critical pushes made with it keep retrying until
+// its deadline instead of stopping after LOKI_CRITICAL_FLUSH_RETRIES. It is
+// used for the logs of failed and timed-out invocations. A context without
+// a deadline is not escalated.
+func Escalate(ctx context.Context) context.Context {
+	return context.WithValue(ctx, escalatedKey{}, true)
+}
+
+// escalated reports whether ctx was marked by Escalate and will end
+func escalated(ctx context.Context) bool {
+	if _, ok := ctx.Deadline(); !ok {
+		return false
+	}
+	marked, _ := ctx.Value(escalatedKey{}).(bool)
+	return marked
+}
+
+// push sends req, and if Loki rejects it with a 400, isolates and drops
+// only the offending entries so the rest of the batch is still delivered.
+// The rejection is returned only if no entry could be delivered.
 func (c *Client) push(ctx context.Context, req *PushRequest, isCritical bool) error {
 	if req == nil || len(req.Streams) == 0 {
 		return nil
 	}
 
-	jsonBody, err := json.Marshal(req)
+	err := c.send(ctx, req, isCritical)
+	if !isRejected(err) {
+		return err
+	}
+
+	rejection := err
+	budget := maxIsolationPushes
+	dropped, err := c.isolate(ctx, req, isCritical, rejection, &budget)
 	if err != nil {
+		return err
+	}
+	total := req.entryCount()
+	if dropped == total {
+		// Nothing was deliverable; let the caller dead-letter the batch
+		return rejection
+	}
+	if dropped > 0 {
+		logger.Warnf("Dropped %d of %d entries rejected by Loki", dropped, total)
+	}
+	return nil
+}
+
+// send encodes and pushes req with retries. The marshal and compression
+// buffers are pooled; the one backing the request body goes back to the
+// pool once the transport has closed every request reading it.
+func (c *Client) send(ctx context.Context, req *PushRequest, isCritical bool) error {
+	jsonBuf := getBuffer()
+	if err := json.NewEncoder(jsonBuf).Encode(req); err != nil {
+		putBuffer(jsonBuf)
 		return fmt.Errorf("failed to marshal push request: %w", err)
 	}
+	// Encode terminates the value with a newline that Marshal would not add
+	jsonBody := bytes.TrimSuffix(jsonBuf.Bytes(), []byte("\n"))
+	jsonBytes := len(jsonBody)
 
-	var body io.Reader
+	payload := newPushBody(jsonBuf, jsonBody)
 	var contentEncoding string
 
 	// Only compress if enabled AND payload exceeds threshold
-	if c.enableGzip && len(jsonBody) > c.compressionThreshold {
-		var buf bytes.Buffer
-		gw := gzip.NewWriter(&buf)
-		if _, err := gw.Write(jsonBody); err != nil {
-			return fmt.Errorf("failed to gzip body: %w", err)
+	if c.compression != config.CompressionNone && c.compressionTuner.shouldCompress(jsonBytes) {
+		compressed := getBuffer()
+		encoded, encoding, err := compress(c.compression, jsonBody, compressed)
+		if err != nil {
+			putBuffer(compressed)
+			payload.release()
+			return err
 		}
-		if err := gw.Close(); err != nil {
-			return fmt.Errorf("failed to close gzip writer: %w", err)
+		c.compressionTuner.observe(jsonBytes, len(encoded))
+		if encoding != "" {
+			payload.release()
+			payload = newPushBody(compressed, encoded)
+		} else {
+			putBuffer(compressed)
 		}
-		body = &buf
-		contentEncoding = "gzip"
-	} else {
-		body = bytes.NewReader(jsonBody)
+		contentEncoding = encoding
+	}
+	defer payload.release()
+	body := payload.data
+
+	tenantID := c.tenantID
+	if req.TenantID != "" {
+		tenantID = req.TenantID
 	}
 
-	return c.pushWithRetry(ctx, body, contentEncoding, isCritical)
+	if c.dryRun {
+		c.reportDryRun(req, tenantID, jsonBytes, body, contentEncoding)
+		return nil
+	}
+	result := PushResult{Critical: isCritical, Entries: req.entryCount()}
+	start := time.Now()
+	err := c.pushWithRetry(ctx, payload, contentEncoding, tenantID, isCritical, &result)
+	if c.onResult != nil {
+		result.Success = err == nil
+		result.Duration = time.Since(start)
+		result.Err = err
+		c.onResult(result)
+	}
+	return err
 }
 
-func (c *Client) pushWithRetry(ctx context.Context, body io.Reader, contentEncoding string, isCritical bool) error {
+// pushWithRetry pushes body until it is accepted or retries run out,
+// recording attempts, the endpoint and the last status in result
+func (c *Client) pushWithRetry(ctx context.Context, body *pushBody, contentEncoding, tenantID string, isCritical bool, result *PushResult) error {
 	var lastErr error
 
-	// Use higher retry count for critical flushes
+	// Use higher retry count for critical flushes; escalated ones retry
+	// until the context ends
 	retries := c.maxRetries
-	if isCritical {
+	unbounded := isCritical && escalated(ctx)
+	switch {
+	case unbounded:
+		retries = math.MaxInt - 1
+	case isCritical:
 		retries = c.criticalRetries
 	}
 
-	// Read body into buffer for retries
-	bodyBytes, err := io.ReadAll(body)
-	if err != nil {
-		return fmt.Errorf("failed to read body: %w", err)
+	// LOKI_RETRY_MAX_ELAPSED_MS bounds the whole push whatever the retry
+	// count; escalated pushes are meant to use their full deadline
+	var deadline time.Time
+	if c.retryBudget > 0 && !unbounded {
+		deadline = time.Now().Add(c.retryBudget)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadlineCause(ctx, deadline, errRetryBudget)
+		defer cancel()
 	}
 
 	for attempt := 0; attempt <= retries; attempt++ {
 		if attempt > 0 {
-			// Exponential backoff: 100ms, 200ms, 400ms, ...
-			backoff := time.Duration(math.Pow(2, float64(attempt-1))) * baseBackoffDelay
+			backoffAttempt := attempt
+			if unbounded {
+				backoffAttempt = min(attempt, maxEscalatedBackoffAttempt)
+			}
+			backoff := backoffDelay(backoffAttempt, lastErr, c.maxBackoff)
+			if !deadline.IsZero() && time.Until(deadline) < backoff {
+				// No point waiting for an attempt the budget would cut off
+				return fmt.Errorf("push failed after %d retries, %w: %w", attempt-1, errRetryBudget, lastErr)
+			}
 			select {
 			case <-ctx.Done():
-				return ctx.Err()
+				return ctxError(ctx)
 			case <-time.After(backoff):
 			}
 		}
 
-		err := c.doPush(ctx, bytes.NewReader(bodyBytes), contentEncoding)
+		endpoint := c.endpoints.pick()
+		status, err := c.doPush(ctx, endpoint, body, contentEncoding, tenantID)
+		result.Attempts++
+		result.Endpoint = endpoint
+		result.StatusCode = status
+		if err == nil || isRetryable(err) {
+			c.endpoints.report(endpoint, err == nil)
+		}
 		if err == nil {
 			return nil
 		}
@@ -133,11 +286,19 @@ func (c *Client) pushWithRetry(ctx context.Context, body io.Reader, contentEncod
 	return fmt.Errorf("push failed after %d retries: %w", retries, lastErr)
 }
 
-func (c *Client) doPush(ctx context.Context, body io.Reader, contentEncoding string) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, body)
+// doPush makes a single push attempt, returning the response status (0 if
+// none was received)
+func (c *Client) doPush(ctx context.Context, endpoint string, body *pushBody, contentEncoding, tenantID string) (int, error) {
+	// The transport closes the body, releasing its hold on the buffer, once
+	// it is done reading; GetBody serves redirects and HTTP/2 retries
+	reqBody := body.reader()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, reqBody)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		reqBody.Close()
+		return 0, fmt.Errorf("failed to create request: %w", err)
 	}
+	req.ContentLength = int64(len(body.data))
+	req.GetBody = func() (io.ReadCloser, error) { return body.reader(), nil }
 
 	req.Header.Set("Content-Type", "application/json")
 
@@ -145,41 +306,132 @@ func (c *Client) doPush(ctx context.Context, body io.Reader, contentEncoding str
 		req.Header.Set("Content-Encoding", contentEncoding)
 	}
 
-	// Set authentication
-	if c.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	} else if c.username != "" && c.password != "" {
-		req.SetBasicAuth(c.username, c.password)
-	}
-
-	// Set tenant ID for multi-tenant Loki
-	if c.tenantID != "" {
-		req.Header.Set("X-Scope-OrgID", c.tenantID)
+	if err := c.authorize(req, tenantID, body.data); err != nil {
+		reqBody.Close()
+		return 0, err
 	}
 
+	start := time.Now()
+	log := logger.With("endpoint", config.RedactURL(endpoint), "bytes", len(body.data), "encoding", contentEncoding)
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return &retryableError{err: fmt.Errorf("request failed: %w", err)}
+		log.With("duration_ms", time.Since(start).Milliseconds()).Debugf("Loki push failed: %v", err)
+		// Name the proxy so egress misconfiguration is not mistaken for Loki being down
+		if proxy := proxyFor(c.httpClient.Transport, req); proxy != "" {
+			return 0, &retryableError{err: fmt.Errorf("request failed via proxy %s: %w", proxy, err)}
+		}
+		return 0, &retryableError{err: fmt.Errorf("request failed: %w", err)}
 	}
 	defer resp.Body.Close()
+	log.With("status", resp.StatusCode, "duration_ms", time.Since(start).Milliseconds()).Debug("Loki push response")
 
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		return nil
+		// Drain so the keep-alive connection can be reused
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, nil
 	}
 
-	respBody, _ := io.ReadAll(resp.Body)
-	err = fmt.Errorf("push failed with status %d: %s", resp.StatusCode, string(respBody))
+	err = fmt.Errorf("push failed with status %d: %s", resp.StatusCode, readErrorBody(resp.Body))
+
+	if resp.StatusCode == http.StatusBadRequest {
+		return resp.StatusCode, &rejectedError{err: err}
+	}
 
 	// Retry on 429 (rate limited) or 5xx (server errors)
 	if resp.StatusCode == 429 || resp.StatusCode >= 500 {
-		return &retryableError{err: err}
+		return resp.StatusCode, &retryableError{
+			err:        err,
+			statusCode: resp.StatusCode,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
 	}
 
-	return err
+	return resp.StatusCode, err
+}
+
+// readErrorBody returns an error response body for inclusion in the push
+// error, truncated to maxErrorBodyBytes. The rest is drained so the
+// connection can be reused.
+func readErrorBody(body io.Reader) string {
+	head, _ := io.ReadAll(io.LimitReader(body, maxErrorBodyBytes))
+	rest, _ := io.Copy(io.Discard, body)
+	if rest > 0 {
+		return fmt.Sprintf("%s... (%d more bytes)", head, rest)
+	}
+	return string(head)
+}
+
+// authorize sets the tenant and LOKI_EXTRA_HEADERS headers on req, then
+// the credentials of LOKI_AUTH_MODE. They are added last so sigv4 signs
+// the final headers and the exact body.
+func (c *Client) authorize(req *http.Request, tenantID string, body []byte) error {
+	// Set tenant ID for multi-tenant Loki
+	if tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", tenantID)
+	}
+
+	for name, value := range c.extraHeaders {
+		req.Header.Set(name, value)
+	}
+
+	return c.auth.authenticate(req, body)
+}
+
+// errRetryBudget ends a push that has used up LOKI_RETRY_MAX_ELAPSED_MS
+var errRetryBudget = errors.New("retry budget exhausted")
+
+// ctxError returns why ctx ended, naming the retry budget when it was the cause
+func ctxError(ctx context.Context) error {
+	if errors.Is(context.Cause(ctx), errRetryBudget) {
+		return fmt.Errorf("%w: %w", errRetryBudget, ctx.Err())
+	}
+	return ctx.Err()
+}
+
+// backoffDelay returns the wait before the given retry attempt. A
+// server-provided Retry-After wins; otherwise full jitter is applied to the
+// exponential schedule (100ms, 200ms, 400ms, ...), capped at maxDelay when
+// it is set, so concurrent Lambdas that failed together do not retry in
+// lockstep.
+func backoffDelay(attempt int, lastErr error, maxDelay time.Duration) time.Duration {
+	if re, ok := lastErr.(*retryableError); ok && re.retryAfter > 0 {
+		return re.retryAfter
+	}
+	ceiling := time.Duration(math.Pow(2, float64(attempt-1)) * float64(baseBackoffDelay))
+	if ceiling <= 0 || (maxDelay > 0 && ceiling > maxDelay) {
+		ceiling = maxDelay // also catches the float overflow of a large attempt
+	}
+	if ceiling <= 0 {
+		ceiling = maxRetryAfter
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// parseRetryAfter parses a Retry-After header given either as delay seconds
+// or as an HTTP date. Returns 0 if absent or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		d = time.Until(t)
+	}
+	if d <= 0 {
+		return 0
+	}
+	if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return d
 }
 
 type retryableError struct {
-	err error
+	err        error
+	statusCode int           // 0 for transport errors
+	retryAfter time.Duration // server-requested delay before the next attempt
 }
 
 func (e *retryableError) Error() string {
@@ -190,6 +442,12 @@ func (e *retryableError) Unwrap() error {
 	return e.err
 }
 
+// IsRateLimited reports whether a push failed because Loki answered 429
+func IsRateLimited(err error) bool {
+	var re *retryableError
+	return errors.As(err, &re) && re.statusCode == http.StatusTooManyRequests
+}
+
 func isRetryable(err error) bool {
 	_, ok := err.(*retryableError)
 	return ok
@@ -1,9 +1,11 @@
 package loki
 
 import (
+	"bytes"
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -216,6 +218,53 @@ func TestClient_PushCritical_HigherRetries(t *testing.T) {
 	}
 }
 
+func TestClient_PushCritical_EscalatedRetriesUntilDeadline(t *testing.T) {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 4 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.CriticalFlushRetries = 1
+	client := NewClient(cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.PushCritical(Escalate(ctx), newTestRequest()); err != nil {
+		t.Fatalf("PushCritical() error = %v, want success past the critical retries", err)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 4 {
+		t.Errorf("attempts = %d, want 4", got)
+	}
+}
+
+func TestClient_PushCritical_EscalatedWithoutDeadline(t *testing.T) {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.CriticalFlushRetries = 1
+	client := NewClient(cfg)
+
+	if err := client.PushCritical(Escalate(context.Background()), newTestRequest()); err == nil {
+		t.Fatal("PushCritical() error = nil, want error")
+	}
+	if got := atomic.LoadInt32(&attempts); got != 2 {
+		t.Errorf("attempts = %d, want 2 (no escalation without a deadline)", got)
+	}
+}
+
 // TC-5.3.2: Context Cancellation During Backoff
 func TestClient_Push_ContextCancellation(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -447,6 +496,63 @@ func TestClient_Push_TenantID(t *testing.T) {
 	}
 }
 
+// LOKI_EXTRA_HEADERS are sent alongside the auth headers
+func TestClient_Push_ExtraHeaders(t *testing.T) {
+	var received http.Header
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.LokiAPIKey = "token"
+	cfg.LokiExtraHeaders = map[string]string{
+		"CF-Access-Client-Id":     "id.access",
+		"CF-Access-Client-Secret": "secret",
+	}
+	client := NewClient(cfg)
+
+	if err := client.Push(context.Background(), newTestRequest()); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if received.Get("Cf-Access-Client-Id") != "id.access" || received.Get("Cf-Access-Client-Secret") != "secret" {
+		t.Errorf("extra headers not sent: %v", received)
+	}
+	if received.Get("Authorization") != "Bearer token" {
+		t.Errorf("Authorization = %s, want bearer token kept", received.Get("Authorization"))
+	}
+}
+
+// Per-request tenant overrides the configured tenant
+func TestClient_Push_TenantOverride(t *testing.T) {
+	var receivedTenantID string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedTenantID = r.Header.Get("X-Scope-OrgID")
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "payments") {
+			t.Errorf("tenant ID leaked into request body: %s", body)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.LokiTenantID = "tenant-123"
+	client := NewClient(cfg)
+
+	req := newTestRequest()
+	req.TenantID = "payments"
+	if err := client.Push(context.Background(), req); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if receivedTenantID != "payments" {
+		t.Errorf("X-Scope-OrgID = %s, want 'payments'", receivedTenantID)
+	}
+}
+
 // TC-5.5.4: All Auth Combined
 func TestClient_Push_AllAuthCombined(t *testing.T) {
 	var receivedAuth, receivedTenantID string
@@ -647,6 +753,230 @@ func TestClient_Push_GzipBodyDecompresses(t *testing.T) {
 	}
 }
 
+// Pooled writers and buffers must not leak data between pushes
+func TestClient_Push_PooledBuffersKeepBodiesIntact(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("body is not gzip: %v", err)
+			return
+		}
+		decompressed, _ := io.ReadAll(reader)
+		var received PushRequest
+		if err := json.Unmarshal(decompressed, &received); err != nil {
+			t.Errorf("body is not valid JSON: %v", err)
+			return
+		}
+		bodies = append(bodies, received.Streams[0].Values[0][1])
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.CompressionThreshold = 10
+	client := NewClient(cfg)
+
+	// Shrinking messages would expose stale bytes left in a reused buffer
+	messages := []string{strings.Repeat("long ", 500), strings.Repeat("mid ", 50), "short message"}
+	for _, msg := range messages {
+		req := &PushRequest{Streams: []Stream{{
+			Stream: map[string]string{"test": "label"},
+			Values: [][]string{{"1234567890", msg}},
+		}}}
+		if err := client.Push(context.Background(), req); err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+	}
+
+	if len(bodies) != len(messages) {
+		t.Fatalf("received %d pushes, want %d", len(bodies), len(messages))
+	}
+	for i, msg := range messages {
+		if bodies[i] != msg {
+			t.Errorf("push %d: got %d bytes, want %d", i, len(bodies[i]), len(msg))
+		}
+	}
+}
+
+// holdingTransport answers every push without reading or closing its
+// body, as a transport may still hold one after Do has returned
+type holdingTransport struct {
+	bodies []io.ReadCloser
+}
+
+func (t *holdingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.bodies = append(t.bodies, req.Body)
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+// A body the transport has not closed keeps its bytes when later pushes
+// take buffers from the pool
+func TestClient_Push_BodyOutlivesDo(t *testing.T) {
+	for _, codec := range []string{config.CompressionNone, config.CompressionGzip} {
+		t.Run(codec, func(t *testing.T) {
+			cfg := newTestConfig("http://loki.invalid/loki/api/v1/push")
+			cfg.Compression = codec
+			cfg.CompressionThreshold = 10
+			client := NewClient(cfg)
+			transport := &holdingTransport{}
+			client.httpClient.Transport = transport
+
+			push := func(msg string) {
+				req := &PushRequest{Streams: []Stream{{
+					Stream: map[string]string{"test": "label"},
+					Values: [][]string{{"1234567890", strings.Repeat(msg, 50)}},
+				}}}
+				if err := client.Push(context.Background(), req); err != nil {
+					t.Fatalf("Push() error = %v", err)
+				}
+			}
+			push("first. ")
+			push("second ")
+
+			raw, _ := io.ReadAll(transport.bodies[0])
+			if codec == config.CompressionGzip {
+				gr, err := gzip.NewReader(bytes.NewReader(raw))
+				if err != nil {
+					t.Fatalf("first body is not gzip: %v", err)
+				}
+				raw, _ = io.ReadAll(gr)
+			}
+			if !strings.Contains(string(raw), "first. ") || strings.Contains(string(raw), "second ") {
+				t.Errorf("first body was overwritten: %.80s", raw)
+			}
+		})
+	}
+}
+
+// Test explicit "none" codec overrides the legacy gzip flag
+func TestClient_Push_CompressionNone(t *testing.T) {
+	var contentEncoding string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentEncoding = r.Header.Get("Content-Encoding")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.EnableGzip = true
+	cfg.Compression = config.CompressionNone
+	cfg.CompressionThreshold = 10
+	client := NewClient(cfg)
+
+	if err := client.Push(context.Background(), newTestRequest()); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if contentEncoding != "" {
+		t.Errorf("Content-Encoding = %s, want empty", contentEncoding)
+	}
+}
+
+// Retry-After on 429 delays the next attempt
+func TestClient_Push_HonorsRetryAfter(t *testing.T) {
+	var attempts int32
+	var firstAt, secondAt time.Time
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			firstAt = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		secondAt = time.Now()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(newTestConfig(server.URL))
+	if err := client.Push(context.Background(), newTestRequest()); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if gap := secondAt.Sub(firstAt); gap < 900*time.Millisecond {
+		t.Errorf("retry after %v, want >= 1s per Retry-After", gap)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"", 0, 0},
+		{"garbage", 0, 0},
+		{"-5", 0, 0},
+		{"2", 2 * time.Second, 2 * time.Second},
+		{"3600", maxRetryAfter, maxRetryAfter},
+		{time.Now().Add(5 * time.Second).UTC().Format(http.TimeFormat), 3 * time.Second, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		got := parseRetryAfter(tt.value)
+		if got < tt.min || got > tt.max {
+			t.Errorf("parseRetryAfter(%q) = %v, want in [%v, %v]", tt.value, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestBackoffDelay_FullJitter(t *testing.T) {
+	for attempt := 1; attempt <= 4; attempt++ {
+		ceiling := time.Duration(1<<(attempt-1)) * baseBackoffDelay
+		for i := 0; i < 50; i++ {
+			if d := backoffDelay(attempt, io.EOF, 0); d < 0 || d > ceiling {
+				t.Fatalf("backoffDelay(%d) = %v, want in [0, %v]", attempt, d, ceiling)
+			}
+		}
+	}
+
+	err := &retryableError{err: io.EOF, retryAfter: 2 * time.Second}
+	if d := backoffDelay(1, err, time.Second); d != 2*time.Second {
+		t.Errorf("backoffDelay with Retry-After = %v, want 2s", d)
+	}
+}
+
+func TestBackoffDelay_Ceiling(t *testing.T) {
+	for _, attempt := range []int{5, 10, 2000} {
+		for i := 0; i < 50; i++ {
+			if d := backoffDelay(attempt, io.EOF, 300*time.Millisecond); d < 0 || d > 300*time.Millisecond {
+				t.Fatalf("backoffDelay(%d) = %v, want in [0, 300ms]", attempt, d)
+			}
+		}
+	}
+	// Overflowing the schedule without a ceiling still yields a sane wait
+	if d := backoffDelay(2000, io.EOF, 0); d < 0 || d > maxRetryAfter {
+		t.Errorf("backoffDelay(2000) = %v, want in [0, %v]", d, maxRetryAfter)
+	}
+}
+
+func TestClient_Push_RetryBudget(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.MaxRetries = 10
+	cfg.RetryMaxElapsedMs = 200
+	client := NewClient(cfg)
+
+	start := time.Now()
+	err := client.Push(context.Background(), newTestRequest())
+	if !errors.Is(err, errRetryBudget) {
+		t.Fatalf("Push() error = %v, want retry budget exhausted", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Push() took %v, want it bounded by the 200ms budget", elapsed)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 1 {
+		t.Errorf("attempts = %d, want 1 (a 1s Retry-After does not fit the budget)", n)
+	}
+}
+
 // Test isRetryable function
 func TestIsRetryable(t *testing.T) {
 	tests := []struct {
@@ -695,3 +1025,19 @@ func TestRetryableError_Unwrap(t *testing.T) {
 		t.Errorf("Unwrap() = %v, want %v", err.Unwrap(), io.EOF)
 	}
 }
+
+func TestClient_Push_TruncatesErrorBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(strings.Repeat("x", maxErrorBodyBytes+500)))
+	}))
+	defer server.Close()
+
+	err := NewClient(newTestConfig(server.URL)).Push(context.Background(), newTestRequest())
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if strings.Count(err.Error(), "x") != maxErrorBodyBytes || !strings.Contains(err.Error(), "(500 more bytes)") {
+		t.Errorf("error body not truncated: %d bytes", len(err.Error()))
+	}
+}
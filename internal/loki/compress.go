@@ -0,0 +1,106 @@
+package loki
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+// maxPooledBuffer keeps unusually large push bodies from pinning memory
+// in the pool between flushes
+const maxPooledBuffer = 8 << 20
+
+// gzipWriters reuses gzip writers: allocating a writer's compression
+// tables costs more than compressing a typical push body
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(io.Discard) },
+}
+
+// bodyBuffers holds marshal and compression buffers reused across pushes
+var bodyBuffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// getBuffer returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	buf := bodyBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns buf to the pool. Its bytes must no longer be in use.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bodyBuffers.Put(buf)
+	}
+}
+
+// pushBody is an encoded push body held in a pooled buffer. A transport may
+// read a request body after Do returns (redirects, HTTP/2 retries, error
+// paths), so the buffer is only returned to the pool once the sender and
+// every request body reading it have been closed.
+type pushBody struct {
+	data []byte
+	buf  *bytes.Buffer
+	refs atomic.Int32
+}
+
+// newPushBody wraps data, which lives in buf, holding one reference for
+// the caller to release
+func newPushBody(buf *bytes.Buffer, data []byte) *pushBody {
+	b := &pushBody{data: data, buf: buf}
+	b.refs.Store(1)
+	return b
+}
+
+// reader returns a request body reading data. Closing it releases the
+// reference it holds.
+func (b *pushBody) reader() io.ReadCloser {
+	b.refs.Add(1)
+	return &pushBodyReader{Reader: bytes.NewReader(b.data), body: b}
+}
+
+// release drops one reference, pooling the buffer after the last
+func (b *pushBody) release() {
+	if b.refs.Add(-1) == 0 {
+		putBuffer(b.buf)
+	}
+}
+
+type pushBodyReader struct {
+	*bytes.Reader
+	body *pushBody
+	once sync.Once
+}
+
+func (r *pushBodyReader) Close() error {
+	r.once.Do(r.body.release)
+	return nil
+}
+
+// compress encodes body with the given codec and returns the encoded bytes
+// along with the Content-Encoding header value. Gzip output is written to
+// dst, so the result is only valid until dst is reused. Unknown codecs and
+// "none" return the body unchanged with an empty encoding.
+func compress(codec string, body []byte, dst *bytes.Buffer) ([]byte, string, error) {
+	switch codec {
+	case config.CompressionGzip:
+		gw := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(gw)
+		gw.Reset(dst)
+		if _, err := gw.Write(body); err != nil {
+			return nil, "", fmt.Errorf("failed to gzip body: %w", err)
+		}
+		if err := gw.Close(); err != nil {
+			return nil, "", fmt.Errorf("failed to close gzip writer: %w", err)
+		}
+		return dst.Bytes(), "gzip", nil
+	default:
+		return body, "", nil
+	}
+}
@@ -0,0 +1,35 @@
+package loki
+
+import "github.com/mumzworld-tech/lambdawatch/internal/logger"
+
+// dryRunStream summarizes one stream of a push that LOKI_DRY_RUN suppressed
+type dryRunStream struct {
+	Labels  map[string]string `json:"labels"`
+	Entries int               `json:"entries"`
+	Bytes   int               `json:"bytes"` // sum of line lengths
+}
+
+// reportDryRun prints what a push of req would have sent: its entries, the
+// uncompressed JSON body size and the body size as it would be sent
+func (c *Client) reportDryRun(req *PushRequest, tenantID string, jsonBytes int, body []byte, contentEncoding string) {
+	entries := 0
+	streams := make([]dryRunStream, 0, len(req.Streams))
+	for _, stream := range req.Streams {
+		s := dryRunStream{Labels: stream.Stream, Entries: len(stream.Values)}
+		for _, value := range stream.Values {
+			s.Bytes += len(value[1])
+		}
+		entries += s.Entries
+		streams = append(streams, s)
+	}
+
+	log := logger.With()
+	if tenantID != "" {
+		log = log.With("tenant", tenantID)
+	}
+	log = log.With("entries", entries, "bytes", jsonBytes, "encoded_bytes", len(body))
+	if contentEncoding != "" {
+		log = log.With("encoding", contentEncoding)
+	}
+	log.With("streams", streams).Fprint(c.dryRunLog, "info", "Dry run: push not sent")
+}
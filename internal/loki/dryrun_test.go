@@ -0,0 +1,61 @@
+package loki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClient_DryRun_PrintsInsteadOfPushing(t *testing.T) {
+	var pushes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushes.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.DryRun = true
+	cfg.LokiTenantID = "staging"
+	client := NewClient(cfg)
+	var out bytes.Buffer
+	client.dryRunLog = &out
+
+	req := &PushRequest{Streams: []Stream{
+		{Stream: map[string]string{"function_name": "orders"}, Values: [][]string{{"1", "hello"}, {"2", "world!"}}},
+		{Stream: map[string]string{"function_name": "orders", "error": "true"}, Values: [][]string{{"3", "boom"}}},
+	}}
+	if err := client.PushCritical(context.Background(), req); err != nil {
+		t.Fatalf("PushCritical() error = %v, want nil", err)
+	}
+	if pushes.Load() != 0 {
+		t.Errorf("dry run sent %d requests to Loki", pushes.Load())
+	}
+
+	var got struct {
+		Context      string         `json:"context"`
+		Tenant       string         `json:"tenant"`
+		Entries      int            `json:"entries"`
+		Bytes        int            `json:"bytes"`
+		EncodedBytes int            `json:"encoded_bytes"`
+		Encoding     string         `json:"encoding"`
+		Streams      []dryRunStream `json:"streams"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("output is not one JSON line: %v\n%s", err, out.String())
+	}
+	if got.Context != "LambdaWatch" || got.Tenant != "staging" || got.Entries != 3 {
+		t.Errorf("batch = %+v", got)
+	}
+	if got.Bytes == 0 || got.EncodedBytes != got.Bytes || got.Encoding != "" {
+		t.Errorf("sizes = (%d, %d, %q), want uncompressed body size", got.Bytes, got.EncodedBytes, got.Encoding)
+	}
+	if len(got.Streams) != 2 || got.Streams[0].Entries != 2 || got.Streams[0].Bytes != 11 ||
+		got.Streams[1].Labels["error"] != "true" {
+		t.Errorf("streams = %+v", got.Streams)
+	}
+}
@@ -0,0 +1,95 @@
+package loki
+
+import (
+	"sync"
+	"time"
+)
+
+// endpointPool tracks which of several Loki endpoints pushes go to. The
+// first endpoint is the primary; after threshold consecutive retryable
+// failures the pool rotates to the next one. While away from the primary,
+// one push per probeInterval is sent to the primary and a success moves
+// traffic back.
+type endpointPool struct {
+	mu            sync.Mutex
+	urls          []string
+	active        int
+	failures      int
+	threshold     int
+	probeInterval time.Duration
+	switchedAt    time.Time
+	probing       bool
+	now           func() time.Time
+}
+
+func newEndpointPool(urls []string, threshold int, probeInterval time.Duration) *endpointPool {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &endpointPool{
+		urls:          urls,
+		threshold:     threshold,
+		probeInterval: probeInterval,
+		now:           time.Now,
+	}
+}
+
+// pick returns the endpoint for the next attempt
+func (p *endpointPool) pick() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.urls) == 1 {
+		return p.urls[0]
+	}
+	if p.active != 0 && !p.probing && p.now().Sub(p.switchedAt) >= p.probeInterval {
+		p.probing = true
+		return p.urls[0]
+	}
+	return p.urls[p.active]
+}
+
+// report records the outcome of an attempt against url. Only retryable
+// failures should be reported as !ok; client errors say nothing about
+// endpoint health.
+func (p *endpointPool) report(url string, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.urls) == 1 {
+		return
+	}
+
+	// Primary recovery probe
+	if p.active != 0 && url == p.urls[0] {
+		p.probing = false
+		if ok {
+			p.active = 0
+			p.failures = 0
+		} else {
+			p.switchedAt = p.now()
+		}
+		return
+	}
+
+	if url != p.urls[p.active] {
+		return // stale result from before a rotation
+	}
+	if ok {
+		p.failures = 0
+		return
+	}
+	p.failures++
+	if p.failures >= p.threshold {
+		p.active = (p.active + 1) % len(p.urls)
+		p.failures = 0
+		p.switchedAt = p.now()
+	}
+}
+
+// current returns the endpoint traffic is routed to
+func (p *endpointPool) current() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.urls[p.active]
+}
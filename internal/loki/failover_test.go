@@ -0,0 +1,119 @@
+package loki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEndpointPool_SingleEndpoint(t *testing.T) {
+	p := newEndpointPool([]string{"a"}, 1, time.Minute)
+	p.report("a", false)
+	if got := p.pick(); got != "a" {
+		t.Errorf("pick() = %q, want a", got)
+	}
+}
+
+func TestEndpointPool_RotatesAfterThreshold(t *testing.T) {
+	p := newEndpointPool([]string{"a", "b"}, 2, time.Minute)
+
+	p.report("a", false)
+	if p.current() != "a" {
+		t.Fatal("rotated before reaching threshold")
+	}
+	p.report("a", true) // success resets the streak
+	p.report("a", false)
+	if p.current() != "a" {
+		t.Fatal("success should reset consecutive failures")
+	}
+	p.report("a", false)
+	if p.current() != "b" {
+		t.Errorf("current() = %q, want b after %d failures", p.current(), 2)
+	}
+}
+
+func TestEndpointPool_ProbesPrimary(t *testing.T) {
+	now := time.Unix(0, 0)
+	p := newEndpointPool([]string{"a", "b"}, 1, time.Minute)
+	p.now = func() time.Time { return now }
+
+	p.report("a", false)
+	if got := p.pick(); got != "b" {
+		t.Fatalf("pick() = %q, want b after failover", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got := p.pick(); got != "a" {
+		t.Fatalf("pick() = %q, want primary probe", got)
+	}
+	if got := p.pick(); got != "b" {
+		t.Errorf("pick() = %q, want b while a probe is in flight", got)
+	}
+
+	// Failed probe waits another interval
+	p.report("a", false)
+	if got := p.pick(); got != "b" {
+		t.Errorf("pick() = %q, want b after failed probe", got)
+	}
+
+	now = now.Add(time.Minute)
+	p.report(p.pick(), true)
+	if p.current() != "a" {
+		t.Errorf("current() = %q, want primary after successful probe", p.current())
+	}
+}
+
+func TestClient_FailsOverToSecondary(t *testing.T) {
+	var primaryHits, secondaryHits atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondaryHits.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer secondary.Close()
+
+	cfg := newTestConfig(primary.URL)
+	cfg.LokiEndpoints = []string{primary.URL, secondary.URL}
+	cfg.LokiFailoverThreshold = 2
+	cfg.LokiFailoverProbeIntervalMs = 60000
+	client := NewClient(cfg)
+
+	if err := client.Push(context.Background(), newTestRequest()); err != nil {
+		t.Fatalf("expected push to succeed via secondary, got %v", err)
+	}
+	if primaryHits.Load() != 2 || secondaryHits.Load() != 1 {
+		t.Errorf("hits primary=%d secondary=%d, want 2 and 1", primaryHits.Load(), secondaryHits.Load())
+	}
+
+	// Subsequent pushes go straight to the secondary
+	if err := client.Push(context.Background(), newTestRequest()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if primaryHits.Load() != 2 {
+		t.Errorf("primary hit again before probe interval elapsed")
+	}
+}
+
+func TestClient_ClientErrorsDoNotFailOver(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer primary.Close()
+
+	cfg := newTestConfig(primary.URL)
+	cfg.LokiEndpoints = []string{primary.URL, "http://unused"}
+	cfg.LokiFailoverThreshold = 1
+	client := NewClient(cfg)
+
+	_ = client.Push(context.Background(), newTestRequest())
+	if client.endpoints.current() != primary.URL {
+		t.Errorf("400 response should not trigger failover")
+	}
+}
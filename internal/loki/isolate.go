@@ -0,0 +1,131 @@
+package loki
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+)
+
+// maxIsolationPushes bounds the extra pushes spent bisecting one rejected
+// request, so a batch Loki rejects wholesale (e.g. every entry too old)
+// costs a few requests rather than one per entry
+const maxIsolationPushes = 32
+
+// rejectedError is a 400 from Loki: the request holds entries Loki will
+// never accept, so retrying it unchanged is pointless
+type rejectedError struct {
+	err error
+}
+
+func (e *rejectedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *rejectedError) Unwrap() error {
+	return e.err
+}
+
+func isRejected(err error) bool {
+	var re *rejectedError
+	return errors.As(err, &re)
+}
+
+// IsRejected reports whether a push failed because Loki rejected every
+// entry of the request with a 400, so pushing it again cannot succeed
+func IsRejected(err error) bool {
+	return isRejected(err)
+}
+
+// isolate bisects a rejected request, pushing the halves Loki accepts and
+// dropping only the entries it rejects. Loki ignores exact duplicates, so
+// entries it already accepted from a partially rejected push are safe to
+// resend. Returns the number of entries dropped, or the first error that
+// was not a rejection.
+func (c *Client) isolate(ctx context.Context, req *PushRequest, isCritical bool, cause error, budget *int) (int, error) {
+	n := req.entryCount()
+	if n <= 1 || *budget <= 0 {
+		c.reportRejected(req, cause)
+		return n, nil
+	}
+
+	dropped := 0
+	for _, half := range req.split() {
+		*budget--
+		err := c.send(ctx, half, isCritical)
+		if err == nil {
+			continue
+		}
+		if !isRejected(err) {
+			return dropped, err
+		}
+		d, err := c.isolate(ctx, half, isCritical, err, budget)
+		dropped += d
+		if err != nil {
+			return dropped, err
+		}
+	}
+	return dropped, nil
+}
+
+// reportRejected logs every entry of req with Loki's rejection reason to
+// stderr, each as [timestamp ns, line]
+func (c *Client) reportRejected(req *PushRequest, cause error) {
+	log := logger.With("reason", cause.Error())
+	if req.TenantID != "" {
+		log = log.With("tenant", req.TenantID)
+	}
+	for _, stream := range req.Streams {
+		for _, value := range stream.Values {
+			log.With("stream", stream.Stream, "entry", value).Fprint(c.rejectLog, "error", "Dropped log entry rejected by Loki")
+		}
+	}
+}
+
+// entryCount returns the number of values across all streams
+func (r *PushRequest) entryCount() int {
+	n := 0
+	for _, s := range r.Streams {
+		n += len(s.Values)
+	}
+	return n
+}
+
+// split divides the request's entries into two requests of roughly equal
+// size, keeping stream labels and structured metadata
+func (r *PushRequest) split() [2]*PushRequest {
+	half := r.entryCount() / 2
+	parts := [2]*PushRequest{{TenantID: r.TenantID}, {TenantID: r.TenantID}}
+
+	seen := 0
+	for _, s := range r.Streams {
+		first := half - seen // values of s that go to the first half
+		if first > len(s.Values) {
+			first = len(s.Values)
+		}
+		if first < 0 {
+			first = 0
+		}
+		if first > 0 {
+			parts[0].Streams = append(parts[0].Streams, s.slice(0, first))
+		}
+		if first < len(s.Values) {
+			parts[1].Streams = append(parts[1].Streams, s.slice(first, len(s.Values)))
+		}
+		seen += len(s.Values)
+	}
+	return parts
+}
+
+// slice returns the stream with only values [from, to)
+func (s Stream) slice(from, to int) Stream {
+	out := Stream{Stream: s.Stream, Values: s.Values[from:to]}
+	if from < len(s.Metadata) {
+		end := to
+		if end > len(s.Metadata) {
+			end = len(s.Metadata)
+		}
+		out.Metadata = s.Metadata[from:end]
+	}
+	return out
+}
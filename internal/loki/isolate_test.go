@@ -0,0 +1,146 @@
+package loki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// rejectingLoki answers 400 to any push containing a line with "BAD" and
+// records the lines of accepted pushes
+type rejectingLoki struct {
+	mu       sync.Mutex
+	accepted []string
+	pushes   atomic.Int32
+}
+
+func (l *rejectingLoki) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.pushes.Add(1)
+	var req PushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var lines []string
+	for _, s := range req.Streams {
+		for _, v := range s.Values {
+			if strings.Contains(v[1], "BAD") {
+				http.Error(w, "entry too far behind", http.StatusBadRequest)
+				return
+			}
+			lines = append(lines, v[1])
+		}
+	}
+	l.mu.Lock()
+	l.accepted = append(l.accepted, lines...)
+	l.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func requestWithLines(lines ...string) *PushRequest {
+	req := &PushRequest{}
+	for i, line := range lines {
+		stream := map[string]string{"stream": fmt.Sprint(i % 2)}
+		if i < 2 {
+			req.Streams = append(req.Streams, Stream{Stream: stream})
+		}
+		s := &req.Streams[i%2]
+		s.Values = append(s.Values, []string{fmt.Sprint(1000 + i), line})
+	}
+	return req
+}
+
+func TestClient_Push_IsolatesRejectedEntries(t *testing.T) {
+	loki := &rejectingLoki{}
+	server := httptest.NewServer(loki)
+	defer server.Close()
+
+	client := NewClient(newTestConfig(server.URL))
+	var rejected bytes.Buffer
+	client.rejectLog = &rejected
+
+	req := requestWithLines("a", "b", "BAD-1", "c", "d", "e", "BAD-2", "f")
+	if err := client.Push(context.Background(), req); err != nil {
+		t.Fatalf("Push() error = %v, want nil after isolating bad entries", err)
+	}
+
+	if len(loki.accepted) != 6 {
+		t.Errorf("accepted %v, want the 6 good lines", loki.accepted)
+	}
+	for _, bad := range []string{"BAD-1", "BAD-2"} {
+		if !strings.Contains(rejected.String(), bad) {
+			t.Errorf("rejected entry %s not logged: %s", bad, rejected.String())
+		}
+	}
+	if !strings.Contains(rejected.String(), `"context":"LambdaWatch"`) {
+		t.Error("rejection log must carry the extension marker so it is not re-ingested")
+	}
+}
+
+func TestClient_Push_AllRejectedReturnsError(t *testing.T) {
+	loki := &rejectingLoki{}
+	server := httptest.NewServer(loki)
+	defer server.Close()
+
+	client := NewClient(newTestConfig(server.URL))
+	client.rejectLog = &bytes.Buffer{}
+
+	if err := client.Push(context.Background(), requestWithLines("BAD-1", "BAD-2")); err == nil {
+		t.Error("Push() error = nil, want rejection when nothing was delivered")
+	}
+}
+
+func TestClient_Push_IsolationBudget(t *testing.T) {
+	loki := &rejectingLoki{}
+	server := httptest.NewServer(loki)
+	defer server.Close()
+
+	client := NewClient(newTestConfig(server.URL))
+	client.rejectLog = &bytes.Buffer{}
+
+	lines := make([]string, 1000)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("BAD-%d", i)
+	}
+	_ = client.Push(context.Background(), requestWithLines(lines...))
+
+	if n := loki.pushes.Load(); n > maxIsolationPushes+1 {
+		t.Errorf("pushes = %d, want at most %d", n, maxIsolationPushes+1)
+	}
+}
+
+func TestPushRequest_Split(t *testing.T) {
+	req := &PushRequest{
+		TenantID: "team-a",
+		Streams: []Stream{
+			{Stream: map[string]string{"s": "1"}, Values: [][]string{{"1", "a"}, {"2", "b"}, {"3", "c"}},
+				Metadata: []map[string]string{nil, {"trace_id": "t"}}},
+			{Stream: map[string]string{"s": "2"}, Values: [][]string{{"4", "d"}}},
+		},
+	}
+
+	parts := req.split()
+	if parts[0].entryCount() != 2 || parts[1].entryCount() != 2 {
+		t.Fatalf("split sizes = %d/%d, want 2/2", parts[0].entryCount(), parts[1].entryCount())
+	}
+	if parts[0].TenantID != "team-a" || parts[1].TenantID != "team-a" {
+		t.Error("tenant must be preserved")
+	}
+	if parts[0].Streams[0].Metadata[1]["trace_id"] != "t" {
+		t.Errorf("metadata misaligned in first half: %v", parts[0].Streams[0].Metadata)
+	}
+	second := parts[1].Streams[0]
+	if second.Values[0][1] != "c" || len(second.Metadata) != 0 {
+		t.Errorf("unexpected second half stream %+v", second)
+	}
+	if parts[1].Streams[1].Stream["s"] != "2" {
+		t.Errorf("second stream labels lost: %+v", parts[1].Streams[1])
+	}
+}
@@ -0,0 +1,321 @@
+package loki
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+)
+
+// overflowValue replaces new values of a label that exceeded LOKI_MAX_LABEL_VALUES
+const overflowValue = "__overflow__"
+
+// protectedLabels are never dropped: streams cannot be found or told apart
+// without them
+var protectedLabels = map[string]bool{
+	"function_name": true,
+	"source":        true,
+	"type":          true,
+	"error":         true,
+}
+
+// LabelGuardStats counts the guard's interventions since startup
+type LabelGuardStats struct {
+	Sanitized  uint64 // names or values rewritten to characters Loki accepts
+	Dropped    uint64 // labels removed by the allow/deny lists or LOKI_MAX_LABELS
+	Truncated  uint64 // values shortened to LOKI_MAX_LABEL_VALUE_LENGTH
+	Overflowed uint64 // values replaced once a label had LOKI_MAX_LABEL_VALUES distinct values
+}
+
+// LabelGuard enforces label governance on every stream before it is pushed,
+// so a misconfigured label cannot flood Loki's index with series
+type LabelGuard struct {
+	allow          map[string]bool // nil allows every label
+	deny           map[string]bool
+	maxLabels      int
+	maxValueLength int
+	maxValues      int
+
+	mu      sync.Mutex
+	seen    map[string]map[string]bool // label name → distinct values shipped
+	stats   LabelGuardStats
+	warned  map[string]bool // "action:label" pairs already reported
+	warnLog io.Writer
+}
+
+// NewLabelGuard creates a guard from the LOKI_LABEL_* / LOKI_MAX_LABEL*
+// settings. A zero limit disables that check.
+func NewLabelGuard(cfg *config.Config) *LabelGuard {
+	g := &LabelGuard{
+		deny:           toSet(cfg.LabelDenylist),
+		maxLabels:      cfg.MaxLabels,
+		maxValueLength: cfg.MaxLabelValueLength,
+		maxValues:      cfg.MaxLabelValues,
+		seen:           make(map[string]map[string]bool),
+		warned:         make(map[string]bool),
+		warnLog:        os.Stderr,
+	}
+	if len(cfg.LabelAllowlist) > 0 {
+		g.allow = toSet(cfg.LabelAllowlist)
+	}
+	return g
+}
+
+func toSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[n] = true
+	}
+	return set
+}
+
+// Apply returns labels with the governance rules applied. labels is never
+// modified; a copy is returned when anything changes. Names and values are
+// sanitized first, so Loki does not reject the push; a nil guard does
+// only that.
+func (g *LabelGuard) Apply(labels map[string]string) map[string]string {
+	sanitized, changed := sanitizeLabels(labels)
+	if g == nil {
+		return sanitized
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, name := range changed {
+		g.intervene("sanitized", name, &g.stats.Sanitized)
+	}
+	labels = sanitized
+
+	out := labels
+	copied := false
+	modify := func() {
+		if !copied {
+			out = make(map[string]string, len(labels))
+			for k, v := range labels {
+				out[k] = v
+			}
+			copied = true
+		}
+	}
+
+	for name := range labels {
+		if protectedLabels[name] {
+			continue
+		}
+		if (g.allow != nil && !g.allow[name]) || g.deny[name] {
+			modify()
+			delete(out, name)
+			g.intervene("dropped", name, &g.stats.Dropped)
+		}
+	}
+
+	if g.maxLabels > 0 && len(out) > g.maxLabels {
+		modify()
+		for _, name := range g.overLimit(out) {
+			delete(out, name)
+			g.intervene("dropped", name, &g.stats.Dropped)
+		}
+	}
+
+	for name, value := range out {
+		if protectedLabels[name] {
+			continue
+		}
+		if g.maxValueLength > 0 && len(value) > g.maxValueLength {
+			modify()
+			value = truncateValue(value, g.maxValueLength)
+			out[name] = value
+			g.intervene("truncated", name, &g.stats.Truncated)
+		}
+		if g.maxValues > 0 && !g.admit(name, value) {
+			modify()
+			out[name] = overflowValue
+			g.intervene("overflowed", name, &g.stats.Overflowed)
+		}
+	}
+	return out
+}
+
+// overLimit returns the labels to drop to get down to maxLabels. Protected
+// labels are kept first, then the rest in name order.
+func (g *LabelGuard) overLimit(labels map[string]string) []string {
+	var names []string
+	keep := 0
+	for name := range labels {
+		if protectedLabels[name] {
+			keep++
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	room := g.maxLabels - keep
+	if room < 0 {
+		room = 0
+	}
+	if room >= len(names) {
+		return nil
+	}
+	return names[room:]
+}
+
+// admit records value for label and reports whether it may be shipped:
+// known values always are, new ones only while under maxValues
+func (g *LabelGuard) admit(label, value string) bool {
+	values := g.seen[label]
+	if values == nil {
+		values = make(map[string]bool)
+		g.seen[label] = values
+	}
+	if values[value] {
+		return true
+	}
+	if len(values) >= g.maxValues {
+		return false
+	}
+	values[value] = true
+	return true
+}
+
+// truncateValue shortens value to max bytes, ending with a hash of the
+// full value so distinct long values stay distinct
+func truncateValue(value string, max int) string {
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	suffix := fmt.Sprintf("~%08x", h.Sum32())
+	if max <= len(suffix) {
+		return validPrefix(value, max)
+	}
+	return validPrefix(value, max-len(suffix)) + suffix
+}
+
+// validPrefix returns at most n bytes of s without splitting a rune
+func validPrefix(s string, n int) string {
+	s = s[:n]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// sanitizeLabels returns labels with names rewritten to Loki's
+// [a-zA-Z_][a-zA-Z0-9_]* charset and control characters and invalid UTF-8
+// removed from values, along with the original names of the labels that
+// changed. labels is returned as is when nothing needs fixing. When two
+// names collide once rewritten, a name that was already valid wins, then
+// the first in name order.
+func sanitizeLabels(labels map[string]string) (map[string]string, []string) {
+	var changed []string
+	for name, value := range labels {
+		if name == "" || sanitizeLabelName(name) != name || sanitizeLabelValue(value) != value {
+			changed = append(changed, name)
+		}
+	}
+	if len(changed) == 0 {
+		return labels, nil
+	}
+	sort.Strings(changed)
+
+	out := make(map[string]string, len(labels))
+	for name, value := range labels {
+		if name != "" && sanitizeLabelName(name) == name {
+			out[name] = sanitizeLabelValue(value)
+		}
+	}
+	for _, name := range changed {
+		clean := sanitizeLabelName(name)
+		if _, taken := out[clean]; taken || clean == "" {
+			continue
+		}
+		out[clean] = sanitizeLabelValue(labels[name])
+	}
+	return out, changed
+}
+
+// sanitizeLabelName replaces characters Loki does not accept in a label
+// name with underscores, prefixing one if the name starts with a digit
+func sanitizeLabelName(name string) string {
+	valid := func(i int, r rune) bool {
+		return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9')
+	}
+	clean := true
+	for i, r := range name {
+		if !valid(i, r) {
+			clean = false
+			break
+		}
+	}
+	if clean {
+		return name
+	}
+
+	var b strings.Builder
+	if name[0] >= '0' && name[0] <= '9' {
+		b.WriteByte('_')
+	}
+	for i, r := range name {
+		if valid(i, r) || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// sanitizeLabelValue drops control characters and invalid UTF-8 from value
+func sanitizeLabelValue(value string) string {
+	clean := utf8.ValidString(value)
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			clean = false
+			break
+		}
+	}
+	if clean {
+		return value
+	}
+	return strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, value)
+}
+
+// guardActions describe each intervention in warnings
+var guardActions = map[string]string{
+	"sanitized":  "rewrote invalid characters in",
+	"dropped":    "dropped",
+	"truncated":  "truncated long values of",
+	"overflowed": "replaced new values with " + overflowValue + " for",
+}
+
+// intervene counts an intervention and warns the first time it hits a label
+func (g *LabelGuard) intervene(action, label string, counter *uint64) {
+	*counter++
+	key := action + ":" + label
+	if g.warned[key] {
+		return
+	}
+	g.warned[key] = true
+	logger.Fprint(g.warnLog, "warn", fmt.Sprintf("Label guard %s label %q", guardActions[action], label))
+}
+
+// Stats returns the interventions counted so far
+func (g *LabelGuard) Stats() LabelGuardStats {
+	if g == nil {
+		return LabelGuardStats{}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.stats
+}
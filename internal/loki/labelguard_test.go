@@ -0,0 +1,194 @@
+package loki
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+func newTestGuard(cfg *config.Config) (*LabelGuard, *bytes.Buffer) {
+	g := NewLabelGuard(cfg)
+	var warnings bytes.Buffer
+	g.warnLog = &warnings
+	return g, &warnings
+}
+
+func TestLabelGuard_NilPassesThrough(t *testing.T) {
+	var g *LabelGuard
+	labels := map[string]string{"a": "1"}
+	if got := g.Apply(labels); got["a"] != "1" {
+		t.Errorf("Apply() = %v", got)
+	}
+	if g.Stats() != (LabelGuardStats{}) {
+		t.Error("nil guard reported interventions")
+	}
+}
+
+func TestLabelGuard_AllowAndDenyLists(t *testing.T) {
+	g, warnings := newTestGuard(&config.Config{
+		LabelAllowlist: []string{"env", "team", "user_id"},
+		LabelDenylist:  []string{"user_id"},
+	})
+	labels := map[string]string{"function_name": "f", "source": "lambda", "env": "prod", "team": "a", "user_id": "42", "debug": "x"}
+
+	got := g.Apply(labels)
+	want := map[string]string{"function_name": "f", "source": "lambda", "env": "prod", "team": "a"}
+	if len(got) != len(want) {
+		t.Fatalf("Apply() = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+	if len(labels) != 6 {
+		t.Error("input labels were modified")
+	}
+	if g.Stats().Dropped != 2 {
+		t.Errorf("Dropped = %d, want 2", g.Stats().Dropped)
+	}
+	if !strings.Contains(warnings.String(), `"context":"LambdaWatch"`) || !strings.Contains(warnings.String(), `user_id`) {
+		t.Errorf("warnings = %s", warnings.String())
+	}
+
+	// Warnings are reported once per label
+	warnings.Reset()
+	g.Apply(labels)
+	if warnings.Len() != 0 {
+		t.Errorf("repeated warning: %s", warnings.String())
+	}
+}
+
+func TestLabelGuard_MaxLabelsKeepsProtected(t *testing.T) {
+	g, _ := newTestGuard(&config.Config{MaxLabels: 3})
+	got := g.Apply(map[string]string{"function_name": "f", "source": "lambda", "a": "1", "b": "2", "c": "3"})
+
+	if len(got) != 3 || got["function_name"] != "f" || got["source"] != "lambda" || got["a"] != "1" {
+		t.Errorf("Apply() = %v", got)
+	}
+}
+
+func TestLabelGuard_TruncatesLongValues(t *testing.T) {
+	g, _ := newTestGuard(&config.Config{MaxLabelValueLength: 20})
+	long1 := strings.Repeat("é", 20)
+	long2 := strings.Repeat("é", 19) + "x"
+
+	v1 := g.Apply(map[string]string{"key": long1})["key"]
+	v2 := g.Apply(map[string]string{"key": long2})["key"]
+	if len(v1) > 20 || !utf8.ValidString(v1) {
+		t.Errorf("truncated value %q: len %d", v1, len(v1))
+	}
+	if v1 == v2 {
+		t.Error("distinct long values collapsed to the same label value")
+	}
+	if got := g.Apply(map[string]string{"key": "short"})["key"]; got != "short" {
+		t.Errorf("short value changed to %q", got)
+	}
+	if g.Stats().Truncated != 2 {
+		t.Errorf("Truncated = %d, want 2", g.Stats().Truncated)
+	}
+}
+
+func TestLabelGuard_OverflowsNewValues(t *testing.T) {
+	g, _ := newTestGuard(&config.Config{MaxLabelValues: 2})
+	for _, id := range []string{"r1", "r2", "r3", "r1"} {
+		got := g.Apply(map[string]string{"request_id": id})["request_id"]
+		want := id
+		if id == "r3" {
+			want = overflowValue
+		}
+		if got != want {
+			t.Errorf("request_id %s shipped as %q, want %q", id, got, want)
+		}
+	}
+	if g.Stats().Overflowed != 1 {
+		t.Errorf("Overflowed = %d, want 1", g.Stats().Overflowed)
+	}
+}
+
+func TestLabelGuard_SanitizesNamesAndValues(t *testing.T) {
+	g, warnings := newTestGuard(&config.Config{})
+	labels := map[string]string{
+		"function_name": "orders\tsync\x00",
+		"team-name":     "payments",
+		"2fa":           "on",
+		"env":           "prod",
+		"env!":          "dev",
+		"bad_utf8":      "caf\xe9",
+	}
+
+	got := g.Apply(labels)
+	want := map[string]string{
+		"function_name": "orderssync",
+		"team_name":     "payments",
+		"_2fa":          "on",
+		"env":           "prod",
+		"env_":          "dev",
+		"bad_utf8":      "caf",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Apply() = %q, want %q", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+	if labels["team-name"] != "payments" || len(labels) != 6 {
+		t.Error("Apply() modified its input")
+	}
+	if s := g.Stats(); s.Sanitized != 5 {
+		t.Errorf("Sanitized = %d, want 5", s.Sanitized)
+	}
+	if !strings.Contains(warnings.String(), `rewrote invalid characters in label \"team-name\"`) {
+		t.Errorf("missing warning, got %s", warnings.String())
+	}
+}
+
+func TestSanitizeLabels_Collisions(t *testing.T) {
+	got, changed := sanitizeLabels(map[string]string{"a.b": "1", "a-b": "2", "a_b": "3", "c.d": "4", "c-d": "5"})
+	if got["a_b"] != "3" {
+		t.Errorf("a_b = %q, want the already valid name's value", got["a_b"])
+	}
+	if got["c_d"] != "5" {
+		t.Errorf("c_d = %q, want the first rewritten name in order (c-d)", got["c_d"])
+	}
+	if len(got) != 2 || len(changed) != 4 {
+		t.Errorf("got %v, changed %v", got, changed)
+	}
+
+	valid := map[string]string{"source": "lambda"}
+	if out, changed := sanitizeLabels(valid); changed != nil || len(out) != 1 {
+		t.Errorf("valid labels rewritten: %v", out)
+	}
+}
+
+func TestBatch_SanitizesLabelsWithoutGuard(t *testing.T) {
+	b := NewBatch(map[string]string{"source": "lambda", "app.name": "shop"}, false)
+	b.Add([]buffer.LogEntry{{Timestamp: 1, Message: "a"}})
+
+	stream := b.ToPushRequest().Streams[0].Stream
+	if stream["app_name"] != "shop" {
+		t.Errorf("stream labels = %v, want app_name", stream)
+	}
+}
+
+func TestBatch_LabelGuardAppliedToStreams(t *testing.T) {
+	g, _ := newTestGuard(&config.Config{LabelDenylist: []string{"env"}})
+	b := NewBatch(map[string]string{"source": "lambda", "env": "prod"}, false)
+	b.SetLabelGuard(g)
+	b.Add([]buffer.LogEntry{
+		{Timestamp: 1, Message: "a"},
+		{Timestamp: 2, Message: "b", StreamLabels: map[string]string{"env": "dev", "type": "summary"}},
+	})
+
+	for _, s := range b.ToPushRequest().Streams {
+		if _, ok := s.Stream["env"]; ok {
+			t.Errorf("denied label shipped: %v", s.Stream)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package loki
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+// mergeInternal interleaves the extension's own log entries with the
+// telemetry entries of a batch by timestamp. The logger stamps its entries
+// when they are written while telemetry entries carry their event time, so
+// the two sequences reach the buffer out of step. Each sequence keeps its
+// own order; on equal timestamps telemetry entries come first.
+func mergeInternal(entries []buffer.LogEntry) []buffer.LogEntry {
+	var internal, external []buffer.LogEntry
+	for _, e := range entries {
+		if e.Internal {
+			internal = append(internal, e)
+		} else {
+			external = append(external, e)
+		}
+	}
+	if len(internal) == 0 || len(external) == 0 {
+		return entries
+	}
+
+	merged := make([]buffer.LogEntry, 0, len(entries))
+	i, j := 0, 0
+	for i < len(internal) && j < len(external) {
+		if internal[i].Timestamp < external[j].Timestamp {
+			merged = append(merged, internal[i])
+			i++
+		} else {
+			merged = append(merged, external[j])
+			j++
+		}
+	}
+	merged = append(merged, internal[i:]...)
+	return append(merged, external[j:]...)
+}
+
+// orderStreams makes timestamps non-decreasing within each stream so Loki
+// does not reject entries as out of order. Entries can arrive out of order
+// when split chunks, platform events and the extension's own logs
+// interleave in the buffer.
+func orderStreams(req *PushRequest, mode string) {
+	switch mode {
+	case config.OrderingClamp:
+		for i := range req.Streams {
+			clampStream(&req.Streams[i])
+		}
+	case config.OrderingSort:
+		for i := range req.Streams {
+			sortStream(&req.Streams[i])
+		}
+	}
+}
+
+// clampStream raises each timestamp that is earlier than its predecessor's
+// to the predecessor's, keeping line order
+func clampStream(s *Stream) {
+	var last int64
+	for i, v := range s.Values {
+		ts, err := strconv.ParseInt(v[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if i > 0 && ts < last {
+			s.Values[i] = []string{strconv.FormatInt(last, 10), v[1]}
+			continue
+		}
+		last = ts
+	}
+}
+
+// sortStream stable-sorts a stream's values by timestamp, moving their
+// structured metadata with them
+func sortStream(s *Stream) {
+	ts := make([]int64, len(s.Values))
+	sorted := true
+	for i, v := range s.Values {
+		ts[i], _ = strconv.ParseInt(v[0], 10, 64)
+		if i > 0 && ts[i] < ts[i-1] {
+			sorted = false
+		}
+	}
+	if sorted {
+		return
+	}
+
+	order := make([]int, len(s.Values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return ts[order[a]] < ts[order[b]] })
+
+	values := make([][]string, len(s.Values))
+	var metadata []map[string]string
+	if len(s.Metadata) > 0 {
+		metadata = make([]map[string]string, len(s.Values))
+	}
+	for dst, src := range order {
+		values[dst] = s.Values[src]
+		if metadata != nil && src < len(s.Metadata) {
+			metadata[dst] = s.Metadata[src]
+		}
+	}
+	s.Values = values
+	s.Metadata = metadata
+}
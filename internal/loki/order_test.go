@@ -0,0 +1,85 @@
+package loki
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+func outOfOrderBatch(mode string) *PushRequest {
+	b := NewBatch(map[string]string{}, false)
+	b.SetOrdering(mode)
+	b.Add([]buffer.LogEntry{
+		{Timestamp: 3, Message: "chunk 1"},
+		{Timestamp: 1, Message: "extension log", Attributes: map[string]string{buffer.AttrTraceID: "t1"}},
+		{Timestamp: 3, Message: "chunk 2"},
+		{Timestamp: 2, Message: "other stream", StreamLabels: map[string]string{"error": "true"}},
+		{Timestamp: 4, Message: "later"},
+	})
+	return b.ToPushRequest()
+}
+
+func TestOrdering_Off(t *testing.T) {
+	got := outOfOrderBatch(config.OrderingOff).Streams[0].Values
+	want := [][]string{{"3000000", "chunk 1"}, {"1000000", "extension log"}, {"3000000", "chunk 2"}, {"4000000", "later"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("values = %v, want unchanged %v", got, want)
+	}
+}
+
+func TestOrdering_Clamp(t *testing.T) {
+	req := outOfOrderBatch(config.OrderingClamp)
+	want := [][]string{{"3000000", "chunk 1"}, {"3000000", "extension log"}, {"3000000", "chunk 2"}, {"4000000", "later"}}
+	if got := req.Streams[0].Values; !reflect.DeepEqual(got, want) {
+		t.Errorf("values = %v, want %v", got, want)
+	}
+	if req.Streams[0].Metadata[1]["trace_id"] != "t1" {
+		t.Errorf("metadata moved: %v", req.Streams[0].Metadata)
+	}
+	if req.Streams[1].Values[0][0] != "2000000" {
+		t.Errorf("other stream must be ordered independently, got %v", req.Streams[1].Values)
+	}
+}
+
+func TestOrdering_Sort(t *testing.T) {
+	req := outOfOrderBatch(config.OrderingSort)
+	want := [][]string{{"1000000", "extension log"}, {"3000000", "chunk 1"}, {"3000000", "chunk 2"}, {"4000000", "later"}}
+	if got := req.Streams[0].Values; !reflect.DeepEqual(got, want) {
+		t.Errorf("values = %v, want %v", got, want)
+	}
+	if req.Streams[0].Metadata[0]["trace_id"] != "t1" || req.Streams[0].Metadata[1] != nil {
+		t.Errorf("metadata not moved with its value: %v", req.Streams[0].Metadata)
+	}
+}
+
+func TestMergeInternal(t *testing.T) {
+	b := NewBatch(map[string]string{}, false)
+	b.Add([]buffer.LogEntry{
+		{Timestamp: 1, Message: "function 1"},
+		{Timestamp: 5, Message: "function 5"},
+		{Timestamp: 3, Message: "extension 3", Internal: true},
+		{Timestamp: 4, Message: "function 4 (late)"},
+		{Timestamp: 5, Message: "extension 5", Internal: true},
+		{Timestamp: 9, Message: "function 9"},
+	})
+	var got []string
+	for _, v := range b.ToPushRequest().Streams[0].Values {
+		got = append(got, v[1])
+	}
+	want := []string{"function 1", "extension 3", "function 5", "function 4 (late)", "extension 5", "function 9"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged = %v, want %v", got, want)
+	}
+}
+
+func TestMergeInternal_OnlyOneSource(t *testing.T) {
+	entries := []buffer.LogEntry{
+		{Timestamp: 3, Message: "a", Internal: true},
+		{Timestamp: 1, Message: "b", Internal: true},
+	}
+	if got := mergeInternal(entries); !reflect.DeepEqual(got, entries) {
+		t.Errorf("entries reordered without telemetry entries: %v", got)
+	}
+}
@@ -0,0 +1,34 @@
+//go:build !race
+
+// The race detector makes sync.Pool drop items at random, so pooling cannot
+// be measured under -race
+
+package loki
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+func TestCompressGzip_AllocBudget(t *testing.T) {
+	batch := NewBatch(benchLabels, true)
+	batch.Add(benchEntries(1000))
+	body, err := json.Marshal(batch.ToPushRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Writers and buffers are pooled, so steady-state gzip barely allocates
+	allocs := testing.AllocsPerRun(20, func() {
+		dst := getBuffer()
+		if _, _, err := compress(config.CompressionGzip, body, dst); err != nil {
+			t.Fatal(err)
+		}
+		putBuffer(dst)
+	})
+	if allocs > 2 {
+		t.Errorf("gzip allocs = %v, want <= 2", allocs)
+	}
+}
@@ -0,0 +1,136 @@
+package loki
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+)
+
+// maxLimitedStreams bounds the buckets kept; past it, buckets that have
+// refilled completely are forgotten
+const maxLimitedStreams = 1024
+
+// tokenBucket is one stream's allowance. Time is measured by entry
+// timestamps rather than the wall clock, so a backlog flushed at once is
+// judged by the rate the function logged it at.
+type tokenBucket struct {
+	tokens  float64
+	last    int64 // latest entry timestamp seen (ms)
+	dropped int   // lines dropped since the last one accepted
+}
+
+// StreamLimiter applies a token-bucket rate limit per stream, so one
+// runaway function cannot exhaust the tenant's ingestion limits and cause
+// 429s for everyone
+type StreamLimiter struct {
+	rate  float64 // tokens per millisecond
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	total   uint64
+	warned  bool
+	warnLog io.Writer
+}
+
+// NewStreamLimiter creates a limiter from LOKI_STREAM_RATE_LIMIT and
+// LOKI_STREAM_RATE_BURST, or returns nil when rate limiting is disabled
+func NewStreamLimiter(cfg *config.Config) *StreamLimiter {
+	if cfg.StreamRateLimit <= 0 {
+		return nil
+	}
+	return &StreamLimiter{
+		rate:    cfg.StreamRateLimit / 1000,
+		burst:   float64(cfg.StreamRateBurst),
+		buckets: make(map[string]*tokenBucket),
+		warnLog: os.Stderr,
+	}
+}
+
+// allow takes a token from the stream's bucket for an entry logged at
+// tsMillis, reporting whether the entry may be shipped
+func (l *StreamLimiter) allow(stream string, tsMillis int64) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[stream]
+	if !ok {
+		if len(l.buckets) >= maxLimitedStreams {
+			l.forgetFull(tsMillis)
+		}
+		b = &tokenBucket{tokens: l.burst, last: tsMillis}
+		l.buckets[stream] = b
+	}
+	if tsMillis > b.last {
+		b.tokens += float64(tsMillis-b.last) * l.rate
+		if b.tokens > l.burst {
+			b.tokens = l.burst
+		}
+		b.last = tsMillis
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+	b.dropped++
+	l.total++
+	l.warnOnce(stream)
+	return false
+}
+
+// takeDropped returns and resets the count of lines dropped from stream
+// since its last accepted line
+func (l *StreamLimiter) takeDropped(stream string) int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[stream]
+	if !ok {
+		return 0
+	}
+	n := b.dropped
+	b.dropped = 0
+	return n
+}
+
+// forgetFull removes buckets that would be full again by tsMillis and have
+// no drops left to report. Caller must hold mu.
+func (l *StreamLimiter) forgetFull(tsMillis int64) {
+	for key, b := range l.buckets {
+		if b.dropped == 0 && b.tokens+float64(tsMillis-b.last)*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// warnOnce reports the first drop. Caller must hold mu.
+func (l *StreamLimiter) warnOnce(stream string) {
+	if l.warned {
+		return
+	}
+	l.warned = true
+	name := stream
+	if name == "" {
+		name = "default"
+	}
+	logger.Fprint(l.warnLog, "warn", fmt.Sprintf("Stream rate limit of %g lines/s exceeded; dropping lines (first stream: %s)", l.rate*1000, name))
+}
+
+// Dropped returns the number of lines dropped since startup
+func (l *StreamLimiter) Dropped() uint64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.total
+}
@@ -0,0 +1,119 @@
+package loki
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+func newTestLimiter(rate float64, burst int) (*StreamLimiter, *bytes.Buffer) {
+	l := NewStreamLimiter(&config.Config{StreamRateLimit: rate, StreamRateBurst: burst})
+	var warnings bytes.Buffer
+	l.warnLog = &warnings
+	return l, &warnings
+}
+
+func TestStreamLimiter_DisabledByDefault(t *testing.T) {
+	l := NewStreamLimiter(&config.Config{})
+	if l != nil {
+		t.Fatal("expected nil limiter without LOKI_STREAM_RATE_LIMIT")
+	}
+	if !l.allow("", 0) || l.takeDropped("") != 0 || l.Dropped() != 0 {
+		t.Error("nil limiter limited entries")
+	}
+}
+
+func TestStreamLimiter_BurstThenRate(t *testing.T) {
+	l, warnings := newTestLimiter(10, 5) // one line per 100ms
+
+	allowed := 0
+	for i := 0; i < 8; i++ {
+		if l.allow("", 1000) {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Errorf("allowed %d lines at once, want burst of 5", allowed)
+	}
+	if l.takeDropped("") != 3 || l.takeDropped("") != 0 {
+		t.Error("takeDropped did not report and reset the 3 drops")
+	}
+
+	// Refill follows entry timestamps, not the wall clock
+	if !l.allow("", 1100) || l.allow("", 1100) {
+		t.Error("expected exactly one token after 100ms of log time")
+	}
+	if l.Dropped() != 4 {
+		t.Errorf("Dropped() = %d, want 4", l.Dropped())
+	}
+	if n := strings.Count(warnings.String(), "\n"); n != 1 || !strings.Contains(warnings.String(), `"context":"LambdaWatch"`) {
+		t.Errorf("warnings = %q, want one extension warning", warnings.String())
+	}
+}
+
+func TestStreamLimiter_StreamsAreIndependent(t *testing.T) {
+	l, _ := newTestLimiter(1, 1)
+	if !l.allow("type=function,", 0) || l.allow("type=function,", 0) {
+		t.Error("expected function stream to be limited to 1")
+	}
+	if !l.allow("type=platform,", 0) {
+		t.Error("platform stream was limited by the function stream")
+	}
+}
+
+func TestBatch_RateLimiterDropsAndMarks(t *testing.T) {
+	l, _ := newTestLimiter(1, 2)
+	batch := NewBatch(map[string]string{"function_name": "f"}, false)
+	batch.SetRateLimiter(l)
+
+	var entries []buffer.LogEntry
+	for i := 0; i < 5; i++ {
+		entries = append(entries, buffer.LogEntry{Timestamp: 1000, Message: fmt.Sprintf("line %d", i)})
+	}
+	entries = append(entries, buffer.LogEntry{Timestamp: 2000, Message: "after"})
+	batch.Add(batch.Admit(entries))
+
+	req := batch.ToPushRequest()
+	if len(req.Streams) != 1 {
+		t.Fatalf("got %d streams, want 1", len(req.Streams))
+	}
+	stream := req.Streams[0]
+	if len(stream.Values) != 3 {
+		t.Fatalf("got %d values, want 3 (burst of 2, then 1 after refill)", len(stream.Values))
+	}
+	if stream.Values[2][1] != "after" {
+		t.Errorf("last value = %q, want %q", stream.Values[2][1], "after")
+	}
+	if len(stream.Metadata) != 3 || stream.Metadata[2]["rate_limited"] != "3" {
+		t.Errorf("metadata = %v, want rate_limited=3 on the line after the drops", stream.Metadata)
+	}
+}
+
+func TestBatch_AdmitSkipsRetriedEntries(t *testing.T) {
+	l, _ := newTestLimiter(1, 2)
+	batch := NewBatch(map[string]string{"function_name": "f"}, false)
+	batch.SetRateLimiter(l)
+
+	buf := buffer.New(10)
+	buf.Add(buffer.LogEntry{Timestamp: 1000, Message: "a"})
+	buf.Add(buffer.LogEntry{Timestamp: 1000, Message: "b"})
+
+	lease := buf.Take(10, 0)
+	if got := len(batch.Admit(lease.Entries)); got != 2 {
+		t.Fatalf("admitted %d entries, want 2", got)
+	}
+	buf.Nack(lease)
+
+	// The burst is spent, but the retry was already admitted once
+	lease = buf.Take(10, 0)
+	if got := len(batch.Admit(lease.Entries)); got != 2 {
+		t.Errorf("admitted %d retried entries, want 2", got)
+	}
+	if l.Dropped() != 0 {
+		t.Errorf("Dropped() = %d, want 0", l.Dropped())
+	}
+}
@@ -0,0 +1,26 @@
+package loki
+
+import "os"
+
+// AddResourceLabels adds the OpenTelemetry resource attributes ADOT sets on
+// the function's traces, named as Loki's OTLP ingestion names them (dots
+// become underscores), so logs and traces can be joined on the same values.
+// faas_instance is unique per sandbox, so it goes out as structured metadata
+// (see resourceMetadata) rather than as a label.
+func AddResourceLabels(labels map[string]string, functionName, functionVersion string) {
+	labels["faas_name"] = functionName
+	labels["faas_version"] = functionVersion
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		labels["cloud_region"] = region
+	}
+}
+
+// resourceMetadata returns the resource attributes attached to every entry
+// as structured metadata, or nil when there are none
+func resourceMetadata() map[string]string {
+	instance := os.Getenv("AWS_LAMBDA_LOG_STREAM_NAME")
+	if instance == "" {
+		return nil
+	}
+	return map[string]string{"faas_instance": instance}
+}
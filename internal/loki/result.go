@@ -0,0 +1,22 @@
+package loki
+
+import "time"
+
+// PushResult describes one push to Loki after its retries. A batch whose
+// entries were isolated after a 400 reports one result per sub-push.
+type PushResult struct {
+	Success    bool
+	StatusCode int // last HTTP status; 0 when no response was received
+	Attempts   int
+	Duration   time.Duration
+	Endpoint   string
+	Critical   bool
+	Entries    int
+	Err        error
+}
+
+// SetResultHook registers fn to receive the result of every push. fn is
+// called from flush workers concurrently and must not block.
+func (c *Client) SetResultHook(fn func(PushResult)) {
+	c.onResult = fn
+}
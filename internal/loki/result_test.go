@@ -0,0 +1,58 @@
+package loki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClient_ResultHook(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	var results []PushResult
+	client := NewClient(newTestConfig(server.URL))
+	client.SetResultHook(func(r PushResult) { results = append(results, r) })
+
+	if err := client.PushCritical(context.Background(), newTestRequest()); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	r := results[0]
+	if !r.Success || r.Err != nil || r.StatusCode != http.StatusNoContent || r.Attempts != 2 {
+		t.Errorf("unexpected result %+v", r)
+	}
+	if !r.Critical || r.Entries != 1 || r.Endpoint != server.URL || r.Duration <= 0 {
+		t.Errorf("unexpected result %+v", r)
+	}
+}
+
+func TestClient_ResultHook_Failure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	var result PushResult
+	client := NewClient(newTestConfig(server.URL))
+	client.SetResultHook(func(r PushResult) { result = r })
+
+	err := client.Push(context.Background(), newTestRequest())
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if result.Success || result.Err != err || result.StatusCode != http.StatusUnauthorized || result.Attempts != 1 {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
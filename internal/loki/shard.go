@@ -0,0 +1,47 @@
+package loki
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+// ShardLabel is the stream label carrying a batch's shard
+const ShardLabel = "shard"
+
+// Sharder spreads a function's writes over LOKI_STREAM_SHARDS streams by
+// giving each batch the next value of a shard label, so a high-volume
+// function stays under Loki's per-stream rate limits
+type Sharder struct {
+	shards uint64
+	next   atomic.Uint64
+}
+
+// NewSharder creates a sharder from LOKI_STREAM_SHARDS, or returns nil when
+// there is at most one shard
+func NewSharder(cfg *config.Config) *Sharder {
+	if cfg.StreamShards <= 1 {
+		return nil
+	}
+	return &Sharder{shards: uint64(cfg.StreamShards)}
+}
+
+// take returns the next shard, cycling 0..N-1. ok is false for a nil sharder.
+func (s *Sharder) take() (shard string, ok bool) {
+	if s == nil {
+		return "", false
+	}
+	n := s.next.Add(1) - 1
+	return strconv.FormatUint(n%s.shards, 10), true
+}
+
+// LabelSize returns the bytes the widest shard label adds to a push body's
+// stream labels, or 0 for a nil sharder
+func (s *Sharder) LabelSize() int {
+	if s == nil {
+		return 0
+	}
+	widest := strconv.FormatUint(s.shards-1, 10)
+	return len(`,"`+ShardLabel+`":""`) + len(widest)
+}
@@ -0,0 +1,70 @@
+package loki
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+func TestSharder_DisabledByDefault(t *testing.T) {
+	for _, shards := range []int{0, 1} {
+		if s := NewSharder(&config.Config{StreamShards: shards}); s != nil {
+			t.Errorf("StreamShards=%d: expected nil sharder", shards)
+		}
+	}
+
+	b := NewBatch(map[string]string{"source": "lambda"}, false)
+	b.SetSharder(nil)
+	b.Add([]buffer.LogEntry{{Timestamp: 1000, Message: "x"}})
+	if _, ok := b.ToPushRequest().Streams[0].Stream[ShardLabel]; ok {
+		t.Error("nil sharder added a shard label")
+	}
+}
+
+func TestSharder_RoundRobinPerBatch(t *testing.T) {
+	s := NewSharder(&config.Config{StreamShards: 3})
+	labels := map[string]string{"source": "lambda"}
+
+	var got []string
+	for i := 0; i < 5; i++ {
+		b := NewBatch(labels, false)
+		b.SetSharder(s)
+		b.Add([]buffer.LogEntry{
+			{Timestamp: 1000, Message: "a"},
+			{Timestamp: 2000, Message: "b", StreamLabels: map[string]string{"error": "true"}},
+		})
+		req := b.ToPushRequest()
+		for _, stream := range req.Streams {
+			if stream.Stream[ShardLabel] != req.Streams[0].Stream[ShardLabel] {
+				t.Errorf("batch %d: streams got different shards %v", i, req.Streams)
+			}
+		}
+		got = append(got, req.Streams[0].Stream[ShardLabel])
+	}
+
+	want := []string{"0", "1", "2", "0", "1"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("shards = %v, want %v", got, want)
+		}
+	}
+	if _, ok := labels[ShardLabel]; ok {
+		t.Error("SetSharder modified the caller's labels")
+	}
+}
+
+func TestSharder_LabelSize(t *testing.T) {
+	s := NewSharder(&config.Config{StreamShards: 12})
+	labels := map[string]string{"source": "lambda"}
+	plain, _ := json.Marshal(labels)
+	sharded, _ := json.Marshal(map[string]string{"source": "lambda", ShardLabel: "11"})
+
+	if got, want := s.LabelSize(), len(sharded)-len(plain); got != want {
+		t.Errorf("LabelSize() = %d, want %d", got, want)
+	}
+	if (*Sharder)(nil).LabelSize() != 0 {
+		t.Error("nil sharder has a label size")
+	}
+}
@@ -0,0 +1,41 @@
+package loki
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+	"github.com/mumzworld-tech/lambdawatch/internal/sigv4"
+)
+
+// requestSigner signs requests to IAM-authenticated endpoints (API Gateway
+// or Amazon Managed Service for Prometheus style ingestion proxies) with
+// the function role's credentials, so no long-lived secret is configured
+type requestSigner struct {
+	service     string
+	region      string
+	credentials func() sigv4.Credentials
+	now         func() time.Time
+}
+
+// newRequestSigner returns the signer for LOKI_AUTH_MODE=sigv4
+func newRequestSigner(cfg *config.Config) *requestSigner {
+	return &requestSigner{
+		service:     cfg.LokiSigV4Service,
+		region:      cfg.LokiSigV4Region,
+		credentials: sigv4.CredentialsFromEnv,
+		now:         time.Now,
+	}
+}
+
+// authenticate adds the SigV4 headers to req. Credentials are read on every
+// request because Lambda refreshes the role's session credentials.
+func (s *requestSigner) authenticate(req *http.Request, body []byte) error {
+	creds := s.credentials()
+	if !creds.Valid() {
+		return errors.New("LOKI_AUTH_MODE=sigv4: no AWS credentials available")
+	}
+	sigv4.Sign(req, body, s.service, s.region, creds, s.now())
+	return nil
+}
@@ -0,0 +1,61 @@
+package loki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+	"github.com/mumzworld-tech/lambdawatch/internal/sigv4"
+)
+
+func TestClient_Push_SigV4(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.LokiAuthMode = config.AuthModeSigV4
+	cfg.LokiSigV4Service = "aps"
+	cfg.LokiSigV4Region = "eu-west-1"
+	client := NewClient(cfg)
+	signer := client.auth.(*requestSigner)
+	signer.credentials = func() sigv4.Credentials {
+		return sigv4.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret", SessionToken: "session"}
+	}
+	signer.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	if err := client.Push(context.Background(), newTestRequest()); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	auth := received.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20260102/eu-west-1/aps/aws4_request") {
+		t.Errorf("Authorization = %s, want a SigV4 signature for aps in eu-west-1", auth)
+	}
+	if received.Get("X-Amz-Date") != "20260102T030405Z" || received.Get("X-Amz-Security-Token") != "session" {
+		t.Errorf("SigV4 headers = %v", received)
+	}
+}
+
+func TestClient_Push_SigV4WithoutCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("unsigned request reached the server")
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.LokiAuthMode = config.AuthModeSigV4
+	client := NewClient(cfg)
+	signer := client.auth.(*requestSigner)
+	signer.credentials = func() sigv4.Credentials { return sigv4.Credentials{} }
+
+	if err := client.Push(context.Background(), newTestRequest()); err == nil || !strings.Contains(err.Error(), "credentials") {
+		t.Errorf("Push() error = %v, want missing credentials", err)
+	}
+}
@@ -0,0 +1,31 @@
+package loki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+// newTLSConfig builds a TLS config from the custom CA and client
+// certificate, or returns nil when neither is configured. The material is
+// validated by config.Load, so parse failures here leave that part unset.
+func newTLSConfig(cfg *config.Config) *tls.Config {
+	if len(cfg.LokiTLSCA) == 0 && len(cfg.LokiTLSCert) == 0 {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(cfg.LokiTLSCA) > 0 {
+		pool := x509.NewCertPool()
+		if pool.AppendCertsFromPEM(cfg.LokiTLSCA) {
+			tlsConfig.RootCAs = pool
+		}
+	}
+	if len(cfg.LokiTLSCert) > 0 {
+		if cert, err := tls.X509KeyPair(cfg.LokiTLSCert, cfg.LokiTLSKey); err == nil {
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+	return tlsConfig
+}
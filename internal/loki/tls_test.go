@@ -0,0 +1,77 @@
+package loki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newClientCert returns a self-signed client certificate and key as PEM
+func newClientCert(t *testing.T) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "lambdawatch"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestNewTLSConfig_NoneConfigured(t *testing.T) {
+	if newTLSConfig(newTestConfig("https://unused")) != nil {
+		t.Error("expected nil TLS config without CA or client certificate")
+	}
+}
+
+func TestClient_MutualTLS(t *testing.T) {
+	certPEM, keyPEM := newClientCert(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(certPEM)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	cfg := newTestConfig(server.URL)
+	cfg.MaxRetries = 0
+	cfg.LokiTLSCA = caPEM
+	if err := NewClient(cfg).Push(context.Background(), newTestRequest()); err == nil {
+		t.Fatal("expected handshake failure without a client certificate")
+	}
+
+	cfg.LokiTLSCert = certPEM
+	cfg.LokiTLSKey = keyPEM
+	if err := NewClient(cfg).Push(context.Background(), newTestRequest()); err != nil {
+		t.Fatalf("expected mTLS push to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package loki
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+// Transport tuning for a single long-lived Lambda container pushing to one
+// or two Loki hosts. Idle connections are kept well under typical NAT and
+// load balancer idle timeouts so a thawed container does not reuse a
+// connection that was silently dropped while frozen.
+const (
+	dialTimeout           = 5 * time.Second
+	dialKeepAlive         = 30 * time.Second
+	tlsHandshakeTimeout   = 5 * time.Second
+	idleConnTimeout       = 60 * time.Second
+	expectContinueTimeout = 1 * time.Second
+	maxIdleConns          = 16
+)
+
+// newTransport returns the HTTP transport for Loki pushes, sized to reuse
+// connections across flushes so only the first push pays the TLS handshake
+func newTransport(cfg *config.Config) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: dialKeepAlive,
+	}
+	maxIdlePerHost := cfg.LokiMaxIdleConnsPerHost
+	if maxIdlePerHost <= 0 {
+		maxIdlePerHost = http.DefaultMaxIdleConnsPerHost
+	}
+	return &http.Transport{
+		Proxy:                 proxyFunc(cfg),
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     cfg.LokiForceHTTP2,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdlePerHost,
+		IdleConnTimeout:       idleConnTimeout,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		ExpectContinueTimeout: expectContinueTimeout,
+		TLSClientConfig:       newTLSConfig(cfg),
+	}
+}
+
+// proxyFunc returns the proxy selector for Loki pushes: LOKI_PROXY_URL
+// when set, otherwise HTTPS_PROXY/HTTP_PROXY honoring NO_PROXY
+func proxyFunc(cfg *config.Config) func(*http.Request) (*url.URL, error) {
+	if cfg.LokiProxyURL == "" {
+		return http.ProxyFromEnvironment
+	}
+	// Validated by config; a parse failure here means no proxy
+	u, err := url.Parse(cfg.LokiProxyURL)
+	if err != nil {
+		return nil
+	}
+	return http.ProxyURL(u)
+}
+
+// proxyFor returns the redacted proxy URL rt would use for req, or "" when
+// the request goes direct
+func proxyFor(rt http.RoundTripper, req *http.Request) string {
+	tr, ok := rt.(*http.Transport)
+	if !ok || tr.Proxy == nil {
+		return ""
+	}
+	u, err := tr.Proxy(req)
+	if err != nil || u == nil {
+		return ""
+	}
+	return u.Redacted()
+}
+
+// requestTimeout returns the per-request timeout for Loki pushes
+func requestTimeout(cfg *config.Config) time.Duration {
+	if cfg.LokiHTTPTimeoutMs > 0 {
+		return time.Duration(cfg.LokiHTTPTimeoutMs) * time.Millisecond
+	}
+	return httpClientTimeout
+}
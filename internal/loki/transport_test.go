@@ -0,0 +1,120 @@
+package loki
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewTransport_Tuning(t *testing.T) {
+	cfg := newTestConfig("http://unused")
+	cfg.LokiMaxIdleConnsPerHost = 8
+	cfg.LokiForceHTTP2 = true
+
+	tr := newTransport(cfg)
+	if tr.MaxIdleConnsPerHost != 8 {
+		t.Errorf("MaxIdleConnsPerHost = %d, want 8", tr.MaxIdleConnsPerHost)
+	}
+	if !tr.ForceAttemptHTTP2 {
+		t.Error("expected ForceAttemptHTTP2")
+	}
+	if tr.IdleConnTimeout != idleConnTimeout || tr.TLSHandshakeTimeout != tlsHandshakeTimeout {
+		t.Errorf("unexpected timeouts: idle=%v handshake=%v", tr.IdleConnTimeout, tr.TLSHandshakeTimeout)
+	}
+	if tr.TLSClientConfig != nil {
+		t.Error("expected default TLS config without custom material")
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	cfg := newTestConfig("http://unused")
+	if got := requestTimeout(cfg); got != httpClientTimeout {
+		t.Errorf("requestTimeout() = %v, want default %v", got, httpClientTimeout)
+	}
+	cfg.LokiHTTPTimeoutMs = 2500
+	if got := requestTimeout(cfg); got != 2500*time.Millisecond {
+		t.Errorf("requestTimeout() = %v, want 2.5s", got)
+	}
+}
+
+func TestClient_ReusesConnections(t *testing.T) {
+	var newConns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := NewClient(newTestConfig(server.URL))
+	for i := 0; i < 5; i++ {
+		if err := client.Push(context.Background(), newTestRequest()); err != nil {
+			t.Fatalf("push %d: %v", i, err)
+		}
+	}
+	if n := newConns.Load(); n != 1 {
+		t.Errorf("opened %d connections for sequential pushes, want 1", n)
+	}
+}
+
+func TestClient_PushesThroughProxyURL(t *testing.T) {
+	var proxiedHost atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute target URL
+		proxiedHost.Store(r.URL.Host)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	cfg := newTestConfig("http://loki.internal:3100/loki/api/v1/push")
+	cfg.LokiProxyURL = proxy.URL
+	client := NewClient(cfg)
+	if err := client.Push(context.Background(), newTestRequest()); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if got, _ := proxiedHost.Load().(string); got != "loki.internal:3100" {
+		t.Errorf("proxy saw host %q, want loki.internal:3100", got)
+	}
+}
+
+func TestClient_ProxyErrorNamesProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.NotFoundHandler())
+	proxyURL := proxy.URL
+	proxy.Close()
+
+	cfg := newTestConfig("http://loki.internal:3100/loki/api/v1/push")
+	cfg.LokiProxyURL = "http://user:secret@" + strings.TrimPrefix(proxyURL, "http://")
+	cfg.MaxRetries = 0
+	err := NewClient(cfg).Push(context.Background(), newTestRequest())
+	if err == nil {
+		t.Fatal("expected error with unreachable proxy")
+	}
+	if !strings.Contains(err.Error(), "via proxy http://user:xxxxx@") {
+		t.Errorf("error does not name the redacted proxy: %v", err)
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error leaks proxy password: %v", err)
+	}
+}
+
+func TestProxyFunc_Environment(t *testing.T) {
+	cfg := newTestConfig("http://unused")
+	if proxyFunc(cfg) == nil {
+		t.Fatal("expected environment proxy selector by default")
+	}
+	cfg.LokiProxyURL = "http://proxy.internal:3128"
+	req, _ := http.NewRequest(http.MethodPost, "https://loki.example.com/loki/api/v1/push", nil)
+	u, err := proxyFunc(cfg)(req)
+	if err != nil || u == nil || u.Host != "proxy.internal:3128" {
+		t.Errorf("proxy = %v, %v; want proxy.internal:3128", u, err)
+	}
+}
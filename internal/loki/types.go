@@ -1,14 +1,89 @@
 package loki
 
+import "encoding/json"
+
 // PushRequest is the Loki push API request body
 type PushRequest struct {
 	Streams []Stream `json:"streams"`
+
+	// TenantID overrides the client's configured tenant for this request.
+	// It is sent as the X-Scope-OrgID header, never in the body.
+	TenantID string `json:"-"`
 }
 
 // Stream represents a single log stream in Loki
 type Stream struct {
 	Stream map[string]string `json:"stream"`
 	Values [][]string        `json:"values"`
+
+	// Metadata holds optional structured metadata for each value, index-aligned
+	// with Values. It is encoded as the third element of each value tuple.
+	Metadata []map[string]string `json:"-"`
+}
+
+// streamJSON is the wire form of Stream when structured metadata is present
+type streamJSON struct {
+	Stream map[string]string `json:"stream"`
+	Values [][]interface{}   `json:"values"`
+}
+
+// MarshalJSON encodes values as [ts, line] or [ts, line, {metadata}] tuples
+func (s Stream) MarshalJSON() ([]byte, error) {
+	type plain Stream
+	if len(s.Metadata) == 0 {
+		return json.Marshal(plain(s))
+	}
+
+	values := make([][]interface{}, len(s.Values))
+	for i, v := range s.Values {
+		tuple := make([]interface{}, 0, 3)
+		for _, part := range v {
+			tuple = append(tuple, part)
+		}
+		if i < len(s.Metadata) && len(s.Metadata[i]) > 0 {
+			tuple = append(tuple, s.Metadata[i])
+		}
+		values[i] = tuple
+	}
+	return json.Marshal(streamJSON{Stream: s.Stream, Values: values})
+}
+
+// UnmarshalJSON decodes both plain and structured-metadata value tuples
+func (s *Stream) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Stream map[string]string   `json:"stream"`
+		Values [][]json.RawMessage `json:"values"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	s.Stream = raw.Stream
+	s.Values = make([][]string, len(raw.Values))
+	s.Metadata = nil
+	for i, tuple := range raw.Values {
+		value := make([]string, 0, 2)
+		for j, part := range tuple {
+			if j < 2 {
+				var str string
+				if err := json.Unmarshal(part, &str); err != nil {
+					return err
+				}
+				value = append(value, str)
+				continue
+			}
+			var md map[string]string
+			if err := json.Unmarshal(part, &md); err != nil {
+				return err
+			}
+			if s.Metadata == nil {
+				s.Metadata = make([]map[string]string, len(raw.Values))
+			}
+			s.Metadata[i] = md
+		}
+		s.Values[i] = value
+	}
+	return nil
 }
 
 // NewPushRequest creates a new push request with the given labels and log values
@@ -0,0 +1,143 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+const (
+	pushPath       = "/loki/api/v1/push"
+	queryRangePath = "/loki/api/v1/query_range"
+)
+
+// queryRangeResponse is the part of a query_range response used to count
+// entries: a matrix of [unix seconds, "value"] samples
+type queryRangeResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Values [][]interface{} `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// CountEntries asks Loki how many entries matching query have timestamps
+// in [start, end], using query_range against the primary endpoint. query is
+// a LogQL log query such as the one built by LogSelector.
+func (c *Client) CountEntries(ctx context.Context, query string, start, end time.Time) (int, error) {
+	if c.dryRun {
+		return 0, errors.New("dry run: nothing was pushed to Loki")
+	}
+	queryURL, err := queryRangeURL(c.endpoints.urls[0])
+	if err != nil {
+		return 0, err
+	}
+
+	// One sample whose range covers the whole window, evaluated at end
+	window := end.Sub(start)
+	if window < time.Millisecond {
+		window = time.Millisecond
+	}
+	params := url.Values{}
+	params.Set("query", fmt.Sprintf("sum(count_over_time(%s [%dms]))", query, window.Milliseconds()))
+	params.Set("start", strconv.FormatInt(end.UnixNano(), 10))
+	params.Set("end", strconv.FormatInt(end.UnixNano(), 10))
+	params.Set("step", strconv.FormatInt(window.Milliseconds(), 10)+"ms")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, queryURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create query: %w", err)
+	}
+	if err := c.authorize(req, c.tenantID, nil); err != nil {
+		return 0, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("query failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read query response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("query failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result queryRangeResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, fmt.Errorf("failed to decode query response: %w", err)
+	}
+	return countFromMatrix(result)
+}
+
+// countFromMatrix returns the largest sample of a count_over_time result.
+// An empty result means no entry matched.
+func countFromMatrix(result queryRangeResponse) (int, error) {
+	if result.Status != "success" {
+		return 0, fmt.Errorf("query status %q", result.Status)
+	}
+	count := 0
+	for _, series := range result.Data.Result {
+		for _, sample := range series.Values {
+			if len(sample) != 2 {
+				continue
+			}
+			str, ok := sample[1].(string)
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseFloat(str, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid sample value %q", str)
+			}
+			if int(v) > count {
+				count = int(v)
+			}
+		}
+	}
+	return count, nil
+}
+
+// queryRangeURL derives the query_range URL from a push URL
+func queryRangeURL(pushURL string) (string, error) {
+	base, ok := strings.CutSuffix(pushURL, pushPath)
+	if !ok {
+		return "", fmt.Errorf("cannot derive query URL from %q: path does not end in %s", config.RedactURL(pushURL), pushPath)
+	}
+	return base + queryRangePath, nil
+}
+
+// LogSelector builds a LogQL query matching streams with all of labels
+// whose lines contain needle
+func LogSelector(labels map[string]string, needle string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	matchers := make([]string, len(keys))
+	for i, k := range keys {
+		matchers[i] = k + "=" + strconv.Quote(labels[k])
+	}
+	query := "{" + strings.Join(matchers, ", ") + "}"
+	if needle != "" {
+		query += " |= " + strconv.Quote(needle)
+	}
+	return query
+}
@@ -0,0 +1,95 @@
+package loki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_CountEntries(t *testing.T) {
+	var gotQuery, gotTenant, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != queryRangePath {
+			t.Errorf("path = %s, want %s", r.URL.Path, queryRangePath)
+		}
+		gotQuery = r.URL.Query().Get("query")
+		gotTenant = r.Header.Get("X-Scope-OrgID")
+		gotAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1700000000,"3"],[1700000001,"7"]]}]}}`))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL + pushPath)
+	cfg.LokiTenantID = "staging"
+	cfg.LokiAPIKey = "secret"
+	client := NewClient(cfg)
+
+	end := time.Unix(1700000001, 0)
+	n, err := client.CountEntries(context.Background(), `{function_name="orders"} |= "req-1"`, end.Add(-2*time.Second), end)
+	if err != nil {
+		t.Fatalf("CountEntries() error = %v", err)
+	}
+	if n != 7 {
+		t.Errorf("count = %d, want 7", n)
+	}
+	if want := `sum(count_over_time({function_name="orders"} |= "req-1" [2000ms]))`; gotQuery != want {
+		t.Errorf("query = %s, want %s", gotQuery, want)
+	}
+	if gotTenant != "staging" || gotAuth != "Bearer secret" {
+		t.Errorf("tenant = %q, auth = %q", gotTenant, gotAuth)
+	}
+}
+
+func TestClient_CountEntries_EmptyResult(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(newTestConfig(server.URL + pushPath))
+	n, err := client.CountEntries(context.Background(), `{function_name="orders"}`, time.Now().Add(-time.Second), time.Now())
+	if err != nil || n != 0 {
+		t.Errorf("CountEntries() = %d, %v; want 0, nil", n, err)
+	}
+}
+
+func TestClient_CountEntries_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "too many outstanding requests", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := NewClient(newTestConfig(server.URL + pushPath))
+	if _, err := client.CountEntries(context.Background(), `{}`, time.Now(), time.Now()); err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("error = %v, want status 429", err)
+	}
+
+	client = NewClient(newTestConfig(strings.Replace(server.URL, "http://", "http://user:hunter2@", 1) + "/custom/ingest"))
+	_, err := client.CountEntries(context.Background(), `{}`, time.Now(), time.Now())
+	if err == nil {
+		t.Error("expected error when the push URL has no standard path")
+	} else if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("error leaks the push URL password: %v", err)
+	}
+
+	cfg := newTestConfig(server.URL + pushPath)
+	cfg.DryRun = true
+	if _, err := NewClient(cfg).CountEntries(context.Background(), `{}`, time.Now(), time.Now()); err == nil {
+		t.Error("expected error in dry run")
+	}
+}
+
+func TestLogSelector(t *testing.T) {
+	got := LogSelector(map[string]string{"source": "lambda", "function_name": `say "hi"`}, "req-1")
+	want := `{function_name="say \"hi\"", source="lambda"} |= "req-1"`
+	if got != want {
+		t.Errorf("LogSelector() = %s, want %s", got, want)
+	}
+	if got := LogSelector(map[string]string{"function_name": "orders"}, ""); got != `{function_name="orders"}` {
+		t.Errorf("LogSelector() without needle = %s", got)
+	}
+}
@@ -0,0 +1,171 @@
+// Package metrics tracks the extension's own delivery metrics and exports
+// them to a Prometheus remote-write endpoint such as Mimir.
+package metrics
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// overheadReservoirSize bounds the post-invoke overheads kept for
+// quantiles. Past it, reservoir sampling keeps a uniform sample of the
+// sandbox's lifetime.
+const overheadReservoirSize = 1024
+
+// Sample is the current value of one series. Name becomes the __name__
+// label; Labels are merged over the writer's base labels.
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Registry accumulates push counters between exports. Counters are
+// cumulative for the life of the sandbox, as Prometheus expects.
+type Registry struct {
+	mu          sync.Mutex
+	pushSuccess float64
+	pushFailure float64
+	pushSeconds float64
+
+	// Fed from platform.report
+	invocations       float64
+	invocationSeconds float64
+	coldStarts        float64
+	maxMemoryBytes    float64
+	memoryUtilization float64
+
+	// Fed from Loki delivery verification
+	verifyOK       float64
+	verifyMismatch float64
+	verifyError    float64
+	verifyMissing  float64
+
+	// Time each invocation's runtimeDone handling held Lambda up, and the
+	// critical flush's share of it
+	overheadCount   float64
+	overheadSeconds float64
+	flushSeconds    float64
+	overheads       []float64 // reservoir of overhead seconds
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// ObservePush records one Loki push and how long it took
+func (r *Registry) ObservePush(d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.pushFailure++
+	} else {
+		r.pushSuccess++
+	}
+	r.pushSeconds += d.Seconds()
+}
+
+// ObserveInvocation records one invocation's platform.report metrics.
+// Memory is reported as of the latest invocation: Lambda's max memory used
+// is the sandbox's peak, so it only grows between reports.
+func (r *Registry) ObserveInvocation(durationMs, maxMemoryUsedMB, memorySizeMB float64, coldStart bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.invocations++
+	r.invocationSeconds += durationMs / 1000
+	if coldStart {
+		r.coldStarts++
+	}
+	r.maxMemoryBytes = maxMemoryUsedMB * 1024 * 1024
+	if memorySizeMB > 0 {
+		r.memoryUtilization = maxMemoryUsedMB / memorySizeMB
+	}
+}
+
+// ObserveOverhead records the time the extension added after an
+// invocation's runtimeDone, of which flush was spent in the critical flush
+func (r *Registry) ObserveOverhead(total, flush time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.overheadCount++
+	r.overheadSeconds += total.Seconds()
+	r.flushSeconds += flush.Seconds()
+
+	if len(r.overheads) < overheadReservoirSize {
+		r.overheads = append(r.overheads, total.Seconds())
+	} else if i := rand.Int63n(int64(r.overheadCount)); i < overheadReservoirSize {
+		r.overheads[i] = total.Seconds()
+	}
+}
+
+// OverheadQuantile returns the q-quantile (0 < q <= 1) of the post-invoke
+// overheads observed so far, or 0 before the first
+func (r *Registry) OverheadQuantile(q float64) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Duration(r.overheadQuantile(q) * float64(time.Second))
+}
+
+// overheadQuantile is OverheadQuantile in seconds. Caller must hold mu.
+func (r *Registry) overheadQuantile(q float64) float64 {
+	if len(r.overheads) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), r.overheads...)
+	sort.Float64s(sorted)
+	rank := int(q*float64(len(sorted)) + 0.5) // nearest rank, 1-based
+	rank = min(max(rank, 1), len(sorted))
+	return sorted[rank-1]
+}
+
+// ObserveVerification records one delivery verification and how many
+// pushed entries Loki did not return
+func (r *Registry) ObserveVerification(missing int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case err != nil:
+		r.verifyError++
+		return
+	case missing > 0:
+		r.verifyMismatch++
+	default:
+		r.verifyOK++
+	}
+	if missing < 0 {
+		missing = 0
+	}
+	r.verifyMissing = float64(missing)
+}
+
+// Snapshot returns every series, including the buffer gauges passed in
+// by the caller
+func (r *Registry) Snapshot(bufferDepth int, dropped uint64) []Sample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return []Sample{
+		{Name: "lambdawatch_push_total", Labels: map[string]string{"result": "success"}, Value: r.pushSuccess},
+		{Name: "lambdawatch_push_total", Labels: map[string]string{"result": "failure"}, Value: r.pushFailure},
+		{Name: "lambdawatch_push_duration_seconds_sum", Value: r.pushSeconds},
+		{Name: "lambdawatch_push_duration_seconds_count", Value: r.pushSuccess + r.pushFailure},
+		{Name: "lambdawatch_entries_dropped_total", Value: float64(dropped)},
+		{Name: "lambdawatch_buffer_entries", Value: float64(bufferDepth)},
+		{Name: "lambdawatch_invocation_duration_seconds_sum", Value: r.invocationSeconds},
+		{Name: "lambdawatch_invocation_duration_seconds_count", Value: r.invocations},
+		{Name: "lambdawatch_cold_starts_total", Value: r.coldStarts},
+		{Name: "lambdawatch_max_memory_used_bytes", Value: r.maxMemoryBytes},
+		{Name: "lambdawatch_memory_utilization_ratio", Value: r.memoryUtilization},
+		{Name: "lambdawatch_delivery_verifications_total", Labels: map[string]string{"result": "ok"}, Value: r.verifyOK},
+		{Name: "lambdawatch_delivery_verifications_total", Labels: map[string]string{"result": "mismatch"}, Value: r.verifyMismatch},
+		{Name: "lambdawatch_delivery_verifications_total", Labels: map[string]string{"result": "error"}, Value: r.verifyError},
+		{Name: "lambdawatch_delivery_missing_entries", Value: r.verifyMissing},
+		{Name: "lambdawatch_post_invoke_overhead_seconds_sum", Value: r.overheadSeconds},
+		{Name: "lambdawatch_post_invoke_overhead_seconds_count", Value: r.overheadCount},
+		{Name: "lambdawatch_post_invoke_overhead_seconds", Labels: map[string]string{"quantile": "0.5"}, Value: r.overheadQuantile(0.5)},
+		{Name: "lambdawatch_post_invoke_overhead_seconds", Labels: map[string]string{"quantile": "0.95"}, Value: r.overheadQuantile(0.95)},
+		{Name: "lambdawatch_post_invoke_flush_seconds_sum", Value: r.flushSeconds},
+	}
+}
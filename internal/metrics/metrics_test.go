@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegistry_OverheadQuantiles(t *testing.T) {
+	r := NewRegistry()
+	if got := r.OverheadQuantile(0.5); got != 0 {
+		t.Errorf("quantile before any observation = %v, want 0", got)
+	}
+	for i := 1; i <= 100; i++ {
+		r.ObserveOverhead(time.Duration(i)*time.Millisecond, time.Millisecond)
+	}
+	if got := r.OverheadQuantile(0.5); got != 50*time.Millisecond {
+		t.Errorf("p50 = %v, want 50ms", got)
+	}
+	if got := r.OverheadQuantile(0.95); got != 95*time.Millisecond {
+		t.Errorf("p95 = %v, want 95ms", got)
+	}
+}
+
+func TestRegistry_OverheadReservoirIsBounded(t *testing.T) {
+	r := NewRegistry()
+	for i := 0; i < 3*overheadReservoirSize; i++ {
+		r.ObserveOverhead(time.Millisecond, 0)
+	}
+	if len(r.overheads) != overheadReservoirSize {
+		t.Errorf("kept %d overheads, want %d", len(r.overheads), overheadReservoirSize)
+	}
+	if r.overheadCount != 3*overheadReservoirSize {
+		t.Errorf("count = %v, want every observation", r.overheadCount)
+	}
+}
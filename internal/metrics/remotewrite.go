@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+// writeTimeout bounds one export so it cannot eat into the log flush budget
+const writeTimeout = 2 * time.Second
+
+// Writer sends samples to a Prometheus remote-write endpoint using the
+// 0.1.0 protocol: a snappy-compressed protobuf WriteRequest
+type Writer struct {
+	url        string
+	username   string
+	password   string
+	tenantID   string
+	labels     map[string]string // attached to every series
+	httpClient *http.Client
+}
+
+// NewWriter creates a writer for PROM_REMOTE_WRITE_URL. labels identify the
+// sandbox and are attached to every series.
+func NewWriter(cfg *config.Config, labels map[string]string) *Writer {
+	return &Writer{
+		url:        cfg.PromRemoteWriteURL,
+		username:   cfg.PromRemoteWriteUsername,
+		password:   cfg.PromRemoteWritePassword,
+		tenantID:   cfg.PromRemoteWriteTenantID,
+		labels:     labels,
+		httpClient: &http.Client{Timeout: writeTimeout},
+	}
+}
+
+// Write exports samples stamped with ts. Failures are not retried: the
+// counters are cumulative, so the next export carries the same information.
+func (w *Writer) Write(ctx context.Context, samples []Sample, ts time.Time) error {
+	body := s2.EncodeSnappy(nil, encodeWriteRequest(samples, w.labels, ts.UnixMilli()))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.username != "" && w.password != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	if w.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", w.tenantID)
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("remote write failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("remote write failed with status %d: %s", resp.StatusCode, string(respBody))
+}
+
+// Protobuf field numbers and wire types from prometheus/prompb
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+
+	fieldWriteRequestTimeseries = 1
+	fieldTimeSeriesLabels       = 1
+	fieldTimeSeriesSamples      = 2
+	fieldLabelName              = 1
+	fieldLabelValue             = 2
+	fieldSampleValue            = 1
+	fieldSampleTimestamp        = 2
+)
+
+// encodeWriteRequest marshals a prompb.WriteRequest with one sample per
+// series. Labels are sorted by name, as remote-write receivers require.
+func encodeWriteRequest(samples []Sample, base map[string]string, tsMillis int64) []byte {
+	var out []byte
+	for _, s := range samples {
+		labels := make(map[string]string, len(base)+len(s.Labels)+1)
+		for k, v := range base {
+			labels[k] = v
+		}
+		for k, v := range s.Labels {
+			labels[k] = v
+		}
+		labels["__name__"] = s.Name
+
+		names := make([]string, 0, len(labels))
+		for k := range labels {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		var series []byte
+		for _, name := range names {
+			var label []byte
+			label = appendString(label, fieldLabelName, name)
+			label = appendString(label, fieldLabelValue, labels[name])
+			series = appendBytes(series, fieldTimeSeriesLabels, label)
+		}
+
+		var sample []byte
+		sample = appendTag(sample, fieldSampleValue, wireFixed64)
+		sample = binary.LittleEndian.AppendUint64(sample, math.Float64bits(s.Value))
+		sample = appendTag(sample, fieldSampleTimestamp, wireVarint)
+		sample = binary.AppendUvarint(sample, uint64(tsMillis))
+		series = appendBytes(series, fieldTimeSeriesSamples, sample)
+
+		out = appendBytes(out, fieldWriteRequestTimeseries, series)
+	}
+	return out
+}
+
+func appendTag(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wireType))
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendString(b []byte, field int, v string) []byte {
+	return appendBytes(b, field, []byte(v))
+}
@@ -0,0 +1,196 @@
+package metrics
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+// decodedSeries is one time series parsed back from a WriteRequest
+type decodedSeries struct {
+	labels    [][2]string
+	value     float64
+	timestamp int64
+}
+
+// readField reads one protobuf field, returning its number, wire type,
+// payload (bytes fields) or scalar (varint/fixed64) and the remainder
+func readField(t *testing.T, b []byte) (int, int, []byte, uint64, []byte) {
+	t.Helper()
+	tag, n := binary.Uvarint(b)
+	if n <= 0 {
+		t.Fatalf("bad tag")
+	}
+	b = b[n:]
+	field, wire := int(tag>>3), int(tag&7)
+	switch wire {
+	case wireVarint:
+		v, n := binary.Uvarint(b)
+		return field, wire, nil, v, b[n:]
+	case wireFixed64:
+		return field, wire, nil, binary.LittleEndian.Uint64(b), b[8:]
+	case wireBytes:
+		l, n := binary.Uvarint(b)
+		b = b[n:]
+		return field, wire, b[:l], 0, b[l:]
+	}
+	t.Fatalf("unexpected wire type %d", wire)
+	return 0, 0, nil, 0, nil
+}
+
+func decodeWriteRequest(t *testing.T, b []byte) []decodedSeries {
+	t.Helper()
+	var out []decodedSeries
+	for len(b) > 0 {
+		var series []byte
+		_, _, series, _, b = readField(t, b)
+		var ds decodedSeries
+		for len(series) > 0 {
+			field, _, payload, _, rest := readField(t, series)
+			series = rest
+			switch field {
+			case fieldTimeSeriesLabels:
+				var name, value []byte
+				_, _, name, _, payload = readField(t, payload)
+				_, _, value, _, _ = readField(t, payload)
+				ds.labels = append(ds.labels, [2]string{string(name), string(value)})
+			case fieldTimeSeriesSamples:
+				for len(payload) > 0 {
+					f, _, _, v, rest := readField(t, payload)
+					payload = rest
+					if f == fieldSampleValue {
+						ds.value = math.Float64frombits(v)
+					} else {
+						ds.timestamp = int64(v)
+					}
+				}
+			}
+		}
+		out = append(out, ds)
+	}
+	return out
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	samples := []Sample{
+		{Name: "lambdawatch_push_total", Labels: map[string]string{"result": "success"}, Value: 3},
+		{Name: "lambdawatch_buffer_entries", Value: 0.5},
+	}
+	base := map[string]string{"function_name": "orders", "instance": "2024/01/01/[$LATEST]abc"}
+
+	got := decodeWriteRequest(t, encodeWriteRequest(samples, base, 1700000000123))
+	if len(got) != 2 {
+		t.Fatalf("got %d series, want 2", len(got))
+	}
+
+	want := [][2]string{
+		{"__name__", "lambdawatch_push_total"},
+		{"function_name", "orders"},
+		{"instance", "2024/01/01/[$LATEST]abc"},
+		{"result", "success"},
+	}
+	if len(got[0].labels) != len(want) {
+		t.Fatalf("labels = %v, want %v", got[0].labels, want)
+	}
+	for i := range want {
+		if got[0].labels[i] != want[i] {
+			t.Errorf("label %d = %v, want %v", i, got[0].labels[i], want[i])
+		}
+	}
+	if got[0].value != 3 || got[0].timestamp != 1700000000123 {
+		t.Errorf("sample = (%v, %d)", got[0].value, got[0].timestamp)
+	}
+	if got[1].value != 0.5 || len(got[1].labels) != 3 {
+		t.Errorf("second series = %+v", got[1])
+	}
+}
+
+func TestWriter_Write(t *testing.T) {
+	var gotHeader http.Header
+	var gotSeries []decodedSeries
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		body, _ := io.ReadAll(r.Body)
+		decoded, err := s2.Decode(nil, body)
+		if err != nil {
+			t.Errorf("body is not snappy: %v", err)
+		}
+		gotSeries = decodeWriteRequest(t, decoded)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	w := NewWriter(&config.Config{
+		PromRemoteWriteURL:      srv.URL,
+		PromRemoteWriteUsername: "user",
+		PromRemoteWritePassword: "pass",
+		PromRemoteWriteTenantID: "team-a",
+	}, map[string]string{"function_name": "orders"})
+
+	r := NewRegistry()
+	r.ObservePush(250*time.Millisecond, nil)
+	r.ObservePush(time.Second, errors.New("boom"))
+
+	if err := w.Write(context.Background(), r.Snapshot(7, 2), time.UnixMilli(1000)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if gotHeader.Get("Content-Encoding") != "snappy" ||
+		gotHeader.Get("Content-Type") != "application/x-protobuf" ||
+		gotHeader.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+		t.Errorf("unexpected headers: %v", gotHeader)
+	}
+	if gotHeader.Get("X-Scope-OrgID") != "team-a" {
+		t.Errorf("X-Scope-OrgID = %q", gotHeader.Get("X-Scope-OrgID"))
+	}
+	if !strings.HasPrefix(gotHeader.Get("Authorization"), "Basic ") {
+		t.Errorf("Authorization = %q", gotHeader.Get("Authorization"))
+	}
+
+	values := map[string]float64{}
+	for _, s := range gotSeries {
+		key := ""
+		for _, l := range s.labels {
+			if l[0] == "__name__" || l[0] == "result" {
+				key += l[1]
+			}
+		}
+		values[key] = s.value
+	}
+	for key, want := range map[string]float64{
+		"lambdawatch_push_totalsuccess":           1,
+		"lambdawatch_push_totalfailure":           1,
+		"lambdawatch_push_duration_seconds_sum":   1.25,
+		"lambdawatch_push_duration_seconds_count": 2,
+		"lambdawatch_entries_dropped_total":       2,
+		"lambdawatch_buffer_entries":              7,
+	} {
+		if values[key] != want {
+			t.Errorf("%s = %v, want %v", key, values[key], want)
+		}
+	}
+}
+
+func TestWriter_WriteError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	w := NewWriter(&config.Config{PromRemoteWriteURL: srv.URL}, nil)
+	err := w.Write(context.Background(), NewRegistry().Snapshot(0, 0), time.Now())
+	if err == nil || !strings.Contains(err.Error(), "status 400") {
+		t.Errorf("Write() error = %v, want status 400", err)
+	}
+}
@@ -0,0 +1,144 @@
+// Package reload fetches settings that can change between invocations
+// from SSM Parameter Store or AWS AppConfig.
+package reload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/sigv4"
+)
+
+const (
+	httpClientTimeout = 2 * time.Second
+
+	// AppConfig's Lambda extension serves configurations locally
+	appConfigEndpoint = "http://localhost:2772"
+)
+
+// Source returns the current settings document (YAML or JSON)
+type Source interface {
+	Fetch(ctx context.Context) ([]byte, error)
+}
+
+// NewSource parses a source spec: ssm:<parameter-name> or
+// appconfig:<application>/<environment>/<profile>
+func NewSource(spec string) (Source, error) {
+	kind, target, ok := strings.Cut(spec, ":")
+	if !ok || target == "" {
+		return nil, fmt.Errorf("invalid reload source %q", spec)
+	}
+
+	switch kind {
+	case "ssm":
+		region := os.Getenv("AWS_REGION")
+		return &ssmSource{
+			name:        target,
+			endpoint:    fmt.Sprintf("https://ssm.%s.amazonaws.com/", region),
+			region:      region,
+			httpClient:  &http.Client{Timeout: httpClientTimeout},
+			credentials: sigv4.CredentialsFromEnv,
+			now:         time.Now,
+		}, nil
+
+	case "appconfig":
+		parts := strings.Split(target, "/")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid appconfig source %q: want application/environment/profile", target)
+		}
+		return &appConfigSource{
+			url: fmt.Sprintf("%s/applications/%s/environments/%s/configurations/%s",
+				appConfigEndpoint, url.PathEscape(parts[0]), url.PathEscape(parts[1]), url.PathEscape(parts[2])),
+			httpClient: &http.Client{Timeout: httpClientTimeout},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown reload source type %q (want ssm or appconfig)", kind)
+}
+
+// ssmSource reads a (possibly SecureString) SSM parameter
+type ssmSource struct {
+	name        string
+	endpoint    string
+	region      string
+	httpClient  *http.Client
+	credentials func() sigv4.Credentials
+	now         func() time.Time
+}
+
+func (s *ssmSource) Fetch(ctx context.Context) ([]byte, error) {
+	creds := s.credentials()
+	if !creds.Valid() {
+		return nil, fmt.Errorf("no AWS credentials available for SSM")
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"Name": s.name, "WithDecryption": true})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSM request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonSSM.GetParameter")
+	sigv4.Sign(req, body, "ssm", s.region, creds, s.now())
+
+	respBody, err := do(s.httpClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("SSM GetParameter %s: %w", s.name, err)
+	}
+
+	var out struct {
+		Parameter struct {
+			Value string `json:"Value"`
+		} `json:"Parameter"`
+	}
+	if err := json.Unmarshal(respBody, &out); err != nil {
+		return nil, fmt.Errorf("failed to parse SSM response: %w", err)
+	}
+	return []byte(out.Parameter.Value), nil
+}
+
+// appConfigSource reads a configuration profile through the AppConfig
+// Lambda extension, which handles polling and caching
+type appConfigSource struct {
+	url        string
+	httpClient *http.Client
+}
+
+func (a *appConfigSource) Fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AppConfig request: %w", err)
+	}
+	body, err := do(a.httpClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("AppConfig fetch: %w", err)
+	}
+	return body, nil
+}
+
+func do(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
@@ -0,0 +1,110 @@
+package reload
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/sigv4"
+)
+
+func TestNewSource(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{"ssm:/lambdawatch/my-function", false},
+		{"appconfig:app/prod/logging", false},
+		{"appconfig:app/prod", true},
+		{"ssm:", true},
+		{"s3:bucket/key", true},
+		{"no-scheme", true},
+	}
+	for _, tt := range tests {
+		_, err := NewSource(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewSource(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSSMSource_Fetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "AmazonSSM.GetParameter" {
+			t.Errorf("unexpected target %q", r.Header.Get("X-Amz-Target"))
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256") {
+			t.Error("expected SigV4-signed request")
+		}
+		var req map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req["Name"] != "/lambdawatch/fn" || req["WithDecryption"] != true {
+			t.Errorf("unexpected request body: %v", req)
+		}
+		_, _ = w.Write([]byte(`{"Parameter":{"Name":"/lambdawatch/fn","Value":"LOG_SAMPLE_RATE: 0.5"}}`))
+	}))
+	defer server.Close()
+
+	src := &ssmSource{
+		name:       "/lambdawatch/fn",
+		endpoint:   server.URL,
+		region:     "us-east-1",
+		httpClient: server.Client(),
+		credentials: func() sigv4.Credentials {
+			return sigv4.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+		},
+		now: time.Now,
+	}
+	data, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() error: %v", err)
+	}
+	if string(data) != "LOG_SAMPLE_RATE: 0.5" {
+		t.Errorf("Fetch() = %q", data)
+	}
+}
+
+func TestSSMSource_NoCredentials(t *testing.T) {
+	src := &ssmSource{credentials: func() sigv4.Credentials { return sigv4.Credentials{} }}
+	if _, err := src.Fetch(context.Background()); err == nil {
+		t.Error("expected error without credentials")
+	}
+}
+
+func TestAppConfigSource_Fetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/applications/app/environments/prod/configurations/logging" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"LOG_FILTER_MIN_LEVEL":"debug"}`))
+	}))
+	defer server.Close()
+
+	src := &appConfigSource{
+		url:        server.URL + "/applications/app/environments/prod/configurations/logging",
+		httpClient: server.Client(),
+	}
+	data, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() error: %v", err)
+	}
+	if string(data) != `{"LOG_FILTER_MIN_LEVEL":"debug"}` {
+		t.Errorf("Fetch() = %q", data)
+	}
+}
+
+func TestAppConfigSource_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	src := &appConfigSource{url: server.URL, httpClient: server.Client()}
+	if _, err := src.Fetch(context.Background()); err == nil {
+		t.Error("expected error on 404")
+	}
+}
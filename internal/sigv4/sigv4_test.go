@@ -0,0 +1,65 @@
+package sigv4
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testCreds = Credentials{
+	AccessKeyID:     "AKIDEXAMPLE",
+	SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+}
+
+var testTime = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+// get-vanilla from the AWS SigV4 test suite
+func TestSign_GetVanilla(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	Sign(req, nil, "service", "us-east-1", testCreds, testTime)
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+	if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+		t.Errorf("X-Amz-Date = %s", got)
+	}
+}
+
+// get-vanilla-query-order-key-case from the AWS SigV4 test suite
+func TestSign_QueryOrder(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/?Param2=value2&Param1=value1", nil)
+	Sign(req, nil, "service", "us-east-1", testCreds, testTime)
+
+	want := "Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"
+	if got := req.Header.Get("Authorization"); !strings.HasSuffix(got, want) {
+		t.Errorf("Authorization = %s, want suffix %s", got, want)
+	}
+}
+
+func TestSign_SessionTokenSigned(t *testing.T) {
+	creds := testCreds
+	creds.SessionToken = "token"
+	req, _ := http.NewRequest(http.MethodPut, "https://bucket.s3.us-east-1.amazonaws.com/key", nil)
+	Sign(req, []byte("body"), "s3", "us-east-1", creds, testTime)
+
+	if req.Header.Get("X-Amz-Security-Token") != "token" {
+		t.Error("expected X-Amz-Security-Token header")
+	}
+	if !strings.Contains(req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-date;x-amz-security-token") {
+		t.Errorf("session token not signed: %s", req.Header.Get("Authorization"))
+	}
+}
+
+func TestCredentials_Valid(t *testing.T) {
+	if (Credentials{}).Valid() {
+		t.Error("empty credentials should be invalid")
+	}
+	if !testCreds.Valid() {
+		t.Error("test credentials should be valid")
+	}
+}
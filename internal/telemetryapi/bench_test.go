@@ -0,0 +1,83 @@
+package telemetryapi
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+)
+
+// benchDelivery returns one second of a function logging n lines in one
+// invocation, as the Telemetry API would deliver them
+func benchDelivery(n int) []TelemetryEvent {
+	start := time.Date(2026, 2, 5, 21, 34, 18, 0, time.UTC)
+	events := make([]TelemetryEvent, 0, n+2)
+	events = append(events, TelemetryEvent{
+		Time:   start.Format(time.RFC3339Nano),
+		Type:   EventTypePlatformStart,
+		Record: map[string]interface{}{"requestId": "req-bench", "version": "$LATEST"},
+	})
+	for i := 0; i < n; i++ {
+		ts := start.Add(time.Duration(i) * time.Second / time.Duration(n))
+		events = append(events, TelemetryEvent{
+			Time:   ts.Format(time.RFC3339Nano),
+			Type:   EventTypeFunction,
+			Record: fmt.Sprintf(`{"level":"info","message":"order processed","order_id":"ord-%d"}`, i),
+		})
+	}
+	return append(events, TelemetryEvent{
+		Time:   start.Add(time.Second).Format(time.RFC3339Nano),
+		Type:   EventTypePlatformRuntimeDone,
+		Record: map[string]interface{}{"requestId": "req-bench", "status": "success"},
+	})
+}
+
+func BenchmarkSplitMessage(b *testing.B) {
+	message := strings.Repeat("a", 256*1024)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(message)))
+	for i := 0; i < b.N; i++ {
+		splitMessage(message, 16*1024)
+	}
+}
+
+// BenchmarkIngest10kEntriesPerSecond turns one second of our heaviest
+// function's telemetry, 10k lines, into buffered entries
+func BenchmarkIngest10kEntriesPerSecond(b *testing.B) {
+	events := benchDelivery(10000)
+	s := NewServer(buffer.New(len(events)), 0, 0, true, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.ingest(events)
+		b.StopTimer()
+		s.buffer.Flush(len(events))
+		b.StartTimer()
+	}
+}
+
+// Allocation budgets for splitting and ingesting. Raising one should be a
+// deliberate decision, not a side effect.
+func TestSplitMessage_AllocBudget(t *testing.T) {
+	message := strings.Repeat("a", 64*1024)
+	chunks, _ := splitMessage(message, 16*1024)
+	allocs := testing.AllocsPerRun(20, func() { splitMessage(message, 16*1024) })
+	// Chunks are substrings, so only the chunk slice is allocated
+	if max := 1.0; allocs > max {
+		t.Errorf("splitMessage allocs = %v for %d chunks, want <= %v", allocs, len(chunks), max)
+	}
+}
+
+func TestIngest_AllocBudget(t *testing.T) {
+	events := benchDelivery(1000)
+	s := NewServer(buffer.New(len(events)), 0, 0, true, nil)
+	allocs := testing.AllocsPerRun(10, func() {
+		s.ingest(events)
+		s.buffer.Flush(len(events))
+	})
+	if perEntry := allocs / float64(len(events)); perEntry > 20 {
+		t.Errorf("ingest allocs per event = %.1f, want <= 20", perEntry)
+	}
+}
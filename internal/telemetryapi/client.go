@@ -12,38 +12,90 @@ import (
 const (
 	extensionIDHeader   = "Lambda-Extension-Identifier"
 	telemetryAPIVersion = "2022-07-01"
+
+	// telemetrySchemaVersion is the newest event schema, which delivers
+	// function logs as structured records under advanced logging controls
+	telemetrySchemaVersion = "2022-12-13"
+)
+
+// Telemetry API buffering defaults and the limits Lambda accepts
+const (
+	DefaultBufferMaxItems  = 1000
+	DefaultBufferMaxBytes  = 262144
+	DefaultBufferTimeoutMs = 100
+
+	minBufferMaxItems  = 1000
+	maxBufferMaxItems  = 10000
+	minBufferMaxBytes  = 262144
+	maxBufferMaxBytes  = 1048576
+	minBufferTimeoutMs = 25
+	maxBufferTimeoutMs = 30000
 )
 
-// Client is a Lambda Telemetry API client
+// API describes a Lambda log subscription API. The Telemetry API and the
+// legacy Logs API accept the same subscription body and deliver the same
+// {time, type, record} envelope, so one client and one receiver serve both.
+type API struct {
+	Name          string // for errors, e.g. "telemetry API"
+	Path          string // endpoint below the runtime API, e.g. "2022-07-01/telemetry"
+	SchemaVersion string
+}
+
+// TelemetryAPI is the Lambda Telemetry API
+var TelemetryAPI = API{
+	Name:          "telemetry API",
+	Path:          telemetryAPIVersion + "/telemetry",
+	SchemaVersion: telemetrySchemaVersion,
+}
+
+// Client subscribes to a Lambda log subscription API
 type Client struct {
-	baseURL     string
-	httpClient  *http.Client
-	extensionID string
+	baseURL       string
+	httpClient    *http.Client
+	extensionID   string
+	buffering     BufferConfig
+	protocol      string
+	name          string
+	schemaVersion string
 }
 
 // NewClient creates a new Telemetry API client
 func NewClient(extensionID string) *Client {
+	return NewAPIClient(extensionID, TelemetryAPI)
+}
+
+// NewAPIClient creates a client subscribing to api
+func NewAPIClient(extensionID string, api API) *Client {
 	runtimeAPI := os.Getenv("AWS_LAMBDA_RUNTIME_API")
 
 	return &Client{
-		baseURL:     fmt.Sprintf("http://%s/%s/telemetry", runtimeAPI, telemetryAPIVersion),
-		httpClient:  &http.Client{},
-		extensionID: extensionID,
+		baseURL:       fmt.Sprintf("http://%s/%s", runtimeAPI, api.Path),
+		httpClient:    &http.Client{},
+		extensionID:   extensionID,
+		name:          api.Name,
+		schemaVersion: api.SchemaVersion,
 	}
 }
 
-// Subscribe subscribes to the Lambda Telemetry API
+// SetBuffering sets how Lambda batches telemetry before delivering it.
+// Zero fields keep the defaults; values outside Lambda's limits are clamped.
+func (c *Client) SetBuffering(b BufferConfig) {
+	c.buffering = b
+}
+
+// SetProtocol sets the destination protocol (HTTP or TCP); HTTP by default
+func (c *Client) SetProtocol(protocol string) {
+	c.protocol = protocol
+}
+
+// Subscribe subscribes listenerURI to the client's API
 func (c *Client) Subscribe(ctx context.Context, listenerURI string) error {
 	req := SubscribeRequest{
-		SchemaVersion: "2022-07-01",
+		SchemaVersion: c.schemaVersionOrDefault(),
 		Types:         []string{"platform", "function", "extension"},
-		Buffering: BufferConfig{
-			MaxItems:  1000,
-			MaxBytes:  262144,
-			TimeoutMs: 100,
-		},
+		Buffering:     c.buffering.normalize(),
 		Destination: Destination{
-			Protocol: "HTTP",
+			Protocol: c.destinationProtocol(),
 			URI:      listenerURI,
 		},
 	}
@@ -63,7 +115,7 @@ func (c *Client) Subscribe(ctx context.Context, listenerURI string) error {
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return fmt.Errorf("failed to subscribe to telemetry API: %w", err)
+		return fmt.Errorf("failed to subscribe to %s: %w", c.nameOrDefault(), err)
 	}
 	defer resp.Body.Close()
 
@@ -73,3 +125,48 @@ func (c *Client) Subscribe(ctx context.Context, listenerURI string) error {
 
 	return nil
 }
+
+// schemaVersionOrDefault and nameOrDefault cover clients built without
+// NewAPIClient, which target the Telemetry API
+func (c *Client) schemaVersionOrDefault() string {
+	if c.schemaVersion == "" {
+		return TelemetryAPI.SchemaVersion
+	}
+	return c.schemaVersion
+}
+
+func (c *Client) nameOrDefault() string {
+	if c.name == "" {
+		return TelemetryAPI.Name
+	}
+	return c.name
+}
+
+func (c *Client) destinationProtocol() string {
+	if c.protocol == "" {
+		return ProtocolHTTP
+	}
+	return c.protocol
+}
+
+// normalize fills unset fields with defaults and clamps the rest to the
+// ranges Lambda accepts, since an out-of-range value fails the subscription
+func (b BufferConfig) normalize() BufferConfig {
+	return BufferConfig{
+		MaxItems:  clamp(b.MaxItems, DefaultBufferMaxItems, minBufferMaxItems, maxBufferMaxItems),
+		MaxBytes:  clamp(b.MaxBytes, DefaultBufferMaxBytes, minBufferMaxBytes, maxBufferMaxBytes),
+		TimeoutMs: clamp(b.TimeoutMs, DefaultBufferTimeoutMs, minBufferTimeoutMs, maxBufferTimeoutMs),
+	}
+}
+
+func clamp(v, def, lo, hi int) int {
+	switch {
+	case v <= 0:
+		return def
+	case v < lo:
+		return lo
+	case v > hi:
+		return hi
+	}
+	return v
+}
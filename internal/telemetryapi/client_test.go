@@ -18,8 +18,8 @@ func TestClient_Subscribe_Success(t *testing.T) {
 		}
 		var req SubscribeRequest
 		_ = json.NewDecoder(r.Body).Decode(&req)
-		if req.SchemaVersion != "2022-07-01" {
-			t.Errorf("expected schema 2022-07-01, got %s", req.SchemaVersion)
+		if req.SchemaVersion != "2022-12-13" {
+			t.Errorf("expected schema 2022-12-13, got %s", req.SchemaVersion)
 		}
 		if len(req.Types) != 3 {
 			t.Errorf("expected 3 types, got %d", len(req.Types))
@@ -79,3 +79,67 @@ func TestClient_Subscribe_NetworkError(t *testing.T) {
 		t.Error("expected error on network failure")
 	}
 }
+
+func TestClient_Subscribe_CustomBuffering(t *testing.T) {
+	var got BufferConfig
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req SubscribeRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		got = req.Buffering
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c := &Client{
+		baseURL:     server.URL,
+		httpClient:  &http.Client{},
+		extensionID: "ext-456",
+	}
+	c.SetBuffering(BufferConfig{MaxItems: 5000, MaxBytes: 524288, TimeoutMs: 25})
+	if err := c.Subscribe(context.Background(), "http://sandbox.localdomain:8080"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != (BufferConfig{MaxItems: 5000, MaxBytes: 524288, TimeoutMs: 25}) {
+		t.Errorf("unexpected buffering: %+v", got)
+	}
+}
+
+func TestBufferConfig_Normalize(t *testing.T) {
+	tests := []struct {
+		in   BufferConfig
+		want BufferConfig
+	}{
+		{BufferConfig{}, BufferConfig{MaxItems: 1000, MaxBytes: 262144, TimeoutMs: 100}},
+		{BufferConfig{MaxItems: 10, MaxBytes: 1024, TimeoutMs: 5}, BufferConfig{MaxItems: 1000, MaxBytes: 262144, TimeoutMs: 25}},
+		{BufferConfig{MaxItems: 50000, MaxBytes: 1 << 24, TimeoutMs: 60000}, BufferConfig{MaxItems: 10000, MaxBytes: 1048576, TimeoutMs: 30000}},
+	}
+	for _, tt := range tests {
+		if got := tt.in.normalize(); got != tt.want {
+			t.Errorf("normalize(%+v) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestClient_Subscribe_TCPProtocol(t *testing.T) {
+	var got Destination
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req SubscribeRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		got = req.Destination
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c := &Client{
+		baseURL:     server.URL,
+		httpClient:  &http.Client{},
+		extensionID: "ext-456",
+	}
+	c.SetProtocol(ProtocolTCP)
+	if err := c.Subscribe(context.Background(), "tcp://sandbox.localdomain:8080"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Protocol != "TCP" || got.URI != "tcp://sandbox.localdomain:8080" {
+		t.Errorf("unexpected destination: %+v", got)
+	}
+}
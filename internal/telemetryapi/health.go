@@ -0,0 +1,101 @@
+package telemetryapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Health is the extension state reported on /health
+type Health struct {
+	Status              string        `json:"status"` // "ok", "degraded" (see Degraded), or "failing" after a failed push
+	Degraded            string        `json:"degraded,omitempty"`
+	BufferDepth         int           `json:"buffer_depth"`
+	LastPushSuccess     *time.Time    `json:"last_push_success,omitempty"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	RecentErrors        []PushFailure `json:"recent_errors,omitempty"`
+}
+
+// PushFailure is a failed Loki push kept for diagnosis
+type PushFailure struct {
+	Time       time.Time `json:"time"`
+	Error      string    `json:"error"`
+	StatusCode int       `json:"status_code,omitempty"` // 0 when no response was received
+	Attempts   int       `json:"attempts"`
+	DurationMs int64     `json:"duration_ms"`
+	Endpoint   string    `json:"endpoint,omitempty"` // credentials redacted
+	Critical   bool      `json:"critical"`
+	Entries    int       `json:"entries"`
+}
+
+// PushStats reports Loki push outcomes for the health endpoint
+type PushStats func() (lastSuccess time.Time, consecutiveFailures int)
+
+// SetPushStats sets the source of push outcomes reported on /health
+func (s *Server) SetPushStats(stats PushStats) {
+	s.pushStats = stats
+}
+
+// SetRecentErrors sets the source of recent push failures reported on /health
+func (s *Server) SetRecentErrors(recent func() []PushFailure) {
+	s.recentErrors = recent
+}
+
+// SetDegraded reports on /health that the extension is running with part
+// of its setup missing, such as a log subscription that failed at INIT.
+// An empty reason clears it.
+func (s *Server) SetDegraded(reason string) {
+	if reason == "" {
+		s.degraded.Store(nil)
+		return
+	}
+	s.degraded.Store(&reason)
+}
+
+// Degraded returns the reason set by SetDegraded, or "" when healthy
+func (s *Server) Degraded() string {
+	if reason := s.degraded.Load(); reason != nil {
+		return *reason
+	}
+	return ""
+}
+
+// health builds the current health report
+func (s *Server) health() Health {
+	h := Health{Status: "ok", BufferDepth: s.buffer.Len()}
+	if s.pushStats != nil {
+		last, failures := s.pushStats()
+		if !last.IsZero() {
+			h.LastPushSuccess = &last
+		}
+		h.ConsecutiveFailures = failures
+		if failures > 0 {
+			h.Status = "failing"
+		}
+	}
+	if reason := s.degraded.Load(); reason != nil {
+		h.Degraded = *reason
+		if h.Status == "ok" {
+			h.Status = "degraded"
+		}
+	}
+	if s.recentErrors != nil {
+		h.RecentErrors = s.recentErrors()
+	}
+	return h
+}
+
+// handleHealth serves GET /health so the function runtime or a canary can
+// detect a wedged extension. Responds 503 while pushes are failing.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h := s.health()
+	w.Header().Set("Content-Type", "application/json")
+	if h.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(h)
+}
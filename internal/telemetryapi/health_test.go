@@ -0,0 +1,88 @@
+package telemetryapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+)
+
+func getHealth(s *Server) (*httptest.ResponseRecorder, Health) {
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var h Health
+	_ = json.Unmarshal(w.Body.Bytes(), &h)
+	return w, h
+}
+
+func TestHealth_ReportsBufferDepth(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.buffer.Add(buffer.LogEntry{Message: "queued"})
+
+	w, h := getHealth(s)
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+	if h.Status != "ok" || h.BufferDepth != 1 || h.LastPushSuccess != nil {
+		t.Errorf("unexpected health %+v", h)
+	}
+}
+
+func TestHealth_ReportsPushFailures(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	last := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.SetPushStats(func() (time.Time, int) { return last, 3 })
+
+	w, h := getHealth(s)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+	if h.Status != "failing" || h.ConsecutiveFailures != 3 {
+		t.Errorf("unexpected health %+v", h)
+	}
+	if h.LastPushSuccess == nil || !h.LastPushSuccess.Equal(last) {
+		t.Errorf("LastPushSuccess = %v, want %v", h.LastPushSuccess, last)
+	}
+}
+
+func TestHealth_ReportsDegraded(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.SetDegraded("not subscribed to Telemetry API")
+
+	w, h := getHealth(s)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+	if h.Status != "degraded" || h.Degraded != "not subscribed to Telemetry API" {
+		t.Errorf("unexpected health %+v", h)
+	}
+
+	s.SetDegraded("")
+	if _, h := getHealth(s); h.Status != "ok" || h.Degraded != "" {
+		t.Errorf("health after recovery = %+v", h)
+	}
+}
+
+func TestHealth_GetOnly(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/health", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want 405", w.Code)
+	}
+}
+
+func TestHealth_ReportsRecentErrors(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.SetRecentErrors(func() []PushFailure {
+		return []PushFailure{{Error: "push failed with status 500", StatusCode: 500, Attempts: 4}}
+	})
+
+	_, h := getHealth(s)
+	if len(h.RecentErrors) != 1 || h.RecentErrors[0].StatusCode != 500 || h.RecentErrors[0].Attempts != 4 {
+		t.Errorf("unexpected recent errors %+v", h.RecentErrors)
+	}
+}
@@ -0,0 +1,218 @@
+package telemetryapi
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+// maxIndexedInvocations bounds the request index; older invocations are
+// forgotten once this many newer ones have started
+const maxIndexedInvocations = 64
+
+// invocationStart is one platform.start seen by the server
+type invocationStart struct {
+	requestID string
+	start     int64 // ms
+	end       int64 // platform.runtimeDone time (ms); 0 while running
+}
+
+// requestIndex remembers when recent invocations started and ended.
+// Invocations in a sandbox never overlap, so an entry belongs to the latest
+// invocation that started at or before its timestamp, however its delivery
+// interleaved with others. Unless sticky, an entry after that invocation's
+// runtimeDone belongs to none.
+type requestIndex struct {
+	mu     sync.RWMutex
+	starts []invocationStart // ordered by start
+	sticky bool              // attribute entries up to the next start, not just to runtimeDone
+}
+
+// add records that requestID started at start (ms). An invocation already
+// indexed keeps the earlier of its two start times.
+func (x *requestIndex) add(requestID string, start int64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var end int64
+	for i, s := range x.starts {
+		if s.requestID != requestID {
+			continue
+		}
+		if start >= s.start {
+			return
+		}
+		end = s.end
+		x.starts = append(x.starts[:i], x.starts[i+1:]...)
+		break
+	}
+	i := sort.Search(len(x.starts), func(i int) bool { return x.starts[i].start > start })
+	x.starts = append(x.starts, invocationStart{})
+	copy(x.starts[i+1:], x.starts[i:])
+	x.starts[i] = invocationStart{requestID: requestID, start: start, end: end}
+	if len(x.starts) > maxIndexedInvocations {
+		x.starts = x.starts[len(x.starts)-maxIndexedInvocations:]
+	}
+}
+
+// finish records requestID's platform.runtimeDone time (ms); 0 is ignored
+func (x *requestIndex) finish(requestID string, end int64) {
+	if end <= 0 {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for i := range x.starts {
+		if x.starts[i].requestID == requestID {
+			x.starts[i].end = end
+			return
+		}
+	}
+}
+
+// lookup returns the request running at ts (ms), or "" if ts is before
+// every indexed invocation or, unless sticky, between two of them.
+// ok is false while nothing has been indexed.
+func (x *requestIndex) lookup(ts int64) (requestID string, ok bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if len(x.starts) == 0 {
+		return "", false
+	}
+	i := sort.Search(len(x.starts), func(i int) bool { return x.starts[i].start > ts })
+	if i == 0 {
+		return "", true
+	}
+	inv := x.starts[i-1]
+	if !x.sticky && inv.end > 0 && ts > inv.end {
+		return "", true
+	}
+	return inv.requestID, true
+}
+
+// isSticky reports whether attribution lasts until the next invocation
+func (x *requestIndex) isSticky() bool {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.sticky
+}
+
+// StartInvocation records an INVOKE event's request ID as the running
+// invocation, starting at now. The Telemetry API may deliver a function's
+// first lines before its platform.start; with the INVOKE known they are not
+// attributed to the previous request. platform.start, when it arrives,
+// corrects the start time to Lambda's own.
+func (s *Server) StartInvocation(requestID string, now time.Time) {
+	if requestID == "" {
+		return
+	}
+	start := now.UnixMilli()
+	s.requestIDMu.Lock()
+	s.currentRequestID = requestID
+	s.requestIDMu.Unlock()
+	s.index.add(requestID, start)
+}
+
+// startOf returns when requestID started (ms), if it is indexed
+func (x *requestIndex) startOf(requestID string) (int64, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	for _, s := range x.starts {
+		if s.requestID == requestID {
+			return s.start, true
+		}
+	}
+	return 0, false
+}
+
+// between reports whether ts (ms) falls after an invocation's runtimeDone
+// and before the next one started. It is always false when sticky.
+func (x *requestIndex) between(ts int64) bool {
+	if ts <= 0 {
+		return false
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	i := sort.Search(len(x.starts), func(i int) bool { return x.starts[i].start > ts })
+	if i == 0 || x.sticky {
+		return false
+	}
+	end := x.starts[i-1].end
+	return end > 0 && ts > end
+}
+
+// SetAttributionWindow selects how long entries are attributed to an
+// invocation: config.AttributionInvocation until its runtimeDone, or
+// config.AttributionSticky until the next invocation starts
+func (s *Server) SetAttributionWindow(window string) {
+	s.index.mu.Lock()
+	s.index.sticky = window == config.AttributionSticky
+	s.index.mu.Unlock()
+}
+
+// endInvocation closes requestID's attribution window at its runtimeDone
+// time (ms): later entries without a request ID of their own belong to no
+// invocation rather than the one that just completed
+func (s *Server) endInvocation(requestID string, end int64) {
+	s.index.finish(requestID, end)
+	if s.index.isSticky() {
+		return
+	}
+	s.requestIDMu.Lock()
+	if s.currentRequestID == requestID {
+		s.currentRequestID = ""
+	}
+	s.requestIDMu.Unlock()
+}
+
+// requestIDAt attributes an event to a request: by the requestId in its
+// record when it has one, otherwise by the index at ts. Events without a
+// usable timestamp, or seen before any platform.start, fall back to the
+// running invocation, if any.
+func (s *Server) requestIDAt(ts int64, record interface{}) string {
+	if recordMap, ok := record.(map[string]interface{}); ok {
+		if id, _ := recordMap["requestId"].(string); id != "" {
+			return id
+		}
+	}
+	if ts > 0 {
+		if id, ok := s.index.lookup(ts); ok {
+			return id
+		}
+	}
+	s.requestIDMu.RLock()
+	defer s.requestIDMu.RUnlock()
+	return s.currentRequestID
+}
+
+// AssignRequestIDs attributes entries that were buffered without a request
+// ID to the invocation running at their timestamp. It runs when a batch is
+// assembled, so entries whose platform.start was delivered after them, and
+// the extension's own log lines, still end up with their invocation.
+func (s *Server) AssignRequestIDs(entries []buffer.LogEntry) {
+	if s == nil {
+		return
+	}
+	s.requestIDMu.RLock()
+	cold := s.coldRequestID
+	s.requestIDMu.RUnlock()
+
+	for i := range entries {
+		e := &entries[i]
+		if e.RequestID != "" || e.Timestamp <= 0 {
+			continue
+		}
+		e.RequestID, _ = s.index.lookup(e.Timestamp)
+		if e.RequestID == "" {
+			continue
+		}
+		if e.Attribute(buffer.AttrTraceID) == "" {
+			e.SetAttribute(buffer.AttrTraceID, s.traceIDFor(e.RequestID))
+		}
+		if e.RequestID == cold {
+			e.SetAttribute(buffer.AttrColdStart, "true")
+		}
+	}
+}
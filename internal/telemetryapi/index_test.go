@@ -0,0 +1,209 @@
+package telemetryapi
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+func TestRequestIndex_Lookup(t *testing.T) {
+	var x requestIndex
+	if _, ok := x.lookup(100); ok {
+		t.Error("empty index should report nothing indexed")
+	}
+
+	// Out of order, as concurrent deliveries may add them
+	x.add("req-2", 200)
+	x.add("req-1", 100)
+	x.add("req-3", 300)
+	x.add("req-2", 250) // duplicate start is ignored
+
+	for ts, want := range map[int64]string{50: "", 100: "req-1", 199: "req-1", 200: "req-2", 299: "req-2", 1000: "req-3"} {
+		if got, ok := x.lookup(ts); !ok || got != want {
+			t.Errorf("lookup(%d) = %q, %v, want %q", ts, got, ok, want)
+		}
+	}
+}
+
+// The INVOKE is indexed when the extension sees it, just after Lambda's
+// platform.start time; the earlier start wins whichever arrives first
+func TestRequestIndex_KeepsEarlierStart(t *testing.T) {
+	var x requestIndex
+	x.add("req-1", 100)
+	x.add("req-2", 305) // INVOKE seen by the extension
+	x.add("req-2", 300) // platform.start delivered later
+
+	if got, _ := x.lookup(302); got != "req-2" {
+		t.Errorf("lookup(302) = %q, want req-2", got)
+	}
+	if len(x.starts) != 2 {
+		t.Errorf("indexed %d invocations, want 2", len(x.starts))
+	}
+}
+
+func TestRequestIndex_ForgetsOldInvocations(t *testing.T) {
+	var x requestIndex
+	for i := 0; i < maxIndexedInvocations+10; i++ {
+		x.add(fmt.Sprintf("req-%d", i), int64(i*10))
+	}
+	if len(x.starts) != maxIndexedInvocations {
+		t.Errorf("indexed %d invocations, want %d", len(x.starts), maxIndexedInvocations)
+	}
+	if got, _ := x.lookup(5); got != "" {
+		t.Errorf("forgotten invocation still found: %q", got)
+	}
+	if got, _ := x.lookup(int64((maxIndexedInvocations+9)*10 + 1)); got != fmt.Sprintf("req-%d", maxIndexedInvocations+9) {
+		t.Errorf("latest invocation = %q", got)
+	}
+}
+
+// A delivery handled after the next invocation's platform.start keeps its
+// lines with the invocation that logged them
+func TestServer_InterleavedDeliveriesKeepRequestIDs(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformStart, Time: "2026-02-05T21:34:18.000Z", Record: map[string]interface{}{"requestId": "req-1"}},
+	})
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformStart, Time: "2026-02-05T21:34:19.000Z", Record: map[string]interface{}{"requestId": "req-2"}},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:19.100Z", Record: "second"},
+	})
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.500Z", Record: "first"},
+		{Type: EventTypePlatformRuntimeDone, Time: "2026-02-05T21:34:18.600Z", Record: map[string]interface{}{"requestId": "req-1", "status": "success"}},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:17.000Z", Record: "init"},
+	})
+
+	want := map[string]string{"second": "req-2", "first": "req-1", "init": ""}
+	for _, e := range s.buffer.Flush(10) {
+		if e.Type == EventTypePlatformRuntimeDone && e.RequestID != "req-1" {
+			t.Errorf("runtimeDone attributed to %q, want req-1", e.RequestID)
+		}
+		if id, ok := want[e.Message]; ok && e.RequestID != id {
+			t.Errorf("%q attributed to %q, want %q", e.Message, e.RequestID, id)
+		}
+	}
+}
+
+func TestServer_AssignRequestIDs(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.SetColdStart("req-1")
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformStart, Time: "2026-02-05T21:34:18.000Z", Record: map[string]interface{}{"requestId": "req-1"}},
+	})
+	start, _ := parseTimestampOK("2026-02-05T21:34:18.000Z")
+
+	entries := []buffer.LogEntry{
+		{Timestamp: start - 10, Message: "before"},
+		{Timestamp: start + 10, Message: "extension line", Type: EventTypeExtension},
+		{Timestamp: start + 20, Message: "explicit", RequestID: "other"},
+	}
+	s.AssignRequestIDs(entries)
+
+	if entries[0].RequestID != "" {
+		t.Errorf("entry before the first invocation attributed to %q", entries[0].RequestID)
+	}
+	if entries[1].RequestID != "req-1" || entries[1].Attribute(buffer.AttrColdStart) != "true" {
+		t.Errorf("extension line = %+v, want req-1 cold start", entries[1])
+	}
+	if entries[2].RequestID != "other" {
+		t.Errorf("explicit request ID overwritten with %q", entries[2].RequestID)
+	}
+
+	var nilServer *Server
+	nilServer.AssignRequestIDs(entries)
+}
+
+// Lines delivered before their invocation's platform.start are attributed
+// to the INVOKE's request, not the previous one
+func TestServer_StartInvocationAttributesEarlyLines(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformStart, Time: "2026-02-05T21:34:18.000Z", Record: map[string]interface{}{"requestId": "req-1"}},
+		{Type: EventTypePlatformRuntimeDone, Time: "2026-02-05T21:34:18.500Z", Record: map[string]interface{}{"requestId": "req-1", "status": "success"}},
+	})
+
+	s.StartInvocation("req-2", time.Date(2026, 2, 5, 21, 34, 19, 0, time.UTC))
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:19.050Z", Record: "early line"},
+		{Type: EventTypeFunction, Record: "untimed line"},
+	})
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformStart, Time: "2026-02-05T21:34:18.990Z", Record: map[string]interface{}{"requestId": "req-2"}},
+	})
+
+	for _, e := range s.buffer.Flush(10) {
+		if e.Type == EventTypeFunction && e.RequestID != "req-2" {
+			t.Errorf("%q attributed to %q, want req-2", e.Message, e.RequestID)
+		}
+	}
+	if got, _ := s.index.lookup(time.Date(2026, 2, 5, 21, 34, 18, 995_000_000, time.UTC).UnixMilli()); got != "req-2" {
+		t.Errorf("platform.start did not move req-2's start earlier, lookup = %q", got)
+	}
+}
+
+func TestRequestIndex_WindowEndsAtRuntimeDone(t *testing.T) {
+	var x requestIndex
+	x.add("req-1", 100)
+	x.finish("req-1", 200)
+	x.add("req-2", 300)
+
+	for ts, want := range map[int64]string{150: "req-1", 200: "req-1", 250: "", 300: "req-2"} {
+		if got, _ := x.lookup(ts); got != want {
+			t.Errorf("lookup(%d) = %q, want %q", ts, got, want)
+		}
+	}
+	if !x.between(250) || x.between(150) || x.between(350) {
+		t.Error("between() should hold only after req-1's runtimeDone and before req-2")
+	}
+
+	x.sticky = true
+	if got, _ := x.lookup(250); got != "req-1" || x.between(250) {
+		t.Errorf("sticky lookup(250) = %q, want req-1", got)
+	}
+}
+
+// Lines logged after runtimeDone, by background work or the extension, are
+// not attributed to the completed invocation, even via the regex fallback
+func TestServer_RuntimeDoneClosesAttribution(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformStart, Time: "2026-02-05T21:34:18.000Z", Record: map[string]interface{}{"requestId": "req-1"}},
+		{Type: EventTypePlatformRuntimeDone, Time: "2026-02-05T21:34:18.500Z", Record: map[string]interface{}{"requestId": "req-1", "status": "success"}},
+	})
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.700Z", Record: "background flush for RequestId: req-0"},
+		{Type: EventTypeFunction, Record: "untimed background line"},
+	})
+
+	for _, e := range s.buffer.Flush(10) {
+		if e.Type == EventTypeFunction && e.RequestID != "" {
+			t.Errorf("%q attributed to %q, want none", e.Message, e.RequestID)
+		}
+	}
+
+	own := []buffer.LogEntry{{Timestamp: time.Date(2026, 2, 5, 21, 34, 18, 800_000_000, time.UTC).UnixMilli(), Message: "extension idle", Internal: true}}
+	s.AssignRequestIDs(own)
+	if own[0].RequestID != "" {
+		t.Errorf("extension line between invocations attributed to %q", own[0].RequestID)
+	}
+}
+
+func TestServer_StickyAttributionWindow(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.SetAttributionWindow(config.AttributionSticky)
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformStart, Time: "2026-02-05T21:34:18.000Z", Record: map[string]interface{}{"requestId": "req-1"}},
+		{Type: EventTypePlatformRuntimeDone, Time: "2026-02-05T21:34:18.500Z", Record: map[string]interface{}{"requestId": "req-1", "status": "success"}},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.700Z", Record: "background line"},
+	})
+
+	for _, e := range s.buffer.Flush(10) {
+		if e.Type == EventTypeFunction && e.RequestID != "req-1" {
+			t.Errorf("%q attributed to %q, want req-1 until the next invocation", e.Message, e.RequestID)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package telemetryapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+)
+
+// fieldAliases maps top-level JSON field names used by common runtimes and
+// logging libraries to the canonical schema
+var fieldAliases = map[string]string{
+	"msg":        "message",
+	"@message":   "message",
+	"ts":         "timestamp",
+	"time":       "timestamp",
+	"@timestamp": "timestamp",
+	"severity":   "level",
+	"levelname":  "level",
+	"lvl":        "level",
+	"@level":     "level",
+}
+
+// jsonField is a top-level field with its value kept verbatim
+type jsonField struct {
+	key   string
+	value json.RawMessage
+}
+
+// normalizeStage renames aliased fields of JSON function logs to their
+// canonical names. Field order and values are preserved; an alias is left
+// alone when the canonical field is already present.
+func normalizeStage() Stage {
+	return func(entry *buffer.LogEntry) bool {
+		if isFilterable(entry) {
+			entry.Message = normalizeJSON(entry.Message)
+		}
+		return true
+	}
+}
+
+// normalizeJSON returns message with aliased top-level keys renamed, or
+// message unchanged if it is not a JSON object or has nothing to rename
+func normalizeJSON(message string) string {
+	if !strings.HasPrefix(message, "{") {
+		return message
+	}
+	fields, ok := parseObject(message)
+	if !ok {
+		return message
+	}
+
+	present := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		present[f.key] = true
+	}
+
+	renamed := false
+	for i, f := range fields {
+		canonical, ok := fieldAliases[f.key]
+		if !ok || present[canonical] {
+			continue
+		}
+		fields[i].key = canonical
+		present[canonical] = true
+		renamed = true
+	}
+	if !renamed {
+		return message
+	}
+
+	return encodeObject(fields)
+}
+
+// encodeObject writes fields back out as a compact JSON object
+func encodeObject(fields []jsonField) string {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(f.encode())
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+// encode returns the field as "key":value
+func (f jsonField) encode() string {
+	key, _ := json.Marshal(f.key)
+	return string(key) + ":" + string(f.value)
+}
+
+// parseObject splits a JSON object into its top-level fields in order
+func parseObject(message string) ([]jsonField, bool) {
+	dec := json.NewDecoder(strings.NewReader(message))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, false
+	}
+
+	var fields []jsonField
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, false
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, false
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, false
+		}
+		fields = append(fields, jsonField{key: key, value: value})
+	}
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('}') {
+		return nil, false
+	}
+	// Reject trailing content after the object
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, false
+	}
+	return fields, true
+}
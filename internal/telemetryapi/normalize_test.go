@@ -0,0 +1,57 @@
+package telemetryapi
+
+import (
+	"testing"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+func TestNormalizeJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"renames aliases in place",
+			`{"ts":1700000000.5,"severity":"ERROR","msg":"boom","user":{"id":7}}`,
+			`{"timestamp":1700000000.5,"level":"ERROR","message":"boom","user":{"id":7}}`},
+		{"canonical field wins",
+			`{"message":"kept","msg":"alias"}`,
+			`{"message":"kept","msg":"alias"}`},
+		{"first alias wins",
+			`{"time":"t1","@timestamp":"t2"}`,
+			`{"timestamp":"t1","@timestamp":"t2"}`},
+		{"nested fields untouched",
+			`{"detail":{"msg":"x"}}`,
+			`{"detail":{"msg":"x"}}`},
+		{"plain text", "msg=hello", "msg=hello"},
+		{"invalid JSON", `{"msg":`, `{"msg":`},
+		{"trailing content", `{"msg":"a"} extra`, `{"msg":"a"} extra`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeJSON(tt.in); got != tt.want {
+				t.Errorf("normalizeJSON(%s)\n got %s\nwant %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipeline_NormalizeJSON(t *testing.T) {
+	p, err := NewPipeline(&config.Config{LogNormalizeJSON: true, LogSampleRate: 1})
+	if err != nil {
+		t.Fatalf("NewPipeline() error = %v", err)
+	}
+	entries := []buffer.LogEntry{
+		fnEntry(`{"msg":"hello"}`),
+		{Type: EventTypeExtension, Message: `{"msg":"other extension"}`},
+	}
+	got := p.Process(entries)
+	if got[0].Message != `{"message":"hello"}` {
+		t.Errorf("function log not normalized: %s", got[0].Message)
+	}
+	if got[1].Message != `{"msg":"other extension"}` {
+		t.Errorf("extension log should be left alone: %s", got[1].Message)
+	}
+}
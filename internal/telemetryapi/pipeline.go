@@ -0,0 +1,170 @@
+package telemetryapi
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+// Stage inspects an entry before it is buffered. Returning false drops it.
+// Stages may modify the entry in place.
+type Stage func(entry *buffer.LogEntry) bool
+
+// Pipeline runs entries through an ordered list of stages before buffering
+type Pipeline struct {
+	stages []Stage
+}
+
+// logLevels orders the levels understood by the min-level filter
+var logLevels = map[string]int{
+	"trace": 0, "debug": 1, "info": 2, "warn": 3, "warning": 3,
+	"error": 4, "fatal": 5, "critical": 5, "panic": 5,
+}
+
+// NewPipeline builds the filter, sampling, normalization and redaction
+// stages from config. UTF-8 sanitization always runs last, except for
+// wrapping plain text in JSON, which needs the sanitized line.
+func NewPipeline(cfg *config.Config) (*Pipeline, error) {
+	p := &Pipeline{}
+
+	if cfg.LogFilterExclude != "" {
+		re, err := regexp.Compile(cfg.LogFilterExclude)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LOG_FILTER_EXCLUDE: %w", err)
+		}
+		p.Add(excludeStage(re))
+	}
+
+	if cfg.LogFilterMinLevel != "" {
+		minLevel, ok := logLevels[strings.ToLower(cfg.LogFilterMinLevel)]
+		if !ok {
+			return nil, fmt.Errorf("invalid LOG_FILTER_MIN_LEVEL: %q", cfg.LogFilterMinLevel)
+		}
+		p.Add(minLevelStage(minLevel))
+	}
+
+	if cfg.LogSampleRate < 1 {
+		p.Add(sampleStage(cfg.LogSampleRate, rand.Float64))
+	}
+
+	if cfg.LogNormalizeJSON {
+		p.Add(normalizeStage())
+	}
+
+	// Redact last so dropped entries are never scanned
+	if cfg.LogRedactBuiltin || len(cfg.LogRedactPatterns) > 0 {
+		rules, err := newRedactionRules(cfg.LogRedactPatterns, cfg.LogRedactBuiltin)
+		if err != nil {
+			return nil, err
+		}
+		p.Add(redactStage(rules))
+	}
+
+	p.Add(sanitizeStage(cfg.LogBinaryBase64))
+
+	if cfg.WrapPlaintextJSON {
+		p.Add(wrapStage())
+	}
+
+	return p, nil
+}
+
+// Add appends a stage to the pipeline
+func (p *Pipeline) Add(stage Stage) {
+	p.stages = append(p.stages, stage)
+}
+
+// Process runs entries through every stage, returning the survivors.
+// The input slice is reused for the result.
+func (p *Pipeline) Process(entries []buffer.LogEntry) []buffer.LogEntry {
+	if p == nil || len(p.stages) == 0 {
+		return entries
+	}
+
+	kept := entries[:0]
+	for i := range entries {
+		if p.keep(&entries[i]) {
+			kept = append(kept, entries[i])
+		}
+	}
+	return kept
+}
+
+func (p *Pipeline) keep(entry *buffer.LogEntry) bool {
+	for _, stage := range p.stages {
+		if !stage(entry) {
+			return false
+		}
+	}
+	return true
+}
+
+// isFilterable reports whether an entry is a function log line. Platform
+// events and extension logs are never filtered or sampled.
+func isFilterable(entry *buffer.LogEntry) bool {
+	return entry.Type == EventTypeFunction
+}
+
+// excludeStage drops function logs whose message matches re
+func excludeStage(re *regexp.Regexp) Stage {
+	return func(entry *buffer.LogEntry) bool {
+		return !isFilterable(entry) || !re.MatchString(entry.Message)
+	}
+}
+
+// minLevelStage drops function logs below the given level. Lines whose level
+// cannot be determined are kept.
+func minLevelStage(minLevel int) Stage {
+	return func(entry *buffer.LogEntry) bool {
+		if !isFilterable(entry) {
+			return true
+		}
+		name := entry.Attribute(buffer.AttrLevel)
+		if name == "" {
+			name = messageLevel(entry.Message)
+		}
+		level, ok := logLevels[name]
+		return !ok || level >= minLevel
+	}
+}
+
+// sampleStage keeps roughly rate of function logs. High-priority entries
+// (errors) are always kept.
+func sampleStage(rate float64, random func() float64) Stage {
+	return func(entry *buffer.LogEntry) bool {
+		if !isFilterable(entry) || entry.Priority >= buffer.PriorityHigh {
+			return true
+		}
+		return random() < rate
+	}
+}
+
+// messageLevel returns the lowercase log level of a message, from a JSON
+// level field or Lambda's tab-separated "\tLEVEL\t" column. Returns "" if unknown.
+func messageLevel(message string) string {
+	return recordLevel(message, parseJSONFields(message))
+}
+
+// recordLevel is messageLevel for a message whose JSON fields, if any, have
+// already been parsed
+func recordLevel(message string, fields map[string]interface{}) string {
+	if fields != nil {
+		for _, name := range []string{"level", "levelname", "severity"} {
+			if level, ok := fields[name].(string); ok {
+				return strings.ToLower(level)
+			}
+		}
+		return ""
+	}
+
+	for _, part := range strings.SplitN(message, "\t", 4) {
+		if _, ok := logLevels[strings.ToLower(part)]; ok {
+			return strings.ToLower(part)
+		}
+	}
+	return ""
+}
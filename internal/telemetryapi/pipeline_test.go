@@ -0,0 +1,98 @@
+package telemetryapi
+
+import (
+	"testing"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+func fnEntry(msg string) buffer.LogEntry {
+	return buffer.LogEntry{Type: EventTypeFunction, Message: msg}
+}
+
+func TestNewPipeline_Empty(t *testing.T) {
+	p, err := NewPipeline(&config.Config{LogSampleRate: 1})
+	if err != nil {
+		t.Fatalf("NewPipeline() error = %v", err)
+	}
+	entries := []buffer.LogEntry{fnEntry("a"), fnEntry("b")}
+	if got := p.Process(entries); len(got) != 2 {
+		t.Errorf("expected all entries kept, got %d", len(got))
+	}
+}
+
+func TestNewPipeline_InvalidConfig(t *testing.T) {
+	if _, err := NewPipeline(&config.Config{LogFilterExclude: "(", LogSampleRate: 1}); err == nil {
+		t.Error("expected error for invalid regex")
+	}
+	if _, err := NewPipeline(&config.Config{LogFilterMinLevel: "loud", LogSampleRate: 1}); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
+
+func TestPipeline_ExcludeRegex(t *testing.T) {
+	p, _ := NewPipeline(&config.Config{LogFilterExclude: `health-?check`, LogSampleRate: 1})
+	entries := []buffer.LogEntry{
+		fnEntry("GET /healthcheck 200"),
+		fnEntry("GET /orders 200"),
+		{Type: EventTypePlatformStart, Message: "START healthcheck"},
+	}
+	got := p.Process(entries)
+	if len(got) != 2 || got[0].Message != "GET /orders 200" {
+		t.Errorf("unexpected result: %+v", got)
+	}
+}
+
+func TestPipeline_MinLevel(t *testing.T) {
+	p, _ := NewPipeline(&config.Config{LogFilterMinLevel: "warn", LogSampleRate: 1})
+	entries := []buffer.LogEntry{
+		fnEntry(`{"level":"debug","msg":"a"}`),
+		fnEntry(`{"level":"WARN","msg":"b"}`),
+		fnEntry("2026-02-05T08:12:42.944Z\treq\tINFO\tc"),
+		fnEntry("2026-02-05T08:12:42.944Z\treq\tERROR\td"),
+		fnEntry("no level at all"),
+		{Type: EventTypeExtension, Message: `{"level":"debug"}`},
+	}
+	got := p.Process(entries)
+	if len(got) != 4 {
+		t.Fatalf("expected 4 entries kept, got %d: %+v", len(got), got)
+	}
+}
+
+func TestSampleStage(t *testing.T) {
+	values := []float64{0.1, 0.9}
+	i := 0
+	random := func() float64 { v := values[i%len(values)]; i++; return v }
+	stage := sampleStage(0.5, random)
+
+	keep := fnEntry("a")
+	drop := fnEntry("b")
+	errEntry := fnEntry("c")
+	errEntry.Priority = buffer.PriorityHigh
+
+	if !stage(&keep) {
+		t.Error("expected entry under rate to be kept")
+	}
+	if stage(&drop) {
+		t.Error("expected entry over rate to be dropped")
+	}
+	if !stage(&errEntry) {
+		t.Error("expected high-priority entry to always be kept")
+	}
+}
+
+func TestServer_AppliesPipeline(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	p, _ := NewPipeline(&config.Config{LogFilterExclude: "noise", LogSampleRate: 1})
+	s.SetPipeline(p)
+
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.835Z", Record: "noise"},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.835Z", Record: "signal"},
+	})
+	entries := s.buffer.Flush(10)
+	if len(entries) != 1 || entries[0].Message != "signal" {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+}
@@ -0,0 +1,93 @@
+package telemetryapi
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+)
+
+const redacted = "[REDACTED]"
+
+// redactionRule replaces matches of pattern. If valid is set, only matches
+// it accepts are replaced (used to Luhn-check card numbers).
+type redactionRule struct {
+	pattern *regexp.Regexp
+	replace string
+	valid   func(match string) bool
+}
+
+// builtinRedactions cover common secrets and PII found in application logs
+var builtinRedactions = []redactionRule{
+	// Email addresses
+	{pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), replace: redacted},
+	// Payment card numbers (13-19 digits, optional space/dash separators)
+	{pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), replace: redacted, valid: luhnValid},
+	// AWS access key IDs
+	{pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), replace: redacted},
+	// AWS secret access keys when labelled as such
+	{pattern: regexp.MustCompile(`(?i)(aws_?secret_?access_?key["']?\s*[:=]\s*["']?)[A-Za-z0-9/+=]{40}`), replace: "${1}" + redacted},
+	// Bearer tokens
+	{pattern: regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9\-._~+/]+=*`), replace: "${1}" + redacted},
+}
+
+// redactStage scrubs every entry's message with the given rules
+func redactStage(rules []redactionRule) Stage {
+	return func(entry *buffer.LogEntry) bool {
+		entry.Message = redact(entry.Message, rules)
+		return true
+	}
+}
+
+// newRedactionRules compiles user patterns, optionally prefixed by the built-ins
+func newRedactionRules(patterns []string, builtin bool) ([]redactionRule, error) {
+	var rules []redactionRule
+	if builtin {
+		rules = append(rules, builtinRedactions...)
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LOG_REDACT_PATTERNS entry %q: %w", p, err)
+		}
+		rules = append(rules, redactionRule{pattern: re, replace: redacted})
+	}
+	return rules, nil
+}
+
+func redact(message string, rules []redactionRule) string {
+	for _, rule := range rules {
+		if rule.valid == nil {
+			message = rule.pattern.ReplaceAllString(message, rule.replace)
+			continue
+		}
+		message = rule.pattern.ReplaceAllStringFunc(message, func(match string) string {
+			if rule.valid(match) {
+				return rule.replace
+			}
+			return match
+		})
+	}
+	return message
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
@@ -0,0 +1,79 @@
+package telemetryapi
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+)
+
+// EventTypeReportMetrics is the entry type and stream label value of
+// structured platform.report entries
+const EventTypeReportMetrics = "report_metrics"
+
+// ReportMetrics are the numeric fields of a platform.report record
+type ReportMetrics struct {
+	RequestID            string  `json:"request_id"`
+	Status               string  `json:"status,omitempty"`
+	DurationMs           float64 `json:"duration_ms"`
+	BilledDurationMs     float64 `json:"billed_duration_ms"`
+	MemorySizeMB         float64 `json:"memory_size_mb"`
+	MaxMemoryUsedMB      float64 `json:"max_memory_used_mb"`
+	MemoryUtilizationPct float64 `json:"memory_utilization_pct"`
+	InitDurationMs       float64 `json:"init_duration_ms"`
+	ColdStart            bool    `json:"cold_start"`
+}
+
+// ReportHandler receives the metrics of every platform.report event
+type ReportHandler func(ReportMetrics)
+
+// SetReportHandler sets the handler called with each invocation's
+// platform.report metrics
+func (s *Server) SetReportHandler(h ReportHandler) {
+	s.onReport = h
+}
+
+// EnableReportMetrics emits each platform.report as a JSON entry with
+// numeric fields, in its own stream labelled type=report_metrics, next to
+// the textual REPORT line
+func (s *Server) EnableReportMetrics() {
+	s.reportMetrics = true
+}
+
+// parseReportMetrics extracts the metrics of a platform.report record.
+// ok is false if the record has no request ID or metrics. Only cold starts
+// report initDurationMs, so its presence sets ColdStart.
+func parseReportMetrics(record interface{}) (ReportMetrics, bool) {
+	recordMap, _ := record.(map[string]interface{})
+	requestID, _ := recordMap["requestId"].(string)
+	metrics, ok := recordMap["metrics"].(map[string]interface{})
+	if requestID == "" || !ok {
+		return ReportMetrics{}, false
+	}
+
+	m := ReportMetrics{RequestID: requestID}
+	m.Status, _ = recordMap["status"].(string)
+	m.DurationMs, _ = metrics["durationMs"].(float64)
+	m.BilledDurationMs, _ = metrics["billedDurationMs"].(float64)
+	m.MemorySizeMB, _ = metrics["memorySizeMB"].(float64)
+	m.MaxMemoryUsedMB, _ = metrics["maxMemoryUsedMB"].(float64)
+	m.InitDurationMs, _ = metrics["initDurationMs"].(float64)
+	m.ColdStart = m.InitDurationMs > 0
+	if m.MemorySizeMB > 0 {
+		m.MemoryUtilizationPct = math.Round(m.MaxMemoryUsedMB/m.MemorySizeMB*10000) / 100
+	}
+	return m, true
+}
+
+// reportMetricsEntry renders report metrics as a log entry
+func reportMetricsEntry(m ReportMetrics, ts int64) buffer.LogEntry {
+	body, _ := json.Marshal(m)
+	// RequestID is left empty: the body already carries request_id, so
+	// the batch must not inject it a second time
+	return buffer.LogEntry{
+		Timestamp:    ts,
+		Message:      string(body),
+		Type:         EventTypeReportMetrics,
+		StreamLabels: map[string]string{"type": EventTypeReportMetrics},
+	}
+}
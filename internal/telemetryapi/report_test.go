@@ -0,0 +1,83 @@
+package telemetryapi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func reportEvent(requestID string, metrics map[string]interface{}) TelemetryEvent {
+	return TelemetryEvent{
+		Type:   EventTypePlatformReport,
+		Time:   "2026-02-05T21:34:20.458Z",
+		Record: map[string]interface{}{"requestId": requestID, "status": "success", "metrics": metrics},
+	}
+}
+
+func TestServer_ReportMetricsEntry(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.EnableReportMetrics()
+	postEvents(s, []TelemetryEvent{reportEvent("abc-123", map[string]interface{}{
+		"durationMs":       2251.86,
+		"billedDurationMs": 2252.0,
+		"memorySizeMB":     1024.0,
+		"maxMemoryUsedMB":  184.0,
+		"initDurationMs":   861.71,
+	})})
+
+	entries := s.buffer.Flush(10)
+	if len(entries) != 2 {
+		t.Fatalf("expected REPORT line and metrics entry, got %d entries", len(entries))
+	}
+	entry := entries[1]
+	if entry.Type != EventTypeReportMetrics || entry.StreamLabels["type"] != EventTypeReportMetrics {
+		t.Errorf("unexpected type %q / labels %v", entry.Type, entry.StreamLabels)
+	}
+	if entry.Timestamp != entries[0].Timestamp {
+		t.Errorf("timestamp = %d, want the report's %d", entry.Timestamp, entries[0].Timestamp)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(entry.Message), &got); err != nil {
+		t.Fatalf("entry is not JSON: %v", err)
+	}
+	for key, want := range map[string]interface{}{
+		"request_id":             "abc-123",
+		"duration_ms":            2251.86,
+		"max_memory_used_mb":     184.0,
+		"memory_utilization_pct": 17.97,
+		"cold_start":             true,
+	} {
+		if got[key] != want {
+			t.Errorf("%s = %v, want %v", key, got[key], want)
+		}
+	}
+}
+
+func TestServer_ReportMetricsDisabledByDefault(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	postEvents(s, []TelemetryEvent{reportEvent("abc-123", map[string]interface{}{"durationMs": 1.0})})
+
+	for _, e := range s.buffer.Flush(10) {
+		if e.Type == EventTypeReportMetrics {
+			t.Fatal("report metrics entry emitted without EnableReportMetrics")
+		}
+	}
+}
+
+func TestServer_ReportHandler(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	var got []ReportMetrics
+	s.SetReportHandler(func(m ReportMetrics) { got = append(got, m) })
+
+	postEvents(s, []TelemetryEvent{
+		reportEvent("warm-1", map[string]interface{}{"durationMs": 12.5, "memorySizeMB": 128.0, "maxMemoryUsedMB": 64.0}),
+		{Type: EventTypePlatformReport, Record: map[string]interface{}{"requestId": "no-metrics"}},
+	})
+
+	if len(got) != 1 {
+		t.Fatalf("handler called %d times, want 1", len(got))
+	}
+	if got[0].ColdStart || got[0].DurationMs != 12.5 || got[0].MemoryUtilizationPct != 50 {
+		t.Errorf("unexpected metrics %+v", got[0])
+	}
+}
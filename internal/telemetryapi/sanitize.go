@@ -0,0 +1,62 @@
+package telemetryapi
+
+import (
+	"encoding/base64"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+)
+
+// binaryThreshold is the share of invalid or control bytes above which a
+// record is treated as binary rather than text with a few bad sequences
+const binaryThreshold = 0.1
+
+// encodingLabel marks entries whose message was base64-encoded
+const encodingLabel = "encoding"
+
+// sanitizeStage makes every message valid UTF-8, since Loki rejects the
+// whole push with a 400 if any line is not. Invalid sequences are replaced
+// with U+FFFD; with encodeBinary set, binary-looking records are instead
+// base64-encoded and labelled encoding="base64" so they can be recovered.
+func sanitizeStage(encodeBinary bool) Stage {
+	return func(entry *buffer.LogEntry) bool {
+		if encodeBinary && looksBinary(entry.Message) {
+			entry.Message = base64.StdEncoding.EncodeToString([]byte(entry.Message))
+			labels := make(map[string]string, len(entry.StreamLabels)+1)
+			for k, v := range entry.StreamLabels {
+				labels[k] = v
+			}
+			labels[encodingLabel] = "base64"
+			entry.StreamLabels = labels
+			return true
+		}
+		if !utf8.ValidString(entry.Message) {
+			entry.Message = strings.ToValidUTF8(entry.Message, "\uFFFD")
+		}
+		return true
+	}
+}
+
+// looksBinary reports whether message contains a NUL byte or more than
+// binaryThreshold of invalid UTF-8 and control bytes (other than tab and
+// line breaks)
+func looksBinary(message string) bool {
+	if message == "" {
+		return false
+	}
+	bad := 0
+	for i := 0; i < len(message); {
+		r, size := utf8.DecodeRuneInString(message[i:])
+		switch {
+		case r == 0:
+			return true
+		case r == utf8.RuneError && size == 1:
+			bad++
+		case r < ' ' && r != '\t' && r != '\n' && r != '\r':
+			bad++
+		}
+		i += size
+	}
+	return float64(bad)/float64(len(message)) > binaryThreshold
+}
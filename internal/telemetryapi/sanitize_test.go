@@ -0,0 +1,92 @@
+package telemetryapi
+
+import (
+	"encoding/base64"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+func TestSanitizeStage_ReplacesInvalidUTF8(t *testing.T) {
+	stage := sanitizeStage(false)
+	entry := fnEntry("caf\xc3 ok \xff")
+	stage(&entry)
+	if !utf8.ValidString(entry.Message) {
+		t.Fatalf("message still invalid: %q", entry.Message)
+	}
+	if entry.Message != "caf\uFFFD ok \uFFFD" {
+		t.Errorf("Message = %q", entry.Message)
+	}
+}
+
+func TestSanitizeStage_ValidUnchanged(t *testing.T) {
+	stage := sanitizeStage(true)
+	entry := fnEntry("héllo\twörld\n")
+	stage(&entry)
+	if entry.Message != "héllo\twörld\n" || entry.StreamLabels != nil {
+		t.Errorf("valid text modified: %q %v", entry.Message, entry.StreamLabels)
+	}
+}
+
+func TestSanitizeStage_Base64EncodesBinary(t *testing.T) {
+	raw := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	stage := sanitizeStage(true)
+	entry := buffer.LogEntry{
+		Type:         EventTypeFunction,
+		Message:      raw,
+		StreamLabels: map[string]string{"error": "true"},
+	}
+	labels := entry.StreamLabels
+	stage(&entry)
+
+	decoded, err := base64.StdEncoding.DecodeString(entry.Message)
+	if err != nil || string(decoded) != raw {
+		t.Errorf("message not base64 of original: %q", entry.Message)
+	}
+	if entry.StreamLabels["encoding"] != "base64" || entry.StreamLabels["error"] != "true" {
+		t.Errorf("StreamLabels = %v", entry.StreamLabels)
+	}
+	if _, ok := labels["encoding"]; ok {
+		t.Error("shared label map must not be modified")
+	}
+}
+
+func TestSanitizeStage_BinaryReplacedWhenEncodingDisabled(t *testing.T) {
+	stage := sanitizeStage(false)
+	entry := fnEntry("\x00\xff\xfe")
+	stage(&entry)
+	if !utf8.ValidString(entry.Message) || entry.StreamLabels != nil {
+		t.Errorf("unexpected result %q %v", entry.Message, entry.StreamLabels)
+	}
+}
+
+func TestLooksBinary(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"", false},
+		{"plain text line", false},
+		{"one bad byte \xff in a long enough line of otherwise normal text", false},
+		{"nul\x00byte", true},
+		{"\xff\xfe\xfd\x01\x02abc", true},
+	}
+	for _, tt := range tests {
+		if got := looksBinary(tt.in); got != tt.want {
+			t.Errorf("looksBinary(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPipeline_AlwaysSanitizes(t *testing.T) {
+	p, err := NewPipeline(&config.Config{LogSampleRate: 1})
+	if err != nil {
+		t.Fatalf("NewPipeline() error = %v", err)
+	}
+	got := p.Process([]buffer.LogEntry{{Type: EventTypePlatformReport, Message: "bad \xc3"}})
+	if !utf8.ValidString(got[0].Message) {
+		t.Errorf("pipeline left invalid UTF-8: %q", got[0].Message)
+	}
+}
@@ -3,12 +3,17 @@ package telemetryapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"regexp"
+	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
@@ -17,28 +22,79 @@ import (
 
 var requestIDRegex = regexp.MustCompile(`(?i)RequestId:\s*([a-f0-9-]+)`)
 
-// Skip our own extension logs - they're already added to buffer by the logger
-const ownExtensionMarker = `"context":"LambdaWatch"`
+// RuntimeDoneHandler is called when platform.runtimeDone is received, with
+// the invocation's status (success, failure, timeout)
+type RuntimeDoneHandler func(requestID, status string)
 
-// RuntimeDoneHandler is called when platform.runtimeDone is received
-type RuntimeDoneHandler func(requestID string)
+// InitDoneHandler is called when platform.initRuntimeDone or
+// platform.restoreRuntimeDone is received
+type InitDoneHandler func(status string)
 
-// Server is an HTTP server that receives telemetry from Lambda
+// ListenerFailureHandler is called when the receiver's listener stops
+// with an error; the receiver no longer accepts deliveries until restarted
+type ListenerFailureHandler func(err error)
+
+// PanicHandler is called after a panic while handling a delivery has been
+// recovered, with the recovered value
+type PanicHandler func(recovered interface{})
+
+// Server receives telemetry from Lambda over HTTP or TCP
 type Server struct {
 	server           *http.Server
+	protocol         string
+	listener         net.Listener // set when protocol is HTTP; guarded by listenMu
+	tcp              *tcpReceiver // set when protocol is TCP; guarded by listenMu
+	listenMu         sync.Mutex
+	closed           bool                   // set by Shutdown; guarded by listenMu
+	onListenerFail   ListenerFailureHandler // nil until SetListenerFailureHandler
 	buffer           *buffer.Buffer
-	port             int
+	basePort         int // configured port, probed upward from when taken
+	portProbe        int // extra ports tried after basePort
+	port             int // port actually listened on; guarded by listenMu
 	maxLineSize      int
+	maxBodyBytes     int64 // deliveries with a larger body are refused (0 = no limit)
 	extractRequestID bool
 	onRuntimeDone    RuntimeDoneHandler
-	currentRequestID string
+	onInitDone       InitDoneHandler
+	onPanic          PanicHandler // nil until SetPanicHandler
+	pipeline         atomic.Pointer[Pipeline]
+	summaries        *invocationTracker     // nil unless invocation summaries are enabled
+	reportMetrics    bool                   // emit structured platform.report entries
+	endLines         bool                   // emit CloudWatch END lines
+	endAtPlatformEnd bool                   // take END lines from the Logs API's platform.end
+	traceContext     bool                   // read traceparent, span IDs and plain-text X-Ray headers
+	tail             *tailSampler           // nil unless tail sampling is enabled
+	onReport         ReportHandler          // nil until SetReportHandler
+	pushStats        PushStats              // nil until SetPushStats
+	recentErrors     func() []PushFailure   // nil until SetRecentErrors
+	onVerify         VerifyHandler          // nil until SetVerifyHandler
+	degraded         atomic.Pointer[string] // why the extension runs degraded; nil when healthy
+	currentRequestID string                 // invocation running now, "" between invocations; guarded by requestIDMu
 	requestIDMu      sync.RWMutex
+	index            requestIndex // invocation start times, for attributing entries
+
+	// Trace ID of the most recent invocation, keyed by its request ID.
+	// Guarded by requestIDMu.
+	traceRequestID string
+	traceID        string
+
+	// Request ID of the sandbox's first invocation. Guarded by requestIDMu.
+	coldRequestID string
+
+	// Latest invocation that failed or timed out and its runtimeDone
+	// status. Guarded by requestIDMu.
+	failedRequestID string
+	failedOutcome   string
+
+	// Request ID of the latest platform.report. Guarded by requestIDMu.
+	reportedRequestID string
 }
 
 // NewServer creates a new telemetry receiver server
 func NewServer(buf *buffer.Buffer, port int, maxLineSize int, extractRequestID bool, onRuntimeDone RuntimeDoneHandler) *Server {
 	s := &Server{
 		buffer:           buf,
+		basePort:         port,
 		port:             port,
 		maxLineSize:      maxLineSize,
 		extractRequestID: extractRequestID,
@@ -47,156 +103,697 @@ func NewServer(buf *buffer.Buffer, port int, maxLineSize int, extractRequestID b
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handleTelemetry)
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/verify", s.handleVerify)
 
-	s.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
-		Handler: mux,
-	}
+	s.server = &http.Server{Handler: mux}
 
 	return s
 }
 
-// Start starts the HTTP server
+// SetProtocol selects the HTTP or TCP receiver. Must be called before Start.
+func (s *Server) SetProtocol(protocol string) {
+	s.protocol = protocol
+}
+
+// SetMaxBodyBytes refuses HTTP deliveries whose body exceeds limit bytes
+// (0 = no limit), whether declared up front or found while reading. Must be
+// called before Start.
+func (s *Server) SetMaxBodyBytes(limit int) {
+	s.maxBodyBytes = int64(limit)
+}
+
+// Protocol returns the destination protocol for the Telemetry API subscription
+func (s *Server) Protocol() string {
+	if s.protocol == ProtocolTCP {
+		return ProtocolTCP
+	}
+	return ProtocolHTTP
+}
+
+// Start starts the receiver. The port is bound before Start returns, so a
+// port that is already taken fails Start rather than the first delivery.
 func (s *Server) Start() error {
+	s.listenMu.Lock()
+	defer s.listenMu.Unlock()
+	if s.Protocol() == ProtocolTCP {
+		return s.startTCP()
+	}
+	ln, err := s.listen()
+	if err != nil {
+		return err
+	}
 	logger.Debugf("Starting telemetry receiver on port %d", s.port)
-	go func() {
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Debugf("Telemetry server error: %v", err)
-		}
-	}()
+	s.listener = ln
+	go s.serveHTTP(ln)
 	return nil
 }
 
+// SetPortProbe makes Start try up to n successive ports after the
+// configured one when it is already in use, e.g. by another vendor's
+// extension in the same sandbox. ListenerURI reports the port bound.
+func (s *Server) SetPortProbe(n int) {
+	s.portProbe = n
+}
+
+// listen binds the first free port from basePort through basePort+portProbe
+// and records it. Caller must hold listenMu.
+func (s *Server) listen() (net.Listener, error) {
+	var err error
+	for port := s.basePort; port <= s.basePort+s.portProbe; port++ {
+		var ln net.Listener
+		ln, err = net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err == nil {
+			s.port = ln.Addr().(*net.TCPAddr).Port
+			if s.port != s.basePort && s.basePort != 0 {
+				logger.Warnf("Telemetry port %d is in use; listening on %d instead", s.basePort, s.port)
+			}
+			return ln, nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			break
+		}
+	}
+	return nil, fmt.Errorf("failed to listen for telemetry: %w", err)
+}
+
+// Restart closes what is left of a failed listener and starts the receiver
+// again on the same port
+func (s *Server) Restart() error {
+	s.listenMu.Lock()
+	if s.closed {
+		s.listenMu.Unlock()
+		return errors.New("telemetry receiver is shut down")
+	}
+	if s.tcp != nil {
+		s.tcp.close()
+		s.tcp = nil
+	}
+	if s.listener != nil {
+		s.listener.Close()
+		s.listener = nil
+	}
+	s.listenMu.Unlock()
+	return s.Start()
+}
+
+// SetListenerFailureHandler sets the handler called when the listener
+// stops with an error
+func (s *Server) SetListenerFailureHandler(h ListenerFailureHandler) {
+	s.onListenerFail = h
+}
+
+func (s *Server) serveHTTP(ln net.Listener) {
+	err := s.server.Serve(ln)
+	if err == nil || err == http.ErrServerClosed {
+		return
+	}
+	// A listener closed by Restart has already been replaced
+	s.listenMu.Lock()
+	current := s.listener == ln
+	s.listenMu.Unlock()
+	if current {
+		s.listenerFailed(err)
+	}
+}
+
+// listenerFailed reports a listener that stopped with an error, unless the
+// receiver is shutting down
+func (s *Server) listenerFailed(err error) {
+	s.listenMu.Lock()
+	closed := s.closed
+	s.listenMu.Unlock()
+	if closed {
+		return
+	}
+	logger.Errorf("Telemetry receiver stopped: %v", err)
+	if s.onListenerFail != nil {
+		s.onListenerFail(err)
+	}
+}
+
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown(ctx context.Context) error {
+	s.listenMu.Lock()
+	s.closed = true
+	tcp := s.tcp
+	s.listenMu.Unlock()
+	if tcp != nil {
+		return tcp.close()
+	}
 	return s.server.Shutdown(ctx)
 }
 
-// ListenerURI returns the URI for the Telemetry API subscription
+// SetInitDoneHandler sets the handler called after the INIT phase completes
+func (s *Server) SetInitDoneHandler(h InitDoneHandler) {
+	s.onInitDone = h
+}
+
+// SetPanicHandler sets the handler called after a delivery panicked
+func (s *Server) SetPanicHandler(h PanicHandler) {
+	s.onPanic = h
+}
+
+// SetPipeline sets the filter/sampling pipeline applied before buffering.
+// It may be swapped while the server is running.
+func (s *Server) SetPipeline(p *Pipeline) {
+	s.pipeline.Store(p)
+}
+
+// EnableInvocationSummaries emits one structured summary entry per
+// invocation, in its own stream labelled type=invocation_summary
+func (s *Server) EnableInvocationSummaries() {
+	s.summaries = newInvocationTracker()
+}
+
+// SetTracing records the X-Ray tracing header from an INVOKE event so log
+// entries for that request carry its trace ID
+func (s *Server) SetTracing(requestID, value string) {
+	traceID := parseXRayTraceID(value)
+	if requestID == "" || traceID == "" {
+		return
+	}
+	s.requestIDMu.Lock()
+	s.traceRequestID = requestID
+	s.traceID = traceID
+	s.requestIDMu.Unlock()
+}
+
+// SetColdStart marks requestID as the sandbox's cold-start invocation, so
+// its entries carry cold_start metadata
+func (s *Server) SetColdStart(requestID string) {
+	s.requestIDMu.Lock()
+	s.coldRequestID = requestID
+	s.requestIDMu.Unlock()
+}
+
+// markColdStart flags entries of the cold-start invocation
+func (s *Server) markColdStart(entries []buffer.LogEntry) {
+	s.requestIDMu.RLock()
+	cold := s.coldRequestID
+	s.requestIDMu.RUnlock()
+	if cold == "" {
+		return
+	}
+	for i := range entries {
+		if entries[i].RequestID == cold {
+			entries[i].SetAttribute(buffer.AttrColdStart, "true")
+		}
+	}
+}
+
+// setOutcome records a failed or timed-out invocation and marks its
+// entries still in the buffer, so lines delivered before runtimeDone carry
+// the outcome too
+func (s *Server) setOutcome(requestID, status string) {
+	s.requestIDMu.Lock()
+	s.failedRequestID = requestID
+	s.failedOutcome = status
+	s.requestIDMu.Unlock()
+
+	s.buffer.Update(func(e *buffer.LogEntry) {
+		if e.RequestID == requestID {
+			markOutcome(e, status)
+		}
+	})
+}
+
+// markOutcomes flags entries of the latest failed or timed-out invocation
+func (s *Server) markOutcomes(entries []buffer.LogEntry) {
+	s.requestIDMu.RLock()
+	failed, outcome := s.failedRequestID, s.failedOutcome
+	s.requestIDMu.RUnlock()
+	if failed == "" {
+		return
+	}
+	for i := range entries {
+		if entries[i].RequestID == failed {
+			markOutcome(&entries[i], outcome)
+		}
+	}
+}
+
+// traceAttributes returns the attributes of an entry correlated with
+// traceID, or nil when there is none
+func traceAttributes(traceID string) map[string]string {
+	if traceID == "" {
+		return nil
+	}
+	return map[string]string{buffer.AttrTraceID: traceID}
+}
+
+// markOutcome sets an entry's outcome and ships it ahead of normal entries
+func markOutcome(e *buffer.LogEntry, outcome string) {
+	e.SetAttribute(buffer.AttrOutcome, outcome)
+	e.Priority = buffer.PriorityHigh
+}
+
+// IsFailedStatus reports whether a runtimeDone status means the
+// invocation did not complete successfully
+func IsFailedStatus(status string) bool {
+	return status != "" && status != "success"
+}
+
+// Reported reports whether requestID's platform.report, the last event of
+// an invocation, has been received
+func (s *Server) Reported(requestID string) bool {
+	s.requestIDMu.RLock()
+	defer s.requestIDMu.RUnlock()
+	return requestID != "" && requestID == s.reportedRequestID
+}
+
+// traceIDFor returns the known trace ID for requestID, or ""
+func (s *Server) traceIDFor(requestID string) string {
+	if requestID == "" {
+		return ""
+	}
+	s.requestIDMu.RLock()
+	defer s.requestIDMu.RUnlock()
+	if requestID == s.traceRequestID {
+		return s.traceID
+	}
+	return ""
+}
+
+// ListenerURI returns the URI for the Telemetry API subscription. After
+// Start it names the port actually bound.
 func (s *Server) ListenerURI() string {
-	return fmt.Sprintf("http://sandbox.localdomain:%d", s.port)
+	s.listenMu.Lock()
+	port := s.port
+	s.listenMu.Unlock()
+	if s.Protocol() == ProtocolTCP {
+		return fmt.Sprintf("tcp://sandbox.localdomain:%d", port)
+	}
+	return fmt.Sprintf("http://sandbox.localdomain:%d", port)
 }
 
 func (s *Server) handleTelemetry(w http.ResponseWriter, r *http.Request) {
+	// A recovered delivery is still acknowledged so it is not redelivered
+	defer s.recoverDelivery()
+
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	body := io.Reader(r.Body)
+	if s.maxBodyBytes > 0 {
+		if r.ContentLength > s.maxBodyBytes {
+			s.refuseBody(w, r.ContentLength)
+			return
+		}
+		// A chunked or mis-declared body is cut off once it passes the limit
+		body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+	}
+
+	events, err := decodeEvents(body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		s.refuseBody(w, -1)
+		return
+	}
 	if err != nil {
-		logger.Debugf("Failed to read telemetry body: %v", err)
-		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		logger.Debugf("Failed to parse telemetry events: %v", err)
+		http.Error(w, "Failed to parse events", http.StatusBadRequest)
 		return
 	}
-	defer r.Body.Close()
+
+	done := s.ingest(events)
+
+	// Respond to the Telemetry API immediately so it can continue delivering
+	// subsequent events (e.g. platform.report) without waiting for our
+	// critical flush to finish pushing to Loki.
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	// Trigger critical flush AFTER responding — this may block on Loki I/O
+	// but will no longer delay the Telemetry API's next delivery.
+	s.notify(done)
+}
+
+// refuseBody answers a delivery over the body limit with 413; size is -1
+// when the body did not declare its length
+func (s *Server) refuseBody(w http.ResponseWriter, size int64) {
+	if size < 0 {
+		logger.Warnf("Refused telemetry delivery over %d bytes", s.maxBodyBytes)
+	} else {
+		logger.Warnf("Refused telemetry delivery of %d bytes (limit %d)", size, s.maxBodyBytes)
+	}
+	http.Error(w, "Body too large", http.StatusRequestEntityTooLarge)
+}
+
+// decodeEvents reads a delivery's JSON array one event at a time, so the
+// raw body is never held in memory next to the events decoded from it
+func decodeEvents(r io.Reader) ([]TelemetryEvent, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		return nil, nil // a null delivery carries no events
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("expected an array of events, got %v", tok)
+	}
 
 	var events []TelemetryEvent
-	if err := json.Unmarshal(body, &events); err != nil {
-		logger.Debugf("Failed to parse telemetry events: %v", err)
-		http.Error(w, "Failed to parse events", http.StatusBadRequest)
+	for dec.More() {
+		var event TelemetryEvent
+		if err := dec.Decode(&event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// lifecycleSignals carries the lifecycle events seen in a delivery whose
+// handlers must run after the delivery is acknowledged
+type lifecycleSignals struct {
+	runtimeDoneRequestID string
+	runtimeDoneStatus    string
+	initDoneStatus       string
+}
+
+// notify invokes the runtimeDone and initDone handlers for a delivery
+func (s *Server) notify(done lifecycleSignals) {
+	if done.runtimeDoneRequestID != "" && s.onRuntimeDone != nil {
+		s.onRuntimeDone(done.runtimeDoneRequestID, done.runtimeDoneStatus)
+	}
+	if done.initDoneStatus != "" && s.onInitDone != nil {
+		s.onInitDone(done.initDoneStatus)
+	}
+}
+
+// Ingest buffers events as if they had been delivered by the Telemetry API
+// and runs the lifecycle handlers they trigger. It lets events from other
+// sources, such as local mode's input, share the receivers' processing.
+func (s *Server) Ingest(events []TelemetryEvent) {
+	s.deliver(events)
+}
+
+// deliver ingests events and runs their lifecycle handlers, recovering from
+// any panic on the way
+func (s *Server) deliver(events []TelemetryEvent) {
+	defer s.recoverDelivery()
+	s.notify(s.ingest(events))
+}
+
+// signal runs a delivery's lifecycle handlers, recovering from any panic
+func (s *Server) signal(done lifecycleSignals) {
+	defer s.recoverDelivery()
+	s.notify(done)
+}
+
+// recoverDelivery keeps a panic while handling a delivery from taking the
+// receiver down. The panic handler gets a chance to ship what is buffered.
+func (s *Server) recoverDelivery() {
+	r := recover()
+	if r == nil {
 		return
 	}
+	logger.Errorf("Recovered from panic handling telemetry: %v\n%s", r, debug.Stack())
+	if s.onPanic != nil {
+		s.onPanic(r)
+	}
+}
+
+// safely handles one event of a delivery, dropping it if it panics
+func (s *Server) safely(event TelemetryEvent, handle func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("Dropped %s telemetry event that could not be handled: %v", event.Type, r)
+		}
+	}()
+	handle()
+}
 
+// ingest converts a delivery of telemetry events into log entries and
+// buffers them. It is shared by the HTTP and TCP receivers.
+func (s *Server) ingest(events []TelemetryEvent) lifecycleSignals {
 	entries := make([]buffer.LogEntry, 0, len(events))
-	var runtimeDoneRequestID string
+	var runtimeDoneRequestID, runtimeDoneStatus string
+	var initDoneStatus string
+	var reports []TelemetryEvent
+	var finished []invocationOutcome // runtimeDone of each invocation, for tail sampling
+	var untimed []int                // indexes of function logs without a parsable timestamp
+	doneAt := make(map[string]int64) // platform.runtimeDone time by request ID
 
 	for _, event := range events {
-		switch event.Type {
-		case EventTypePlatformStart:
-			// Extract request ID from platform.start
-			if record, ok := event.Record.(map[string]interface{}); ok {
-				if reqID, ok := record["requestId"].(string); ok {
-					s.requestIDMu.Lock()
-					s.currentRequestID = reqID
-					s.requestIDMu.Unlock()
+		// A record that panics is dropped without losing the rest of the delivery
+		s.safely(event, func() {
+			switch event.Type {
+			case EventTypePlatformInitStart, EventTypePlatformInitReport,
+				EventTypePlatformRestoreStart, EventTypePlatformRestoreReport:
+				// INIT and RESTORE phase events arrive before any request ID exists
+				entries = append(entries, buffer.LogEntry{
+					Timestamp: parseTimestamp(event.Time),
+					Message:   formatPlatformInit(event.Type, event.Record),
+					Type:      event.Type,
+					Priority:  initPriority(event.Record),
+				})
+
+			case EventTypePlatformInitRuntimeDone, EventTypePlatformRestoreRuntimeDone:
+				// A restored snapshot's runtime is ready at restoreRuntimeDone,
+				// so its logs are flushed then just like INIT's
+				if record, ok := event.Record.(map[string]interface{}); ok {
+					initDoneStatus, _ = record["status"].(string)
 				}
-			}
-			// Ship platform.start log in Lambda format
-			ts := parseTimestamp(event.Time)
-			s.requestIDMu.RLock()
-			currentReqID := s.currentRequestID
-			s.requestIDMu.RUnlock()
-			entry := buffer.LogEntry{
-				Timestamp: ts,
-				Message:   formatPlatformStart(event.Record),
-				Type:      event.Type,
-				RequestID: currentReqID,
-			}
-			entries = append(entries, entry)
+				entries = append(entries, buffer.LogEntry{
+					Timestamp: parseTimestamp(event.Time),
+					Message:   formatPlatformInit(event.Type, event.Record),
+					Type:      event.Type,
+					Priority:  initPriority(event.Record),
+				})
 
-		case EventTypePlatformRuntimeDone:
-			// Extract request ID and ship log
-			if record, ok := event.Record.(map[string]interface{}); ok {
-				if id, ok := record["requestId"].(string); ok {
-					runtimeDoneRequestID = id
+			case EventTypePlatformStart:
+				// Extract request ID from platform.start
+				if record, ok := event.Record.(map[string]interface{}); ok {
+					if reqID, ok := record["requestId"].(string); ok {
+						s.requestIDMu.Lock()
+						s.currentRequestID = reqID
+						s.requestIDMu.Unlock()
+						s.SetTracing(reqID, tracingValue(record))
+						if s.summaries != nil {
+							s.summaries.start(reqID)
+						}
+					}
 				}
-			}
-			ts := parseTimestamp(event.Time)
-			s.requestIDMu.RLock()
-			currentReqID := s.currentRequestID
-			s.requestIDMu.RUnlock()
-			entry := buffer.LogEntry{
-				Timestamp: ts,
-				Message:   formatPlatformRuntimeDone(event.Record),
-				Type:      event.Type,
-				RequestID: currentReqID,
-			}
-			entries = append(entries, entry)
+				// Ship platform.start log in Lambda format
+				ts := parseTimestamp(event.Time)
+				requestID := s.requestIDAt(ts, event.Record)
+				if requestID != "" {
+					s.index.add(requestID, ts)
+				}
+				entry := buffer.LogEntry{
+					Timestamp:  ts,
+					Message:    formatPlatformStart(event.Record),
+					Type:       event.Type,
+					RequestID:  requestID,
+					Attributes: traceAttributes(s.traceIDFor(requestID)),
+				}
+				entries = append(entries, entry)
 
-		case EventTypeFunction, EventTypeExtension:
-			// Process function and extension logs
-			message, ts := formatRecordWithTimestamp(event.Record, event.Time)
+			case EventTypePlatformRuntimeDone:
+				// Extract request ID and ship log
+				if record, ok := event.Record.(map[string]interface{}); ok {
+					if id, ok := record["requestId"].(string); ok {
+						status, _ := record["status"].(string)
+						runtimeDoneRequestID = id
+						runtimeDoneStatus = status
+						finished = append(finished, invocationOutcome{requestID: id, status: status})
+						end, ok := parseTimestampOK(event.Time)
+						if ok {
+							doneAt[id] = end
+						}
+						s.endInvocation(id, end)
+						if IsFailedStatus(status) {
+							s.setOutcome(id, status)
+						}
+						if s.summaries != nil {
+							s.summaries.runtimeDone(id, status)
+						}
+					}
+				}
+				ts := parseTimestamp(event.Time)
+				requestID := s.requestIDAt(ts, event.Record)
+				entry := buffer.LogEntry{
+					Timestamp:  ts,
+					Message:    formatPlatformRuntimeDone(event.Record),
+					Type:       event.Type,
+					RequestID:  requestID,
+					Attributes: traceAttributes(s.traceIDFor(requestID)),
+					Priority:   runtimeDonePriority(event.Record),
+				}
+				entries = append(entries, entry)
 
-			// Skip our own extension logs - they're already in buffer via logger
-			if event.Type == EventTypeExtension && strings.Contains(message, ownExtensionMarker) {
-				continue
-			}
+				// The Telemetry API has no platform.end; CloudWatch writes
+				// END when the runtime is done
+				if s.endLines && !s.endAtPlatformEnd && requestID != "" {
+					entries = append(entries, s.endEntry(requestID, ts))
+				}
 
-			// Extract request ID from message if enabled
-			s.requestIDMu.RLock()
-			requestID := s.currentRequestID
-			s.requestIDMu.RUnlock()
-			if s.extractRequestID && requestID == "" {
-				requestID = extractRequestID(message)
-			}
+			case EventTypePlatformEnd:
+				// Only the Logs API delivers platform.end
+				if !s.endLines || !s.endAtPlatformEnd {
+					return
+				}
+				if record, ok := event.Record.(map[string]interface{}); ok {
+					if id, _ := record["requestId"].(string); id != "" {
+						entries = append(entries, s.endEntry(id, parseTimestamp(event.Time)))
+					}
+				}
+
+			case EventTypeFunction, EventTypeExtension:
+				// Process function and extension logs
+				var (
+					message, requestID, traceID, spanID, level string
+					ts                                         int64
+					priority                                   buffer.Priority
+				)
+				if rec, ok := parseStructuredRecord(event.Record); ok && event.Type == EventTypeFunction {
+					// JSON log format: Lambda supplies the timestamp, level
+					// and request ID, so skip the text heuristics
+					message, ts = rec.line(), rec.timestamp
+					requestID = rec.requestID
+					if requestID == "" {
+						requestID = s.requestIDAt(ts, nil)
+					}
+					priority = rec.priority()
+					level = strings.ToLower(rec.level)
+					traceID, spanID = s.traceContextOf(message, rec.fields)
+				} else {
+					message, ts = formatRecordWithTimestamp(event.Record, event.Time)
+
+					// Skip our own extension logs - they're already in buffer via logger
+					if event.Type == EventTypeExtension && logger.IsOwnLine(message) {
+						return
+					}
 
-			// Split long messages if needed
-			if s.maxLineSize > 0 && len(message) > s.maxLineSize {
-				chunks := splitMessage(message, s.maxLineSize)
-				for i, chunk := range chunks {
-					entry := buffer.LogEntry{
-						Timestamp: ts + int64(i),
-						Message:   chunk,
-						Type:      event.Type,
-						RequestID: requestID,
+					// Attribute to the invocation running when the line was
+					// logged; fall back to a request ID in the message if enabled,
+					// unless the line was logged between invocations
+					requestID = s.requestIDAt(ts, event.Record)
+					if s.extractRequestID && requestID == "" && !s.index.between(ts) {
+						requestID = extractRequestID(message)
 					}
-					entries = append(entries, entry)
+
+					fields := parseJSONFields(message)
+					priority = messagePriority(message, fields)
+					level = recordLevel(message, fields)
+					traceID, spanID = s.traceContextOf(message, fields)
+				}
+
+				// Prefer a trace ID logged by the function over the invocation's
+				if traceID == "" {
+					traceID, spanID = s.traceIDFor(requestID), ""
+				}
+				attrs := traceAttributes(traceID)
+				if spanID != "" {
+					attrs[buffer.AttrSpanID] = spanID
+				}
+				if level != "" {
+					if attrs == nil {
+						attrs = make(map[string]string, 1)
+					}
+					attrs[buffer.AttrLevel] = level
+				}
+
+				if ts == 0 {
+					untimed = append(untimed, len(entries))
 				}
-			} else {
 				entry := buffer.LogEntry{
-					Timestamp: ts,
-					Message:   message,
-					Type:      event.Type,
-					RequestID: requestID,
+					Timestamp:  ts,
+					Message:    message,
+					Type:       event.Type,
+					RequestID:  requestID,
+					Attributes: attrs,
+					Priority:   priority,
+				}
+				entries = append(entries, entry)
+
+			case EventTypePlatformReport:
+				// Log platform report in Lambda format
+				ts := parseTimestamp(event.Time)
+				message := formatPlatformReport(event.Record)
+				requestID := s.requestIDAt(ts, event.Record)
+				s.requestIDMu.Lock()
+				s.reportedRequestID = requestID
+				s.requestIDMu.Unlock()
+				entry := buffer.LogEntry{
+					Timestamp:  ts,
+					Message:    message,
+					Type:       event.Type,
+					RequestID:  requestID,
+					Attributes: traceAttributes(s.traceIDFor(requestID)),
+				}
+				entries = append(entries, entry)
+				reports = append(reports, event)
+
+				if metrics, ok := parseReportMetrics(event.Record); ok {
+					if s.reportMetrics {
+						entries = append(entries, reportMetricsEntry(metrics, ts))
+					}
+					if s.onReport != nil {
+						s.onReport(metrics)
+					}
+				}
+
+			case EventTypePlatformFault, EventTypePlatformExtension:
+				message, failed := formatPlatformStatus(event.Type, event.Record)
+				ts := parseTimestamp(event.Time)
+				requestID := s.requestIDAt(ts, event.Record)
+				entry := buffer.LogEntry{
+					Timestamp:  ts,
+					Message:    message,
+					Type:       event.Type,
+					RequestID:  requestID,
+					Attributes: traceAttributes(s.traceIDFor(requestID)),
+				}
+				if failed {
+					entry.Priority = buffer.PriorityHigh
+					entry.StreamLabels = map[string]string{"error": "true"}
 				}
 				entries = append(entries, entry)
 			}
+		})
+	}
+
+	s.backfillTimestamps(entries, untimed, doneAt)
+	s.markColdStart(entries)
+	s.markOutcomes(entries)
+
+	// Filters, redaction and sampling see whole lines; only what they keep
+	// is split to fit LOKI_MAX_LINE_SIZE
+	entries = s.pipeline.Load().Process(entries)
+	entries = SplitEntries(entries, s.maxLineSize)
+
+	// Function logs wait for their invocation's outcome; those of
+	// invocations that just finished and were kept go ahead of the rest
+	if s.tail != nil {
+		entries = s.tail.hold(entries, s.buffer.Len(), s.buffer.ByteSize())
+		var released []buffer.LogEntry
+		for _, done := range finished {
+			released = append(released, s.tail.finish(done.requestID, done.status)...)
+		}
+		s.markOutcomes(released)
+		entries = append(released, entries...)
+	}
 
-		case EventTypePlatformReport:
-			// Log platform report in Lambda format
-			ts := parseTimestamp(event.Time)
-			message := formatPlatformReport(event.Record)
-			s.requestIDMu.RLock()
-			currentReqID := s.currentRequestID
-			s.requestIDMu.RUnlock()
-			entry := buffer.LogEntry{
-				Timestamp: ts,
-				Message:   message,
-				Type:      event.Type,
-				RequestID: currentReqID,
+	// Summaries are built after filtering so counts reflect what is shipped
+	if s.summaries != nil {
+		s.summaries.count(entries)
+		for _, report := range reports {
+			if summary, ok := s.summaries.finish(report.Record, parseTimestamp(report.Time)); ok {
+				entries = append(entries, summary)
 			}
-			entries = append(entries, entry)
 		}
 	}
 
@@ -204,32 +801,74 @@ func (s *Server) handleTelemetry(w http.ResponseWriter, r *http.Request) {
 		s.buffer.AddBatch(entries)
 	}
 
-	// Respond to the Telemetry API immediately so it can continue delivering
-	// subsequent events (e.g. platform.report) without waiting for our
-	// critical flush to finish pushing to Loki.
-	w.WriteHeader(http.StatusOK)
-	if f, ok := w.(http.Flusher); ok {
-		f.Flush()
-	}
-
-	// Trigger critical flush AFTER responding — this may block on Loki I/O
-	// but will no longer delay the Telemetry API's next delivery.
-	if runtimeDoneRequestID != "" && s.onRuntimeDone != nil {
-		s.onRuntimeDone(runtimeDoneRequestID)
+	return lifecycleSignals{
+		runtimeDoneRequestID: runtimeDoneRequestID,
+		runtimeDoneStatus:    runtimeDoneStatus,
+		initDoneStatus:       initDoneStatus,
 	}
 }
 
 // parseTimestamp parses RFC3339Nano timestamp and returns milliseconds
 func parseTimestamp(timeStr string) int64 {
+	if ts, ok := parseTimestampOK(timeStr); ok {
+		return ts
+	}
+	return time.Now().UnixMilli()
+}
+
+// parseTimestampOK parses an RFC3339Nano timestamp into milliseconds,
+// reporting whether it was valid
+func parseTimestampOK(timeStr string) (int64, bool) {
 	t, err := time.Parse(time.RFC3339Nano, timeStr)
 	if err != nil {
-		return time.Now().UnixMilli()
+		return 0, false
 	}
-	return t.UnixMilli()
+	return t.UnixMilli(), true
 }
 
-// formatRecordWithTimestamp extracts timestamp from Lambda prefix and returns cleaned message
+// backfillTimestamps assigns times to function logs that had none, spacing
+// each request's untimed entries evenly between its platform.start and
+// platform.runtimeDone (or now, if the invocation has not finished), so
+// late-delivered batches keep their order within the invocation.
+func (s *Server) backfillTimestamps(entries []buffer.LogEntry, untimed []int, doneAt map[string]int64) {
+	if len(untimed) == 0 {
+		return
+	}
+
+	byRequest := make(map[string][]int)
+	var order []string
+	for _, idx := range untimed {
+		id := entries[idx].RequestID
+		if _, ok := byRequest[id]; !ok {
+			order = append(order, id)
+		}
+		byRequest[id] = append(byRequest[id], idx)
+	}
+
+	now := time.Now().UnixMilli()
+	for _, id := range order {
+		end, ok := doneAt[id]
+		if !ok || end > now {
+			end = now
+		}
+		start := end
+		if begun, ok := s.index.startOf(id); ok && begun <= end {
+			start = begun
+		}
+
+		idxs := byRequest[id]
+		span := end - start
+		for k, idx := range idxs {
+			entries[idx].Timestamp = start + span*int64(k+1)/int64(len(idxs)+1)
+		}
+	}
+}
+
+// formatRecordWithTimestamp extracts timestamp from Lambda prefix and returns cleaned message.
+// The timestamp is 0 if neither the prefix nor fallbackTime can be parsed.
 func formatRecordWithTimestamp(record interface{}, fallbackTime string) (string, int64) {
+	fallback, _ := parseTimestampOK(fallbackTime)
+
 	var msg string
 	switch v := record.(type) {
 	case string:
@@ -237,7 +876,7 @@ func formatRecordWithTimestamp(record interface{}, fallbackTime string) (string,
 	default:
 		b, err := json.Marshal(v)
 		if err != nil {
-			return fmt.Sprintf("%v", v), parseTimestamp(fallbackTime)
+			return fmt.Sprintf("%v", v), fallback
 		}
 		msg = string(b)
 	}
@@ -250,9 +889,9 @@ func formatRecordWithTimestamp(record interface{}, fallbackTime string) (string,
 				return strings.TrimSpace(msg[idx:]), ts
 			}
 		}
-		return strings.TrimSpace(msg[idx:]), parseTimestamp(fallbackTime)
+		return strings.TrimSpace(msg[idx:]), fallback
 	}
-	return strings.TrimSpace(msg), parseTimestamp(fallbackTime)
+	return strings.TrimSpace(msg), fallback
 }
 
 // formatPlatformStart formats platform.start event as Lambda START message
@@ -271,6 +910,136 @@ func formatPlatformStart(record interface{}) string {
 	return formatAsJSON(record)
 }
 
+// EnableEndLines emits an "END RequestId: ..." entry for each invocation, at
+// platform.runtimeDone or, with fromPlatformEnd set for the Logs API, at
+// platform.end. The Logs API sends both events, so only one of them may
+// produce the line.
+func (s *Server) EnableEndLines(fromPlatformEnd bool) {
+	s.endLines = true
+	s.endAtPlatformEnd = fromPlatformEnd
+}
+
+// endEntry is CloudWatch's END line for the invocation
+func (s *Server) endEntry(requestID string, ts int64) buffer.LogEntry {
+	return buffer.LogEntry{
+		Timestamp:  ts,
+		Message:    "END RequestId: " + requestID,
+		Type:       EventTypePlatformEnd,
+		RequestID:  requestID,
+		Attributes: traceAttributes(s.traceIDFor(requestID)),
+	}
+}
+
+// phaseNames are the CloudWatch names of INIT and RESTORE phase events
+var phaseNames = map[string]string{
+	EventTypePlatformInitStart:          "INIT_START",
+	EventTypePlatformInitRuntimeDone:    "INIT_RUNTIME_DONE",
+	EventTypePlatformInitReport:         "INIT_REPORT",
+	EventTypePlatformRestoreStart:       "RESTORE_START",
+	EventTypePlatformRestoreRuntimeDone: "RESTORE_RUNTIME_DONE",
+	EventTypePlatformRestoreReport:      "RESTORE_REPORT",
+}
+
+// formatPlatformInit formats INIT and SnapStart RESTORE phase events like
+// CloudWatch's INIT_START, INIT_REPORT and RESTORE_START lines
+func formatPlatformInit(eventType string, record interface{}) string {
+	recordMap, ok := record.(map[string]interface{})
+	if !ok {
+		return formatAsJSON(record)
+	}
+	name := phaseNames[eventType]
+
+	switch eventType {
+	case EventTypePlatformInitStart, EventTypePlatformRestoreStart:
+		version, _ := recordMap["runtimeVersion"].(string)
+		arn, _ := recordMap["runtimeVersionArn"].(string)
+		if version == "" {
+			return formatAsJSON(record)
+		}
+		msg := name + " Runtime Version: " + version
+		if arn != "" {
+			msg += "\tRuntime Version ARN: " + arn
+		}
+		return msg
+
+	case EventTypePlatformInitRuntimeDone, EventTypePlatformRestoreRuntimeDone:
+		status, _ := recordMap["status"].(string)
+		if status == "" {
+			return formatAsJSON(record)
+		}
+		msg := name + " Status: " + status
+		if phase, _ := recordMap["phase"].(string); phase != "" {
+			msg += "\tPhase: " + phase
+		}
+		if errorType, _ := recordMap["errorType"].(string); errorType != "" {
+			msg += "\tError Type: " + errorType
+		}
+		return msg
+
+	case EventTypePlatformInitReport, EventTypePlatformRestoreReport:
+		metrics, ok := recordMap["metrics"].(map[string]interface{})
+		if !ok {
+			return formatAsJSON(record)
+		}
+		duration, _ := metrics["durationMs"].(float64)
+		label := "Init Duration"
+		if eventType == EventTypePlatformRestoreReport {
+			label = "Restore Duration"
+		}
+		msg := fmt.Sprintf("%s %s: %.2f ms", name, label, duration)
+		if phase, _ := recordMap["phase"].(string); phase != "" {
+			msg += "\tPhase: " + phase
+		}
+		if status, _ := recordMap["status"].(string); status != "" {
+			msg += "\tStatus: " + status
+		}
+		if errorType, _ := recordMap["errorType"].(string); errorType != "" {
+			msg += "\tError Type: " + errorType
+		}
+		return msg
+	}
+	return formatAsJSON(record)
+}
+
+// formatPlatformStatus formats platform.fault and platform.extension events
+// and reports whether the event describes a failure. Faults always do;
+// extension events only when Lambda attaches an errorType.
+func formatPlatformStatus(eventType string, record interface{}) (string, bool) {
+	if eventType == EventTypePlatformFault {
+		if fault, ok := record.(string); ok {
+			return "FAULT " + fault, true
+		}
+		return "FAULT " + formatAsJSON(record), true
+	}
+
+	recordMap, ok := record.(map[string]interface{})
+	if !ok {
+		return formatAsJSON(record), false
+	}
+	name, _ := recordMap["name"].(string)
+	state, _ := recordMap["state"].(string)
+	msg := fmt.Sprintf("EXTENSION Name: %s\tState: %s", name, state)
+	if events, ok := recordMap["events"].([]interface{}); ok {
+		names := make([]string, 0, len(events))
+		for _, e := range events {
+			if s, ok := e.(string); ok {
+				names = append(names, s)
+			}
+		}
+		msg += "\tEvents: [" + strings.Join(names, ",") + "]"
+	}
+	errorType, _ := recordMap["errorType"].(string)
+	if errorType != "" {
+		msg += "\tError Type: " + errorType
+	}
+	return msg, errorType != ""
+}
+
+// initPriority marks failed INIT and RESTORE phases as high priority
+func initPriority(record interface{}) buffer.Priority {
+	return runtimeDonePriority(record)
+}
+
 // formatPlatformRuntimeDone formats platform.runtimeDone event
 func formatPlatformRuntimeDone(record interface{}) string {
 	// Just return as JSON for now - these don't appear in CloudWatch
@@ -326,40 +1095,48 @@ func formatAsJSON(record interface{}) string {
 	return string(b)
 }
 
-func extractRequestID(message string) string {
-	matches := requestIDRegex.FindStringSubmatch(message)
-	if len(matches) >= 2 {
-		return matches[1]
-	}
-	return ""
-}
+// errorLevels are JSON log level values shipped with high priority
+var errorLevels = map[string]bool{"error": true, "fatal": true, "critical": true, "panic": true}
 
-// splitMessage splits a message into chunks of maxSize bytes
-func splitMessage(message string, maxSize int) []string {
-	if len(message) <= maxSize {
-		return []string{message}
+// messagePriority classifies a function or extension log line. JSON logs are
+// judged by their level field; plain text by Lambda's "\tERROR\t" column and
+// common crash signatures.
+func messagePriority(message string, fields map[string]interface{}) buffer.Priority {
+	if fields != nil {
+		for _, name := range []string{"level", "levelname", "severity"} {
+			if level, ok := fields[name].(string); ok {
+				if errorLevels[strings.ToLower(level)] {
+					return buffer.PriorityHigh
+				}
+				return buffer.PriorityNormal
+			}
+		}
+		return buffer.PriorityNormal
 	}
 
-	// Reserve space for chunk markers
-	markerReserve := 20
-	effectiveSize := maxSize - markerReserve
-	if effectiveSize < 100 {
-		effectiveSize = 100
+	if strings.Contains(message, "\tERROR\t") ||
+		strings.HasPrefix(message, "ERROR") ||
+		strings.Contains(message, "Traceback (most recent call last)") ||
+		strings.HasPrefix(message, "panic:") {
+		return buffer.PriorityHigh
 	}
+	return buffer.PriorityNormal
+}
 
-	numChunks := (len(message) + effectiveSize - 1) / effectiveSize
-	chunks := make([]string, 0, numChunks)
-
-	for i := 0; i < len(message); i += effectiveSize {
-		end := i + effectiveSize
-		if end > len(message) {
-			end = len(message)
+// runtimeDonePriority marks unsuccessful invocations (error, timeout, failure) as high priority
+func runtimeDonePriority(record interface{}) buffer.Priority {
+	if recordMap, ok := record.(map[string]interface{}); ok {
+		if status, _ := recordMap["status"].(string); status != "" && status != "success" {
+			return buffer.PriorityHigh
 		}
-
-		chunkNum := len(chunks) + 1
-		chunk := fmt.Sprintf("[chunk %d/%d] %s", chunkNum, numChunks, message[i:end])
-		chunks = append(chunks, chunk)
 	}
+	return buffer.PriorityNormal
+}
 
-	return chunks
+func extractRequestID(message string) string {
+	matches := requestIDRegex.FindStringSubmatch(message)
+	if len(matches) >= 2 {
+		return matches[1]
+	}
+	return ""
 }
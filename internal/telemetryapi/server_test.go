@@ -2,7 +2,10 @@ package telemetryapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -48,6 +51,57 @@ func TestServer_InvalidJSONBody(t *testing.T) {
 	}
 }
 
+func TestServer_RejectsOversizedBody(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.SetMaxBodyBytes(64)
+	events := []TelemetryEvent{{
+		Type:   EventTypeFunction,
+		Time:   "2026-02-05T21:34:18.205Z",
+		Record: strings.Repeat("x", 100),
+	}}
+	w := postEvents(s, events)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", w.Code)
+	}
+	if s.buffer.Len() != 0 {
+		t.Errorf("expected 0 entries, got %d", s.buffer.Len())
+	}
+}
+
+func TestServer_RejectsOversizedUndeclaredBody(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.SetMaxBodyBytes(64)
+	body, _ := json.Marshal([]TelemetryEvent{{
+		Type:   EventTypeFunction,
+		Time:   "2026-02-05T21:34:18.205Z",
+		Record: strings.Repeat("x", 100),
+	}})
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.ContentLength = -1 // chunked
+	w := httptest.NewRecorder()
+	s.handleTelemetry(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", w.Code)
+	}
+	if s.buffer.Len() != 0 {
+		t.Errorf("expected 0 entries, got %d", s.buffer.Len())
+	}
+}
+
+func TestServer_TruncatedEventArray(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	body := `[{"time":"2026-02-05T21:34:18.205Z","type":"function","record":"first"},{"time":`
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	s.handleTelemetry(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+	if s.buffer.Len() != 0 {
+		t.Errorf("a rejected delivery buffered %d entries", s.buffer.Len())
+	}
+}
+
 func TestServer_EmptyEventArray(t *testing.T) {
 	s := newTestServer(0, true, nil)
 	w := postEvents(s, []TelemetryEvent{})
@@ -89,7 +143,7 @@ func TestServer_PlatformStart(t *testing.T) {
 
 func TestServer_PlatformRuntimeDone(t *testing.T) {
 	var calledWith string
-	handler := func(reqID string) { calledWith = reqID }
+	handler := func(reqID, status string) { calledWith = reqID }
 	s := newTestServer(0, true, handler)
 	events := []TelemetryEvent{{
 		Type: EventTypePlatformRuntimeDone,
@@ -108,6 +162,70 @@ func TestServer_PlatformRuntimeDone(t *testing.T) {
 	}
 }
 
+func TestServer_EndLines(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.EnableEndLines(false)
+	postEvents(s, []TelemetryEvent{{
+		Type:   EventTypePlatformRuntimeDone,
+		Time:   "2026-02-05T21:34:19.572Z",
+		Record: map[string]interface{}{"requestId": "abc-123", "status": "success"},
+	}})
+
+	entries := s.buffer.Flush(10)
+	if len(entries) != 2 {
+		t.Fatalf("expected runtimeDone and END entries, got %d", len(entries))
+	}
+	if entries[1].Message != "END RequestId: abc-123" || entries[1].RequestID != "abc-123" || entries[1].Type != EventTypePlatformEnd {
+		t.Errorf("entry = %+v, want END for abc-123", entries[1])
+	}
+	if entries[1].Timestamp != entries[0].Timestamp {
+		t.Errorf("END timestamp = %d, want the runtimeDone's %d", entries[1].Timestamp, entries[0].Timestamp)
+	}
+}
+
+func TestServer_EndLinesLogsAPI(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.EnableEndLines(true)
+	// The Logs API sends both events for an invocation
+	postEvents(s, []TelemetryEvent{
+		{
+			Type:   EventTypePlatformRuntimeDone,
+			Time:   "2026-02-05T21:34:19.572Z",
+			Record: map[string]interface{}{"requestId": "abc-123", "status": "success"},
+		},
+		{
+			Type:   EventTypePlatformEnd,
+			Time:   "2026-02-05T21:34:20.001Z",
+			Record: map[string]interface{}{"requestId": "abc-123"},
+		},
+	})
+
+	var ends []buffer.LogEntry
+	for _, e := range s.buffer.Flush(10) {
+		if e.Type == EventTypePlatformEnd {
+			ends = append(ends, e)
+		}
+	}
+	if len(ends) != 1 || ends[0].Message != "END RequestId: abc-123" {
+		t.Fatalf("END entries = %+v, want exactly one for abc-123", ends)
+	}
+	if want := parseTimestamp("2026-02-05T21:34:20.001Z"); ends[0].Timestamp != want {
+		t.Errorf("END timestamp = %d, want platform.end's %d", ends[0].Timestamp, want)
+	}
+}
+
+func TestServer_EndLinesDisabledByDefault(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	postEvents(s, []TelemetryEvent{{
+		Type:   EventTypePlatformEnd,
+		Time:   "2026-02-05T21:34:20.001Z",
+		Record: map[string]interface{}{"requestId": "def-456"},
+	}})
+	if s.buffer.Len() != 0 {
+		t.Errorf("expected no entries without EnableEndLines, got %d", s.buffer.Len())
+	}
+}
+
 func TestServer_PlatformReport(t *testing.T) {
 	s := newTestServer(0, true, nil)
 	s.currentRequestID = "abc-123"
@@ -164,6 +282,216 @@ func TestServer_PlatformReportWithoutInitDuration(t *testing.T) {
 
 // --- 6.3 Function Logs ---
 
+func TestServer_PlatformInitStart(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	events := []TelemetryEvent{{
+		Type: EventTypePlatformInitStart,
+		Time: "2026-02-05T21:34:17.900Z",
+		Record: map[string]interface{}{
+			"initializationType": "on-demand",
+			"phase":              "init",
+			"runtimeVersion":     "nodejs:20.v13",
+		},
+	}}
+	postEvents(s, events)
+
+	entries := s.buffer.Flush(10)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if entries[0].Message != "INIT_START Runtime Version: nodejs:20.v13" {
+		t.Errorf("unexpected message: %s", entries[0].Message)
+	}
+	if entries[0].RequestID != "" {
+		t.Errorf("expected no request ID during init, got %s", entries[0].RequestID)
+	}
+}
+
+func TestServer_PlatformInitReport(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	events := []TelemetryEvent{{
+		Type: EventTypePlatformInitReport,
+		Time: "2026-02-05T21:34:18.100Z",
+		Record: map[string]interface{}{
+			"initializationType": "on-demand",
+			"phase":              "init",
+			"status":             "error",
+			"errorType":          "Runtime.ExitError",
+			"metrics":            map[string]interface{}{"durationMs": 182.4},
+		},
+	}}
+	postEvents(s, events)
+
+	entries := s.buffer.Flush(10)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	want := "INIT_REPORT Init Duration: 182.40 ms\tPhase: init\tStatus: error\tError Type: Runtime.ExitError"
+	if entries[0].Message != want {
+		t.Errorf("expected %q, got %q", want, entries[0].Message)
+	}
+	if entries[0].Priority != buffer.PriorityHigh {
+		t.Error("expected failed init report to be high priority")
+	}
+}
+
+func TestServer_PlatformInitRuntimeDoneCallsHandler(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	var status string
+	s.SetInitDoneHandler(func(st string) { status = st })
+
+	events := []TelemetryEvent{{
+		Type: EventTypePlatformInitRuntimeDone,
+		Time: "2026-02-05T21:34:18.050Z",
+		Record: map[string]interface{}{
+			"initializationType": "on-demand",
+			"phase":              "init",
+			"status":             "failure",
+		},
+	}}
+	postEvents(s, events)
+
+	if status != "failure" {
+		t.Errorf("expected handler status=failure, got %q", status)
+	}
+	entries := s.buffer.Flush(10)
+	if len(entries) != 1 || entries[0].Priority != buffer.PriorityHigh {
+		t.Fatalf("expected 1 high priority entry, got %+v", entries)
+	}
+	if want := "INIT_RUNTIME_DONE Status: failure\tPhase: init"; entries[0].Message != want {
+		t.Errorf("expected %q, got %q", want, entries[0].Message)
+	}
+}
+
+func TestServer_SnapStartRestorePhase(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	var status string
+	s.SetInitDoneHandler(func(st string) { status = st })
+
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformRestoreStart, Time: "2026-02-05T21:34:17.900Z", Record: map[string]interface{}{
+			"runtimeVersion":    "java:21.v12",
+			"runtimeVersionArn": "arn:aws:lambda:us-east-1::runtime:abc",
+		}},
+		{Type: EventTypePlatformRestoreRuntimeDone, Time: "2026-02-05T21:34:18.000Z", Record: map[string]interface{}{
+			"status": "success",
+		}},
+		{Type: EventTypePlatformRestoreReport, Time: "2026-02-05T21:34:18.010Z", Record: map[string]interface{}{
+			"status":  "success",
+			"metrics": map[string]interface{}{"durationMs": 571.666},
+		}},
+	})
+
+	if status != "success" {
+		t.Errorf("expected restoreRuntimeDone to call the init handler, got status %q", status)
+	}
+	want := []string{
+		"RESTORE_START Runtime Version: java:21.v12\tRuntime Version ARN: arn:aws:lambda:us-east-1::runtime:abc",
+		"RESTORE_RUNTIME_DONE Status: success",
+		"RESTORE_REPORT Restore Duration: 571.67 ms\tStatus: success",
+	}
+	entries := s.buffer.Flush(10)
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), entries)
+	}
+	for i, e := range entries {
+		if e.Message != want[i] {
+			t.Errorf("entry %d: expected %q, got %q", i, want[i], e.Message)
+		}
+		if e.Priority == buffer.PriorityHigh {
+			t.Errorf("entry %d: successful restore marked high priority", i)
+		}
+	}
+}
+
+func TestServer_FailedRestoreIsHighPriority(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	postEvents(s, []TelemetryEvent{{
+		Type: EventTypePlatformRestoreRuntimeDone,
+		Time: "2026-02-05T21:34:18.000Z",
+		Record: map[string]interface{}{
+			"status":    "error",
+			"errorType": "Runtime.RestoreHookUserErrorType",
+		},
+	}})
+	entries := s.buffer.Flush(10)
+	if len(entries) != 1 || entries[0].Priority != buffer.PriorityHigh {
+		t.Fatalf("expected 1 high priority entry, got %+v", entries)
+	}
+	if want := "RESTORE_RUNTIME_DONE Status: error\tError Type: Runtime.RestoreHookUserErrorType"; entries[0].Message != want {
+		t.Errorf("expected %q, got %q", want, entries[0].Message)
+	}
+}
+
+func TestServer_PlatformFault(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.currentRequestID = "abc-123"
+	events := []TelemetryEvent{{
+		Type:   EventTypePlatformFault,
+		Time:   "2026-02-05T21:34:19.000Z",
+		Record: "RequestId: abc-123 Process exited before completing request",
+	}}
+	postEvents(s, events)
+
+	entries := s.buffer.Flush(10)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Message != "FAULT RequestId: abc-123 Process exited before completing request" {
+		t.Errorf("unexpected message: %s", e.Message)
+	}
+	if e.StreamLabels["error"] != "true" || e.Priority != buffer.PriorityHigh {
+		t.Errorf("expected error=true high priority entry, got %+v", e)
+	}
+	if e.RequestID != "abc-123" {
+		t.Errorf("expected requestID=abc-123, got %s", e.RequestID)
+	}
+}
+
+func TestServer_PlatformExtension(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	events := []TelemetryEvent{
+		{
+			Type: EventTypePlatformExtension,
+			Time: "2026-02-05T21:34:17.950Z",
+			Record: map[string]interface{}{
+				"name":   "lambdawatch",
+				"state":  "Ready",
+				"events": []interface{}{"INVOKE", "SHUTDOWN"},
+			},
+		},
+		{
+			Type: EventTypePlatformExtension,
+			Time: "2026-02-05T21:34:17.960Z",
+			Record: map[string]interface{}{
+				"name":      "other",
+				"state":     "Ready",
+				"events":    []interface{}{},
+				"errorType": "Extension.Crash",
+			},
+		},
+	}
+	postEvents(s, events)
+
+	entries := s.buffer.Flush(10)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Message != "EXTENSION Name: lambdawatch\tState: Ready\tEvents: [INVOKE,SHUTDOWN]" {
+		t.Errorf("unexpected message: %q", entries[0].Message)
+	}
+	if entries[0].StreamLabels != nil {
+		t.Errorf("expected healthy extension without error marker, got %v", entries[0].StreamLabels)
+	}
+	if entries[1].StreamLabels["error"] != "true" {
+		t.Errorf("expected error=true on failed extension, got %v", entries[1].StreamLabels)
+	}
+	if !strings.HasSuffix(entries[1].Message, "Error Type: Extension.Crash") {
+		t.Errorf("unexpected message: %q", entries[1].Message)
+	}
+}
+
 func TestServer_FunctionLog(t *testing.T) {
 	s := newTestServer(0, true, nil)
 	s.currentRequestID = "req-1"
@@ -225,6 +553,20 @@ func TestServer_OwnExtensionLogsFiltered(t *testing.T) {
 	}
 }
 
+func TestServer_OwnExtensionLogsFilteredInAnyFormat(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	events := []TelemetryEvent{
+		{Type: EventTypeExtension, Time: "2026-02-05T21:34:18.835Z",
+			Record: `level=info timestamp=2026-02-05T21:34:18.835Z app_name="" environment=unknown context=LambdaWatch message="Internal log"`},
+		{Type: EventTypeExtension, Time: "2026-02-05T21:34:18.836Z",
+			Record: `2026-02-05T21:34:18.836Z INFO  [LambdaWatch] Internal log`},
+	}
+	postEvents(s, events)
+	if s.buffer.Len() != 0 {
+		t.Errorf("expected own logfmt/text extension logs filtered, got %d entries", s.buffer.Len())
+	}
+}
+
 func TestServer_OtherExtensionLogsKept(t *testing.T) {
 	s := newTestServer(0, true, nil)
 	events := []TelemetryEvent{{
@@ -238,6 +580,214 @@ func TestServer_OtherExtensionLogsKept(t *testing.T) {
 	}
 }
 
+// --- Trace ID Propagation ---
+
+func TestServer_TraceIDFromPlatformStartTracing(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	events := []TelemetryEvent{
+		{Type: EventTypePlatformStart, Time: "2026-02-05T21:34:18.205Z",
+			Record: map[string]interface{}{
+				"requestId": "req-1",
+				"version":   "$LATEST",
+				"tracing": map[string]interface{}{
+					"type":  "X-Amzn-Trace-Id",
+					"value": "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1",
+				},
+			}},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.835Z", Record: "plain log"},
+	}
+	postEvents(s, events)
+	entries := s.buffer.Flush(10)
+	for i, e := range entries {
+		if e.Attribute(buffer.AttrTraceID) != "1-5759e988-bd862e3fe1be46a994272793" {
+			t.Errorf("entry %d: TraceID = %q", i, e.Attribute(buffer.AttrTraceID))
+		}
+	}
+}
+
+func TestServer_TraceIDFromInvoke(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.SetTracing("req-1", "Root=1-abc-def;Sampled=0")
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformStart, Time: "2026-02-05T21:34:18.205Z",
+			Record: map[string]interface{}{"requestId": "req-1", "version": "$LATEST"}},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.835Z", Record: "plain log"},
+	})
+	entries := s.buffer.Flush(10)
+	if entries[1].Attribute(buffer.AttrTraceID) != "1-abc-def" {
+		t.Errorf("TraceID = %q, want 1-abc-def", entries[1].Attribute(buffer.AttrTraceID))
+	}
+}
+
+func TestServer_TraceIDFromLogBodyWins(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.SetTracing("req-1", "Root=1-abc-def")
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformStart, Time: "2026-02-05T21:34:18.205Z",
+			Record: map[string]interface{}{"requestId": "req-1", "version": "$LATEST"}},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.835Z", Record: `{"traceId":"from-log","msg":"x"}`},
+	})
+	entries := s.buffer.Flush(10)
+	if entries[1].Attribute(buffer.AttrTraceID) != "from-log" {
+		t.Errorf("TraceID = %q, want from-log", entries[1].Attribute(buffer.AttrTraceID))
+	}
+}
+
+func TestServer_TraceContext(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.EnableTraceContext()
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.835Z",
+			Record: `{"traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01","msg":"x"}`},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.836Z",
+			Record: `{"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7","msg":"x"}`},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.837Z",
+			Record: "calling orders X-Amzn-Trace-Id: Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1 done"},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.838Z", Record: "no trace here"},
+	})
+	entries := s.buffer.Flush(10)
+	want := [][2]string{
+		{"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{"1-5759e988-bd862e3fe1be46a994272793", "53995c3f42cd8ad8"},
+		{"", ""},
+	}
+	for i, e := range entries {
+		got := [2]string{e.Attribute(buffer.AttrTraceID), e.Attribute(buffer.AttrSpanID)}
+		if got != want[i] {
+			t.Errorf("%q: trace/span = %v, want %v", e.Message, got, want[i])
+		}
+	}
+}
+
+func TestServer_TraceContextDisabledByDefault(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.835Z",
+			Record: `{"traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01","span_id":"00f067aa0ba902b7"}`},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.836Z",
+			Record: "X-Amzn-Trace-Id: Root=1-5759e988-bd862e3fe1be46a994272793"},
+	})
+	for _, e := range s.buffer.Flush(10) {
+		if e.Attribute(buffer.AttrTraceID) != "" || e.Attribute(buffer.AttrSpanID) != "" {
+			t.Errorf("%q: attributes = %v, want no trace context", e.Message, e.Attributes)
+		}
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		in          string
+		trace, span string
+		ok          bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", "", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "", "", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", "", false},
+		{"not a traceparent", "", "", false},
+	}
+	for _, tt := range tests {
+		trace, span, ok := parseTraceparent(tt.in)
+		if trace != tt.trace || span != tt.span || ok != tt.ok {
+			t.Errorf("parseTraceparent(%q) = %q, %q, %v", tt.in, trace, span, ok)
+		}
+	}
+}
+
+func TestServer_LevelAttribute(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.835Z", Record: `{"level":"WARN","msg":"x"}`},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.836Z", Record: "2026-02-05T21:34:18.836Z\treq-1\tERROR\tboom"},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.837Z", Record: "no level here"},
+	})
+	entries := s.buffer.Flush(10)
+	want := []string{"warn", "error", ""}
+	for i, e := range entries {
+		if got := e.Attribute(buffer.AttrLevel); got != want[i] {
+			t.Errorf("%q: level = %q, want %q", e.Message, got, want[i])
+		}
+	}
+}
+
+func TestServer_TraceIDNotLeakedToOtherRequest(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.SetTracing("req-old", "Root=1-abc-def")
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformStart, Time: "2026-02-05T21:34:18.205Z",
+			Record: map[string]interface{}{"requestId": "req-new", "version": "$LATEST"}},
+	})
+	entries := s.buffer.Flush(10)
+	if entries[0].Attribute(buffer.AttrTraceID) != "" {
+		t.Errorf("TraceID = %q, want empty", entries[0].Attribute(buffer.AttrTraceID))
+	}
+}
+
+func TestParseXRayTraceID(t *testing.T) {
+	tests := map[string]string{
+		"Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1": "1-5759e988-bd862e3fe1be46a994272793",
+		"Parent=53995c3f42cd8ad8;Root=1-abc":                                         "1-abc",
+		"1-5759e988-bd862e3fe1be46a994272793":                                        "1-5759e988-bd862e3fe1be46a994272793",
+		"Parent=53995c3f42cd8ad8":                                                    "",
+		"":                                                                           "",
+	}
+	for in, want := range tests {
+		if got := parseXRayTraceID(in); got != want {
+			t.Errorf("parseXRayTraceID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestExtractTraceID(t *testing.T) {
+	tests := map[string]string{
+		`{"trace_id":"abc"}`:                       "abc",
+		`{"xray_trace_id":"Root=1-abc;Sampled=1"}`: "1-abc",
+		`{"msg":"no trace"}`:                       "",
+		`plain trace_id=abc`:                       "",
+	}
+	for in, want := range tests {
+		if got := extractTraceID(in); got != want {
+			t.Errorf("extractTraceID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// --- Priority ---
+
+func TestMessagePriority(t *testing.T) {
+	tests := []struct {
+		message string
+		want    buffer.Priority
+	}{
+		{`{"level":"error","msg":"boom"}`, buffer.PriorityHigh},
+		{`{"levelname":"CRITICAL"}`, buffer.PriorityHigh},
+		{`{"level":"info","msg":"ERROR in text"}`, buffer.PriorityNormal},
+		{"2026-02-05T08:12:42.944Z\tabc\tERROR\tsomething failed", buffer.PriorityHigh},
+		{"Traceback (most recent call last):", buffer.PriorityHigh},
+		{"all good", buffer.PriorityNormal},
+	}
+	for _, tt := range tests {
+		if got := messagePriority(tt.message, parseJSONFields(tt.message)); got != tt.want {
+			t.Errorf("messagePriority(%q) = %d, want %d", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestServer_FailedRuntimeDoneIsHighPriority(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformRuntimeDone, Time: "2026-02-05T21:34:19.572Z",
+			Record: map[string]interface{}{"requestId": "a", "status": "timeout"}},
+		{Type: EventTypePlatformRuntimeDone, Time: "2026-02-05T21:34:19.572Z",
+			Record: map[string]interface{}{"requestId": "b", "status": "success"}},
+	})
+	entries := s.buffer.Flush(10)
+	if entries[0].Priority != buffer.PriorityHigh || entries[1].Priority != buffer.PriorityNormal {
+		t.Errorf("priorities = %d, %d; want high, normal", entries[0].Priority, entries[1].Priority)
+	}
+}
+
 // --- 6.5 Request ID Handling ---
 
 func TestServer_RequestIDFromPlatformStart(t *testing.T) {
@@ -322,8 +872,32 @@ func TestServer_LargeMessageSplit(t *testing.T) {
 		t.Errorf("expected message to be split into multiple chunks, got %d entries", count)
 	}
 	entries := s.buffer.Flush(count)
-	if !strings.Contains(entries[0].Message, "[chunk 1/") {
-		t.Errorf("expected chunk prefix, got: %s", entries[0].Message)
+	var joined strings.Builder
+	for i, e := range entries {
+		if e.Chunk.ID == "" || e.Chunk.ID != entries[0].Chunk.ID {
+			t.Errorf("chunk %d ID = %q, want one shared non-empty ID", i, e.Chunk.ID)
+		}
+		if e.Chunk.Index != i+1 || e.Chunk.Total != count {
+			t.Errorf("chunk %d = %d/%d, want %d/%d", i, e.Chunk.Index, e.Chunk.Total, i+1, count)
+		}
+		joined.WriteString(e.Message)
+	}
+	if joined.String() != bigMsg {
+		t.Error("chunks do not reassemble into the original message")
+	}
+}
+
+func TestServer_LargeJSONFieldSplitAsBase64(t *testing.T) {
+	s := newTestServer(100, true, nil)
+	postEvents(s, []TelemetryEvent{{
+		Type:   EventTypeFunction,
+		Time:   "2026-02-05T21:34:18.835Z",
+		Record: `{"blob":"` + strings.Repeat("x", 300) + `"}`,
+	}})
+	for _, e := range s.buffer.Flush(s.buffer.Len()) {
+		if e.StreamLabels[encodingLabel] != "base64" {
+			t.Errorf("chunk %d/%d labels = %v, want encoding=base64", e.Chunk.Index, e.Chunk.Total, e.StreamLabels)
+		}
 	}
 }
 
@@ -373,6 +947,47 @@ func TestParseTimestamp_Invalid(t *testing.T) {
 	}
 }
 
+func TestServer_BackfillsMissingTimestamps(t *testing.T) {
+	s := newTestServer(0, false, nil)
+	events := []TelemetryEvent{
+		{Type: EventTypePlatformStart, Time: "2026-02-05T21:34:18.000Z",
+			Record: map[string]interface{}{"requestId": "req-1", "version": "$LATEST"}},
+		{Type: EventTypeFunction, Time: "", Record: "first"},
+		{Type: EventTypeFunction, Time: "not a time", Record: "second"},
+		{Type: EventTypeFunction, Time: "", Record: "third"},
+		{Type: EventTypePlatformRuntimeDone, Time: "2026-02-05T21:34:18.400Z",
+			Record: map[string]interface{}{"requestId": "req-1", "status": "success"}},
+	}
+	postEvents(s, events)
+
+	entries := s.buffer.Flush(10)
+	start := time.Date(2026, 2, 5, 21, 34, 18, 0, time.UTC).UnixMilli()
+	want := map[string]int64{"first": start + 100, "second": start + 200, "third": start + 300}
+	for _, e := range entries {
+		if ts, ok := want[e.Message]; ok && e.Timestamp != ts {
+			t.Errorf("%s: timestamp = %d, want %d", e.Message, e.Timestamp, ts)
+		}
+	}
+}
+
+func TestServer_BackfillWithoutRuntimeDoneStaysBeforeNow(t *testing.T) {
+	s := newTestServer(0, false, nil)
+	startTime := time.Now().Add(-time.Second).UTC()
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformStart, Time: startTime.Format(time.RFC3339Nano),
+			Record: map[string]interface{}{"requestId": "req-1", "version": "$LATEST"}},
+	})
+	s.buffer.Flush(10)
+
+	before := time.Now().UnixMilli()
+	postEvents(s, []TelemetryEvent{{Type: EventTypeFunction, Time: "", Record: "late"}})
+
+	e := s.buffer.Flush(10)[0]
+	if e.Timestamp <= startTime.UnixMilli() || e.Timestamp > before {
+		t.Errorf("timestamp %d not between start %d and now %d", e.Timestamp, startTime.UnixMilli(), before)
+	}
+}
+
 // --- 6.8 Batch Processing ---
 
 func TestServer_MultipleEventsInBatch(t *testing.T) {
@@ -390,7 +1005,7 @@ func TestServer_MultipleEventsInBatch(t *testing.T) {
 
 func TestServer_MixedEventTypes(t *testing.T) {
 	var runtimeDoneCalled bool
-	handler := func(reqID string) { runtimeDoneCalled = true }
+	handler := func(reqID, status string) { runtimeDoneCalled = true }
 	s := newTestServer(0, true, handler)
 
 	events := []TelemetryEvent{
@@ -414,13 +1029,13 @@ func TestServer_MixedEventTypes(t *testing.T) {
 
 func TestServer_RuntimeDoneAfterBufferAdd(t *testing.T) {
 	var bufLenAtCallback int
-	handler := func(reqID string) {
+	handler := func(reqID, status string) {
 		// At callback time, entries should already be in buffer
 		// We can't access s.buffer here directly, so we capture via closure
 	}
 	s := newTestServer(0, true, nil)
 	// Override handler to check buffer state
-	s.onRuntimeDone = func(reqID string) {
+	s.onRuntimeDone = func(reqID, status string) {
 		bufLenAtCallback = s.buffer.Len()
 	}
 
@@ -471,26 +1086,6 @@ func TestExtractRequestID(t *testing.T) {
 	}
 }
 
-func TestSplitMessage(t *testing.T) {
-	// Message under limit
-	chunks := splitMessage("short", 100)
-	if len(chunks) != 1 {
-		t.Errorf("expected 1 chunk, got %d", len(chunks))
-	}
-
-	// Message over limit
-	msg := strings.Repeat("a", 300)
-	chunks = splitMessage(msg, 100)
-	if len(chunks) < 2 {
-		t.Errorf("expected multiple chunks, got %d", len(chunks))
-	}
-	for i, c := range chunks {
-		if !strings.Contains(c, "[chunk") {
-			t.Errorf("chunk %d missing prefix: %s", i, c)
-		}
-	}
-}
-
 func TestFormatPlatformStart(t *testing.T) {
 	record := map[string]interface{}{"requestId": "req-1", "version": "$LATEST"}
 	msg := formatPlatformStart(record)
@@ -526,3 +1121,219 @@ func TestListenerURI(t *testing.T) {
 		t.Errorf("unexpected URI: %s", uri)
 	}
 }
+
+func TestServer_ColdStartMarksOnlyFirstInvocation(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.SetColdStart("req-1")
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformStart, Time: "2026-02-05T21:34:18.205Z",
+			Record: map[string]interface{}{"requestId": "req-1", "version": "$LATEST"}},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.835Z", Record: "cold log"},
+		{Type: EventTypePlatformStart, Time: "2026-02-05T21:34:19.205Z",
+			Record: map[string]interface{}{"requestId": "req-2", "version": "$LATEST"}},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:19.835Z", Record: "warm log"},
+	})
+	for _, e := range s.buffer.Flush(10) {
+		if want := e.RequestID == "req-1"; (e.Attribute(buffer.AttrColdStart) == "true") != want {
+			t.Errorf("%q (request %s): attributes %v, want cold start %v", e.Message, e.RequestID, e.Attributes, want)
+		}
+	}
+}
+
+func TestServer_PanickingEventDroppedRestOfDeliveryKept(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.SetReportHandler(func(ReportMetrics) { panic("boom") })
+	w := postEvents(s, []TelemetryEvent{
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.835Z", Record: "before"},
+		{Type: EventTypePlatformReport, Time: "2026-02-05T21:34:18.900Z",
+			Record: map[string]interface{}{"requestId": "req-1", "metrics": map[string]interface{}{"durationMs": 1.0}}},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.950Z", Record: "after"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var messages []string
+	for _, e := range s.buffer.Flush(10) {
+		messages = append(messages, e.Message)
+	}
+	got := strings.Join(messages, "|")
+	if !strings.Contains(got, "before") || !strings.Contains(got, "after") {
+		t.Errorf("delivery lost around the panicking event: %q", got)
+	}
+}
+
+func TestServer_PanicInHandlerIsRecovered(t *testing.T) {
+	s := newTestServer(0, true, func(string, string) { panic("flush failed") })
+	var recovered interface{}
+	s.SetPanicHandler(func(r interface{}) { recovered = r })
+
+	w := postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformRuntimeDone, Time: "2026-02-05T21:34:18.835Z",
+			Record: map[string]interface{}{"requestId": "req-1", "status": "success"}},
+	})
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the delivery to be acknowledged, got %d", w.Code)
+	}
+	if recovered != "flush failed" {
+		t.Errorf("panic handler got %v", recovered)
+	}
+}
+
+func TestServer_ListenerFailureAndRestart(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	failed := make(chan error, 1)
+	s.SetListenerFailureHandler(func(err error) { failed <- err })
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	defer s.Shutdown(context.Background())
+
+	// Lose the listener from under the running server
+	s.listenMu.Lock()
+	s.listener.Close()
+	s.listenMu.Unlock()
+	select {
+	case <-failed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("listener failure not reported")
+	}
+
+	if err := s.Restart(); err != nil {
+		t.Fatalf("Restart() error: %v", err)
+	}
+	s.listenMu.Lock()
+	addr := s.listener.Addr().String()
+	s.listenMu.Unlock()
+	body := `[{"time":"2026-02-05T21:34:18.300Z","type":"function","record":"after restart"}]`
+	resp, err := http.Post("http://"+addr+"/", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("post after restart: %v", err)
+	}
+	resp.Body.Close()
+	if entries := s.buffer.Flush(10); len(entries) != 1 || entries[0].Message != "after restart" {
+		t.Errorf("expected delivery after restart, got %+v", entries)
+	}
+}
+
+func TestServer_ShutdownIsNotAFailure(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	failed := make(chan error, 1)
+	s.SetListenerFailureHandler(func(err error) { failed <- err })
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	_ = s.Shutdown(context.Background())
+
+	select {
+	case err := <-failed:
+		t.Errorf("shutdown reported as failure: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := s.Restart(); err == nil {
+		t.Error("Restart() after Shutdown should fail")
+	}
+}
+
+func TestServer_StartPortInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	s := NewServer(buffer.New(10), ln.Addr().(*net.TCPAddr).Port, 0, false, nil)
+	if err := s.Start(); err == nil {
+		s.Shutdown(context.Background())
+		t.Error("expected Start() to fail on a port in use")
+	}
+}
+
+func TestServer_StartProbesPastPortInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	taken := ln.Addr().(*net.TCPAddr).Port
+
+	s := NewServer(buffer.New(10), taken, 0, false, nil)
+	s.SetPortProbe(20)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	defer s.Shutdown(context.Background())
+
+	if s.port <= taken || s.port > taken+20 {
+		t.Errorf("listening on %d, want a port in (%d, %d]", s.port, taken, taken+20)
+	}
+	if want := fmt.Sprintf("http://sandbox.localdomain:%d", s.port); s.ListenerURI() != want {
+		t.Errorf("ListenerURI() = %s, want %s", s.ListenerURI(), want)
+	}
+}
+
+func TestServer_FailedOutcomeMarksInvocation(t *testing.T) {
+	var doneStatus string
+	s := newTestServer(0, true, func(id, status string) { doneStatus = status })
+	postEvents(s, []TelemetryEvent{
+		{Time: "2026-02-05T21:34:18.000Z", Type: EventTypePlatformStart, Record: map[string]interface{}{"requestId": "req-slow"}},
+		{Time: "2026-02-05T21:34:18.100Z", Type: EventTypeFunction, Record: "still working\n"},
+	})
+	postEvents(s, []TelemetryEvent{
+		{Time: "2026-02-05T21:34:21.000Z", Type: EventTypePlatformRuntimeDone, Record: map[string]interface{}{"requestId": "req-slow", "status": "timeout"}},
+		{Time: "2026-02-05T21:34:20.900Z", Type: EventTypeFunction, Record: "late line\n"},
+	})
+
+	if doneStatus != "timeout" {
+		t.Errorf("runtimeDone handler got status %q, want timeout", doneStatus)
+	}
+	entries := s.buffer.Flush(10)
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(entries))
+	}
+	for _, e := range entries {
+		if e.Attribute(buffer.AttrOutcome) != "timeout" || e.Priority != buffer.PriorityHigh {
+			t.Errorf("%s entry %q: outcome %q priority %d, want timeout and high", e.Type, e.Message, e.Attribute(buffer.AttrOutcome), e.Priority)
+		}
+	}
+}
+
+func TestServer_SuccessfulOutcomeNotMarked(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	postEvents(s, []TelemetryEvent{
+		{Time: "2026-02-05T21:34:18.000Z", Type: EventTypePlatformStart, Record: map[string]interface{}{"requestId": "req-ok"}},
+		{Time: "2026-02-05T21:34:18.100Z", Type: EventTypeFunction, Record: "done\n"},
+		{Time: "2026-02-05T21:34:18.200Z", Type: EventTypePlatformRuntimeDone, Record: map[string]interface{}{"requestId": "req-ok", "status": "success"}},
+	})
+	for _, e := range s.buffer.Flush(10) {
+		if e.Attribute(buffer.AttrOutcome) != "" {
+			t.Errorf("entry %q has outcome %q, want none", e.Message, e.Attribute(buffer.AttrOutcome))
+		}
+	}
+}
+
+// Logs API deliveries (schema 2021-03-18) share the Telemetry API envelope
+func TestServer_LogsAPIDelivery(t *testing.T) {
+	var doneID string
+	s := newTestServer(0, true, func(id, status string) { doneID = id })
+	w := postEvents(s, []TelemetryEvent{
+		{Time: "2026-02-05T21:34:18.000Z", Type: EventTypePlatformStart, Record: map[string]interface{}{"requestId": "req-logs", "version": "$LATEST"}},
+		{Time: "2026-02-05T21:34:18.100Z", Type: EventTypeFunction, Record: "hello from the Logs API\n"},
+		{Time: "2026-02-05T21:34:18.200Z", Type: EventTypePlatformRuntimeDone, Record: map[string]interface{}{"requestId": "req-logs", "status": "success"}},
+		{Time: "2026-02-05T21:34:18.200Z", Type: "platform.logsSubscription", Record: map[string]interface{}{"name": "lambdawatch"}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if doneID != "req-logs" {
+		t.Errorf("runtimeDone handler got %q, want req-logs", doneID)
+	}
+	var found bool
+	for _, e := range s.buffer.Flush(10) {
+		if e.Message == "hello from the Logs API" {
+			found = e.RequestID == "req-logs"
+		}
+	}
+	if !found {
+		t.Error("function log not attributed to its request")
+	}
+}
@@ -0,0 +1,151 @@
+package telemetryapi
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+)
+
+// splitMessage splits a message into chunks of at most maxSize bytes that
+// each stay valid on their own. A JSON object is split between top-level
+// fields into smaller objects; if one field alone is too large, the record
+// is base64-encoded and the encoding split instead, reported by encoded.
+// Other text is split on UTF-8 rune boundaries. Chunks carry no marker in
+// their text; callers attach buffer.Chunk metadata so consumers can
+// reassemble the line.
+func splitMessage(message string, maxSize int) (chunks []string, encoded bool) {
+	if len(message) <= maxSize {
+		return []string{message}, false
+	}
+
+	if strings.HasPrefix(message, "{") {
+		if fields, ok := parseObject(message); ok {
+			if chunks, ok := splitObject(fields, maxSize); ok {
+				return chunks, false
+			}
+			return splitBytes(base64.StdEncoding.EncodeToString([]byte(message)), maxSize), true
+		}
+	}
+
+	return splitRunes(message, maxSize), false
+}
+
+// SplitEntries replaces each function or extension log longer than maxSize
+// with its chunks, numbered and a millisecond apart so they keep
+// their order. maxSize 0 leaves entries whole. pkg/shipper applies it too.
+func SplitEntries(entries []buffer.LogEntry, maxSize int) []buffer.LogEntry {
+	if maxSize <= 0 {
+		return entries
+	}
+	var split []buffer.LogEntry
+	for i, entry := range entries {
+		long := len(entry.Message) > maxSize &&
+			(entry.Type == EventTypeFunction || entry.Type == EventTypeExtension)
+		if !long {
+			if split != nil {
+				split = append(split, entry)
+			}
+			continue
+		}
+		if split == nil {
+			split = append(make([]buffer.LogEntry, 0, len(entries)+1), entries[:i]...)
+		}
+
+		chunks, encoded := splitMessage(entry.Message, maxSize)
+		labels := entry.StreamLabels
+		if encoded {
+			labels = make(map[string]string, len(entry.StreamLabels)+1)
+			for k, v := range entry.StreamLabels {
+				labels[k] = v
+			}
+			labels[encodingLabel] = "base64"
+		}
+		chunkID := newChunkID()
+		for n, chunk := range chunks {
+			part := entry
+			part.Timestamp += int64(n)
+			part.Message = chunk
+			part.StreamLabels = labels
+			part.Chunk = buffer.Chunk{ID: chunkID, Index: n + 1, Total: len(chunks)}
+			split = append(split, part)
+		}
+	}
+	if split == nil {
+		return entries
+	}
+	return split
+}
+
+// splitObject packs top-level fields, in order, into as few objects of at
+// most maxSize bytes as possible. It fails if a field does not fit alone.
+func splitObject(fields []jsonField, maxSize int) ([]string, bool) {
+	var chunks []string
+	var sb strings.Builder
+	for _, f := range fields {
+		field := f.encode()
+		if len("{}")+len(field) > maxSize {
+			return nil, false
+		}
+		if sb.Len() > 0 && sb.Len()+len(",")+len(field)+len("}") > maxSize {
+			sb.WriteByte('}')
+			chunks = append(chunks, sb.String())
+			sb.Reset()
+		}
+		if sb.Len() == 0 {
+			sb.WriteByte('{')
+		} else {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(field)
+	}
+	if sb.Len() > 0 {
+		sb.WriteByte('}')
+		chunks = append(chunks, sb.String())
+	}
+	return chunks, true
+}
+
+// splitRunes cuts message into pieces of at most maxSize bytes without
+// splitting a multi-byte character, unless maxSize is smaller than one
+func splitRunes(message string, maxSize int) []string {
+	chunks := make([]string, 0, (len(message)+maxSize-1)/maxSize)
+	for i := 0; i < len(message); {
+		end := i + maxSize
+		if end >= len(message) {
+			end = len(message)
+		} else {
+			cut := end
+			for cut > i && !utf8.RuneStart(message[cut]) {
+				cut--
+			}
+			if cut > i {
+				end = cut
+			}
+		}
+		chunks = append(chunks, message[i:end])
+		i = end
+	}
+	return chunks
+}
+
+// splitBytes cuts ASCII text into pieces of at most maxSize bytes
+func splitBytes(text string, maxSize int) []string {
+	chunks := make([]string, 0, (len(text)+maxSize-1)/maxSize)
+	for i := 0; i < len(text); i += maxSize {
+		chunks = append(chunks, text[i:min(i+maxSize, len(text))])
+	}
+	return chunks
+}
+
+// newChunkID returns a random (version 4) UUID identifying a split line
+func newChunkID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
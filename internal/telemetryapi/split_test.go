@@ -0,0 +1,109 @@
+package telemetryapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	// Message under limit
+	chunks, encoded := splitMessage("short", 100)
+	if len(chunks) != 1 || encoded {
+		t.Errorf("expected 1 unencoded chunk, got %d (encoded %v)", len(chunks), encoded)
+	}
+
+	// Message over limit
+	msg := strings.Repeat("a", 300)
+	chunks, _ = splitMessage(msg, 100)
+	if len(chunks) < 2 {
+		t.Errorf("expected multiple chunks, got %d", len(chunks))
+	}
+	for i, c := range chunks {
+		if len(c) > 100 {
+			t.Errorf("chunk %d is %d bytes, want <= 100", i, len(c))
+		}
+	}
+	if strings.Join(chunks, "") != msg {
+		t.Error("chunks do not reassemble into the original message")
+	}
+}
+
+func TestSplitMessage_RuneBoundaries(t *testing.T) {
+	msg := strings.Repeat("héllo wörld 日本語 ", 40)
+	chunks, encoded := splitMessage(msg, 50)
+	if encoded {
+		t.Fatal("plain text should not be encoded")
+	}
+	for i, c := range chunks {
+		if !utf8.ValidString(c) {
+			t.Errorf("chunk %d splits a character: %q", i, c)
+		}
+		if len(c) > 50 {
+			t.Errorf("chunk %d is %d bytes, want <= 50", i, len(c))
+		}
+	}
+	if strings.Join(chunks, "") != msg {
+		t.Error("chunks do not reassemble into the original message")
+	}
+}
+
+func TestSplitMessage_JSONFieldBoundaries(t *testing.T) {
+	msg := `{"level":"info","message":"` + strings.Repeat("m", 40) + `","user":{"id":7,"name":"` + strings.Repeat("n", 30) + `"},"tags":["a","b"]}`
+	chunks, encoded := splitMessage(msg, 80)
+	if encoded {
+		t.Fatal("splittable JSON should not be encoded")
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("expected multiple chunks, got %d", len(chunks))
+	}
+
+	merged := make(map[string]interface{})
+	for i, c := range chunks {
+		if len(c) > 80 {
+			t.Errorf("chunk %d is %d bytes, want <= 80", i, len(c))
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(c), &fields); err != nil {
+			t.Fatalf("chunk %d is not a JSON object: %v: %s", i, err, c)
+		}
+		for k, v := range fields {
+			merged[k] = v
+		}
+	}
+	var want map[string]interface{}
+	_ = json.Unmarshal([]byte(msg), &want)
+	if len(merged) != len(want) {
+		t.Errorf("merged chunks have %d fields, want %d", len(merged), len(want))
+	}
+}
+
+func TestSplitMessage_OversizedJSONFieldFallsBackToBase64(t *testing.T) {
+	msg := `{"level":"info","payload":"` + strings.Repeat("é", 100) + `"}`
+	chunks, encoded := splitMessage(msg, 64)
+	if !encoded {
+		t.Fatal("expected base64 chunks when a field cannot fit")
+	}
+	for i, c := range chunks {
+		if len(c) > 64 {
+			t.Errorf("chunk %d is %d bytes, want <= 64", i, len(c))
+		}
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.Join(chunks, ""))
+	if err != nil || string(decoded) != msg {
+		t.Errorf("base64 chunks do not decode to the original message (err %v)", err)
+	}
+}
+
+func TestNewChunkID(t *testing.T) {
+	id := newChunkID()
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id) {
+		t.Errorf("newChunkID() = %q, want a version 4 UUID", id)
+	}
+	if newChunkID() == id {
+		t.Error("newChunkID() repeated an ID")
+	}
+}
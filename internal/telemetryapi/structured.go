@@ -0,0 +1,93 @@
+package telemetryapi
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+)
+
+// structuredFields lead a structured record's line in this order; any other
+// fields the runtime added follow sorted by name
+var structuredFields = []string{"timestamp", "level", "requestId", "message"}
+
+// structuredRecord is a function log record in Lambda's JSON log format.
+// With schema 2022-12-13 and advanced logging controls set to JSON, Lambda
+// delivers each line as an object carrying its own timestamp, level and
+// request ID, so none of them need to be parsed out of the text.
+type structuredRecord struct {
+	timestamp int64
+	level     string
+	requestID string
+	fields    map[string]interface{}
+}
+
+// parseStructuredRecord returns record as a structuredRecord, or false if it
+// is not an object with a parsable timestamp and a message
+func parseStructuredRecord(record interface{}) (structuredRecord, bool) {
+	fields, ok := record.(map[string]interface{})
+	if !ok {
+		return structuredRecord{}, false
+	}
+	if _, ok := fields["message"]; !ok {
+		return structuredRecord{}, false
+	}
+	timestamp, _ := fields["timestamp"].(string)
+	ts, ok := parseTimestampOK(timestamp)
+	if !ok {
+		return structuredRecord{}, false
+	}
+
+	level, _ := fields["level"].(string)
+	requestID, _ := fields["requestId"].(string)
+	return structuredRecord{
+		timestamp: ts,
+		level:     level,
+		requestID: requestID,
+		fields:    fields,
+	}, true
+}
+
+// priority ranks the record by its level alone
+func (r structuredRecord) priority() buffer.Priority {
+	if errorLevels[strings.ToLower(r.level)] {
+		return buffer.PriorityHigh
+	}
+	return buffer.PriorityNormal
+}
+
+// line encodes the record as the JSON object shipped to Loki, with the
+// fields Lambda always sets first so lines read the same across runtimes
+func (r structuredRecord) line() string {
+	rest := make([]string, 0, len(r.fields))
+	for key := range r.fields {
+		if !isStructuredField(key) {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+
+	out := make([]jsonField, 0, len(r.fields))
+	for _, key := range append(structuredFields, rest...) {
+		value, ok := r.fields[key]
+		if !ok {
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		out = append(out, jsonField{key: key, value: raw})
+	}
+	return encodeObject(out)
+}
+
+func isStructuredField(key string) bool {
+	for _, f := range structuredFields {
+		if key == f {
+			return true
+		}
+	}
+	return false
+}
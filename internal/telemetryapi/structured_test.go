@@ -0,0 +1,80 @@
+package telemetryapi
+
+import (
+	"testing"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+)
+
+func TestParseStructuredRecord(t *testing.T) {
+	record := map[string]interface{}{
+		"requestId": "req-1",
+		"message":   "order placed",
+		"level":     "ERROR",
+		"timestamp": "2026-02-05T21:34:18.123Z",
+		"orderId":   "o-9",
+		"amount":    12.5,
+	}
+	rec, ok := parseStructuredRecord(record)
+	if !ok {
+		t.Fatal("expected a structured record")
+	}
+	if rec.requestID != "req-1" || rec.level != "ERROR" || rec.timestamp != 1770327258123 {
+		t.Errorf("got %+v", rec)
+	}
+	if rec.priority() != buffer.PriorityHigh {
+		t.Error("ERROR level should be high priority")
+	}
+
+	want := `{"timestamp":"2026-02-05T21:34:18.123Z","level":"ERROR","requestId":"req-1","message":"order placed","amount":12.5,"orderId":"o-9"}`
+	if got := rec.line(); got != want {
+		t.Errorf("line() = %s\nwant %s", got, want)
+	}
+
+	for name, record := range map[string]interface{}{
+		"text":         "2026-02-05T21:34:18.123Z\treq-1\tINFO\thello",
+		"no message":   map[string]interface{}{"timestamp": "2026-02-05T21:34:18.123Z"},
+		"no timestamp": map[string]interface{}{"message": "hello"},
+		"bad time":     map[string]interface{}{"message": "hello", "timestamp": "yesterday"},
+	} {
+		if _, ok := parseStructuredRecord(record); ok {
+			t.Errorf("%s: expected no structured record", name)
+		}
+	}
+}
+
+// Structured records are attributed by their own requestId and timestamp,
+// never by the RequestId: regex in their text
+func TestServer_StructuredFunctionRecord(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformStart, Time: "2026-02-05T21:34:18.000Z", Record: map[string]interface{}{"requestId": "req-1"}},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:19.000Z", Record: map[string]interface{}{
+			"timestamp": "2026-02-05T21:34:18.250Z",
+			"level":     "WARN",
+			"requestId": "req-2",
+			"message":   "retrying RequestId: req-0",
+		}},
+	})
+
+	var got *buffer.LogEntry
+	entries := s.buffer.Flush(10)
+	for i := range entries {
+		if entries[i].Type == EventTypeFunction {
+			got = &entries[i]
+		}
+	}
+	if got == nil {
+		t.Fatal("function record not buffered")
+	}
+	if got.RequestID != "req-2" {
+		t.Errorf("RequestID = %q, want req-2", got.RequestID)
+	}
+	if got.Timestamp != 1770327258250 {
+		t.Errorf("Timestamp = %d, want the record's own", got.Timestamp)
+	}
+	want := `{"timestamp":"2026-02-05T21:34:18.250Z","level":"WARN","requestId":"req-2","message":"retrying RequestId: req-0"}`
+	if got.Message != want {
+		t.Errorf("Message = %s\nwant %s", got.Message, want)
+	}
+}
@@ -0,0 +1,135 @@
+package telemetryapi
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+)
+
+// EventTypeInvocationSummary is the entry type and stream label value of
+// per-invocation summary entries
+const EventTypeInvocationSummary = "invocation_summary"
+
+// maxTrackedInvocations bounds the tracker if platform.report never arrives
+const maxTrackedInvocations = 16
+
+// invocationSummary is the structured body of a summary entry
+type invocationSummary struct {
+	RequestID        string  `json:"request_id"`
+	Status           string  `json:"status"`
+	Error            bool    `json:"error"`
+	DurationMs       float64 `json:"duration_ms"`
+	BilledDurationMs float64 `json:"billed_duration_ms"`
+	MemorySizeMB     float64 `json:"memory_size_mb"`
+	MaxMemoryUsedMB  float64 `json:"max_memory_used_mb"`
+	InitDurationMs   float64 `json:"init_duration_ms,omitempty"`
+	LogCount         int     `json:"log_count"`
+	LogBytes         int     `json:"log_bytes"`
+}
+
+// invocationTracker correlates platform.start, runtimeDone and report events
+// with the logs shipped for each request
+type invocationTracker struct {
+	mu          sync.Mutex
+	invocations map[string]*invocationSummary
+}
+
+func newInvocationTracker() *invocationTracker {
+	return &invocationTracker{invocations: make(map[string]*invocationSummary)}
+}
+
+// get returns the summary for requestID, creating it if needed.
+// Caller must hold the lock.
+func (t *invocationTracker) get(requestID string) *invocationSummary {
+	if sum, ok := t.invocations[requestID]; ok {
+		return sum
+	}
+	if len(t.invocations) >= maxTrackedInvocations {
+		for id := range t.invocations {
+			delete(t.invocations, id)
+			break
+		}
+	}
+	sum := &invocationSummary{RequestID: requestID}
+	t.invocations[requestID] = sum
+	return sum
+}
+
+// start begins tracking a request
+func (t *invocationTracker) start(requestID string) {
+	if requestID == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.get(requestID)
+}
+
+// runtimeDone records the invocation's final status
+func (t *invocationTracker) runtimeDone(requestID, status string) {
+	if requestID == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.get(requestID).Status = status
+}
+
+// count tallies function and extension log entries that will be shipped
+func (t *invocationTracker) count(entries []buffer.LogEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range entries {
+		e := &entries[i]
+		if e.RequestID == "" || (e.Type != EventTypeFunction && e.Type != EventTypeExtension) {
+			continue
+		}
+		sum := t.get(e.RequestID)
+		sum.LogCount++
+		sum.LogBytes += len(e.Message)
+	}
+}
+
+// finish completes the summary from a platform.report record and returns it
+// as a log entry. ok is false if the record has no request ID.
+func (t *invocationTracker) finish(record interface{}, ts int64) (buffer.LogEntry, bool) {
+	recordMap, _ := record.(map[string]interface{})
+	requestID, _ := recordMap["requestId"].(string)
+	if requestID == "" {
+		return buffer.LogEntry{}, false
+	}
+
+	t.mu.Lock()
+	sum := t.get(requestID)
+	delete(t.invocations, requestID)
+	t.mu.Unlock()
+
+	if status, ok := recordMap["status"].(string); ok && status != "" {
+		sum.Status = status
+	}
+	if metrics, ok := recordMap["metrics"].(map[string]interface{}); ok {
+		sum.DurationMs, _ = metrics["durationMs"].(float64)
+		sum.BilledDurationMs, _ = metrics["billedDurationMs"].(float64)
+		sum.MemorySizeMB, _ = metrics["memorySizeMB"].(float64)
+		sum.MaxMemoryUsedMB, _ = metrics["maxMemoryUsedMB"].(float64)
+		sum.InitDurationMs, _ = metrics["initDurationMs"].(float64)
+	}
+	sum.Error = sum.Status != "" && sum.Status != "success"
+
+	body, _ := json.Marshal(sum)
+	priority := buffer.PriorityNormal
+	if sum.Error {
+		priority = buffer.PriorityHigh
+	}
+
+	// RequestID is left empty: the body already carries request_id, so
+	// the batch must not inject it a second time
+	return buffer.LogEntry{
+		Timestamp:    ts,
+		Message:      string(body),
+		Type:         EventTypeInvocationSummary,
+		Priority:     priority,
+		StreamLabels: map[string]string{"type": EventTypeInvocationSummary},
+	}, true
+}
@@ -0,0 +1,81 @@
+package telemetryapi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestServer_InvocationSummary(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.EnableInvocationSummaries()
+
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformStart, Time: "2026-02-05T21:34:18.205Z",
+			Record: map[string]interface{}{"requestId": "req-1", "version": "$LATEST"}},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.300Z", Record: "hello"},
+		{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.400Z", Record: "world!"},
+		{Type: EventTypePlatformRuntimeDone, Time: "2026-02-05T21:34:19.000Z",
+			Record: map[string]interface{}{"requestId": "req-1", "status": "error"}},
+	})
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformReport, Time: "2026-02-05T21:34:19.100Z",
+			Record: map[string]interface{}{
+				"requestId": "req-1",
+				"metrics": map[string]interface{}{
+					"durationMs":       812.5,
+					"billedDurationMs": 813.0,
+					"memorySizeMB":     128.0,
+					"maxMemoryUsedMB":  64.0,
+				},
+			}},
+	})
+
+	entries := s.buffer.Flush(20)
+	last := entries[len(entries)-1]
+	if last.Type != EventTypeInvocationSummary {
+		t.Fatalf("expected summary entry last, got %s", last.Type)
+	}
+	if last.StreamLabels["type"] != EventTypeInvocationSummary {
+		t.Errorf("StreamLabels = %v", last.StreamLabels)
+	}
+
+	var sum invocationSummary
+	if err := json.Unmarshal([]byte(last.Message), &sum); err != nil {
+		t.Fatalf("summary is not JSON: %v", err)
+	}
+	if sum.RequestID != "req-1" || sum.Status != "error" || !sum.Error {
+		t.Errorf("unexpected status fields: %+v", sum)
+	}
+	if sum.DurationMs != 812.5 || sum.BilledDurationMs != 813 || sum.MaxMemoryUsedMB != 64 {
+		t.Errorf("unexpected metrics: %+v", sum)
+	}
+	if sum.LogCount != 2 || sum.LogBytes != len("hello")+len("world!") {
+		t.Errorf("LogCount/LogBytes = %d/%d, want 2/11", sum.LogCount, sum.LogBytes)
+	}
+	if len(s.summaries.invocations) != 0 {
+		t.Errorf("expected tracker to forget finished request, has %d", len(s.summaries.invocations))
+	}
+}
+
+func TestServer_InvocationSummaryDisabledByDefault(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	postEvents(s, []TelemetryEvent{
+		{Type: EventTypePlatformReport, Time: "2026-02-05T21:34:19.100Z",
+			Record: map[string]interface{}{"requestId": "req-1"}},
+	})
+	for _, e := range s.buffer.Flush(10) {
+		if e.Type == EventTypeInvocationSummary {
+			t.Error("unexpected summary entry when disabled")
+		}
+	}
+}
+
+func TestInvocationTracker_Bounded(t *testing.T) {
+	tr := newInvocationTracker()
+	for i := 0; i < maxTrackedInvocations*2; i++ {
+		tr.start(string(rune('a' + i)))
+	}
+	if len(tr.invocations) > maxTrackedInvocations {
+		t.Errorf("tracked %d invocations, want <= %d", len(tr.invocations), maxTrackedInvocations)
+	}
+}
@@ -0,0 +1,223 @@
+package telemetryapi
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+)
+
+// maxHeldEntries bounds what one invocation may hold; past it the
+// invocation is decided without waiting for its outcome
+const maxHeldEntries = 5000
+
+// tailSampler holds each invocation's function logs until its
+// platform.runtimeDone, then ships all of them if the invocation failed or
+// logged an error, and otherwise ships them all or none with probability
+// rate. Logs arriving after the decision follow it. Held logs count
+// against the buffer's BUFFER_SIZE and BUFFER_MAX_BYTES together with
+// what is buffered; an invocation that would exceed them, or that holds
+// maxHeldEntries, is decided early, by its errors so far and rate. One
+// dropped early whose runtimeDone then reports a failure ships the rest of
+// its logs.
+type tailSampler struct {
+	rate       float64
+	random     func() float64
+	maxEntries int // 0 for no limit
+	maxBytes   int // 0 for no limit
+
+	mu           sync.Mutex
+	held         map[string][]buffer.LogEntry // by request ID, until runtimeDone
+	heldEntries  int
+	heldBytes    int
+	errored      map[string]bool         // held invocations that logged an error
+	decided      map[string]tailDecision // for late logs
+	sampledOut   uint64                  // function logs dropped with their invocation at runtimeDone
+	droppedEarly uint64                  // function logs dropped with their invocation before runtimeDone
+}
+
+// tailDecision is what became of an invocation's logs
+type tailDecision struct {
+	keep  bool
+	early bool // made before runtimeDone
+}
+
+// invocationOutcome is the status a runtimeDone reported for a request
+type invocationOutcome struct {
+	requestID string
+	status    string
+}
+
+func newTailSampler(rate float64, random func() float64) *tailSampler {
+	return &tailSampler{
+		rate:    rate,
+		random:  random,
+		held:    make(map[string][]buffer.LogEntry),
+		errored: make(map[string]bool),
+		decided: make(map[string]tailDecision),
+	}
+}
+
+// SetTailSampling holds each invocation's function logs until its
+// platform.runtimeDone and keeps only rate of the invocations that
+// succeeded without logging an error. Held logs share the buffer's
+// maxEntries and maxBytes (0 for no limit). Must be called before Start.
+func (s *Server) SetTailSampling(rate float64, maxEntries, maxBytes int) {
+	s.tail = newTailSampler(rate, rand.Float64)
+	s.tail.maxEntries = maxEntries
+	s.tail.maxBytes = maxBytes
+}
+
+// TailSampledOut returns the number of function logs dropped by tail
+// sampling at their invocation's runtimeDone
+func (s *Server) TailSampledOut() uint64 {
+	if s == nil || s.tail == nil {
+		return 0
+	}
+	s.tail.mu.Lock()
+	defer s.tail.mu.Unlock()
+	return s.tail.sampledOut
+}
+
+// TailDroppedEarly returns the number of function logs dropped by tail
+// sampling before their invocation's runtimeDone, because holding them
+// would have exceeded the buffer's limits
+func (s *Server) TailDroppedEarly() uint64 {
+	if s == nil || s.tail == nil {
+		return 0
+	}
+	s.tail.mu.Lock()
+	defer s.tail.mu.Unlock()
+	return s.tail.droppedEarly
+}
+
+// ReleaseHeld buffers the logs of invocations still waiting for their
+// runtimeDone, e.g. before the final flush at shutdown
+func (s *Server) ReleaseHeld() {
+	if s.tail == nil {
+		return
+	}
+	if entries := s.tail.release(); len(entries) > 0 {
+		s.buffer.AddBatch(entries)
+	}
+}
+
+// hold takes the function logs of invocations still running out of entries
+// and returns the rest, dropping logs of invocations already sampled out.
+// buffered and bufferedBytes are what the buffer holds already.
+func (t *tailSampler) hold(entries []buffer.LogEntry, buffered, bufferedBytes int) []buffer.LogEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	kept := make([]buffer.LogEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !isFilterable(&entry) || entry.RequestID == "" {
+			kept = append(kept, entry)
+			continue
+		}
+		if d, ok := t.decided[entry.RequestID]; ok {
+			switch {
+			case d.keep:
+				kept = append(kept, entry)
+			case d.early:
+				t.droppedEarly++
+			default:
+				t.sampledOut++
+			}
+			continue
+		}
+
+		id := entry.RequestID
+		if _, ok := t.held[id]; !ok && len(t.held) >= maxTrackedInvocations {
+			// runtimeDone never came for some invocation; decide one rather than grow
+			for stale := range t.held {
+				kept = append(kept, t.decideEarly(stale)...)
+				break
+			}
+		}
+		t.held[id] = append(t.held[id], entry)
+		t.heldEntries++
+		t.heldBytes += entry.Size()
+		if entry.Priority >= buffer.PriorityHigh {
+			t.errored[id] = true
+		}
+		if len(t.held[id]) >= maxHeldEntries || t.overBudget(buffered, bufferedBytes) {
+			kept = append(kept, t.decideEarly(id)...)
+		}
+	}
+	return kept
+}
+
+// overBudget reports whether held and buffered logs together exceed the
+// buffer's limits. Caller must hold the lock.
+func (t *tailSampler) overBudget(buffered, bufferedBytes int) bool {
+	return (t.maxEntries > 0 && t.heldEntries+buffered > t.maxEntries) ||
+		(t.maxBytes > 0 && t.heldBytes+bufferedBytes > t.maxBytes)
+}
+
+// finish decides requestID's invocation at its runtimeDone and returns the
+// held logs to ship. A failed invocation already dropped early keeps its
+// late logs; those dropped before stay counted as dropped early.
+func (t *tailSampler) finish(requestID, status string) []buffer.LogEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if d, ok := t.decided[requestID]; ok {
+		if !d.keep && IsFailedStatus(status) {
+			t.decided[requestID] = tailDecision{keep: true}
+		}
+		return nil
+	}
+	keep := IsFailedStatus(status) || t.errored[requestID] || t.random() < t.rate
+	return t.decide(requestID, tailDecision{keep: keep})
+}
+
+// release returns every held log, as if each invocation were kept
+func (t *tailSampler) release() []buffer.LogEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var entries []buffer.LogEntry
+	for id := range t.held {
+		entries = append(entries, t.decide(id, tailDecision{keep: true})...)
+	}
+	return entries
+}
+
+// decideEarly decides requestID before its outcome is known, keeping it if
+// it logged an error so far or with probability rate. Caller must hold the
+// lock.
+func (t *tailSampler) decideEarly(requestID string) []buffer.LogEntry {
+	keep := t.errored[requestID] || t.random() < t.rate
+	return t.decide(requestID, tailDecision{keep: keep, early: true})
+}
+
+// decide records d for requestID and returns its held logs if kept.
+// Caller must hold the lock.
+func (t *tailSampler) decide(requestID string, d tailDecision) []buffer.LogEntry {
+	entries := t.held[requestID]
+	delete(t.held, requestID)
+	delete(t.errored, requestID)
+	t.heldEntries -= len(entries)
+	for _, entry := range entries {
+		t.heldBytes -= entry.Size()
+	}
+
+	if len(t.decided) >= maxTrackedInvocations {
+		for id := range t.decided {
+			delete(t.decided, id)
+			break
+		}
+	}
+	t.decided[requestID] = d
+
+	switch {
+	case d.keep:
+		return entries
+	case d.early:
+		t.droppedEarly += uint64(len(entries))
+	default:
+		t.sampledOut += uint64(len(entries))
+	}
+	return nil
+}
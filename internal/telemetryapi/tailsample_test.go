@@ -0,0 +1,135 @@
+package telemetryapi
+
+import (
+	"testing"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+)
+
+// invocationEvents returns the events of one invocation logging lines and
+// ending with status
+func invocationEvents(requestID, status string, lines ...string) []TelemetryEvent {
+	events := []TelemetryEvent{{
+		Type:   EventTypePlatformStart,
+		Time:   "2026-02-05T21:34:18.000Z",
+		Record: map[string]interface{}{"requestId": requestID, "version": "$LATEST"},
+	}}
+	for _, line := range lines {
+		events = append(events, TelemetryEvent{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.500Z", Record: line})
+	}
+	return append(events, TelemetryEvent{
+		Type:   EventTypePlatformRuntimeDone,
+		Time:   "2026-02-05T21:34:19.000Z",
+		Record: map[string]interface{}{"requestId": requestID, "status": status},
+	})
+}
+
+func functionLogs(entries []buffer.LogEntry) []string {
+	var lines []string
+	for _, e := range entries {
+		if e.Type == EventTypeFunction {
+			lines = append(lines, e.Message)
+		}
+	}
+	return lines
+}
+
+func TestTailSampling_DropsSampledOutInvocation(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.tail = newTailSampler(0.1, func() float64 { return 0.5 })
+
+	postEvents(s, invocationEvents("abc-123", "success", "hello", "world"))
+	// A late line follows the invocation's decision
+	postEvents(s, []TelemetryEvent{{
+		Type:   EventTypeFunction,
+		Time:   "2026-02-05T21:34:19.100Z",
+		Record: map[string]interface{}{"requestId": "abc-123", "message": "late", "timestamp": "2026-02-05T21:34:19.100Z"},
+	}})
+
+	entries := s.buffer.Flush(100)
+	if lines := functionLogs(entries); len(lines) != 0 {
+		t.Errorf("function logs %q shipped, want the invocation sampled out", lines)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected START and runtimeDone entries to ship, got %d entries", len(entries))
+	}
+}
+
+func TestTailSampling_KeepsFailuresAndErrors(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.tail = newTailSampler(0, func() float64 { return 0.5 })
+
+	postEvents(s, invocationEvents("abc-123", "timeout", "hello"))
+	postEvents(s, invocationEvents("def-456", "success", "fine", "ERROR: boom"))
+	postEvents(s, invocationEvents("ghi-789", "success", "dropped"))
+
+	lines := functionLogs(s.buffer.Flush(100))
+	if len(lines) != 3 || lines[0] != "hello" || lines[1] != "fine" || lines[2] != "ERROR: boom" {
+		t.Errorf("function logs = %q, want the timed-out and erroring invocations'", lines)
+	}
+}
+
+func TestTailSampling_HoldsUntilRuntimeDone(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.tail = newTailSampler(1, func() float64 { return 0.5 })
+
+	events := invocationEvents("abc-123", "success", "hello")
+	postEvents(s, events[:2])
+	if lines := functionLogs(s.buffer.Flush(100)); len(lines) != 0 {
+		t.Fatalf("function logs %q buffered before runtimeDone", lines)
+	}
+
+	s.ReleaseHeld()
+	if lines := functionLogs(s.buffer.Flush(100)); len(lines) != 1 || lines[0] != "hello" {
+		t.Errorf("ReleaseHeld buffered %q, want [hello]", lines)
+	}
+}
+
+func TestTailSampling_DecidesEarlyOverBufferBudget(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.SetTailSampling(0, 2, 0)
+	s.tail.random = func() float64 { return 0.5 }
+
+	// Three lines exceed the budget of two, so the invocation is sampled
+	// out before its runtimeDone rather than kept regardless
+	postEvents(s, invocationEvents("abc-123", "success", "one", "two", "three"))
+	if lines := functionLogs(s.buffer.Flush(100)); len(lines) != 0 {
+		t.Errorf("function logs %q shipped, want the invocation sampled out early", lines)
+	}
+	if got, sampled := s.TailDroppedEarly(), s.TailSampledOut(); got != 3 || sampled != 0 {
+		t.Errorf("TailDroppedEarly() = %d, TailSampledOut() = %d; want 3 and 0", got, sampled)
+	}
+
+	// One that logged an error before the budget ran out is kept
+	postEvents(s, invocationEvents("def-456", "success", "ERROR: boom", "two", "three"))
+	if lines := functionLogs(s.buffer.Flush(100)); len(lines) != 3 {
+		t.Errorf("function logs = %q, want the erroring invocation's three", lines)
+	}
+	if s.tail.heldEntries != 0 || s.tail.heldBytes != 0 {
+		t.Errorf("held %d entries (%d bytes) after both invocations were decided", s.tail.heldEntries, s.tail.heldBytes)
+	}
+}
+
+func TestTailSampling_KeepsLateLogsOfFailureDroppedEarly(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.SetTailSampling(0, 2, 0)
+	s.tail.random = func() float64 { return 0.5 }
+
+	// Overflowing the hold drops the invocation before its outcome is known
+	events := invocationEvents("abc-123", "failure", "one", "two", "three")
+	runtimeDone := events[len(events)-1]
+	postEvents(s, events[:len(events)-1])
+	if lines := functionLogs(s.buffer.Flush(100)); len(lines) != 0 {
+		t.Fatalf("function logs %q shipped, want the invocation dropped early", lines)
+	}
+
+	// Its failure then keeps what it logs afterwards
+	postEvents(s, []TelemetryEvent{runtimeDone})
+	postEvents(s, []TelemetryEvent{{Type: EventTypeFunction, Time: "2026-02-05T21:34:18.900Z", Record: "late"}})
+	if lines := functionLogs(s.buffer.Flush(100)); len(lines) != 1 || lines[0] != "late" {
+		t.Errorf("function logs = %q, want the late line kept", lines)
+	}
+	if got := s.TailDroppedEarly(); got != 3 {
+		t.Errorf("TailDroppedEarly() = %d, want 3", got)
+	}
+}
@@ -0,0 +1,176 @@
+package telemetryapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+)
+
+// tcpBatchSize bounds how many streamed events are ingested together
+const tcpBatchSize = 1000
+
+// tcpPendingSignals bounds the lifecycle signals a connection queues while
+// an earlier handler is still running
+const tcpPendingSignals = 16
+
+// tcpReceiver accepts Telemetry API connections using the TCP protocol.
+// Lambda streams events as newline-delimited JSON objects, so there is no
+// per-delivery array envelope or HTTP request to parse.
+type tcpReceiver struct {
+	listener net.Listener
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+// startTCP listens on the server port and ingests streamed events.
+// Caller must hold listenMu.
+func (s *Server) startTCP() error {
+	ln, err := s.listen()
+	if err != nil {
+		return err
+	}
+	logger.Debugf("Starting TCP telemetry receiver on port %d", s.port)
+	s.tcp = &tcpReceiver{listener: ln, conns: make(map[net.Conn]struct{})}
+	go s.acceptTCP(s.tcp)
+	return nil
+}
+
+func (s *Server) acceptTCP(t *tcpReceiver) {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			if !t.isClosed() {
+				s.listenerFailed(err)
+			}
+			return
+		}
+		if !t.track(conn) {
+			conn.Close()
+			return
+		}
+		go s.serveTCP(t, conn)
+	}
+}
+
+// serveTCP decodes events from one connection until it is closed
+func (s *Server) serveTCP(t *tcpReceiver, conn net.Conn) {
+	defer t.untrack(conn)
+	defer conn.Close()
+
+	s.readEvents(bufio.NewReader(conn))
+}
+
+// readEvents ingests a newline-delimited JSON event stream until EOF.
+// Events already sitting in the read buffer are ingested as one batch so
+// chatty functions do not pay the pipeline cost per event.
+//
+// Lifecycle handlers run in order on their own goroutine, as the HTTP
+// receiver runs them after acknowledging the delivery: the runtimeDone
+// handler waits for late telemetry, which arrives on this same stream.
+func (s *Server) readEvents(r *bufio.Reader) {
+	signals := make(chan lifecycleSignals, tcpPendingSignals)
+	notified := make(chan struct{})
+	go func() {
+		defer close(notified)
+		for done := range signals {
+			s.signal(done)
+		}
+	}()
+	defer func() {
+		close(signals)
+		<-notified
+	}()
+
+	dec := json.NewDecoder(r)
+	events := make([]TelemetryEvent, 0, 64)
+
+	for {
+		var event TelemetryEvent
+		if err := dec.Decode(&event); err != nil {
+			if len(events) > 0 {
+				s.receive(events, signals)
+			}
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				logger.Debugf("Failed to parse telemetry stream: %v", err)
+			}
+			return
+		}
+		events = append(events, event)
+
+		if len(events) < tcpBatchSize && pendingInput(dec, r) {
+			continue
+		}
+		s.receive(events, signals)
+		events = events[:0]
+	}
+}
+
+// receive ingests streamed events and queues the lifecycle signals they
+// carry, recovering from any panic on the way
+func (s *Server) receive(events []TelemetryEvent, signals chan<- lifecycleSignals) {
+	defer s.recoverDelivery()
+	if done := s.ingest(events); done != (lifecycleSignals{}) {
+		signals <- done
+	}
+}
+
+// pendingInput reports whether another event is already available without
+// blocking on the connection
+func pendingInput(dec *json.Decoder, r *bufio.Reader) bool {
+	if hasContent(dec.Buffered()) {
+		return true
+	}
+	return r.Buffered() > 0
+}
+
+// hasContent reports whether rd holds anything other than whitespace
+func hasContent(rd io.Reader) bool {
+	buf, _ := io.ReadAll(rd)
+	for _, b := range buf {
+		switch b {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tcpReceiver) track(conn net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return false
+	}
+	t.conns[conn] = struct{}{}
+	return true
+}
+
+func (t *tcpReceiver) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
+
+func (t *tcpReceiver) untrack(conn net.Conn) {
+	t.mu.Lock()
+	delete(t.conns, conn)
+	t.mu.Unlock()
+}
+
+// close stops accepting and closes any open connections
+func (t *tcpReceiver) close() error {
+	t.mu.Lock()
+	t.closed = true
+	for conn := range t.conns {
+		conn.Close()
+	}
+	t.mu.Unlock()
+	return t.listener.Close()
+}
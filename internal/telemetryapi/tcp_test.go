@@ -0,0 +1,105 @@
+package telemetryapi
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadEvents_NDJSON(t *testing.T) {
+	var doneID string
+	s := newTestServer(0, true, func(id, status string) { doneID = id })
+
+	stream := `{"time":"2026-02-05T21:34:18.205Z","type":"platform.start","record":{"requestId":"abc-123"}}
+{"time":"2026-02-05T21:34:18.300Z","type":"function","record":"hello"}
+{"time":"2026-02-05T21:34:18.400Z","type":"platform.runtimeDone","record":{"requestId":"abc-123","status":"success"}}
+`
+	s.readEvents(bufio.NewReader(strings.NewReader(stream)))
+
+	if doneID != "abc-123" {
+		t.Errorf("expected runtimeDone for abc-123, got %q", doneID)
+	}
+	entries := s.buffer.Flush(10)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	if entries[1].Message != "hello" || entries[1].RequestID != "abc-123" {
+		t.Errorf("unexpected function entry: %+v", entries[1])
+	}
+}
+
+func TestReadEvents_MalformedStopsStream(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	stream := `{"time":"2026-02-05T21:34:18.300Z","type":"function","record":"kept"}
+not json
+{"time":"2026-02-05T21:34:18.400Z","type":"function","record":"lost"}
+`
+	s.readEvents(bufio.NewReader(strings.NewReader(stream)))
+
+	entries := s.buffer.Flush(10)
+	if len(entries) != 1 || entries[0].Message != "kept" {
+		t.Errorf("expected only the event before the malformed line, got %+v", entries)
+	}
+}
+
+func TestServer_TCPReceiver(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	s.SetProtocol(ProtocolTCP)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	defer s.Shutdown(context.Background())
+
+	if !strings.HasPrefix(s.ListenerURI(), "tcp://") {
+		t.Errorf("expected tcp:// listener URI, got %s", s.ListenerURI())
+	}
+
+	conn, err := net.Dial("tcp", s.tcp.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte(`{"time":"2026-02-05T21:34:18.300Z","type":"function","record":"over tcp"}` + "\n"))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for s.buffer.Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	entries := s.buffer.Flush(10)
+	if len(entries) != 1 || entries[0].Message != "over tcp" {
+		t.Errorf("expected streamed entry, got %+v", entries)
+	}
+}
+
+// A line streamed after runtimeDone is read while the runtimeDone handler
+// waits for late telemetry
+func TestReadEvents_LateLineWhileHandlerWaits(t *testing.T) {
+	var s *Server
+	sawLate := make(chan bool, 1)
+	s = newTestServer(0, true, func(id, status string) {
+		deadline := time.Now().Add(time.Second)
+		for s.buffer.Len() < 3 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		sawLate <- s.buffer.Len() == 3
+	})
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, _ = pw.Write([]byte(`{"time":"2026-02-05T21:34:18.205Z","type":"platform.start","record":{"requestId":"abc-123"}}
+{"time":"2026-02-05T21:34:18.400Z","type":"platform.runtimeDone","record":{"requestId":"abc-123","status":"success"}}
+`))
+		time.Sleep(20 * time.Millisecond)
+		_, _ = pw.Write([]byte(`{"time":"2026-02-05T21:34:18.300Z","type":"function","record":"late"}` + "\n"))
+		pw.Close()
+	}()
+	s.readEvents(bufio.NewReader(pr))
+
+	if !<-sawLate {
+		t.Error("runtimeDone handler did not see the line streamed after runtimeDone")
+	}
+}
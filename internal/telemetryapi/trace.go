@@ -0,0 +1,166 @@
+package telemetryapi
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// traceIDFields are the JSON log fields checked, in order, for a trace ID
+var traceIDFields = []string{"trace_id", "traceId", "traceID", "xray_trace_id"}
+
+// spanIDFields are the JSON log fields checked, in order, for a span ID
+// when trace context extraction is enabled
+var spanIDFields = []string{"span_id", "spanId", "spanID"}
+
+// xrayHeaderPattern finds an X-Amzn-Trace-Id value in a plain-text line,
+// with its Parent and other segments on either side of Root
+var xrayHeaderPattern = regexp.MustCompile(`[\w=;-]*Root=1-[0-9a-fA-F]{8}-[0-9a-fA-F]{24}[\w=;-]*`)
+
+// parseXRayTraceID returns the Root trace ID from an X-Amzn-Trace-Id header
+// value such as "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=...;Sampled=1".
+// Values without a Root= segment are returned unchanged.
+func parseXRayTraceID(value string) string {
+	root, _ := parseXRayHeader(value)
+	return root
+}
+
+// parseXRayHeader returns the Root and Parent segments of an X-Amzn-Trace-Id
+// header value. A value without segments is returned as the root.
+func parseXRayHeader(value string) (root, parent string) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "=") {
+		return value, ""
+	}
+	for _, part := range strings.Split(value, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "Root":
+			root = v
+		case "Parent":
+			parent = v
+		}
+	}
+	return root, parent
+}
+
+// parseTraceparent returns the trace and parent span IDs of a W3C
+// traceparent value, "00-<32 hex trace ID>-<16 hex span ID>-<2 hex flags>"
+func parseTraceparent(value string) (traceID, spanID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		!isHexID(parts[1], 32) || !isHexID(parts[2], 16) {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// isHexID reports whether s is n lowercase hex digits, not all zero as
+// W3C reserves that for invalid IDs
+func isHexID(s string, n int) bool {
+	if len(s) != n || strings.Trim(s, "0") == "" {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// traceContextFromFields returns the trace and span IDs of a JSON log line:
+// a traceparent field first, then the trace ID fields, where an X-Ray
+// header's Parent is taken as the span, and the span ID fields
+func traceContextFromFields(fields map[string]interface{}) (traceID, spanID string) {
+	if v, ok := fields["traceparent"].(string); ok {
+		if traceID, spanID, ok := parseTraceparent(v); ok {
+			return traceID, spanID
+		}
+	}
+	for _, name := range traceIDFields {
+		if v, ok := fields[name].(string); ok && v != "" {
+			traceID, spanID = parseXRayHeader(v)
+			break
+		}
+	}
+	for _, name := range spanIDFields {
+		if v, ok := fields[name].(string); ok && v != "" {
+			spanID = v
+			break
+		}
+	}
+	return traceID, spanID
+}
+
+// traceContextFromText returns the trace and span IDs of an X-Amzn-Trace-Id
+// value logged in a plain-text line
+func traceContextFromText(message string) (traceID, spanID string) {
+	if !strings.Contains(message, "Root=") {
+		return "", ""
+	}
+	return parseXRayHeader(xrayHeaderPattern.FindString(message))
+}
+
+// extractTraceID returns a trace ID from a JSON log body, or "" if the
+// message is not JSON or has no recognised trace field
+func extractTraceID(message string) string {
+	return traceIDFromFields(parseJSONFields(message))
+}
+
+// traceIDFromFields returns a trace ID from already-decoded JSON log fields
+func traceIDFromFields(fields map[string]interface{}) string {
+	for _, name := range traceIDFields {
+		if v, ok := fields[name].(string); ok && v != "" {
+			return parseXRayTraceID(v)
+		}
+	}
+	return ""
+}
+
+// parseJSONFields decodes a JSON object log body, or returns nil if the
+// message is not a JSON object
+func parseJSONFields(message string) map[string]interface{} {
+	if !strings.HasPrefix(message, "{") {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(message), &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// traceContextOf returns the trace and span IDs a function log line was
+// written with. fields are the line's decoded JSON, nil for plain text.
+// Unless EnableTraceContext was called, only the trace ID fields are read.
+func (s *Server) traceContextOf(message string, fields map[string]interface{}) (traceID, spanID string) {
+	if !s.traceContext {
+		return traceIDFromFields(fields), ""
+	}
+	if fields == nil {
+		return traceContextFromText(message)
+	}
+	return traceContextFromFields(fields)
+}
+
+// EnableTraceContext also reads W3C traceparent and span ID fields from
+// JSON lines and X-Amzn-Trace-Id values from plain-text lines, so entries
+// carry span_id as well as trace_id
+func (s *Server) EnableTraceContext() {
+	s.traceContext = true
+}
+
+// tracingValue returns the X-Ray header value from a platform.start record's
+// "tracing" object, or "" if absent
+func tracingValue(record map[string]interface{}) string {
+	tracing, ok := record["tracing"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	value, _ := tracing["value"].(string)
+	return value
+}
@@ -3,13 +3,21 @@ package telemetryapi
 // Event types from Lambda Telemetry API
 const (
 	// Platform events
-	EventTypePlatformStart       = "platform.start"
-	EventTypePlatformEnd         = "platform.end"
-	EventTypePlatformReport      = "platform.report"
-	EventTypePlatformRuntimeDone = "platform.runtimeDone"
-	EventTypePlatformFault       = "platform.fault"
-	EventTypePlatformExtension   = "platform.extension"
-	EventTypePlatformLogsDropped = "platform.logsDropped"
+	EventTypePlatformInitStart       = "platform.initStart"
+	EventTypePlatformInitRuntimeDone = "platform.initRuntimeDone"
+	EventTypePlatformInitReport      = "platform.initReport"
+	EventTypePlatformStart           = "platform.start"
+	EventTypePlatformEnd             = "platform.end"
+	EventTypePlatformReport          = "platform.report"
+	EventTypePlatformRuntimeDone     = "platform.runtimeDone"
+	EventTypePlatformFault           = "platform.fault"
+	EventTypePlatformExtension       = "platform.extension"
+	EventTypePlatformLogsDropped     = "platform.logsDropped"
+
+	// SnapStart restore phase, which replaces INIT for restored snapshots
+	EventTypePlatformRestoreStart       = "platform.restoreStart"
+	EventTypePlatformRestoreRuntimeDone = "platform.restoreRuntimeDone"
+	EventTypePlatformRestoreReport      = "platform.restoreReport"
 
 	// Function logs
 	EventTypeFunction = "function"
@@ -18,6 +26,12 @@ const (
 	EventTypeExtension = "extension"
 )
 
+// Destination protocols supported by the Telemetry API
+const (
+	ProtocolHTTP = "HTTP"
+	ProtocolTCP  = "TCP"
+)
+
 // TelemetryEvent represents a single telemetry event from Lambda
 type TelemetryEvent struct {
 	Time   string      `json:"time"`
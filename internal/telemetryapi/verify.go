@@ -0,0 +1,49 @@
+package telemetryapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// Verification compares the entries pushed for one request with the
+// entries Loki returns for it
+type Verification struct {
+	RequestID string `json:"request_id"`
+	Pushed    int    `json:"pushed"`
+	Found     int    `json:"found"`
+	Missing   int    `json:"missing"`
+}
+
+// VerifyHandler verifies delivery of requestID's entries; an empty
+// requestID means the latest invocation
+type VerifyHandler func(ctx context.Context, requestID string) (Verification, error)
+
+// SetVerifyHandler enables GET /verify
+func (s *Server) SetVerifyHandler(h VerifyHandler) {
+	s.onVerify = h
+}
+
+// handleVerify serves GET /verify[?request_id=...] so a canary or rollout
+// check can ask for proof of delivery on demand. Responds 409 when entries
+// are missing from Loki, and 502 when Loki could not be queried.
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.onVerify == nil {
+		http.Error(w, "Delivery verification is disabled", http.StatusNotFound)
+		return
+	}
+	v, err := s.onVerify(r.Context(), r.URL.Query().Get("request_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if v.Missing > 0 {
+		w.WriteHeader(http.StatusConflict)
+	}
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,54 @@
+package telemetryapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getVerify(s *Server, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestVerify_DisabledByDefault(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	if w := getVerify(s, "/verify"); w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+}
+
+func TestVerify_ReportsResult(t *testing.T) {
+	s := newTestServer(0, true, nil)
+	var asked string
+	missing := 0
+	s.SetVerifyHandler(func(_ context.Context, requestID string) (Verification, error) {
+		asked = requestID
+		return Verification{RequestID: "req-1", Pushed: 4, Found: 4 - missing, Missing: missing}, nil
+	})
+
+	w := getVerify(s, "/verify?request_id=req-1")
+	if w.Code != http.StatusOK || asked != "req-1" {
+		t.Errorf("status = %d, asked %q; want 200 for req-1", w.Code, asked)
+	}
+	var v Verification
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil || v.Pushed != 4 || v.Found != 4 {
+		t.Errorf("verification = %+v, %v", v, err)
+	}
+
+	missing = 1
+	if w := getVerify(s, "/verify"); w.Code != http.StatusConflict || asked != "" {
+		t.Errorf("status = %d, asked %q; want 409 for the latest invocation", w.Code, asked)
+	}
+
+	s.SetVerifyHandler(func(context.Context, string) (Verification, error) {
+		return Verification{}, errors.New("loki unreachable")
+	})
+	if w := getVerify(s, "/verify"); w.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", w.Code)
+	}
+}
@@ -0,0 +1,56 @@
+package telemetryapi
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+)
+
+// plaintextEnvelope is the JSON object a plain-text line is wrapped in.
+// The request ID is added when batching, like any JSON line's.
+type plaintextEnvelope struct {
+	Message string `json:"message"`
+	Level   string `json:"level,omitempty"`
+}
+
+// wrapStage wraps every line that is not already a JSON object in a
+// minimal {"message","level"} envelope, so streams mixing JSON and plain
+// text parse consistently and Grafana can derive detected_level
+func wrapStage() Stage {
+	return func(entry *buffer.LogEntry) bool {
+		if parseJSONFields(entry.Message) != nil {
+			return true
+		}
+		if wrapped, err := json.Marshal(plaintextEnvelope{
+			Message: entry.Message,
+			Level:   plaintextLevel(entry),
+		}); err == nil {
+			entry.Message = string(wrapped)
+		}
+		return true
+	}
+}
+
+// plaintextLevel returns a plain-text line's level: Lambda's "\tLEVEL\t"
+// column or a leading level word such as "ERROR" or "[warn]". Undetected,
+// error-priority lines are "error" and platform lines "info"; otherwise
+// it is "" and the envelope has no level.
+func plaintextLevel(entry *buffer.LogEntry) string {
+	if level := messageLevel(entry.Message); level != "" {
+		return level
+	}
+	if word, _, _ := strings.Cut(strings.TrimSpace(entry.Message), " "); word != "" {
+		word = strings.ToLower(strings.Trim(word, "[]:"))
+		if _, ok := logLevels[word]; ok {
+			return word
+		}
+	}
+	switch {
+	case entry.Priority >= buffer.PriorityHigh:
+		return "error"
+	case strings.HasPrefix(entry.Type, "platform."):
+		return "info"
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package telemetryapi
+
+import (
+	"testing"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+)
+
+func TestWrapStage(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry buffer.LogEntry
+		want  string
+	}{
+		{"lambda level column",
+			buffer.LogEntry{Type: EventTypeFunction, Message: "2026-02-05T08:12:42.944Z\treq-1\tWARN\tslow query"},
+			`{"message":"2026-02-05T08:12:42.944Z\treq-1\tWARN\tslow query","level":"warn"}`},
+		{"leading level word",
+			buffer.LogEntry{Type: EventTypeFunction, Message: "[ERROR]: connection refused"},
+			`{"message":"[ERROR]: connection refused","level":"error"}`},
+		{"high priority without level",
+			buffer.LogEntry{Type: EventTypeFunction, Message: "Traceback (most recent call last):", Priority: buffer.PriorityHigh},
+			`{"message":"Traceback (most recent call last):","level":"error"}`},
+		{"platform line",
+			buffer.LogEntry{Type: EventTypePlatformStart, Message: "START RequestId: req-1 Version: $LATEST"},
+			`{"message":"START RequestId: req-1 Version: $LATEST","level":"info"}`},
+		{"unknown level",
+			buffer.LogEntry{Type: EventTypeFunction, Message: "hello"},
+			`{"message":"hello"}`},
+		{"JSON untouched",
+			buffer.LogEntry{Type: EventTypeFunction, Message: `{"level":"info","message":"hi"}`},
+			`{"level":"info","message":"hi"}`},
+	}
+	stage := wrapStage()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := tt.entry
+			if !stage(&entry) {
+				t.Fatal("wrap stage dropped the entry")
+			}
+			if entry.Message != tt.want {
+				t.Errorf("Message = %s, want %s", entry.Message, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPipeline_WrapPlaintextJSON(t *testing.T) {
+	p, err := NewPipeline(&config.Config{LogSampleRate: 1, WrapPlaintextJSON: true})
+	if err != nil {
+		t.Fatalf("NewPipeline() error = %v", err)
+	}
+	got := p.Process([]buffer.LogEntry{{Type: EventTypeFunction, Message: "bad \xff byte"}})
+	if len(got) != 1 || got[0].Message != `{"message":"bad `+"�"+` byte"}` {
+		t.Errorf("Process() = %+v, want sanitized line wrapped", got)
+	}
+}
@@ -0,0 +1,250 @@
+// Package shipper ships log lines to Loki from inside a Go Lambda function,
+// as an internal extension. Lines skip the Telemetry API hop the external
+// extension depends on: they are buffered in-process and pushed by the same
+// buffer, batching and retrying code, configured by the same environment
+// variables (LOKI_URL, LOKI_LABELS, LOKI_BATCH_SIZE, ...).
+//
+// Lambda freezes the sandbox as soon as the handler returns, so call Flush
+// before returning; lines still buffered then wait for the next invocation.
+package shipper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/buffer"
+	"github.com/mumzworld-tech/lambdawatch/internal/config"
+	"github.com/mumzworld-tech/lambdawatch/internal/logger"
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+	"github.com/mumzworld-tech/lambdawatch/internal/telemetryapi"
+)
+
+// entryType is the type of every entry a Shipper buffers
+const entryType = "function"
+
+// Shipper buffers log lines and pushes them to Loki in the background
+type Shipper struct {
+	cfg      *config.Config
+	buffer   *buffer.Buffer
+	client   *loki.Client
+	labels   map[string]string
+	batcher  *loki.Batcher
+	pipeline *telemetryapi.Pipeline // LOG_FILTER_*, LOG_SAMPLE_RATE and LOG_REDACT_*
+
+	partial  []byte // Write input after the last newline; guarded by writeMu
+	writeMu  sync.Mutex
+	flushMu  sync.Mutex // one flush at a time
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// New reads the configuration from the environment, as the extension does,
+// and starts shipping in the background. Close it when the function exits.
+func New() (*Shipper, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.LokiEndpoint == "" && !cfg.DryRun {
+		return nil, errors.New("shipper: LOKI_URL is not set")
+	}
+	pipeline, err := telemetryapi.NewPipeline(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newShipper(cfg, pipeline), nil
+}
+
+func newShipper(cfg *config.Config, pipeline *telemetryapi.Pipeline) *Shipper {
+	buf := buffer.NewWithPolicy(
+		cfg.BufferSize,
+		buffer.ParseOverflowPolicy(cfg.BufferOverflowPolicy),
+		time.Duration(cfg.BufferBlockTimeoutMs)*time.Millisecond,
+	)
+	buf.SetMaxAge(time.Duration(cfg.MaxEntryAgeMs) * time.Millisecond)
+	buf.SetMaxBytes(cfg.BufferMaxBytes)
+	buf.SetMaxAttempts(cfg.MaxDeliveryAttempts)
+
+	s := &Shipper{
+		cfg:      cfg,
+		buffer:   buf,
+		client:   loki.NewClient(cfg),
+		labels:   functionLabels(cfg),
+		batcher:  loki.NewBatcher(cfg),
+		pipeline: pipeline,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go s.flushLoop()
+	return s
+}
+
+// functionLabels returns the configured labels plus those the extension
+// learns at registration, read here from the runtime's environment
+func functionLabels(cfg *config.Config) map[string]string {
+	labels := make(map[string]string, len(cfg.Labels)+4)
+	for k, v := range cfg.Labels {
+		labels[k] = v
+	}
+	labels["function_name"] = os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	labels["function_version"] = os.Getenv("AWS_LAMBDA_FUNCTION_VERSION")
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		labels["region"] = region
+	}
+	if cfg.OTelResourceLabels {
+		// The extension also labels cloud_account_id, which needs an INVOKE's ARN
+		loki.AddResourceLabels(labels, labels["function_name"], labels["function_version"])
+	}
+	labels["source"] = "lambda"
+	return labels
+}
+
+// Log buffers line, timestamped now
+func (s *Shipper) Log(line string) {
+	s.LogRequest("", line)
+}
+
+// LogRequest buffers line, timestamped now, as logged by the invocation
+// with the given request ID. The line first goes through the filters,
+// sampling and redaction the extension applies to function logs.
+func (s *Shipper) LogRequest(requestID, line string) {
+	entries := s.pipeline.Process([]buffer.LogEntry{{
+		Timestamp: time.Now().UnixMilli(),
+		Message:   line,
+		Type:      entryType,
+		RequestID: requestID,
+	}})
+	// As in the extension, only what the pipeline keeps is split to fit
+	// LOKI_MAX_LINE_SIZE
+	entries = telemetryapi.SplitEntries(entries, s.cfg.MaxLineSize)
+	for _, entry := range entries {
+		s.buffer.Add(entry)
+	}
+}
+
+// Write buffers each newline-terminated line of p, so a Shipper can be
+// handed to log.SetOutput or slog.NewJSONHandler. A trailing partial line
+// waits for the rest of it, unless it has reached LOKI_MAX_LINE_SIZE, in
+// which case it is buffered as it is.
+func (s *Shipper) Write(p []byte) (int, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	data := append(s.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		if line := bytes.TrimSuffix(data[:i], []byte{'\r'}); len(line) > 0 {
+			s.Log(string(line))
+		}
+		data = data[i+1:]
+	}
+	if limit := s.cfg.MaxLineSize; limit > 0 && len(data) >= limit {
+		s.Log(string(data))
+		data = nil
+	}
+	s.partial = append(s.partial[:0], data...)
+	return len(p), nil
+}
+
+// Flush pushes everything buffered with critical retries. It returns the
+// first push error; a batch that failed stays buffered for the next flush
+// unless Loki rejected it.
+func (s *Shipper) Flush(ctx context.Context) error {
+	return s.flush(ctx, s.client.PushCritical)
+}
+
+// Close stops the background loop and flushes what is left, including a
+// partial line passed to Write
+func (s *Shipper) Close(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		<-s.stopped
+	})
+
+	s.writeMu.Lock()
+	if len(s.partial) > 0 {
+		s.Log(string(s.partial))
+		s.partial = nil
+	}
+	s.writeMu.Unlock()
+
+	return s.Flush(ctx)
+}
+
+// flushLoop pushes on LOKI_FLUSH_INTERVAL_MS and whenever a full batch is
+// buffered, by entries or bytes as the extension's flush loop decides,
+// until Close
+func (s *Shipper) flushLoop() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(time.Duration(s.cfg.FlushIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		case <-s.buffer.Ready():
+			if !s.batcher.Full(s.labels, s.buffer, s.cfg.BatchSize) {
+				continue
+			}
+		}
+		if err := s.flush(context.Background(), s.client.Push); err != nil {
+			logger.Warnf("Failed to push logs to Loki: %v", err)
+		}
+	}
+}
+
+// requeue hands a batch whose push did not succeed back to the buffer,
+// counting a delivery attempt unless ctx was cancelled first
+func (s *Shipper) requeue(ctx context.Context, lease *buffer.Lease) {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		s.buffer.Release(lease)
+		return
+	}
+	if undeliverable := s.buffer.Nack(lease); len(undeliverable) > 0 {
+		logger.Warnf("Discarded %d log entries after %d failed pushes", len(undeliverable), s.cfg.MaxDeliveryAttempts)
+	}
+}
+
+// flush pushes batches with push until the buffer is empty, or until a
+// push fails and its batch goes back to the buffer
+func (s *Shipper) flush(ctx context.Context, push func(context.Context, *loki.PushRequest) error) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	var firstErr error
+	for {
+		lease := s.buffer.Take(s.cfg.BatchSize, s.batcher.ByteLimit(s.labels))
+		if lease == nil {
+			return firstErr
+		}
+		lease.Entries = s.batcher.Admit(s.labels, lease.Entries)
+		retry := false
+		for _, req := range s.batcher.PushRequests(s.labels, lease.Entries) {
+			err := push(ctx, req)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if err != nil && !loki.IsRejected(err) {
+				retry = true
+			}
+		}
+		if retry {
+			s.requeue(ctx, lease)
+			return firstErr
+		}
+		s.buffer.Ack(lease)
+		if ctx.Err() != nil {
+			return firstErr
+		}
+	}
+}
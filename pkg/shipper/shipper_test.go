@@ -0,0 +1,153 @@
+package shipper
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mumzworld-tech/lambdawatch/internal/loki"
+)
+
+// mockLoki records the push requests it receives
+func mockLoki(t *testing.T) (*httptest.Server, func() []loki.PushRequest) {
+	var mu sync.Mutex
+	var pushes []loki.PushRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req loki.PushRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("invalid push body: %v", err)
+		}
+		mu.Lock()
+		pushes = append(pushes, req)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []loki.PushRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return pushes
+	}
+}
+
+func newTestShipper(t *testing.T, lokiURL string) *Shipper {
+	t.Setenv("LOKI_URL", lokiURL)
+	t.Setenv("LOKI_COMPRESSION", "none")
+	t.Setenv("LOKI_LABELS", `{"team":"orders"}`)
+	t.Setenv("AWS_LAMBDA_FUNCTION_NAME", "orders-fn")
+	s, err := New()
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	return s
+}
+
+func TestShipper_FlushPushesWrittenLines(t *testing.T) {
+	server, pushes := mockLoki(t)
+	s := newTestShipper(t, server.URL)
+	defer s.Close(context.Background())
+
+	s.LogRequest("req-1", "first")
+	if _, err := s.Write([]byte("second\nthi")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error: %v", err)
+	}
+
+	var lines []string
+	for _, push := range pushes() {
+		for _, stream := range push.Streams {
+			if stream.Stream["function_name"] != "orders-fn" || stream.Stream["team"] != "orders" {
+				t.Errorf("unexpected stream labels %v", stream.Stream)
+			}
+			for _, v := range stream.Values {
+				lines = append(lines, v[1])
+			}
+		}
+	}
+	if len(lines) != 2 || lines[0] != "[request_id=req-1] first" || lines[1] != "second" {
+		t.Errorf("pushed lines = %q, want first (with its request ID) and second; the partial line waits", lines)
+	}
+}
+
+func TestShipper_CloseFlushesPartialLine(t *testing.T) {
+	server, pushes := mockLoki(t)
+	s := newTestShipper(t, server.URL)
+
+	_, _ = s.Write([]byte("no newline"))
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	got := pushes()
+	if len(got) != 1 || got[0].Streams[0].Values[0][1] != "no newline" {
+		t.Errorf("pushes = %+v, want the partial line", got)
+	}
+}
+
+func TestShipper_AppliesPipeline(t *testing.T) {
+	server, pushes := mockLoki(t)
+	t.Setenv("LOG_FILTER_EXCLUDE", "healthcheck")
+	t.Setenv("LOG_REDACT_PATTERNS", `["sk_live_[0-9A-Za-z]+"]`)
+	s := newTestShipper(t, server.URL)
+	defer s.Close(context.Background())
+
+	s.Log("GET /healthcheck 200")
+	s.Log("charging with sk_live_abc123")
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error: %v", err)
+	}
+
+	got := pushes()
+	if len(got) != 1 || len(got[0].Streams[0].Values) != 1 {
+		t.Fatalf("pushes = %+v, want only the line the filter keeps", got)
+	}
+	if line := got[0].Streams[0].Values[0][1]; line != "charging with [REDACTED]" {
+		t.Errorf("pushed line = %q, want the key redacted", line)
+	}
+}
+
+func TestShipper_SplitsLongLines(t *testing.T) {
+	server, pushes := mockLoki(t)
+	t.Setenv("LOKI_MAX_LINE_SIZE", "10")
+	s := newTestShipper(t, server.URL)
+	defer s.Close(context.Background())
+
+	s.Log(strings.Repeat("a", 25))
+	// A partial line is buffered once it reaches the limit
+	_, _ = s.Write([]byte(strings.Repeat("b", 12)))
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error: %v", err)
+	}
+
+	var lines []string
+	for _, push := range pushes() {
+		for _, stream := range push.Streams {
+			for _, v := range stream.Values {
+				lines = append(lines, v[1])
+			}
+		}
+	}
+	if len(lines) != 5 {
+		t.Fatalf("pushed lines = %q, want 3 chunks of the long line and 2 of the partial one", lines)
+	}
+	for _, line := range lines {
+		if len(line) > 10 {
+			t.Errorf("pushed line %q exceeds LOKI_MAX_LINE_SIZE", line)
+		}
+	}
+}
+
+func TestNew_RequiresLokiURL(t *testing.T) {
+	t.Setenv("LOKI_URL", "")
+	t.Setenv("LOKI_DRY_RUN", "false")
+	if _, err := New(); err == nil {
+		t.Error("expected an error without LOKI_URL")
+	}
+}